@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// client calls the management API with an API token
+type client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+func newClient(server, token string) *client {
+	return &client{
+		baseURL: strings.TrimSuffix(server, "/") + "/api",
+		token:   token,
+		http:    &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// apiError is an error response of the API. Problems lists every problem
+// of an invalid manifest.
+type apiError struct {
+	Status   int
+	Message  string
+	Problems []string
+}
+
+func (e *apiError) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = http.StatusText(e.Status)
+	}
+	if e.Status == http.StatusUnauthorized {
+		msg += " (set -token or CADDYCTL_TOKEN)"
+	}
+	if len(e.Problems) > 1 {
+		msg += "\n  " + strings.Join(e.Problems, "\n  ")
+	}
+	return msg
+}
+
+// send makes a request with a raw body and returns the response body.
+// Responses with an error status are returned as *apiError.
+func (c *client) send(method, path string, body []byte, contentType string) ([]byte, error) {
+	req, err := http.NewRequest(method, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		apiErr := &apiError{Status: resp.StatusCode}
+		var body struct {
+			Error    string   `json:"error"`
+			Problems []string `json:"problems"`
+		}
+		if json.Unmarshal(data, &body) == nil {
+			apiErr.Message, apiErr.Problems = body.Error, body.Problems
+		}
+		return data, apiErr
+	}
+	return data, nil
+}
+
+// call sends in as JSON, if it isn't nil, and returns the JSON response
+func (c *client) call(method, path string, in any) ([]byte, error) {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return nil, err
+		}
+	}
+	return c.send(method, path, body, "application/json")
+}
+
+// get fetches path and decodes the JSON response into out
+func (c *client) get(path string, out any) ([]byte, error) {
+	data, err := c.send(http.MethodGet, path, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return nil, fmt.Errorf("unexpected response from %s: %w", path, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+func runSync(c *cli, args []string) error {
+	fs := c.flags("sync")
+	force := fs.Bool("force", false, "overwrite changes made directly in Caddy")
+	if _, err := c.parse(fs, args, 0, "[-force]"); err != nil {
+		return err
+	}
+
+	path := "/sync"
+	if *force {
+		path += "?force=true"
+	}
+	var resp struct {
+		Results []struct {
+			Instance   string `json:"instance"`
+			Mode       string `json:"mode"`
+			Error      string `json:"error"`
+			RolledBack bool   `json:"rolled_back"`
+			Skipped    bool   `json:"skipped"`
+		} `json:"results"`
+	}
+	data, err := c.api().call(http.MethodPost, path, nil)
+	// A failed fleet sync still has a result per instance worth showing
+	json.Unmarshal(data, &resp)
+	var apiErr *apiError
+	if errors.As(err, &apiErr) && apiErr.Status == http.StatusConflict && !*force {
+		apiErr.Message += " (use -force to overwrite)"
+	}
+	if err != nil && len(resp.Results) == 0 {
+		return err
+	}
+
+	printErr := c.printResponse(data, func() error {
+		if err == nil {
+			fmt.Fprintln(c.stdout, "Synced to Caddy")
+		}
+		if len(resp.Results) == 0 {
+			return nil
+		}
+		rows := make([][]string, 0, len(resp.Results))
+		for _, r := range resp.Results {
+			result := "ok"
+			switch {
+			case r.Skipped:
+				result = "skipped"
+			case r.RolledBack:
+				result = "rolled back: " + r.Error
+			case r.Error != "":
+				result = r.Error
+			}
+			rows = append(rows, []string{r.Instance, orDash(r.Mode), result})
+		}
+		return c.table([]string{"INSTANCE", "MODE", "RESULT"}, rows)
+	})
+	if err != nil {
+		return err
+	}
+	return printErr
+}
+
+func runStatus(c *cli, args []string) error {
+	fs := c.flags("status")
+	if _, err := c.parse(fs, args, 0, ""); err != nil {
+		return err
+	}
+
+	var resp struct {
+		Status        string `json:"status"`
+		Error         string `json:"error"`
+		AdminURL      string `json:"admin_url"`
+		Latency       int64  `json:"latency"`
+		RouteCount    int    `json:"route_count"`
+		LastSyncedAt  string `json:"last_synced_at"`
+		LastSyncError string `json:"last_sync_error"`
+		LastSyncMode  string `json:"last_sync_mode"`
+		Drift         *struct {
+			Drifted     bool   `json:"drifted"`
+			ChangeCount int    `json:"change_count"`
+			Error       string `json:"error"`
+		} `json:"drift"`
+		Instances []struct {
+			Name          string `json:"name"`
+			AdminURL      string `json:"admin_url"`
+			Status        string `json:"status"`
+			Error         string `json:"error"`
+			Latency       int64  `json:"latency"`
+			RouteCount    int    `json:"route_count"`
+			LastSyncedAt  string `json:"last_synced_at"`
+			LastSyncError string `json:"last_sync_error"`
+		} `json:"instances"`
+	}
+	data, err := c.api().get("/status", &resp)
+	if err != nil {
+		return err
+	}
+
+	return c.printResponse(data, func() error {
+		drift := ""
+		if d := resp.Drift; d != nil {
+			switch {
+			case d.Error != "":
+				drift = "unknown: " + d.Error
+			case d.Drifted:
+				drift = fmt.Sprintf("%d changes made directly in Caddy", d.ChangeCount)
+			default:
+				drift = "none"
+			}
+		}
+
+		if resp.Instances != nil {
+			if err := c.fields("Status", resp.Status, "Routes", strconv.Itoa(resp.RouteCount), "Drift", drift); err != nil {
+				return err
+			}
+			fmt.Fprintln(c.stdout)
+			rows := make([][]string, 0, len(resp.Instances))
+			for _, in := range resp.Instances {
+				status := in.Status
+				if in.Error != "" {
+					status += ": " + in.Error
+				}
+				rows = append(rows, []string{in.Name, in.AdminURL, status, fmt.Sprintf("%dms", in.Latency),
+					strconv.Itoa(in.RouteCount), orDash(in.LastSyncedAt), orDash(in.LastSyncError)})
+			}
+			return c.table([]string{"INSTANCE", "ADMIN URL", "STATUS", "LATENCY", "ROUTES", "LAST SYNC", "SYNC ERROR"}, rows)
+		}
+
+		status := resp.Status
+		if resp.Error != "" {
+			status += ": " + resp.Error
+		}
+		routes := ""
+		if resp.Status == "online" {
+			routes = strconv.Itoa(resp.RouteCount)
+		}
+		return c.fields(
+			"Status", status,
+			"Admin URL", resp.AdminURL,
+			"Latency", fmt.Sprintf("%dms", resp.Latency),
+			"Routes", routes,
+			"Last sync", strings.TrimSpace(resp.LastSyncedAt+" "+resp.LastSyncMode),
+			"Sync error", resp.LastSyncError,
+			"Drift", drift,
+		)
+	})
+}
+
+func runImport(c *cli, args []string) error {
+	fs := c.flags("import")
+	preview := fs.Bool("preview", false, "show what the import would change without importing")
+	mode := fs.String("mode", "replace", "replace or merge")
+	keepLocal := fs.Bool("keep-local", true, "in merge mode, keep local routes missing from the source")
+	instance := fs.String("instance", "", "managed instance to import from")
+	caddyfile := fs.String("caddyfile", "", "import this Caddyfile, - for stdin, instead of Caddy's config")
+	if _, err := c.parse(fs, args, 0, "[-preview] [-mode replace|merge] [-keep-local=false] [-instance name] [-caddyfile file]"); err != nil {
+		return err
+	}
+
+	query := url.Values{"mode": {*mode}, "keep_local": {strconv.FormatBool(*keepLocal)}}
+	if *instance != "" {
+		query.Set("instance", *instance)
+	}
+	path := "/import"
+	if *preview {
+		path = "/import-preview"
+	}
+
+	var body []byte
+	contentType := "application/json"
+	if *caddyfile != "" {
+		if *instance != "" {
+			fmt.Fprintln(c.stderr, "caddyctl: -instance can't be used with -caddyfile")
+			return errUsage
+		}
+		var err error
+		if body, err = c.readInput(*caddyfile); err != nil {
+			return err
+		}
+		path += "/caddyfile"
+		contentType = "text/caddyfile"
+	}
+
+	data, err := c.api().send(http.MethodPost, path+"?"+query.Encode(), body, contentType)
+	var resp struct {
+		Count  int            `json:"count"`
+		Plan   map[string]int `json:"plan"`
+		Result *struct {
+			Created int `json:"created"`
+			Updated int `json:"updated"`
+			Skipped int `json:"skipped"`
+			Deleted int `json:"deleted"`
+			Failed  int `json:"failed"`
+		} `json:"result"`
+		Unsupported []struct {
+			Line    int    `json:"line"`
+			Message string `json:"message"`
+		} `json:"unsupported"`
+		Message string `json:"message"`
+		Warning string `json:"warning"`
+	}
+	json.Unmarshal(data, &resp)
+	// Lines the Caddyfile parser skipped explain an empty import
+	for _, u := range resp.Unsupported {
+		c.warn(fmt.Sprintf("line %d: %s", u.Line, u.Message))
+	}
+	if err != nil {
+		return err
+	}
+	c.warn(resp.Warning)
+
+	return c.printResponse(data, func() error {
+		if *preview {
+			p := resp.Plan
+			_, err := fmt.Fprintf(c.stdout, "Found %d routes. Import would create %d, update %d, delete %d, keep %d and leave %d unchanged.\n",
+				resp.Count, p["create"], p["update"], p["delete"], p["keep"], p["unchanged"])
+			return err
+		}
+		fmt.Fprintln(c.stdout, resp.Message)
+		if r := resp.Result; r != nil {
+			return c.fields(
+				"Created", strconv.Itoa(r.Created),
+				"Updated", strconv.Itoa(r.Updated),
+				"Unchanged", strconv.Itoa(r.Skipped),
+				"Deleted", strconv.Itoa(r.Deleted),
+				"Failed", strconv.Itoa(r.Failed),
+			)
+		}
+		return nil
+	})
+}
+
+func runExport(c *cli, args []string) error {
+	fs := c.flags("export")
+	format := fs.String("format", "yaml", "yaml or json for a manifest, or caddyfile")
+	instance := fs.String("instance", "", "only routes deployed to this instance (caddyfile only)")
+	if _, err := c.parse(fs, args, 0, "[-format yaml|json|caddyfile] [-instance name]"); err != nil {
+		return err
+	}
+
+	var path string
+	switch *format {
+	case "yaml", "json":
+		if *instance != "" {
+			fmt.Fprintln(c.stderr, "caddyctl: -instance only applies to -format caddyfile")
+			return errUsage
+		}
+		path = "/export/manifest?format=" + *format
+	case "caddyfile":
+		path = "/export/caddyfile"
+		if *instance != "" {
+			path += "?instance=" + url.QueryEscape(*instance)
+		}
+	default:
+		fmt.Fprintln(c.stderr, "caddyctl: -format must be yaml, json or caddyfile")
+		return errUsage
+	}
+
+	data, err := c.api().send(http.MethodGet, path, nil, "")
+	if err != nil {
+		return err
+	}
+	_, err = c.stdout.Write(data)
+	return err
+}
+
+// manifestPlanEntry is a single change in the plan of a manifest
+type manifestPlanEntry struct {
+	Action  string   `json:"action"`
+	RouteID string   `json:"route_id"`
+	Domain  string   `json:"domain"`
+	Path    string   `json:"path"`
+	Name    string   `json:"name"`
+	Fields  []string `json:"fields"`
+}
+
+func runApply(c *cli, args []string) error {
+	fs := c.flags("apply")
+	file := fs.String("f", "", "manifest file in YAML or JSON, - for stdin")
+	confirm := fs.Bool("confirm", false, "apply the plan instead of only showing it")
+	if _, err := c.parse(fs, args, 0, "-f manifest.yaml [-confirm]"); err != nil {
+		return err
+	}
+	if *file == "" {
+		fmt.Fprintln(c.stderr, "Usage: caddyctl apply -f manifest.yaml [-confirm]")
+		return errUsage
+	}
+
+	body, err := c.readInput(*file)
+	if err != nil {
+		return err
+	}
+	contentType := "application/yaml"
+	if strings.EqualFold(filepath.Ext(*file), ".json") {
+		contentType = "application/json"
+	}
+	path := "/apply"
+	if *confirm {
+		path += "?confirm=true"
+	}
+
+	data, err := c.api().send(http.MethodPost, path, body, contentType)
+	if err != nil {
+		return err
+	}
+	var resp struct {
+		Plan struct {
+			Routes  []manifestPlanEntry `json:"routes"`
+			Servers []manifestPlanEntry `json:"servers"`
+			Global  string              `json:"global"`
+		} `json:"plan"`
+		Summary map[string]int `json:"summary"`
+		Applied bool           `json:"applied"`
+		Message string         `json:"message"`
+		Warning string         `json:"warning"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return err
+	}
+	c.warn(resp.Warning)
+
+	return c.printResponse(data, func() error {
+		var rows [][]string
+		add := func(kind string, entries []manifestPlanEntry) {
+			for _, e := range entries {
+				if e.Action == "unchanged" {
+					continue
+				}
+				name := e.Name
+				if kind == "route" {
+					name = e.Domain + e.Path
+				}
+				rows = append(rows, []string{e.Action, kind, name, orDash(strings.Join(e.Fields, ", "))})
+			}
+		}
+		add("route", resp.Plan.Routes)
+		add("server", resp.Plan.Servers)
+		if resp.Plan.Global != "" && resp.Plan.Global != "unchanged" {
+			rows = append(rows, []string{resp.Plan.Global, "global", "-", "-"})
+		}
+		if len(rows) > 0 {
+			if err := c.table([]string{"ACTION", "KIND", "NAME", "FIELDS"}, rows); err != nil {
+				return err
+			}
+			fmt.Fprintln(c.stdout)
+		}
+
+		s := resp.Summary
+		fmt.Fprintf(c.stdout, "Plan: %d to create, %d to update, %d to delete, %d unchanged.\n",
+			s["create"], s["update"], s["delete"], s["unchanged"])
+		switch {
+		case resp.Message != "":
+			fmt.Fprintln(c.stdout, resp.Message)
+		case !resp.Applied && len(rows) > 0:
+			fmt.Fprintln(c.stdout, "Run again with -confirm to apply.")
+		}
+		return nil
+	})
+}
@@ -0,0 +1,208 @@
+// Command caddyctl is a command-line client for the management API of
+// Caddy Admin UI.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+const usage = `Usage: caddyctl [flags] <command> [arguments]
+
+Commands:
+  routes list                  List routes
+  routes get <id>              Show a route
+  routes create [flags]        Create a route from flags or -f route.json
+  routes update <id> [flags]   Change a route
+  routes delete <id>           Delete a route
+  routes toggle <id>           Enable or disable a route
+  sync [-force]                Sync all routes to Caddy
+  status                       Show the connection status of Caddy
+  import [flags]               Import routes from Caddy or a Caddyfile
+  export [-format f]           Export a manifest (yaml, json) or a Caddyfile
+  apply -f manifest.yaml       Plan a manifest; -confirm applies it
+
+Flags, also accepted after the command:
+  -server URL       Management server (CADDYCTL_SERVER, default http://localhost:3000)
+  -token TOKEN      API token (CADDYCTL_TOKEN)
+  -o table|json     Output format (default table)
+
+Run "caddyctl <command> -h" for the flags of a command.
+`
+
+// errUsage is returned for invalid command lines, after the problem has
+// been printed
+var errUsage = errors.New("usage")
+
+// cli is one run of caddyctl: its global options and streams
+type cli struct {
+	server string
+	token  string
+	output string
+
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// command runs a command with the arguments after its name
+type command func(c *cli, args []string) error
+
+var commands = map[string]command{
+	"routes": runRoutes,
+	"sync":   runSync,
+	"status": runStatus,
+	"import": runImport,
+	"export": runExport,
+	"apply":  runApply,
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run runs caddyctl and returns its exit code: 0 on success, 1 if the
+// command failed and 2 for usage errors
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	c := &cli{
+		server: envOr("CADDYCTL_SERVER", "http://localhost:3000"),
+		token:  os.Getenv("CADDYCTL_TOKEN"),
+		output: "table",
+		stdin:  stdin,
+		stdout: stdout,
+		stderr: stderr,
+	}
+
+	fs := c.flags("caddyctl")
+	fs.Usage = func() { fmt.Fprint(stderr, usage) }
+	if err := parseFlags(fs, args); err != nil {
+		return exitCode(err)
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	name := fs.Arg(0)
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(stderr, "caddyctl: unknown command %q\n\n%s", name, usage)
+		return 2
+	}
+	if err := cmd(c, fs.Args()[1:]); err != nil {
+		if code := exitCode(err); code != 1 {
+			return code
+		}
+		fmt.Fprintf(stderr, "caddyctl: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// exitCode maps an error to the exit code of the run
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, errUsage):
+		return 2
+	}
+	return 1
+}
+
+// parseFlags parses flags, turning errors the flag set has already
+// printed into errUsage
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	err := fs.Parse(args)
+	if err != nil && !errors.Is(err, flag.ErrHelp) {
+		return errUsage
+	}
+	return err
+}
+
+// flags returns a flag set for a command that also takes the global flags
+func (c *cli) flags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.StringVar(&c.server, "server", c.server, "management server URL")
+	fs.StringVar(&c.token, "token", c.token, "API token")
+	fs.StringVar(&c.output, "o", c.output, "output format: table or json")
+	return fs
+}
+
+// parse parses a command's flags, requiring exactly nargs arguments. The
+// global flags may follow the arguments.
+func (c *cli) parse(fs *flag.FlagSet, args []string, nargs int, argsUsage string) ([]string, error) {
+	var positional []string
+	for {
+		if err := parseFlags(fs, args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(positional) != nargs {
+		fmt.Fprintf(c.stderr, "Usage: caddyctl %s %s\n", fs.Name(), argsUsage)
+		return nil, errUsage
+	}
+	if c.output != "table" && c.output != "json" {
+		fmt.Fprintln(c.stderr, "caddyctl: -o must be table or json")
+		return nil, errUsage
+	}
+	return positional, nil
+}
+
+// subcommand dispatches to one of subs by the first argument
+func (c *cli) subcommand(name string, subs map[string]command, args []string) error {
+	var names []string
+	for n := range subs {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	if len(args) == 0 {
+		fmt.Fprintf(c.stderr, "Usage: caddyctl %s <%s>\n", name, strings.Join(names, "|"))
+		return errUsage
+	}
+	sub, ok := subs[args[0]]
+	if !ok {
+		fmt.Fprintf(c.stderr, "caddyctl: unknown command %q, use one of: %s\n", name+" "+args[0], strings.Join(names, ", "))
+		return errUsage
+	}
+	return sub(c, args[1:])
+}
+
+// api returns a client for the configured server
+func (c *cli) api() *client {
+	return newClient(c.server, c.token)
+}
+
+// warn prints a warning from a response, if any
+func (c *cli) warn(warning string) {
+	if warning != "" {
+		fmt.Fprintf(c.stderr, "warning: %s\n", warning)
+	}
+}
+
+// readInput reads a file named on the command line, "-" being stdin
+func (c *cli) readInput(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(c.stdin)
+	}
+	return os.ReadFile(path)
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ArtemStepanov/caddy-admin-ui/internal/api"
+	"github.com/ArtemStepanov/caddy-admin-ui/internal/storage"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// setupTestServer serves the management API from in-memory storage. Syncs
+// go to a Caddy that isn't running, so changes come back with a warning.
+func setupTestServer(t *testing.T) (string, storage.Store) {
+	t.Helper()
+	t.Setenv("CADDYCTL_SERVER", "")
+	t.Setenv("CADDYCTL_TOKEN", "")
+
+	store, err := storage.NewJSONStorage("")
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	router := gin.New()
+	api.SetupRoutes(router, store, "http://localhost:29999", nil)
+	srv := httptest.NewServer(router)
+	t.Cleanup(func() {
+		srv.Close()
+		store.Close()
+	})
+	return srv.URL, store
+}
+
+// runCLI runs caddyctl against server and returns its output and exit code
+func runCLI(server string, args ...string) (string, string, int) {
+	var stdout, stderr bytes.Buffer
+	code := run(append([]string{"-server", server}, args...), strings.NewReader(""), &stdout, &stderr)
+	return stdout.String(), stderr.String(), code
+}
+
+func TestRoutes(t *testing.T) {
+	server, store := setupTestServer(t)
+
+	out, errOut, code := runCLI(server, "routes", "create", "-domain", "app.example.com", "-upstream", "app:8080", "-o", "json")
+	if code != 0 {
+		t.Fatalf("Expected create to succeed, got %d: %s", code, errOut)
+	}
+	var created routeResponse
+	if err := json.Unmarshal([]byte(out), &created); err != nil || created.Route.HandlerType != "reverse_proxy" {
+		t.Fatalf("Expected a reverse_proxy route, got %v: %s", err, out)
+	}
+	if !strings.Contains(errOut, "warning:") {
+		t.Errorf("Expected the failed sync as a warning, got %q", errOut)
+	}
+	id := created.Route.ID
+
+	out, _, code = runCLI(server, "routes", "list")
+	if code != 0 || !strings.Contains(out, "app.example.com") || !strings.Contains(out, "app:8080") {
+		t.Errorf("Expected the route in the list, got %d:\n%s", code, out)
+	}
+
+	// Flags given after the id only change what they name
+	if _, errOut, code := runCLI(server, "routes", "update", id, "-upstream", "app:9090", "-path", "/api/*"); code != 0 {
+		t.Fatalf("Expected update to succeed, got %d: %s", code, errOut)
+	}
+	r, _ := store.GetRoute(id)
+	if r.Domain != "app.example.com" || r.Path != "/api/*" || string(r.Config) != `{"upstreams":["app:9090"]}` {
+		t.Errorf("Unexpected route after update: %+v %s", r, r.Config)
+	}
+
+	out, _, code = runCLI(server, "routes", "toggle", id)
+	if code != 0 || !strings.Contains(out, "disabled") {
+		t.Errorf("Expected the route to be disabled, got %d: %s", code, out)
+	}
+
+	out, _, code = runCLI(server, "routes", "get", id)
+	if code != 0 || !strings.Contains(out, "Enabled:") || !strings.Contains(out, "no") {
+		t.Errorf("Expected the route details, got %d:\n%s", code, out)
+	}
+
+	if _, _, code := runCLI(server, "routes", "delete", id); code != 0 {
+		t.Errorf("Expected delete to succeed, got %d", code)
+	}
+	if _, errOut, code := runCLI(server, "routes", "get", id); code != 1 || !strings.Contains(errOut, "not found") {
+		t.Errorf("Expected the deleted route not to be found, got %d: %s", code, errOut)
+	}
+}
+
+func TestAuthToken(t *testing.T) {
+	server, store := setupTestServer(t)
+	admin := &storage.User{Username: "admin", Role: storage.RoleAdmin}
+	admin.SetPassword("correct-horse")
+	store.CreateUser(admin)
+	store.CreateAPIToken(&storage.APIToken{Name: "ci", Username: "admin", TokenHash: storage.HashToken("s3cret")})
+
+	if _, errOut, code := runCLI(server, "routes", "list"); code != 1 || !strings.Contains(errOut, "CADDYCTL_TOKEN") {
+		t.Errorf("Expected an authentication error, got %d: %s", code, errOut)
+	}
+
+	t.Setenv("CADDYCTL_TOKEN", "s3cret")
+	if _, errOut, code := runCLI(server, "routes", "list"); code != 0 {
+		t.Errorf("Expected the token to be accepted, got %d: %s", code, errOut)
+	}
+}
+
+func TestApply(t *testing.T) {
+	server, store := setupTestServer(t)
+	manifest := filepath.Join(t.TempDir(), "manifest.yaml")
+	os.WriteFile(manifest, []byte(`version: 1
+routes:
+  - domain: docs.example.com
+    handler_type: file_server
+    config:
+      root: /srv/docs
+`), 0o644)
+
+	out, _, code := runCLI(server, "apply", "-f", manifest)
+	if code != 0 || !strings.Contains(out, "1 to create") || !strings.Contains(out, "-confirm") {
+		t.Errorf("Expected a plan creating the route, got %d:\n%s", code, out)
+	}
+	if routes, _ := store.ListRoutes(); len(routes) != 0 {
+		t.Fatalf("Expected the plan not to write, got %d routes", len(routes))
+	}
+
+	out, _, code = runCLI(server, "apply", "-f", manifest, "-confirm")
+	if code != 0 || !strings.Contains(out, "Manifest applied") {
+		t.Errorf("Expected the manifest to be applied, got %d:\n%s", code, out)
+	}
+	if routes, _ := store.ListRoutes(); len(routes) != 1 {
+		t.Errorf("Expected 1 route, got %d", len(routes))
+	}
+
+	// The export can be applied back without changes
+	out, _, code = runCLI(server, "export", "-format", "json")
+	if code != 0 || !strings.Contains(out, "docs.example.com") {
+		t.Fatalf("Expected a JSON manifest, got %d:\n%s", code, out)
+	}
+	exported := filepath.Join(t.TempDir(), "manifest.json")
+	os.WriteFile(exported, []byte(out), 0o644)
+	if out, _, _ = runCLI(server, "apply", "-f", exported); !strings.Contains(out, "0 to create, 0 to update, 0 to delete") {
+		t.Errorf("Expected the export to plan no changes, got:\n%s", out)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	server, _ := setupTestServer(t)
+
+	for _, args := range [][]string{
+		{},
+		{"frobnicate"},
+		{"routes"},
+		{"routes", "get"},
+		{"routes", "list", "-o", "xml"},
+		{"apply"},
+		{"export", "-format", "toml"},
+	} {
+		if _, _, code := runCLI(server, args...); code != 2 {
+			t.Errorf("Expected exit code 2 for %q, got %d", args, code)
+		}
+	}
+	if _, _, code := runCLI(server, "routes", "list", "-h"); code != 0 {
+		t.Errorf("Expected -h to exit 0, got %d", code)
+	}
+}
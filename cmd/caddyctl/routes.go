@@ -0,0 +1,369 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// route is the part of an API route that caddyctl shows
+type route struct {
+	ID              string          `json:"id"`
+	Domain          string          `json:"domain"`
+	Path            string          `json:"path"`
+	HandlerType     string          `json:"handler_type"`
+	Config          json.RawMessage `json:"config"`
+	StripPathPrefix string          `json:"strip_path_prefix"`
+	Server          string          `json:"server"`
+	Instances       []string        `json:"instances"`
+	Enabled         bool            `json:"enabled"`
+	Version         int64           `json:"version"`
+}
+
+// target summarizes where a route sends requests
+func (r *route) target() string {
+	var cfg struct {
+		Upstreams []string `json:"upstreams"`
+		Root      string   `json:"root"`
+		To        string   `json:"to"`
+		Code      int      `json:"code"`
+	}
+	json.Unmarshal(r.Config, &cfg)
+
+	switch r.HandlerType {
+	case "reverse_proxy":
+		return strings.Join(cfg.Upstreams, ", ")
+	case "file_server":
+		return cfg.Root
+	case "redir":
+		if cfg.Code != 0 {
+			return fmt.Sprintf("%s (%d)", cfg.To, cfg.Code)
+		}
+		return cfg.To
+	}
+	return ""
+}
+
+func runRoutes(c *cli, args []string) error {
+	return c.subcommand("routes", map[string]command{
+		"list":   routesList,
+		"get":    routesGet,
+		"create": routesCreate,
+		"update": routesUpdate,
+		"delete": routesDelete,
+		"toggle": routesToggle,
+	}, args)
+}
+
+func routesList(c *cli, args []string) error {
+	fs := c.flags("routes list")
+	domain := fs.String("domain", "", "only list routes whose domain contains this")
+	if _, err := c.parse(fs, args, 0, "[-domain text]"); err != nil {
+		return err
+	}
+
+	var resp struct {
+		Routes []*route `json:"routes"`
+	}
+	data, err := c.api().get("/routes", &resp)
+	if err != nil {
+		return err
+	}
+	if *domain != "" {
+		filtered := resp.Routes[:0]
+		for _, r := range resp.Routes {
+			if strings.Contains(r.Domain, *domain) {
+				filtered = append(filtered, r)
+			}
+		}
+		resp.Routes = filtered
+		if data, err = json.Marshal(map[string]any{"routes": resp.Routes}); err != nil {
+			return err
+		}
+	}
+
+	return c.printResponse(data, func() error {
+		rows := make([][]string, 0, len(resp.Routes))
+		for _, r := range resp.Routes {
+			rows = append(rows, []string{r.ID, r.Domain, orDash(r.Path), r.HandlerType, orDash(r.target()), yesNo(r.Enabled)})
+		}
+		return c.table([]string{"ID", "DOMAIN", "PATH", "HANDLER", "TARGET", "ENABLED"}, rows)
+	})
+}
+
+func routesGet(c *cli, args []string) error {
+	fs := c.flags("routes get")
+	pos, err := c.parse(fs, args, 1, "<id>")
+	if err != nil {
+		return err
+	}
+
+	var resp struct {
+		Route *route `json:"route"`
+	}
+	data, err := c.api().get("/routes/"+url.PathEscape(pos[0]), &resp)
+	if err != nil {
+		return err
+	}
+	return c.printResponse(data, func() error { return c.printRoute(resp.Route) })
+}
+
+// printRoute prints a route's details
+func (c *cli) printRoute(r *route) error {
+	return c.fields(
+		"ID", r.ID,
+		"Domain", r.Domain,
+		"Path", r.Path,
+		"Handler", r.HandlerType,
+		"Target", r.target(),
+		"Strip prefix", r.StripPathPrefix,
+		"Server", r.Server,
+		"Instances", strings.Join(r.Instances, ", "),
+		"Enabled", yesNo(r.Enabled),
+		"Version", strconv.FormatInt(r.Version, 10),
+	)
+}
+
+// routeFlags are the flags that set route fields in create and update
+type routeFlags struct {
+	file        string
+	domain      string
+	path        string
+	handler     string
+	upstreams   stringList
+	root        string
+	browse      bool
+	to          string
+	code        int
+	stripPrefix string
+}
+
+// stringList is a flag that can be repeated or given a comma-separated list
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(v string) error {
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			*l = append(*l, s)
+		}
+	}
+	return nil
+}
+
+func (f *routeFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.file, "f", "", "read the route as JSON from a file, - for stdin")
+	fs.StringVar(&f.domain, "domain", "", "domain, or several separated by commas")
+	fs.StringVar(&f.path, "path", "", "path matcher, like /api/*")
+	fs.StringVar(&f.handler, "handler", "", "handler type: reverse_proxy, file_server or redir (default from the other flags)")
+	fs.Var(&f.upstreams, "upstream", "reverse_proxy upstream, can be repeated")
+	fs.StringVar(&f.root, "root", "", "file_server root directory")
+	fs.BoolVar(&f.browse, "browse", false, "file_server directory listings")
+	fs.StringVar(&f.to, "to", "", "redir target")
+	fs.IntVar(&f.code, "code", 0, "redir status code")
+	fs.StringVar(&f.stripPrefix, "strip-prefix", "", "path prefix to strip before handling")
+}
+
+// apply sets the fields given on the command line in a route's JSON
+// object. Handler config keys are merged into the existing config unless
+// the handler type changes.
+func (f *routeFlags) apply(fs *flag.FlagSet, obj map[string]json.RawMessage) error {
+	set := make(map[string]bool)
+	fs.Visit(func(fl *flag.Flag) { set[fl.Name] = true })
+
+	put := func(key string, v any) {
+		data, _ := json.Marshal(v)
+		obj[key] = data
+	}
+	if set["domain"] {
+		put("domain", f.domain)
+	}
+	if set["path"] {
+		put("path", f.path)
+	}
+	if set["strip-prefix"] {
+		put("strip_path_prefix", f.stripPrefix)
+	}
+
+	handler := f.handler
+	switch {
+	case handler != "":
+	case set["upstream"]:
+		handler = "reverse_proxy"
+	case set["root"] || set["browse"]:
+		handler = "file_server"
+	case set["to"] || set["code"]:
+		handler = "redir"
+	default:
+		return nil
+	}
+
+	var current string
+	json.Unmarshal(obj["handler_type"], &current)
+	cfg := make(map[string]any)
+	if current == handler {
+		json.Unmarshal(obj["config"], &cfg)
+	}
+	if set["upstream"] {
+		cfg["upstreams"] = f.upstreams
+	}
+	if set["root"] {
+		cfg["root"] = f.root
+	}
+	if set["browse"] {
+		cfg["browse"] = f.browse
+	}
+	if set["to"] {
+		cfg["to"] = f.to
+	}
+	if set["code"] {
+		cfg["code"] = f.code
+	}
+	put("handler_type", handler)
+	put("config", cfg)
+	return nil
+}
+
+// readRoute reads the JSON route given with -f into obj
+func (c *cli) readRoute(path string, obj map[string]json.RawMessage) error {
+	if path == "" {
+		return nil
+	}
+	data, err := c.readInput(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return fmt.Errorf("invalid route in %s: %w", path, err)
+	}
+	return nil
+}
+
+// routeResponse is the response of a route change
+type routeResponse struct {
+	Route   *route `json:"route"`
+	Warning string `json:"warning"`
+}
+
+// sendRoute sends a route change and prints the resulting route
+func (c *cli) sendRoute(method, path string, obj map[string]json.RawMessage) error {
+	data, err := c.api().call(method, path, obj)
+	if err != nil {
+		return err
+	}
+	var resp routeResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return err
+	}
+	c.warn(resp.Warning)
+	return c.printResponse(data, func() error { return c.printRoute(resp.Route) })
+}
+
+func routesCreate(c *cli, args []string) error {
+	fs := c.flags("routes create")
+	var f routeFlags
+	f.register(fs)
+	if _, err := c.parse(fs, args, 0, "[-f route.json] [-domain d] [-path p] [-upstream u | -root dir | -to url]"); err != nil {
+		return err
+	}
+
+	obj := make(map[string]json.RawMessage)
+	if err := c.readRoute(f.file, obj); err != nil {
+		return err
+	}
+	if err := f.apply(fs, obj); err != nil {
+		return err
+	}
+	return c.sendRoute(http.MethodPost, "/routes", obj)
+}
+
+func routesUpdate(c *cli, args []string) error {
+	fs := c.flags("routes update")
+	var f routeFlags
+	f.register(fs)
+	pos, err := c.parse(fs, args, 1, "<id> [-f route.json] [flags of routes create]")
+	if err != nil {
+		return err
+	}
+	path := "/routes/" + url.PathEscape(pos[0])
+
+	// Start from the current route so only the given fields change, and
+	// send its version so a concurrent change isn't overwritten
+	var current struct {
+		Route map[string]json.RawMessage `json:"route"`
+	}
+	if _, err := c.api().get(path, &current); err != nil {
+		return err
+	}
+	obj := current.Route
+	version := obj["version"]
+	if err := c.readRoute(f.file, obj); err != nil {
+		return err
+	}
+	if err := f.apply(fs, obj); err != nil {
+		return err
+	}
+	obj["version"] = version
+	return c.sendRoute(http.MethodPut, path, obj)
+}
+
+func routesDelete(c *cli, args []string) error {
+	fs := c.flags("routes delete")
+	pos, err := c.parse(fs, args, 1, "<id>")
+	if err != nil {
+		return err
+	}
+
+	data, err := c.api().call(http.MethodDelete, "/routes/"+url.PathEscape(pos[0]), nil)
+	if err != nil {
+		return err
+	}
+	var resp struct {
+		Message string `json:"message"`
+		Warning string `json:"warning"`
+	}
+	json.Unmarshal(data, &resp)
+	c.warn(resp.Warning)
+	return c.printResponse(data, func() error {
+		_, err := fmt.Fprintf(c.stdout, "Deleted route %s\n", pos[0])
+		return err
+	})
+}
+
+func routesToggle(c *cli, args []string) error {
+	fs := c.flags("routes toggle")
+	pos, err := c.parse(fs, args, 1, "<id>")
+	if err != nil {
+		return err
+	}
+	path := "/routes/" + url.PathEscape(pos[0])
+
+	var current struct {
+		Route *route `json:"route"`
+	}
+	if _, err := c.api().get(path, &current); err != nil {
+		return err
+	}
+	data, err := c.api().call(http.MethodPost, path+"/toggle", map[string]int64{"version": current.Route.Version})
+	if err != nil {
+		return err
+	}
+	var resp routeResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return err
+	}
+	c.warn(resp.Warning)
+	return c.printResponse(data, func() error {
+		state := "disabled"
+		if resp.Route.Enabled {
+			state = "enabled"
+		}
+		_, err := fmt.Fprintf(c.stdout, "Route %s %s\n", resp.Route.ID, state)
+		return err
+	})
+}
@@ -1,9 +1,14 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
@@ -13,22 +18,43 @@
 
 func main() {
 	// Get configuration from environment
-	dbPath := getEnv("DB_PATH", "./data/routes.db")
+	backend := getEnv("STORAGE_BACKEND", storage.BackendSQLite)
+	defaultDBPath := "./data/routes.db"
+	if backend == storage.BackendJSON {
+		defaultDBPath = "./data/routes.json"
+	}
+	dbPath := getEnv("DB_PATH", defaultDBPath)
 	caddyURL := getEnv("CADDY_ADMIN_URL", "http://localhost:2019")
 	listenAddr := getEnv("LISTEN_ADDR", ":3000")
+	driftInterval, err := time.ParseDuration(getEnv("DRIFT_CHECK_INTERVAL", "1m"))
+	if err != nil {
+		log.Fatalf("Invalid DRIFT_CHECK_INTERVAL: %v", err)
+	}
+	var corsOrigins []string
+	for _, origin := range strings.Split(os.Getenv("CORS_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			corsOrigins = append(corsOrigins, origin)
+		}
+	}
 
 	log.Printf("Starting Caddy Orchestrator Lite")
-	log.Printf("  Database: %s", dbPath)
+	log.Printf("  Database: %s (%s)", dbPath, backend)
 	log.Printf("  Default Caddy Admin URL: %s", caddyURL)
 	log.Printf("  Listen Address: %s", listenAddr)
+	log.Printf("  Drift Check Interval: %s", driftInterval)
 
 	// Initialize storage
-	store, err := storage.NewSQLiteStorage(dbPath)
+	store, err := storage.Open(backend, dbPath)
 	if err != nil {
 		log.Fatalf("Failed to initialize storage: %v", err)
 	}
 	defer store.Close()
 
+	// Make sure someone can sign in; the API is open while there are no users
+	if err := ensureAdminUser(store); err != nil {
+		log.Fatalf("Failed to create initial user: %v", err)
+	}
+
 	// Initialize Gin router
 	if os.Getenv("GIN_MODE") == "" {
 		gin.SetMode(gin.ReleaseMode)
@@ -36,7 +62,12 @@ func main() {
 	r := gin.Default()
 
 	// Setup API routes (pass URL string, not client - handlers use dynamic URL from GlobalConfig)
-	api.SetupRoutes(r, store, caddyURL)
+	h := api.SetupRoutes(r, store, caddyURL, corsOrigins)
+
+	// Periodically compare the live Caddy config with stored routes
+	if driftInterval > 0 {
+		h.StartDriftChecker(context.Background(), driftInterval)
+	}
 
 	// Serve static files (frontend)
 	webDir := getEnv("WEB_DIR", "./web/dist")
@@ -67,6 +98,33 @@ func main() {
 	}
 }
 
+// ensureAdminUser creates the initial user from ADMIN_USERNAME and
+// ADMIN_PASSWORD if there are no users yet. Without a password a random one
+// is generated and logged once.
+func ensureAdminUser(store storage.Store) error {
+	n, err := store.CountUsers()
+	if err != nil || n > 0 {
+		return err
+	}
+
+	user := &storage.User{Username: getEnv("ADMIN_USERNAME", "admin"), Role: storage.RoleAdmin}
+	password := os.Getenv("ADMIN_PASSWORD")
+	if password == "" {
+		b := make([]byte, 12)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+		password = base64.RawURLEncoding.EncodeToString(b)
+		log.Printf("Created user %q with password %s - change it after signing in", user.Username, password)
+	} else {
+		log.Printf("Created user %q from ADMIN_USERNAME/ADMIN_PASSWORD", user.Username)
+	}
+	if err := user.SetPassword(password); err != nil {
+		return err
+	}
+	return store.CreateUser(user)
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -0,0 +1,300 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ArtemStepanov/caddy-admin-ui/internal/storage"
+)
+
+// auditKey is the gin context key of the request's *auditRecord
+const auditKey = "audit"
+
+// defaultAuditLimit and maxAuditLimit bound GET /api/audit. The export
+// has no limit.
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// auditActions names the audited requests by method and route pattern.
+// Requests that change nothing, like previews, aren't listed.
+var auditActions = map[string]string{
+	"POST /api/auth/login":             "login",
+	"POST /api/auth/logout":            "logout",
+	"POST /api/users":                  "create_user",
+	"PUT /api/users/:username":         "update_user",
+	"DELETE /api/users/:username":      "delete_user",
+	"POST /api/tokens":                 "create_token",
+	"DELETE /api/tokens/:id":           "delete_token",
+	"POST /api/routes":                 "create_route",
+	"POST /api/routes/bulk":            "bulk",
+	"PUT /api/routes/:id":              "update_route",
+	"DELETE /api/routes/:id":           "delete_route",
+	"POST /api/routes/:id/toggle":      "toggle_route",
+	"POST /api/servers":                "create_server",
+	"PUT /api/servers/:name":           "update_server",
+	"DELETE /api/servers/:name":        "delete_server",
+	"POST /api/instances":              "create_instance",
+	"PUT /api/instances/:name":         "update_instance",
+	"DELETE /api/instances/:name":      "delete_instance",
+	"PUT /api/config":                  "update_config",
+	"PUT /api/config/base":             "update_base_config",
+	"POST /api/sync":                   "sync",
+	"POST /api/import":                 "import",
+	"POST /api/import/caddyfile":       "import_caddyfile",
+	"POST /api/revisions/:id/rollback": "rollback",
+	"POST /api/apply":                  "apply_manifest",
+}
+
+// auditRecord collects what a handler changed, for auditTrail to store
+// once the response is written
+type auditRecord struct {
+	actor   string
+	changes []auditChange
+	warning string
+	skip    bool
+}
+
+// auditChange is one changed route or other target
+type auditChange struct {
+	routeID string
+	target  string
+	before  any
+	after   any
+}
+
+// recordChange notes that the request changed a route (routeID) or
+// something else (target). before is nil for creations, after for
+// deletions. Bulk handlers call it once per route.
+func recordChange(c *gin.Context, routeID, target string, before, after any) {
+	if rec, ok := c.Get(auditKey); ok {
+		r := rec.(*auditRecord)
+		r.changes = append(r.changes, auditChange{routeID: routeID, target: target, before: before, after: after})
+	}
+}
+
+// recordWarning marks the request's change as saved with a warning, for
+// responses that don't carry a "warning" field
+func recordWarning(c *gin.Context, msg string) {
+	if rec, ok := c.Get(auditKey); ok {
+		rec.(*auditRecord).warning = msg
+	}
+}
+
+// recordActor names the actor of a request made without a signed-in user,
+// such as a login attempt
+func recordActor(c *gin.Context, actor string) {
+	if rec, ok := c.Get(auditKey); ok {
+		rec.(*auditRecord).actor = actor
+	}
+}
+
+// skipAudit drops the audit event of a request that turned out to change
+// nothing, like an apply that only returns its plan
+func skipAudit(c *gin.Context) {
+	if rec, ok := c.Get(auditKey); ok {
+		rec.(*auditRecord).skip = true
+	}
+}
+
+// auditWriter keeps a copy of the response body so the outcome can be
+// read from it
+type auditWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *auditWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *auditWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// auditTrail records an audit event for every request in auditActions,
+// including rejected ones. It runs before role checks so forbidden
+// attempts are recorded too.
+func (h *Handler) auditTrail(c *gin.Context) {
+	action, ok := auditActions[c.Request.Method+" "+c.FullPath()]
+	if !ok {
+		c.Next()
+		return
+	}
+
+	rec := &auditRecord{}
+	c.Set(auditKey, rec)
+	w := &auditWriter{ResponseWriter: c.Writer}
+	c.Writer = w
+
+	c.Next()
+	if rec.skip {
+		return
+	}
+
+	for _, event := range auditEvents(c, action, rec, w) {
+		if err := h.store.CreateAuditEvent(event); err != nil {
+			log.Printf("Failed to record audit event: %v", err)
+		}
+	}
+}
+
+// auditEvents turns a finished request into audit events, one per change
+// or a single one if the handler recorded none
+func auditEvents(c *gin.Context, action string, rec *auditRecord, w *auditWriter) []*storage.AuditEvent {
+	actor := rec.actor
+	if user := currentUser(c); user != nil {
+		actor = user.Username
+	}
+
+	var response struct {
+		Error   string `json:"error"`
+		Warning string `json:"warning"`
+	}
+	json.Unmarshal(w.body.Bytes(), &response)
+
+	outcome, message := storage.AuditOutcomeSuccess, ""
+	switch {
+	case w.Status() >= http.StatusBadRequest:
+		outcome, message = storage.AuditOutcomeFailure, response.Error
+		if message == "" {
+			message = http.StatusText(w.Status())
+		}
+	case response.Warning != "":
+		outcome, message = storage.AuditOutcomeWarning, response.Warning
+	case rec.warning != "":
+		outcome, message = storage.AuditOutcomeWarning, rec.warning
+	}
+
+	changes := rec.changes
+	if len(changes) == 0 {
+		// Fall back to the path parameter, if any
+		var change auditChange
+		if len(c.Params) > 0 {
+			if strings.HasPrefix(c.FullPath(), "/api/routes/") {
+				change.routeID = c.Params[0].Value
+			} else {
+				change.target = c.Params[0].Value
+			}
+		}
+		changes = []auditChange{change}
+	}
+
+	events := make([]*storage.AuditEvent, 0, len(changes))
+	for _, ch := range changes {
+		events = append(events, &storage.AuditEvent{
+			Actor:   actor,
+			Action:  action,
+			RouteID: ch.routeID,
+			Target:  ch.target,
+			Before:  auditJSON(ch.before),
+			After:   auditJSON(ch.after),
+			Outcome: outcome,
+			Message: message,
+		})
+	}
+	return events
+}
+
+// auditJSON encodes a before or after value, leaving nil values empty
+func auditJSON(v any) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil || string(data) == "null" {
+		return nil
+	}
+	return data
+}
+
+// auditFilter reads the audit filter from the query: route, actor, action,
+// since and until (RFC 3339) and limit. It writes a 400 for bad values.
+func auditFilter(c *gin.Context, limit int) (storage.AuditFilter, bool) {
+	filter := storage.AuditFilter{
+		RouteID: c.Query("route"),
+		Actor:   c.Query("actor"),
+		Action:  c.Query("action"),
+		Limit:   limit,
+	}
+	for _, p := range []struct {
+		name string
+		dest *time.Time
+	}{{"since", &filter.Since}, {"until", &filter.Until}} {
+		v := c.Query(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": p.name + " must be an RFC 3339 time"})
+			return filter, false
+		}
+		*p.dest = t
+	}
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive number"})
+			return filter, false
+		}
+		if limit > 0 {
+			n = min(n, maxAuditLimit)
+		}
+		filter.Limit = n
+	}
+	return filter, true
+}
+
+// ListAuditEvents returns audit events, newest first, filtered by
+// ?route=, ?actor=, ?action=, ?since= and ?until=
+func (h *Handler) ListAuditEvents(c *gin.Context) {
+	filter, ok := auditFilter(c, defaultAuditLimit)
+	if !ok {
+		return
+	}
+	events, err := h.store.ListAuditEvents(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if events == nil {
+		events = []*storage.AuditEvent{}
+	}
+	c.JSON(http.StatusOK, gin.H{"events": events})
+}
+
+// ExportAuditEvents streams the matching audit events as NDJSON, one event
+// per line. It takes the same filters as ListAuditEvents but returns every
+// match unless ?limit= is given.
+func (h *Handler) ExportAuditEvents(c *gin.Context) {
+	filter, ok := auditFilter(c, 0)
+	if !ok {
+		return
+	}
+	events, err := h.store.ListAuditEvents(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="audit.ndjson"`)
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+	enc := json.NewEncoder(c.Writer)
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ArtemStepanov/caddy-admin-ui/internal/storage"
+)
+
+// listAudit returns the audit events matching query, as admin
+func listAudit(t *testing.T, router *gin.Engine, cookie *http.Cookie, query string) []storage.AuditEvent {
+	t.Helper()
+
+	w := doAuth(router, "GET", "/api/audit"+query, "", "", cookie)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var response struct {
+		Events []storage.AuditEvent `json:"events"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return response.Events
+}
+
+func TestAudit_RouteChanges(t *testing.T) {
+	router, store := setupAuth(t)
+	cookie := login(t, router)
+	editor := addUser(t, store, &storage.User{Username: "ed", Role: storage.RoleEditor, Domains: []string{"*.example.com"}})
+
+	w := doAuth(router, "POST", "/api/routes", `{"domain": "app.example.com", "handler_type": "static_response", "config": {}}`, editor, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var created struct {
+		Route storage.Route `json:"route"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &created)
+	id := created.Route.ID
+
+	doAuth(router, "POST", "/api/routes/"+id+"/toggle", `{"version": 1}`, editor, nil)
+	doAuth(router, "POST", "/api/routes", `{"domain": "other.org", "handler_type": "static_response", "config": {}}`, editor, nil)
+	doAuth(router, "DELETE", "/api/routes/"+id, "", editor, nil)
+
+	events := listAudit(t, router, cookie, "?route="+id)
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events for the route, got %+v", events)
+	}
+	del, toggle, create := events[0], events[1], events[2]
+	if create.Action != "create_route" || create.Actor != "ed" || create.Before != nil || !strings.Contains(string(create.After), "app.example.com") {
+		t.Errorf("Expected a create event with the new route, got %+v", create)
+	}
+	// Nothing listens on the test Caddy URL, so every change is saved with
+	// a sync warning
+	if create.Outcome != storage.AuditOutcomeWarning || !strings.Contains(create.Message, "sync to Caddy failed") {
+		t.Errorf("Expected the sync warning to be recorded, got %+v", create)
+	}
+	if toggle.Action != "toggle_route" || !strings.Contains(string(toggle.Before), `"enabled":true`) || !strings.Contains(string(toggle.After), `"enabled":false`) {
+		t.Errorf("Expected before and after of the toggle, got %s / %s", toggle.Before, toggle.After)
+	}
+	if del.Action != "delete_route" || del.After != nil || del.Before == nil || del.Outcome != storage.AuditOutcomeWarning {
+		t.Errorf("Expected a delete event with the old route, got %+v", del)
+	}
+
+	failed := listAudit(t, router, cookie, "?actor=ed&action=create_route")
+	if len(failed) != 2 || failed[0].Outcome != storage.AuditOutcomeFailure || !strings.Contains(failed[0].Message, "other.org") {
+		t.Errorf("Expected the forbidden create to be recorded as a failure, got %+v", failed)
+	}
+}
+
+func TestAudit_BulkAndLogin(t *testing.T) {
+	router, store := setupAuth(t)
+	a, b := createRoute(store, "a.example.com"), createRoute(store, "b.example.com")
+
+	doJSON(router, "POST", "/api/auth/login", `{"username": "admin", "password": "wrong-horse"}`)
+	cookie := login(t, router)
+	doAuth(router, "POST", "/api/routes/bulk", `{"action": "disable", "ids": ["`+a+`", "`+b+`"]}`, "", cookie)
+
+	logins := listAudit(t, router, cookie, "?action=login")
+	if len(logins) != 2 || logins[1].Outcome != storage.AuditOutcomeFailure || logins[1].Actor != "admin" {
+		t.Errorf("Expected a failed and a successful login by admin, got %+v", logins)
+	}
+	bulk := listAudit(t, router, cookie, "?action=bulk")
+	if len(bulk) != 2 || bulk[0].RouteID == bulk[1].RouteID {
+		t.Errorf("Expected an event per route of the bulk action, got %+v", bulk)
+	}
+	if got := listAudit(t, router, cookie, "?since="+time.Now().Add(time.Hour).Format(time.RFC3339)); len(got) != 0 {
+		t.Errorf("Expected no events in the future, got %d", len(got))
+	}
+	if got := listAudit(t, router, cookie, "?limit=1"); len(got) != 1 {
+		t.Errorf("Expected limit to apply, got %d", len(got))
+	}
+	if w := doAuth(router, "GET", "/api/audit?since=yesterday", "", "", cookie); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a bad time, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	// Reads aren't audited
+	total := len(listAudit(t, router, cookie, ""))
+	doAuth(router, "GET", "/api/routes", "", "", cookie)
+	if got := len(listAudit(t, router, cookie, "")); got != total {
+		t.Errorf("Expected reads not to be audited, got %d events instead of %d", got, total)
+	}
+}
+
+func TestAudit_Export(t *testing.T) {
+	router, store := setupAuth(t)
+	cookie := login(t, router)
+	viewer := addUser(t, store, &storage.User{Username: "vera", Role: storage.RoleViewer})
+	doAuth(router, "PUT", "/api/config", `{"caddy_admin_url": "http://caddy:2019"}`, "", cookie)
+
+	if w := doAuth(router, "GET", "/api/audit", "", viewer, nil); w.Code != http.StatusForbidden {
+		t.Errorf("Expected the audit log to be admin only, got %d", w.Code)
+	}
+
+	w := doAuth(router, "GET", "/api/audit/export", "", "", cookie)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("Expected NDJSON, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	var actions []string
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var event storage.AuditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("Expected one JSON event per line, got %q", scanner.Text())
+		}
+		actions = append(actions, event.Action)
+		if event.Action == "update_config" && !strings.Contains(string(event.After), "http://caddy:2019") {
+			t.Errorf("Expected the new config in the event, got %s", event.After)
+		}
+	}
+	// The viewer's forbidden read isn't an action, so only the config
+	// change and the login are exported
+	if strings.Join(actions, ",") != "update_config,login" {
+		t.Errorf("Expected config change and login, got %v", actions)
+	}
+}
@@ -0,0 +1,573 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ArtemStepanov/caddy-admin-ui/internal/storage"
+)
+
+// sessionCookie is the cookie holding the SPA's session token
+const sessionCookie = "caddy_ui_session"
+
+// sessionTTL is how long a login lasts
+const sessionTTL = 24 * time.Hour
+
+// minPasswordLength is the shortest password a user can be given
+const minPasswordLength = 8
+
+// userKey is the gin context key of the signed-in *storage.User
+const userKey = "user"
+
+// After maxLoginFailures failed logins for a username within loginWindow,
+// further attempts are refused until the oldest failure is that old
+const (
+	maxLoginFailures = 5
+	loginWindow      = 15 * time.Minute
+)
+
+// dummyUser has a password hash to check when a login names an unknown
+// user, so the response takes as long as for a wrong password
+var dummyUser = sync.OnceValue(func() *storage.User {
+	user := &storage.User{}
+	user.SetPassword("not-a-password")
+	return user
+})
+
+// loginThrottle counts failed logins by username. Counting by username
+// rather than address also covers attackers spreading their attempts
+// over many addresses.
+type loginThrottle struct {
+	mu       sync.Mutex
+	failures map[string][]time.Time
+}
+
+func newLoginThrottle() *loginThrottle {
+	return &loginThrottle{failures: make(map[string][]time.Time)}
+}
+
+// retryAfter returns how long username has to wait before trying again,
+// or 0 if it may try now
+func (t *loginThrottle) retryAfter(username string, now time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	recent := t.recent(username, now)
+	if len(recent) < maxLoginFailures {
+		return 0
+	}
+	return recent[len(recent)-maxLoginFailures].Add(loginWindow).Sub(now)
+}
+
+// fail records a failed login. Usernames without recent failures are
+// dropped, so made-up usernames don't pile up.
+func (t *loginThrottle) fail(username string, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for name := range t.failures {
+		if len(t.recent(name, now)) == 0 {
+			delete(t.failures, name)
+		}
+	}
+	t.failures[username] = append(t.recent(username, now), now)
+}
+
+// succeed forgets the failures of a user who signed in
+func (t *loginThrottle) succeed(username string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.failures, username)
+}
+
+// recent returns the failures of username within the window. t.mu must be
+// held.
+func (t *loginThrottle) recent(username string, now time.Time) []time.Time {
+	failures := t.failures[username]
+	for len(failures) > 0 && now.Sub(failures[0]) >= loginWindow {
+		failures = failures[1:]
+	}
+	return failures
+}
+
+// newSecret returns a random token for a session or API token
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// currentUser returns the signed-in user, or nil while no users exist
+func currentUser(c *gin.Context) *storage.User {
+	if user, ok := c.Get(userKey); ok {
+		return user.(*storage.User)
+	}
+	return nil
+}
+
+// requireAuth rejects requests without a valid API token or session cookie.
+// Until the first user is created the API is open, so a fresh install can
+// be set up; the server creates an initial admin on startup.
+func (h *Handler) requireAuth(c *gin.Context) {
+	n, err := h.store.CountUsers()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if n == 0 {
+		c.Next()
+		return
+	}
+
+	user, err := h.authenticate(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if user == nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+	c.Set(userKey, user)
+	c.Next()
+}
+
+// authenticate returns the user a request's bearer token or session cookie
+// belongs to, or nil if it has neither or they aren't valid
+func (h *Handler) authenticate(c *gin.Context) (*storage.User, error) {
+	var username string
+	if token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+		apiToken, err := h.store.GetAPIToken(storage.HashToken(strings.TrimSpace(token)))
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		username = apiToken.Username
+	} else if cookie, err := c.Cookie(sessionCookie); err == nil {
+		hash := storage.HashToken(cookie)
+		session, err := h.store.GetSession(hash)
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if time.Now().After(session.ExpiresAt) {
+			h.store.DeleteSession(hash)
+			return nil, nil
+		}
+		username = session.Username
+	} else {
+		return nil, nil
+	}
+
+	user, err := h.store.GetUser(username)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil
+	}
+	return user, err
+}
+
+// Health reports that the server is up, for container health checks. It
+// doesn't touch Caddy; use GET /api/status for that.
+func (h *Handler) Health(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Login checks a username and password and starts a session. After too
+// many failures for a username, it answers 429 until the window passes.
+func (h *Handler) Login(c *gin.Context) {
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	recordActor(c, req.Username)
+
+	now := time.Now()
+	if wait := h.logins.retryAfter(req.Username, now); wait > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many failed logins, try again later"})
+		return
+	}
+
+	user, err := h.store.GetUser(req.Username)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if user == nil {
+		dummyUser().CheckPassword(req.Password)
+	}
+	if user == nil || !user.CheckPassword(req.Password) {
+		h.logins.fail(req.Username, now)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid username or password"})
+		return
+	}
+	h.logins.succeed(user.Username)
+
+	secret, err := newSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	session := &storage.Session{
+		TokenHash: storage.HashToken(secret),
+		Username:  user.Username,
+		ExpiresAt: time.Now().Add(sessionTTL),
+	}
+	if err := h.store.CreateSession(session); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	setSessionCookie(c, secret, session.ExpiresAt)
+	c.JSON(http.StatusOK, gin.H{"user": user, "expires_at": session.ExpiresAt})
+}
+
+// Logout ends the current session
+func (h *Handler) Logout(c *gin.Context) {
+	if cookie, err := c.Cookie(sessionCookie); err == nil {
+		if err := h.store.DeleteSession(storage.HashToken(cookie)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	setSessionCookie(c, "", time.Unix(0, 0))
+	c.JSON(http.StatusOK, gin.H{"message": "logged out"})
+}
+
+// setSessionCookie sets the session cookie, or clears it for an empty value.
+// It is marked Secure when the request came in over TLS.
+func setSessionCookie(c *gin.Context, value string, expires time.Time) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    value,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   c.Request.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// GetCurrentUser returns the signed-in user. auth_required is false while
+// no users exist and the API is open.
+func (h *Handler) GetCurrentUser(c *gin.Context) {
+	user := currentUser(c)
+	c.JSON(http.StatusOK, gin.H{"user": user, "auth_required": user != nil})
+}
+
+// ListUsers returns all users
+func (h *Handler) ListUsers(c *gin.Context) {
+	users, err := h.store.ListUsers()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if users == nil {
+		users = []*storage.User{}
+	}
+	c.JSON(http.StatusOK, gin.H{"users": users})
+}
+
+// userRequest is the body of user create and update requests. On update,
+// empty or missing fields keep their current value.
+type userRequest struct {
+	Username        string    `json:"username"`
+	Password        string    `json:"password"`
+	CurrentPassword string    `json:"current_password"`
+	Role            string    `json:"role"`
+	Domains         *[]string `json:"domains"`
+}
+
+// CreateUser adds a local user, a viewer unless a role is given. Creating
+// the first one turns on authentication, so it is always an admin.
+func (h *Handler) CreateUser(c *gin.Context) {
+	var req userRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !namePattern.MatchString(req.Username) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "username must only contain letters, digits, '-' and '_'"})
+		return
+	}
+	if !validatePassword(c, req.Password) {
+		return
+	}
+
+	user := &storage.User{Username: req.Username, Role: req.Role}
+	if user.Role == "" {
+		user.Role = storage.RoleViewer
+	}
+	if req.Domains != nil {
+		user.Domains = *req.Domains
+	}
+	if n, err := h.store.CountUsers(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	} else if n == 0 {
+		user.Role = storage.RoleAdmin
+	}
+	if !validateUser(c, user) {
+		return
+	}
+
+	if err := user.SetPassword(req.Password); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	err := h.store.CreateUser(user)
+	if errors.Is(err, storage.ErrUserExists) {
+		c.JSON(http.StatusConflict, gin.H{"error": "user " + user.Username + " already exists"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	recordChange(c, "", user.Username, nil, user)
+	c.JSON(http.StatusCreated, gin.H{"user": user})
+}
+
+// UpdateUser changes a user's password, role or domains. Users can change
+// their own password by also sending the current one; everything else
+// needs an admin. A new password signs the user out of their other
+// sessions. The username can't be changed, and the last admin can't be
+// demoted.
+func (h *Handler) UpdateUser(c *gin.Context) {
+	var req userRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.store.GetUser(c.Param("username"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	before := *user
+
+	caller := currentUser(c)
+	if caller != nil && !caller.HasRole(storage.RoleAdmin) {
+		if caller.Username != user.Username {
+			forbid(c, "you can only change your own password")
+			return
+		}
+		if req.Role != "" || req.Domains != nil {
+			forbid(c, "only admins can change roles and domains")
+			return
+		}
+	}
+
+	self := caller != nil && caller.Username == user.Username
+	if req.Password != "" {
+		if self && !user.CheckPassword(req.CurrentPassword) {
+			forbid(c, "current_password is missing or incorrect")
+			return
+		}
+		if !validatePassword(c, req.Password) {
+			return
+		}
+		if err := user.SetPassword(req.Password); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	demoted := user.Role == storage.RoleAdmin && req.Role != "" && req.Role != storage.RoleAdmin
+	if req.Role != "" {
+		user.Role = req.Role
+	}
+	if req.Domains != nil {
+		user.Domains = *req.Domains
+	}
+	if !validateUser(c, user) {
+		return
+	}
+	if demoted && !h.checkOtherAdmins(c, user.Username, "demoted") {
+		return
+	}
+
+	if err := h.store.UpdateUser(user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	recordChange(c, "", user.Username, &before, user)
+	if req.Password != "" {
+		// Sign out everywhere else, keeping the session that made the change
+		var keep string
+		if cookie, err := c.Cookie(sessionCookie); err == nil && self {
+			keep = storage.HashToken(cookie)
+		}
+		if err := h.store.DeleteUserSessions(user.Username, keep); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"user": user})
+}
+
+// DeleteUser deletes a user and signs them out everywhere. The last admin
+// can't be deleted, so someone can always manage users.
+func (h *Handler) DeleteUser(c *gin.Context) {
+	username := c.Param("username")
+	user, err := h.store.GetUser(username)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	if user.Role == storage.RoleAdmin && !h.checkOtherAdmins(c, username, "deleted") {
+		return
+	}
+
+	if err := h.store.DeleteUser(username); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	recordChange(c, "", username, user, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "user deleted"})
+}
+
+// checkOtherAdmins writes a 409 unless an admin other than username exists
+func (h *Handler) checkOtherAdmins(c *gin.Context, username, change string) bool {
+	users, err := h.store.ListUsers()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if !slices.ContainsFunc(users, func(u *storage.User) bool {
+		return u.Role == storage.RoleAdmin && u.Username != username
+	}) {
+		c.JSON(http.StatusConflict, gin.H{"error": "the last admin can't be " + change})
+		return false
+	}
+	return true
+}
+
+// validateUser checks a user's role and domain patterns, writing a 400 if
+// they're invalid
+func validateUser(c *gin.Context, user *storage.User) bool {
+	if !storage.ValidRole(user.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role must be viewer, editor or admin"})
+		return false
+	}
+	for _, pattern := range user.Domains {
+		if domain := strings.TrimPrefix(pattern, "*."); domain == "" || strings.Contains(domain, "*") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "domain pattern " + strconv.Quote(pattern) + " must be a domain, optionally starting with *."})
+			return false
+		}
+	}
+	return true
+}
+
+// validatePassword writes a 400 if a password is too short
+func validatePassword(c *gin.Context, password string) bool {
+	if len(password) < minPasswordLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "password must be at least 8 characters"})
+		return false
+	}
+	return true
+}
+
+// ListAPITokens returns the signed-in user's API tokens
+func (h *Handler) ListAPITokens(c *gin.Context) {
+	user, ok := requireUser(c)
+	if !ok {
+		return
+	}
+	tokens, err := h.store.ListAPITokens(user.Username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if tokens == nil {
+		tokens = []*storage.APIToken{}
+	}
+	c.JSON(http.StatusOK, gin.H{"tokens": tokens})
+}
+
+// CreateAPIToken creates an API token for the signed-in user. The secret
+// is only returned in this response.
+func (h *Handler) CreateAPIToken(c *gin.Context) {
+	user, ok := requireUser(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+
+	secret, err := newSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	token := &storage.APIToken{Name: req.Name, Username: user.Username, TokenHash: storage.HashToken(secret)}
+	if err := h.store.CreateAPIToken(token); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	recordChange(c, "", token.ID, nil, token)
+	c.JSON(http.StatusCreated, gin.H{"token": token, "secret": secret})
+}
+
+// DeleteAPIToken revokes one of the signed-in user's API tokens
+func (h *Handler) DeleteAPIToken(c *gin.Context) {
+	user, ok := requireUser(c)
+	if !ok {
+		return
+	}
+	tokens, err := h.store.ListAPITokens(user.Username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	id := c.Param("id")
+	if !slices.ContainsFunc(tokens, func(t *storage.APIToken) bool { return t.ID == id }) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "token not found"})
+		return
+	}
+
+	if err := h.store.DeleteAPIToken(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "token deleted"})
+}
+
+// requireUser returns the signed-in user, writing a 400 while no users
+// exist, since API tokens belong to a user
+func requireUser(c *gin.Context) (*storage.User, bool) {
+	user := currentUser(c)
+	if user == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "create a user before managing API tokens"})
+		return nil, false
+	}
+	return user, true
+}
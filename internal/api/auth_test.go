@@ -0,0 +1,257 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ArtemStepanov/caddy-admin-ui/internal/storage"
+)
+
+// setupAuth creates a router with an admin "admin" whose password is
+// "correct-horse", so authentication is enforced
+func setupAuth(t *testing.T) (*gin.Engine, storage.Store) {
+	t.Helper()
+
+	router, store, cleanup := setupTestRouter(t)
+	t.Cleanup(cleanup)
+	admin := &storage.User{Username: "admin", Role: storage.RoleAdmin}
+	admin.SetPassword("correct-horse")
+	if err := store.CreateUser(admin); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	return router, store
+}
+
+// doAuth sends a request with either a bearer token or a session cookie
+func doAuth(router *gin.Engine, method, path, body, token string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// login signs in as admin and returns the session cookie
+func login(t *testing.T, router *gin.Engine) *http.Cookie {
+	t.Helper()
+
+	w := doJSON(router, "POST", "/api/auth/login", `{"username": "admin", "password": "correct-horse"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected login to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+	for _, c := range w.Result().Cookies() {
+		if c.Name == sessionCookie {
+			if !c.HttpOnly || c.SameSite != http.SameSiteStrictMode {
+				t.Errorf("Expected an HttpOnly, SameSite=Strict cookie, got %+v", c)
+			}
+			return c
+		}
+	}
+	t.Fatal("Expected a session cookie")
+	return nil
+}
+
+func TestAuth_OpenWithoutUsers(t *testing.T) {
+	router, _, cleanup := setupTestRouter(t)
+	defer cleanup()
+
+	w := doJSON(router, "GET", "/api/auth/me", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"auth_required":false`) {
+		t.Errorf("Expected open API without users, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := doJSON(router, "POST", "/api/tokens", `{"name": "ci"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a token without a user, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	// Creating the first user turns authentication on
+	if w := doJSON(router, "POST", "/api/users", `{"username": "admin", "password": "short"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a short password, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w := doJSON(router, "POST", "/api/users", `{"username": "admin", "password": "correct-horse"}`); w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	if w := doJSON(router, "GET", "/api/routes", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d once a user exists, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+func TestAuth_SessionLoginLogout(t *testing.T) {
+	router, _ := setupAuth(t)
+
+	if w := doJSON(router, "GET", "/api/routes", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d without credentials, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if w := doJSON(router, "GET", "/api/health", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected health check without credentials, got %d", w.Code)
+	}
+	if w := doJSON(router, "POST", "/api/auth/login", `{"username": "admin", "password": "wrong-horse"}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a wrong password, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if w := doJSON(router, "POST", "/api/auth/login", `{"username": "nobody", "password": "correct-horse"}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for an unknown user, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	cookie := login(t, router)
+	w := doAuth(router, "GET", "/api/auth/me", "", "", cookie)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"username":"admin"`) {
+		t.Errorf("Expected current user, got %d: %s", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "$2") {
+		t.Errorf("Expected password hash to stay hidden, got %s", w.Body.String())
+	}
+	if w := doAuth(router, "GET", "/api/routes", "", "", cookie); w.Code != http.StatusOK {
+		t.Errorf("Expected status %d with a session, got %d", http.StatusOK, w.Code)
+	}
+
+	if w := doAuth(router, "POST", "/api/auth/logout", "", "", cookie); w.Code != http.StatusOK {
+		t.Fatalf("Expected logout to succeed, got %d", w.Code)
+	}
+	if w := doAuth(router, "GET", "/api/routes", "", "", cookie); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d after logout, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+func TestAuth_APITokens(t *testing.T) {
+	router, _ := setupAuth(t)
+	cookie := login(t, router)
+
+	w := doAuth(router, "POST", "/api/tokens", `{"name": "ci"}`, "", cookie)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var created struct {
+		Token  storage.APIToken `json:"token"`
+		Secret string           `json:"secret"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if created.Secret == "" || strings.Contains(w.Body.String(), "token_hash") {
+		t.Fatalf("Expected the secret once and no hash, got %s", w.Body.String())
+	}
+
+	if w := doAuth(router, "GET", "/api/routes", "", created.Secret, nil); w.Code != http.StatusOK {
+		t.Errorf("Expected status %d with a token, got %d", http.StatusOK, w.Code)
+	}
+	if w := doAuth(router, "GET", "/api/routes", "", "not-a-token", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d with a bad token, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	w = doAuth(router, "GET", "/api/tokens", "", created.Secret, nil)
+	if !strings.Contains(w.Body.String(), created.Token.ID) || strings.Contains(w.Body.String(), created.Secret) {
+		t.Errorf("Expected token listed without its secret, got %s", w.Body.String())
+	}
+
+	if w := doAuth(router, "DELETE", "/api/tokens/"+created.Token.ID, "", "", cookie); w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if w := doAuth(router, "GET", "/api/routes", "", created.Secret, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected revoked token to be rejected, got %d", w.Code)
+	}
+}
+
+func TestAuth_LoginThrottle(t *testing.T) {
+	router, store := setupAuth(t)
+	addUser(t, store, &storage.User{Username: "bob", Role: storage.RoleViewer})
+
+	for i := 0; i < maxLoginFailures; i++ {
+		if w := doJSON(router, "POST", "/api/auth/login", `{"username": "admin", "password": "wrong-horse"}`); w.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected failure %d to be a %d, got %d", i+1, http.StatusUnauthorized, w.Code)
+		}
+	}
+	w := doJSON(router, "POST", "/api/auth/login", `{"username": "admin", "password": "correct-horse"}`)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected status %d with Retry-After once throttled, got %d %v", http.StatusTooManyRequests, w.Code, w.Header())
+	}
+	if w := doJSON(router, "POST", "/api/auth/login", `{"username": "bob", "password": "bob-password"}`); w.Code != http.StatusOK {
+		t.Errorf("Expected other users to sign in, got %d", w.Code)
+	}
+
+	// Failures age out of the window, and a login clears them
+	throttle := newLoginThrottle()
+	start := time.Now()
+	for i := 0; i < maxLoginFailures; i++ {
+		throttle.fail("carol", start.Add(time.Duration(i)*time.Minute))
+	}
+	if wait := throttle.retryAfter("carol", start.Add(5*time.Minute)); wait != loginWindow-5*time.Minute {
+		t.Errorf("Expected to wait until the first failure ages out, got %v", wait)
+	}
+	if wait := throttle.retryAfter("carol", start.Add(loginWindow)); wait != 0 {
+		t.Errorf("Expected the oldest failure to have aged out, got %v", wait)
+	}
+	throttle.succeed("carol")
+	if wait := throttle.retryAfter("carol", start.Add(5*time.Minute)); wait != 0 {
+		t.Errorf("Expected a login to clear the failures, got %v", wait)
+	}
+}
+
+func TestAuth_ChangePassword(t *testing.T) {
+	router, store := setupAuth(t)
+	cookie, other := login(t, router), login(t, router)
+	addUser(t, store, &storage.User{Username: "bob", Role: storage.RoleViewer})
+	w := doJSON(router, "POST", "/api/auth/login", `{"username": "bob", "password": "bob-password"}`)
+	bob := w.Result().Cookies()[0]
+
+	for _, body := range []string{`{"password": "new-horse-battery"}`, `{"password": "new-horse-battery", "current_password": "wrong"}`} {
+		if w := doAuth(router, "PUT", "/api/users/admin", body, "", cookie); w.Code != http.StatusForbidden {
+			t.Errorf("Expected %s to be forbidden, got %d", body, w.Code)
+		}
+	}
+	w = doAuth(router, "PUT", "/api/users/admin", `{"password": "new-horse-battery", "current_password": "correct-horse"}`, "", cookie)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if w := doAuth(router, "GET", "/api/auth/me", "", "", cookie); w.Code != http.StatusOK {
+		t.Errorf("Expected the session that changed the password to stay signed in, got %d", w.Code)
+	}
+	if w := doAuth(router, "GET", "/api/auth/me", "", "", other); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the other session to be signed out, got %d", w.Code)
+	}
+
+	// An admin resetting someone else's password doesn't need theirs
+	if w := doAuth(router, "PUT", "/api/users/bob", `{"password": "reset-password"}`, "", cookie); w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if w := doAuth(router, "GET", "/api/auth/me", "", "", bob); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected bob to be signed out after a reset, got %d", w.Code)
+	}
+}
+
+func TestAuth_Users(t *testing.T) {
+	router, store := setupAuth(t)
+	cookie := login(t, router)
+
+	if w := doAuth(router, "DELETE", "/api/users/admin", "", "", cookie); w.Code != http.StatusConflict {
+		t.Errorf("Expected status %d for the last admin, got %d", http.StatusConflict, w.Code)
+	}
+	if w := doAuth(router, "POST", "/api/users", `{"username": "admin", "password": "another-horse"}`, "", cookie); w.Code != http.StatusConflict {
+		t.Errorf("Expected status %d for a duplicate user, got %d", http.StatusConflict, w.Code)
+	}
+	if w := doAuth(router, "POST", "/api/users", `{"username": "bob", "password": "bobs-password", "role": "admin"}`, "", cookie); w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	if w := doAuth(router, "PUT", "/api/users/bob", `{"password": "new-password"}`, "", cookie); w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if bob, _ := store.GetUser("bob"); !bob.CheckPassword("new-password") {
+		t.Error("Expected bob's password to be changed")
+	}
+
+	if w := doAuth(router, "DELETE", "/api/users/admin", "", "", cookie); w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if w := doAuth(router, "GET", "/api/routes", "", "", cookie); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a deleted user's session to be rejected, got %d", w.Code)
+	}
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ArtemStepanov/caddy-admin-ui/internal/config"
+	"github.com/ArtemStepanov/caddy-admin-ui/internal/storage"
+)
+
+// readCaddyfile parses the Caddyfile in the request body, writing a 400 if
+// it can't be read
+func readCaddyfile(c *gin.Context) (*config.CaddyfileImport, bool) {
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	parsed, err := config.ParseCaddyfile(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid Caddyfile: " + err.Error()})
+		return nil, false
+	}
+	if parsed.Unsupported == nil {
+		parsed.Unsupported = []config.CaddyfileIssue{}
+	}
+	return parsed, true
+}
+
+// PreviewCaddyfileImport returns the routes a Caddyfile would be imported
+// as and what the import would change, without writing anything. It takes
+// the same mode and keep_local parameters as PreviewImport.
+func (h *Handler) PreviewCaddyfileImport(c *gin.Context) {
+	mode, keepLocal, ok := importOptions(c)
+	if !ok {
+		return
+	}
+	parsed, ok := readCaddyfile(c)
+	if !ok {
+		return
+	}
+
+	plan, _, err := planImport(h.store, parsed.Routes, mode, keepLocal)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"routes":        parsed.Routes,
+		"count":         len(parsed.Routes),
+		"enable_encode": parsed.EnableEncode,
+		"unsupported":   parsed.Unsupported,
+		"mode":          mode,
+		"plan":          planSummary(plan),
+	})
+}
+
+// ImportCaddyfile imports the site blocks of a Caddyfile as routes and
+// syncs them to Caddy. Unlike an import from Caddy it leaves servers and
+// the base config alone; encode in any site turns on compression.
+func (h *Handler) ImportCaddyfile(c *gin.Context) {
+	mode, keepLocal, ok := importOptions(c)
+	if !ok {
+		return
+	}
+	parsed, ok := readCaddyfile(c)
+	if !ok {
+		return
+	}
+	// In replace mode this would delete every route
+	if len(parsed.Routes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no routes found in the Caddyfile", "unsupported": parsed.Unsupported})
+		return
+	}
+
+	var plan *storage.ImportPlan
+	var existing []*storage.Route
+	var result *storage.ImportResult
+	err := h.store.WithTx(func(tx storage.RouteStore) error {
+		var err error
+		if plan, existing, err = planImport(tx, parsed.Routes, mode, keepLocal); err != nil {
+			return err
+		}
+		result = storage.ApplyImport(tx, plan)
+
+		if !parsed.EnableEncode {
+			return nil
+		}
+		global, err := tx.GetGlobalConfig()
+		if err != nil {
+			return err
+		}
+		global.EnableEncode = true
+		return tx.SetGlobalConfig(global)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import routes: " + err.Error()})
+		return
+	}
+	recordImport(c, existing, plan, result)
+
+	resp := gin.H{
+		"imported":    result.Created + result.Updated,
+		"mode":        mode,
+		"result":      result,
+		"unsupported": parsed.Unsupported,
+		"message":     "Caddyfile imported successfully",
+	}
+	if err := h.syncToCaddy(storage.RevisionActionImport); err != nil {
+		resp["warning"] = "Caddyfile imported but sync to Caddy failed: " + err.Error()
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// ExportCaddyfile renders the stored routes as a Caddyfile. ?instance=
+// limits the export to the routes deployed to that instance.
+func (h *Handler) ExportCaddyfile(c *gin.Context) {
+	instance := c.Query("instance")
+	if instance != "" {
+		if _, err := h.store.GetInstance(instance); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "instance not found"})
+			return
+		}
+	}
+
+	routes, err := h.store.ListRoutes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	global, err := h.store.GetGlobalConfig()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if instance != "" {
+		deployed := routes[:0]
+		for _, r := range routes {
+			if r.DeployedTo(instance) {
+				deployed = append(deployed, r)
+			}
+		}
+		routes = deployed
+	}
+
+	c.Data(http.StatusOK, "text/caddyfile; charset=utf-8", []byte(config.RenderCaddyfile(routes, global)))
+}
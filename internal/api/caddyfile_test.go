@@ -0,0 +1,139 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ArtemStepanov/caddy-admin-ui/internal/config"
+	"github.com/ArtemStepanov/caddy-admin-ui/internal/storage"
+)
+
+const testCaddyfile = `example.com {
+	encode gzip
+	reverse_proxy localhost:8080
+	handle_path /static/* {
+		file_server {
+			root /srv/static
+		}
+	}
+	tls internal
+}
+`
+
+func TestPreviewCaddyfileImport(t *testing.T) {
+	router, store, cleanup := setupTestRouter(t)
+	defer cleanup()
+	createRoute(store, "local.example.com")
+
+	w := doJSON(router, "POST", "/api/import-preview/caddyfile?mode=merge", testCaddyfile)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var response struct {
+		Count        int                     `json:"count"`
+		EnableEncode bool                    `json:"enable_encode"`
+		Unsupported  []config.CaddyfileIssue `json:"unsupported"`
+		Plan         map[string]int          `json:"plan"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if response.Count != 2 || !response.EnableEncode || response.Plan["create"] != 2 || response.Plan["keep"] != 1 {
+		t.Errorf("Expected 2 routes to create and 1 to keep, got %+v", response)
+	}
+	if len(response.Unsupported) != 1 || response.Unsupported[0].Line != 9 {
+		t.Errorf("Expected tls on line 9 to be reported, got %+v", response.Unsupported)
+	}
+	if routes, _ := store.ListRoutes(); len(routes) != 1 {
+		t.Errorf("Expected preview not to write, got %d routes", len(routes))
+	}
+}
+
+func TestImportCaddyfile(t *testing.T) {
+	router, store, fc, cleanup := setupTestRouterWithCaddy(t)
+	defer cleanup()
+	local := createRoute(store, "local.example.com")
+
+	w := doJSON(router, "POST", "/api/import/caddyfile", testCaddyfile)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var response struct {
+		Imported int                  `json:"imported"`
+		Result   storage.ImportResult `json:"result"`
+		Warning  string               `json:"warning"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if response.Imported != 2 || response.Result.Deleted != 1 || response.Warning != "" {
+		t.Errorf("Expected 2 imported and the local route replaced, got %+v", response)
+	}
+
+	routes, _ := store.ListRoutes()
+	if len(routes) != 2 {
+		t.Fatalf("Expected 2 routes, got %d", len(routes))
+	}
+	if cfg, _ := store.GetGlobalConfig(); !cfg.EnableEncode {
+		t.Error("Expected encode to turn on compression")
+	}
+	if fc.loads == 0 && len(fc.routeOps()) == 0 {
+		t.Error("Expected the imported routes to be synced to Caddy")
+	}
+
+	// Each route change is audited on its own
+	if events, _ := store.ListAuditEvents(storage.AuditFilter{RouteID: local}); len(events) != 1 || events[0].Before == nil || events[0].After != nil {
+		t.Errorf("Expected a delete event for the replaced route, got %+v", events)
+	}
+	for _, r := range routes {
+		events, _ := store.ListAuditEvents(storage.AuditFilter{RouteID: r.ID})
+		if len(events) != 1 || events[0].Action != "import_caddyfile" || events[0].Before != nil || !strings.Contains(string(events[0].After), r.Domain) {
+			t.Errorf("Expected a create event for %s, got %+v", r.Domain, events)
+		}
+	}
+}
+
+func TestImportCaddyfile_Errors(t *testing.T) {
+	router, store, cleanup := setupTestRouter(t)
+	defer cleanup()
+	createRoute(store, "local.example.com")
+
+	if w := doJSON(router, "POST", "/api/import/caddyfile", "example.com {\n"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a syntax error, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w := doJSON(router, "POST", "/api/import/caddyfile", "example.com {\n\trespond OK\n}\n"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d without any routes, got %d", http.StatusBadRequest, w.Code)
+	}
+	if routes, _ := store.ListRoutes(); len(routes) != 1 {
+		t.Errorf("Expected routes to be untouched, got %d", len(routes))
+	}
+}
+
+func TestExportCaddyfile(t *testing.T) {
+	router, store, cleanup := setupTestRouter(t)
+	defer cleanup()
+	store.CreateRoute(&storage.Route{
+		Domain: "example.com", HandlerType: "reverse_proxy", Instances: []string{"core"},
+		Config: json.RawMessage(`{"upstreams": ["localhost:8080"]}`), Enabled: true,
+	})
+	store.CreateRoute(&storage.Route{
+		Domain: "edge.example.com", HandlerType: "redir", Instances: []string{"edge-1"},
+		Config: json.RawMessage(`{"to": "https://example.com{uri}"}`), Enabled: true,
+	})
+	store.CreateInstance(&storage.Instance{Name: "edge-1", AdminURL: "http://edge-1:2019"})
+
+	w := doJSON(router, "GET", "/api/export/caddyfile", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	parsed, err := config.ParseCaddyfile(w.Body.Bytes())
+	if err != nil || len(parsed.Routes) != 2 {
+		t.Fatalf("Expected the export to parse back into 2 routes, got %v:\n%s", err, w.Body.String())
+	}
+
+	w = doJSON(router, "GET", "/api/export/caddyfile?instance=edge-1", "")
+	if parsed, _ := config.ParseCaddyfile(w.Body.Bytes()); len(parsed.Routes) != 1 || parsed.Routes[0].Domain != "edge.example.com" {
+		t.Errorf("Expected only the edge route, got:\n%s", w.Body.String())
+	}
+	if w := doJSON(router, "GET", "/api/export/caddyfile?instance=nope", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for an unknown instance, got %d", http.StatusNotFound, w.Code)
+	}
+}
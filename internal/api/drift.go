@@ -0,0 +1,136 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/ArtemStepanov/caddy-admin-ui/internal/config"
+	"github.com/ArtemStepanov/caddy-admin-ui/internal/storage"
+)
+
+// DriftStatus is the result of the last comparison between the stored
+// routes and the config Caddy is actually running
+type DriftStatus struct {
+	Instance     string              `json:"instance,omitempty"`
+	CheckedAt    time.Time           `json:"checked_at"`
+	Drifted      bool                `json:"drifted"`
+	Policy       string              `json:"policy"`
+	Error        string              `json:"error,omitempty"`
+	ChangeCount  int                 `json:"change_count"`
+	Routes       []config.RouteDrift `json:"routes,omitempty"`
+	Other        []config.Change     `json:"other,omitempty"`
+	ReconciledAt *time.Time          `json:"reconciled_at,omitempty"`
+	Instances    []*DriftStatus      `json:"instances,omitempty"`
+}
+
+// StartDriftChecker periodically compares the live Caddy config with the
+// config built from stored routes until ctx is cancelled
+func (h *Handler) StartDriftChecker(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				h.checkDrift()
+			}
+		}
+	}()
+}
+
+// checkDrift runs a single drift check and, if the global policy asks for
+// it, pushes the stored config back to Caddy. With managed instances each
+// one is checked and the result lists them under Instances.
+func (h *Handler) checkDrift() *DriftStatus {
+	policy := storage.DriftPolicyDetect
+	globalCfg, err := h.store.GetGlobalConfig()
+	if err == nil && globalCfg.DriftPolicy != "" {
+		policy = globalCfg.DriftPolicy
+	}
+
+	targets, err := h.syncTargets()
+	if err != nil {
+		status := &DriftStatus{CheckedAt: time.Now(), Policy: policy, Error: err.Error()}
+		h.setDrift(status)
+		return status
+	}
+	if targets[0].instance == nil {
+		status := h.checkTargetDrift(targets[0], policy)
+		h.setDrift(status)
+		return status
+	}
+
+	status := &DriftStatus{CheckedAt: time.Now(), Policy: policy}
+	for _, t := range targets {
+		instStatus := h.checkTargetDrift(t, policy)
+		instStatus.Instance = t.name
+		status.Drifted = status.Drifted || instStatus.Drifted
+		status.ChangeCount += instStatus.ChangeCount
+		status.Instances = append(status.Instances, instStatus)
+	}
+	h.setDrift(status)
+	return status
+}
+
+// checkTargetDrift checks a single target for drift, reconciling it if
+// policy says so
+func (h *Handler) checkTargetDrift(t syncTarget, policy string) *DriftStatus {
+	status := &DriftStatus{CheckedAt: time.Now(), Policy: policy}
+
+	// A sync in progress isn't drift
+	defer h.lockTargets(t)()
+	if err := h.compareLive(t, status); err != nil {
+		status.Error = err.Error()
+		return status
+	}
+
+	if status.Drifted && status.Policy == storage.DriftPolicyReconcile {
+		if err := h.syncTargetLocked(t, storage.RevisionActionReconcile, true); err != nil {
+			status.Error = "reconcile failed: " + err.Error()
+		} else {
+			log.Printf("Drift reconciled: %d change(s) overwritten", status.ChangeCount)
+			now := time.Now()
+			status.ReconciledAt = &now
+		}
+	}
+	return status
+}
+
+// compareLive fills status with the differences between a target's live
+// config and the config built from storage
+func (h *Handler) compareLive(t syncTarget, status *DriftStatus) error {
+	_, desired, err := h.buildConfigFor(t.instance)
+	if err != nil {
+		return err
+	}
+
+	raw, err := t.client.GetConfig("")
+	if err != nil {
+		return err
+	}
+
+	changes, err := config.Diff(raw, desired)
+	if err != nil {
+		return err
+	}
+
+	var live config.CaddyConfig
+	// A config we can't decode still yields a diff; only route details are lost
+	_ = json.Unmarshal(raw, &live)
+
+	status.ChangeCount = len(changes)
+	status.Drifted = len(changes) > 0
+	status.Routes, status.Other = config.GroupRouteChanges(changes, &live, desired)
+	return nil
+}
+
+func (h *Handler) setDrift(status *DriftStatus) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.drift = status
+}
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ArtemStepanov/caddy-admin-ui/internal/storage"
+)
+
+func setupDriftTest(t *testing.T, policy string) (*Handler, storage.Store, *fakeCaddy, func()) {
+	t.Helper()
+
+	_, store, fc, cleanup := setupTestRouterWithCaddy(t)
+	store.SetGlobalConfig(&storage.GlobalConfig{CaddyAdminURL: fc.URL, DriftPolicy: policy})
+	store.CreateRoute(&storage.Route{
+		Domain:      "example.com",
+		HandlerType: "reverse_proxy",
+		Config:      json.RawMessage(`{"upstreams":["localhost:8080"]}`),
+		Enabled:     true,
+	})
+
+	h := NewHandler(store, "http://localhost:29999")
+	if err := h.syncToCaddy(storage.RevisionActionSync); err != nil {
+		cleanup()
+		t.Fatalf("Initial sync failed: %v", err)
+	}
+	return h, store, fc, cleanup
+}
+
+// editLiveUpstream changes the upstream in Caddy's live config, as if
+// someone had edited it through the admin API directly
+func editLiveUpstream(t *testing.T, fc *fakeCaddy) {
+	t.Helper()
+	edited := strings.Replace(string(fc.loadedConfig()), "localhost:8080", "localhost:9999", 1)
+	fc.setConfig(json.RawMessage(edited))
+}
+
+func TestCheckDrift_InSync(t *testing.T) {
+	h, _, _, cleanup := setupDriftTest(t, "")
+	defer cleanup()
+
+	status := h.checkDrift()
+	if status.Error != "" {
+		t.Fatalf("Unexpected error: %s", status.Error)
+	}
+	if status.Drifted {
+		t.Errorf("Expected no drift right after sync, got %+v", status)
+	}
+	if status.Policy != storage.DriftPolicyDetect {
+		t.Errorf("Expected default policy detect, got %s", status.Policy)
+	}
+}
+
+func TestCheckDrift_Detect(t *testing.T) {
+	h, _, fc, cleanup := setupDriftTest(t, storage.DriftPolicyDetect)
+	defer cleanup()
+
+	editLiveUpstream(t, fc)
+	loadsBefore := fc.loads
+
+	status := h.checkDrift()
+	if !status.Drifted {
+		t.Fatal("Expected drift after external edit")
+	}
+	if len(status.Routes) != 1 {
+		t.Fatalf("Expected 1 drifted route, got %+v", status.Routes)
+	}
+
+	route := status.Routes[0]
+	if route.Server != "srv0" || len(route.Hosts) != 1 || route.Hosts[0] != "example.com" {
+		t.Errorf("Expected drift on srv0 example.com, got %+v", route)
+	}
+	if len(route.Handlers) != 1 || route.Handlers[0] != "reverse_proxy" {
+		t.Errorf("Expected reverse_proxy handler to differ, got %v", route.Handlers)
+	}
+	if status.ReconciledAt != nil || fc.loads != loadsBefore {
+		t.Error("Expected detect policy not to reconcile")
+	}
+}
+
+func TestCheckDrift_Reconcile(t *testing.T) {
+	h, store, fc, cleanup := setupDriftTest(t, storage.DriftPolicyReconcile)
+	defer cleanup()
+
+	editLiveUpstream(t, fc)
+
+	status := h.checkDrift()
+	if !status.Drifted || status.ReconciledAt == nil {
+		t.Fatalf("Expected drift to be reconciled, got %+v", status)
+	}
+	if !strings.Contains(string(fc.loadedConfig()), "localhost:8080") {
+		t.Error("Expected stored config to be pushed back to Caddy")
+	}
+
+	revisions, _ := store.ListRevisions(1)
+	if revisions[0].Action != storage.RevisionActionReconcile {
+		t.Errorf("Expected reconcile revision, got %s", revisions[0].Action)
+	}
+
+	if h.checkDrift().Drifted {
+		t.Error("Expected no drift after reconcile")
+	}
+}
+
+func TestCheckDrift_CaddyOffline(t *testing.T) {
+	_, store, cleanup := setupTestRouter(t)
+	defer cleanup()
+
+	store.SetGlobalConfig(&storage.GlobalConfig{CaddyAdminURL: "http://localhost:29999"})
+	h := NewHandler(store, "http://localhost:29999")
+
+	status := h.checkDrift()
+	if status.Error == "" {
+		t.Error("Expected error when Caddy is offline")
+	}
+	if status.Drifted {
+		t.Error("Expected no drift to be reported without a live config")
+	}
+}
+
+func TestGetStatus_IncludesDrift(t *testing.T) {
+	_, store, fc, cleanup := setupTestRouterWithCaddy(t)
+	defer cleanup()
+
+	router := gin.New()
+	h := SetupRoutes(router, store, fc.URL, nil)
+	h.checkDrift()
+
+	req := httptest.NewRequest("GET", "/api/status", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var response map[string]any
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if _, ok := response["drift"].(map[string]any); !ok {
+		t.Errorf("Expected drift in status response, got %v", response)
+	}
+}
+
+func TestUpdateConfig_InvalidDriftPolicy(t *testing.T) {
+	router, _, cleanup := setupTestRouter(t)
+	defer cleanup()
+
+	req := httptest.NewRequest("PUT", "/api/config", strings.NewReader(`{"drift_policy": "panic"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
@@ -2,7 +2,14 @@
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -14,27 +21,58 @@
 
 // Handler contains all HTTP handlers
 type Handler struct {
-	store           *storage.SQLiteStorage
+	store           storage.Store
 	defaultCaddyURL string // fallback URL from env
-	lastSyncedAt    time.Time
-	lastSyncError   string
+
+	// mu guards the sync and drift state below, which is also written by
+	// the background drift checker and concurrent instance syncs
+	mu      sync.RWMutex
+	targets map[string]*targetState // by instance name, "" for the default Caddy
+	drift   *DriftStatus
+
+	// syncLocks serialize syncs to each target, by target name, from
+	// building the config to recording what was applied
+	syncLocks map[string]*sync.Mutex
+
+	logins *loginThrottle
 }
 
 // NewHandler creates a new handler
-func NewHandler(store *storage.SQLiteStorage, defaultCaddyURL string) *Handler {
+func NewHandler(store storage.Store, defaultCaddyURL string) *Handler {
 	return &Handler{
 		store:           store,
 		defaultCaddyURL: defaultCaddyURL,
+		targets:         make(map[string]*targetState),
+		syncLocks:       make(map[string]*sync.Mutex),
+		logins:          newLoginThrottle(),
 	}
 }
 
 // getCaddyClient returns a Caddy client using the URL from GlobalConfig (or default)
 func (h *Handler) getCaddyClient() *caddy.Client {
 	cfg, err := h.store.GetGlobalConfig()
-	if err != nil || cfg.CaddyAdminURL == "" {
+	if err != nil {
 		return caddy.NewClient(h.defaultCaddyURL)
 	}
-	return caddy.NewClient(cfg.CaddyAdminURL)
+
+	adminURL := h.defaultCaddyURL
+	if cfg.CaddyAdminURL != "" {
+		adminURL = cfg.CaddyAdminURL
+	}
+	return newCaddyClient(adminURL, cfg.Admin)
+}
+
+// adminOrigin returns the Origin to send when Caddy enforces origins: the
+// first allowed one, as a URL
+func adminOrigin(admin *storage.AdminSettings) string {
+	if admin == nil || !admin.EnforceOrigin || len(admin.Origins) == 0 {
+		return ""
+	}
+	origin := admin.Origins[0]
+	if !strings.Contains(origin, "://") {
+		origin = "http://" + origin
+	}
+	return origin
 }
 
 // getCaddyURL returns the current Caddy URL from GlobalConfig (or default)
@@ -56,7 +94,7 @@ func (h *Handler) ListRoutes(c *gin.Context) {
 	if routes == nil {
 		routes = []*storage.Route{}
 	}
-	c.JSON(http.StatusOK, gin.H{"routes": routes})
+	c.JSON(http.StatusOK, gin.H{"routes": redactRoutes(c, routes)})
 }
 
 // CreateRoute creates a new route
@@ -76,24 +114,33 @@ func (h *Handler) CreateRoute(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "handler_type is required"})
 		return
 	}
+	if !checkDomain(c, route.Domain) {
+		return
+	}
+	if !h.checkRouteServer(c, &route) || !h.checkRouteInstances(c, &route) {
+		return
+	}
 
 	route.Enabled = true // New routes are enabled by default
+	route.CreatedAt = time.Time{}
 
 	if err := h.store.CreateRoute(&route); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	c.Header("ETag", routeETag(&route))
+	recordChange(c, route.ID, "", nil, &route)
 
 	// Auto-sync to Caddy
-	if err := h.syncToCaddy(); err != nil {
+	if err := h.syncToCaddy(storage.RevisionActionCreateRoute); err != nil {
 		c.JSON(http.StatusCreated, gin.H{
-			"route":   route,
+			"route":   redactRoute(c, &route),
 			"warning": "Route created but sync to Caddy failed: " + err.Error(),
 		})
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"route": route})
+	c.JSON(http.StatusCreated, gin.H{"route": redactRoute(c, &route)})
 }
 
 // GetRoute returns a single route
@@ -104,10 +151,54 @@ func (h *Handler) GetRoute(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "route not found"})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"route": route})
+	c.Header("ETag", routeETag(route))
+	c.JSON(http.StatusOK, gin.H{"route": redactRoute(c, route)})
 }
 
-// UpdateRoute updates an existing route
+// routeETag is the entity tag of a route's current version
+func routeETag(r *storage.Route) string {
+	return fmt.Sprintf(`"%d"`, r.Version)
+}
+
+// expectedVersion returns the route version a change was based on, taken
+// from the If-Match header or else from the request body. It writes an
+// error response if neither is present.
+func expectedVersion(c *gin.Context, bodyVersion int64) (int64, bool) {
+	if ifMatch := c.GetHeader("If-Match"); ifMatch != "" {
+		tag := strings.Trim(strings.TrimPrefix(ifMatch, "W/"), `"`)
+		version, err := strconv.ParseInt(tag, 10, 64)
+		if err != nil || version <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid If-Match header"})
+			return 0, false
+		}
+		return version, true
+	}
+	if bodyVersion <= 0 {
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": "version or If-Match header is required"})
+		return 0, false
+	}
+	return bodyVersion, true
+}
+
+// updateVersioned stores route if its version still matches, writing a 409
+// with the current route if someone else changed it first
+func (h *Handler) updateVersioned(c *gin.Context, route *storage.Route) bool {
+	err := h.store.UpdateRoute(route)
+	if errors.Is(err, storage.ErrVersionConflict) {
+		current, _ := h.store.GetRoute(route.ID)
+		c.JSON(http.StatusConflict, gin.H{"error": "route was modified by someone else", "route": redactRoute(c, current)})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	c.Header("ETag", routeETag(route))
+	return true
+}
+
+// UpdateRoute updates an existing route. The request must carry the
+// version it was based on, as "version" or an If-Match header.
 func (h *Handler) UpdateRoute(c *gin.Context) {
 	id := c.Param("id")
 
@@ -123,6 +214,11 @@ func (h *Handler) UpdateRoute(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	// Scoped editors can neither edit other domains' routes nor move
+	// routes out of their own domains
+	if !checkDomain(c, existing.Domain) || !checkDomain(c, route.Domain) {
+		return
+	}
 
 	// Preserve ID and timestamps
 	route.ID = existing.ID
@@ -130,45 +226,86 @@ func (h *Handler) UpdateRoute(c *gin.Context) {
 	// Preserve state and raw config that isn't editable in the UI
 	route.Enabled = existing.Enabled
 	route.RawCaddyRoute = existing.RawCaddyRoute
+	// Users submitted without a password keep their stored hash
+	preserveBasicAuthPasswords(route.BasicAuth, existing.BasicAuth)
+	if !h.checkRouteServer(c, &route) || !h.checkRouteInstances(c, &route) {
+		return
+	}
 
-	if err := h.store.UpdateRoute(&route); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	version, ok := expectedVersion(c, route.Version)
+	if !ok {
+		return
+	}
+	route.Version = version
+	if !h.updateVersioned(c, &route) {
 		return
 	}
+	recordChange(c, route.ID, "", existing, &route)
 
 	// Auto-sync to Caddy
-	if err := h.syncToCaddy(); err != nil {
+	if err := h.syncToCaddy(storage.RevisionActionUpdateRoute); err != nil {
 		c.JSON(http.StatusOK, gin.H{
-			"route":   route,
+			"route":   redactRoute(c, &route),
 			"warning": "Route updated but sync to Caddy failed: " + err.Error(),
 		})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"route": route})
+	c.JSON(http.StatusOK, gin.H{"route": redactRoute(c, &route)})
+}
+
+// preserveBasicAuthPasswords copies stored password hashes into users that
+// were submitted with an empty password
+func preserveBasicAuthPasswords(updated, existing *storage.BasicAuthConfig) {
+	if updated == nil || existing == nil {
+		return
+	}
+	hashes := make(map[string]string, len(existing.Users))
+	for _, u := range existing.Users {
+		hashes[u.Username] = u.Password
+	}
+	for i, u := range updated.Users {
+		if u.Password == "" {
+			updated.Users[i].Password = hashes[u.Username]
+		}
+	}
 }
 
 // DeleteRoute deletes a route
 func (h *Handler) DeleteRoute(c *gin.Context) {
 	id := c.Param("id")
 
+	route, err := h.store.GetRoute(id)
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "route not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !checkDomain(c, route.Domain) {
+		return
+	}
 	if err := h.store.DeleteRoute(id); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	recordChange(c, id, "", route, nil)
 
 	// Auto-sync to Caddy
-	if err := h.syncToCaddy(); err != nil {
-		c.JSON(http.StatusOK, gin.H{
-			"message": "Route deleted but sync to Caddy failed: " + err.Error(),
-		})
+	if err := h.syncToCaddy(storage.RevisionActionDeleteRoute); err != nil {
+		msg := "Route deleted but sync to Caddy failed: " + err.Error()
+		recordWarning(c, msg)
+		c.JSON(http.StatusOK, gin.H{"message": msg})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "route deleted"})
 }
 
-// ToggleRoute enables/disables a route
+// ToggleRoute enables/disables a route. Like UpdateRoute it needs the
+// current version, as {"version": n} or an If-Match header.
 func (h *Handler) ToggleRoute(c *gin.Context) {
 	id := c.Param("id")
 
@@ -177,24 +314,119 @@ func (h *Handler) ToggleRoute(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "route not found"})
 		return
 	}
+	if !checkDomain(c, route.Domain) {
+		return
+	}
 
+	var req struct {
+		Version int64 `json:"version"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	version, ok := expectedVersion(c, req.Version)
+	if !ok {
+		return
+	}
+
+	before := *route
 	route.Enabled = !route.Enabled
+	route.Version = version
+	if !h.updateVersioned(c, route) {
+		return
+	}
+	recordChange(c, route.ID, "", &before, route)
+
+	// Auto-sync to Caddy
+	if err := h.syncToCaddy(storage.RevisionActionToggleRoute); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"route":   redactRoute(c, route),
+			"warning": "Route toggled but sync to Caddy failed: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"route": redactRoute(c, route)})
+}
+
+// BulkRouteAction enables, disables or deletes several routes at once.
+// Either every route is changed or, if any ID is unknown or outside the
+// user's domains, none are.
+func (h *Handler) BulkRouteAction(c *gin.Context) {
+	var req struct {
+		Action string   `json:"action" binding:"required"`
+		IDs    []string `json:"ids" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	if err := h.store.UpdateRoute(route); err != nil {
+	switch req.Action {
+	case "enable", "disable", "delete":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "action must be enable, disable or delete"})
+		return
+	}
+
+	user := currentUser(c)
+	var missing, forbidden string
+	var changes []auditChange
+	err := h.store.WithTx(func(tx storage.RouteStore) error {
+		changes = nil
+		for _, id := range req.IDs {
+			route, err := tx.GetRoute(id)
+			if err != nil {
+				missing = id
+				return err
+			}
+			if user != nil && !user.CanManageDomain(route.Domain) {
+				forbidden = domainReason(user, route.Domain)
+				return errDomainForbidden
+			}
+
+			change := auditChange{routeID: id, before: *route}
+			if req.Action == "delete" {
+				err = tx.DeleteRoute(id)
+			} else {
+				route.Enabled = req.Action == "enable"
+				err = tx.UpdateRoute(route)
+				change.after = route
+			}
+			if err != nil {
+				return err
+			}
+			changes = append(changes, change)
+		}
+		return nil
+	})
+	if missing != "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "route not found: " + missing})
+		return
+	}
+	if forbidden != "" {
+		forbid(c, forbidden)
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	for _, ch := range changes {
+		recordChange(c, ch.routeID, "", ch.before, ch.after)
+	}
 
 	// Auto-sync to Caddy
-	if err := h.syncToCaddy(); err != nil {
+	if err := h.syncToCaddy(storage.RevisionActionBulk); err != nil {
 		c.JSON(http.StatusOK, gin.H{
-			"route":   route,
-			"warning": "Route toggled but sync to Caddy failed: " + err.Error(),
+			"affected": len(req.IDs),
+			"warning":  "Routes updated but sync to Caddy failed: " + err.Error(),
 		})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"route": route})
+	c.JSON(http.StatusOK, gin.H{"affected": len(req.IDs)})
 }
 
 // GetConfig returns global configuration
@@ -204,7 +436,7 @@ func (h *Handler) GetConfig(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"config": cfg})
+	c.JSON(http.StatusOK, gin.H{"config": redactGlobalConfig(c, cfg)})
 }
 
 // UpdateConfig updates global configuration
@@ -215,21 +447,98 @@ func (h *Handler) UpdateConfig(c *gin.Context) {
 		return
 	}
 
+	if msg := validateGlobalConfig(&cfg); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	before, err := h.store.GetGlobalConfig()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 	if err := h.store.SetGlobalConfig(&cfg); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	recordChange(c, "", "", before, &cfg)
 
 	c.JSON(http.StatusOK, gin.H{"config": cfg})
 }
 
-// GetStatus returns Caddy health status
+// validateGlobalConfig returns what is wrong with a global config, or ""
+func validateGlobalConfig(cfg *storage.GlobalConfig) string {
+	switch cfg.DriftPolicy {
+	case "", storage.DriftPolicyDetect, storage.DriftPolicyReconcile:
+	default:
+		return "drift_policy must be \"detect\" or \"reconcile\""
+	}
+
+	if admin := cfg.Admin; admin != nil && admin.Remote != nil {
+		if admin.Identity == nil || len(admin.Identity.Identifiers) == 0 {
+			return "remote admin requires an identity with at least one identifier"
+		}
+	}
+
+	return validateRollout(cfg.Rollout)
+}
+
+// GetBaseConfig returns the non-route Caddy config that syncs build on
+func (h *Handler) GetBaseConfig(c *gin.Context) {
+	base, err := h.store.GetBaseConfig()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"base_config": base})
+}
+
+// UpdateBaseConfig replaces the base config. Routes in the body are
+// dropped; they are managed through /routes.
+func (h *Handler) UpdateBaseConfig(c *gin.Context) {
+	raw, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	base, err := config.ExtractBaseConfig(raw)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid base config: " + err.Error()})
+		return
+	}
+
+	before, err := h.store.GetBaseConfig()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.store.SetBaseConfig(base); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	recordChange(c, "", "", before, base)
+	c.JSON(http.StatusOK, gin.H{"base_config": base})
+}
+
+// GetStatus returns Caddy health status. With managed instances it reports
+// each of them instead.
 func (h *Handler) GetStatus(c *gin.Context) {
-	caddyClient := h.getCaddyClient()
+	targets, err := h.syncTargets()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if targets[0].instance != nil {
+		h.getFleetStatus(c, targets)
+		return
+	}
+
+	caddyClient := targets[0].client
 	caddyURL := h.getCaddyURL()
 
 	start := time.Now()
-	err := caddyClient.Health()
+	err = caddyClient.Health()
 	latency := time.Since(start).Milliseconds()
 
 	if err != nil {
@@ -239,10 +548,7 @@ func (h *Handler) GetStatus(c *gin.Context) {
 			"latency":   latency,
 			"admin_url": caddyURL,
 		}
-		if !h.lastSyncedAt.IsZero() {
-			resp["last_synced_at"] = h.lastSyncedAt.Format(time.RFC3339)
-			resp["last_sync_error"] = h.lastSyncError
-		}
+		h.addSyncStatus(resp)
 		c.JSON(http.StatusOK, resp)
 		return
 	}
@@ -260,20 +566,94 @@ func (h *Handler) GetStatus(c *gin.Context) {
 		"admin_url":   caddyURL,
 		"route_count": routeCount,
 	}
-	if !h.lastSyncedAt.IsZero() {
-		resp["last_synced_at"] = h.lastSyncedAt.Format(time.RFC3339)
-		resp["last_sync_error"] = h.lastSyncError
-	}
+	h.addSyncStatus(resp)
 	c.JSON(http.StatusOK, resp)
 }
 
-// SyncToCaddy manually triggers sync to Caddy
+// addSyncStatus adds the last sync result and drift state to a status response
+func (h *Handler) addSyncStatus(resp gin.H) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if st := h.targets[""]; st != nil && !st.syncedAt.IsZero() {
+		resp["last_synced_at"] = st.syncedAt.Format(time.RFC3339)
+		resp["last_sync_error"] = st.syncError
+		resp["last_sync_mode"] = st.syncMode
+	}
+	if h.drift != nil {
+		resp["drift"] = h.drift
+	}
+}
+
+// SyncToCaddy manually triggers sync to Caddy. If Caddy's config was changed
+// by someone else since the last sync it responds 409 with those changes;
+// ?force=true overwrites them. With managed instances the response has a
+// result per instance.
 func (h *Handler) SyncToCaddy(c *gin.Context) {
-	if err := h.syncToCaddy(); err != nil {
+	results, err := h.syncAll(storage.RevisionActionSync, c.Query("force") == "true")
+	if err != nil {
+		var conflict *syncConflictError
+		if errors.As(err, &conflict) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "changes": conflict.Changes})
+			return
+		}
+		var fleet *fleetSyncError
+		if errors.As(err, &fleet) {
+			status := http.StatusBadGateway
+			if fleet.conflictsOnly() {
+				status = http.StatusConflict
+			}
+			c.JSON(status, gin.H{"error": err.Error(), "results": fleet.Results})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp := gin.H{"message": "synced successfully"}
+	if results != nil {
+		resp["results"] = results
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// PreviewConfig returns the config a sync would load, without loading it,
+// and a diff against the config Caddy is currently running. With several
+// managed instances ?instance= selects which one.
+func (h *Handler) PreviewConfig(c *gin.Context) {
+	target, ok := h.requestTarget(c)
+	if !ok {
+		return
+	}
+
+	_, caddyConfig, err := h.buildConfigFor(target.instance)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp := gin.H{"config": caddyConfig}
+
+	live, err := target.client.GetConfig("")
+	if err != nil {
+		// Still useful offline: the rendered config is the main payload
+		resp["live_error"] = err.Error()
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+
+	changes, err := config.Diff(live, caddyConfig)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "synced successfully"})
+	if changes == nil {
+		changes = []config.Change{}
+	}
+
+	resp["diff"] = changes
+	resp["in_sync"] = len(changes) == 0
+	c.JSON(http.StatusOK, resp)
 }
 
 // TestConnection tests connection to a specific Caddy URL
@@ -307,103 +687,255 @@ func (h *Handler) TestConnection(c *gin.Context) {
 	})
 }
 
-// syncToCaddy builds config from routes and loads it into Caddy
-func (h *Handler) syncToCaddy() error {
+// buildConfig builds the Caddy config that a sync to the default Caddy
+// would load, together with the routes it was built from
+func (h *Handler) buildConfig() ([]*storage.Route, *config.CaddyConfig, error) {
+	return h.buildConfigFor(nil)
+}
+
+// buildConfigFor builds the config for a managed instance from the routes
+// deployed to it; a nil instance gets every route. The returned routes are
+// always all of them, so revisions can restore the full route table.
+func (h *Handler) buildConfigFor(instance *storage.Instance) ([]*storage.Route, *config.CaddyConfig, error) {
 	routes, err := h.store.ListRoutes()
 	if err != nil {
-		h.lastSyncedAt = time.Now()
-		h.lastSyncError = err.Error()
-		return err
+		return nil, nil, err
+	}
+
+	deployed := routes
+	if instance != nil {
+		deployed = nil
+		for _, r := range routes {
+			if r.DeployedTo(instance.Name) {
+				deployed = append(deployed, r)
+			}
+		}
 	}
 
 	globalCfg, err := h.store.GetGlobalConfig()
 	if err != nil {
-		h.lastSyncedAt = time.Now()
-		h.lastSyncError = err.Error()
-		return err
+		return nil, nil, err
 	}
 
-	// Build Caddy config from routes
-	caddyConfig := config.BuildCaddyConfig(routes, globalCfg)
-
-	// Pretty print for debugging
-	data, _ := json.MarshalIndent(caddyConfig, "", "  ")
-	_ = data // Could log this if needed
+	base, err := h.store.GetBaseConfig()
+	if err != nil {
+		return nil, nil, err
+	}
 
-	// Load into Caddy using dynamic client
-	err = h.getCaddyClient().LoadConfig(caddyConfig)
-	h.lastSyncedAt = time.Now()
+	servers, err := h.store.ListServers()
 	if err != nil {
-		h.lastSyncError = err.Error()
-	} else {
-		h.lastSyncError = ""
+		return nil, nil, err
 	}
-	return err
+
+	caddyConfig := config.BuildCaddyConfigWithServers(deployed, servers, globalCfg)
+	caddyConfig.Base = base
+	return routes, caddyConfig, nil
 }
 
-// PreviewImport returns what would be imported from Caddy
-func (h *Handler) PreviewImport(c *gin.Context) {
-	raw, err := h.getCaddyClient().GetConfig("")
+// importOptions reads the import mode from the query string.
+// mode is "replace" (default) or "merge"; keep_local (default true) controls
+// whether merge keeps local routes that are missing from Caddy.
+func importOptions(c *gin.Context) (mode string, keepLocal bool, ok bool) {
+	mode = c.DefaultQuery("mode", storage.ImportModeReplace)
+	if mode != storage.ImportModeReplace && mode != storage.ImportModeMerge {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be \"replace\" or \"merge\""})
+		return "", false, false
+	}
+	keepLocal = c.DefaultQuery("keep_local", "true") != "false"
+	return mode, keepLocal, true
+}
+
+// caddyImport is a live Caddy config split into what we store
+type caddyImport struct {
+	routes  []*storage.Route
+	servers []*storage.Server
+	admin   *storage.AdminSettings
+	base    json.RawMessage
+}
+
+// fetchCaddyConfig gets the live config from Caddy and parses it into
+// routes, servers and the remaining base config, writing an error response
+// on failure. With several managed instances ?instance= picks the source.
+func (h *Handler) fetchCaddyConfig(c *gin.Context) (*caddyImport, bool) {
+	target, ok := h.requestTarget(c)
+	if !ok {
+		return nil, false
+	}
+
+	raw, err := target.client.GetConfig("")
 	if err != nil {
 		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to connect to Caddy: " + err.Error()})
-		return
+		return nil, false
 	}
 
 	var caddyConfig config.CaddyConfig
 	if err := json.Unmarshal(raw, &caddyConfig); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse Caddy response: " + err.Error()})
-		return
+		return nil, false
 	}
 
 	routes, err := config.ParseCaddyConfig(&caddyConfig)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse Caddy config: " + err.Error()})
-		return
+		return nil, false
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"routes": routes,
-		"count":  len(routes),
-	})
+	base, err := config.ExtractBaseConfig(raw)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse Caddy config: " + err.Error()})
+		return nil, false
+	}
+	// Routes new to us belong to the instance they were found on
+	if target.instance != nil {
+		for _, r := range routes {
+			r.Instances = []string{target.name}
+		}
+	}
+
+	return &caddyImport{
+		routes:  routes,
+		servers: config.ParseCaddyServers(&caddyConfig),
+		admin:   config.ParseAdminSettings(&caddyConfig),
+		base:    base,
+	}, true
 }
 
-// ImportFromCaddy pulls config from Caddy and overwrites local routes
-func (h *Handler) ImportFromCaddy(c *gin.Context) {
-	// 1. Get Caddy config
-	raw, err := h.getCaddyClient().GetConfig("")
+// planImport compares incoming routes with the routes in rs according to
+// mode. It also returns the routes it compared against.
+func planImport(rs storage.RouteStore, incoming []*storage.Route, mode string, keepLocal bool) (*storage.ImportPlan, []*storage.Route, error) {
+	existing, err := rs.ListRoutes()
 	if err != nil {
-		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to connect to Caddy: " + err.Error()})
+		return nil, nil, err
+	}
+	if mode == storage.ImportModeMerge {
+		return storage.PlanMerge(existing, incoming, keepLocal), existing, nil
+	}
+	return storage.PlanReplace(existing, incoming), existing, nil
+}
+
+// recordImport records an audit event for every route an import created,
+// updated or deleted. existing are the routes before the import.
+func recordImport(c *gin.Context, existing []*storage.Route, plan *storage.ImportPlan, result *storage.ImportResult) {
+	before := make(map[string]*storage.Route, len(existing))
+	for _, r := range existing {
+		before[r.ID] = r
+	}
+	after := make(map[string]*storage.Route, len(plan.Create)+len(plan.Update))
+	for _, r := range slices.Concat(plan.Create, plan.Update) {
+		after[r.ID] = r
+	}
+
+	for _, d := range result.Details {
+		switch d.Action {
+		case storage.ImportActionCreated:
+			recordChange(c, d.RouteID, "", nil, after[d.RouteID])
+		case storage.ImportActionUpdated:
+			recordChange(c, d.RouteID, "", before[d.RouteID], after[d.RouteID])
+		case storage.ImportActionDeleted:
+			recordChange(c, d.RouteID, "", before[d.RouteID], nil)
+		}
+	}
+}
+
+// PreviewImport returns what would be imported from Caddy
+func (h *Handler) PreviewImport(c *gin.Context) {
+	mode, keepLocal, ok := importOptions(c)
+	if !ok {
 		return
 	}
 
-	// 2. Parse Caddy config
-	var caddyConfig config.CaddyConfig
-	if err := json.Unmarshal(raw, &caddyConfig); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse Caddy response: " + err.Error()})
+	live, ok := h.fetchCaddyConfig(c)
+	if !ok {
 		return
 	}
 
-	routes, err := config.ParseCaddyConfig(&caddyConfig)
+	plan, _, err := planImport(h.store, live.routes, mode, keepLocal)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse Caddy config: " + err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"routes":      live.routes,
+		"count":       len(live.routes),
+		"servers":     live.servers,
+		"admin":       live.admin,
+		"mode":        mode,
+		"base_config": live.base,
+		"plan":        planSummary(plan),
+	})
+}
+
+// planSummary counts what an import plan would do
+func planSummary(plan *storage.ImportPlan) gin.H {
+	return gin.H{
+		"create":    len(plan.Create),
+		"update":    len(plan.Update),
+		"unchanged": len(plan.Unchanged),
+		"delete":    len(plan.Delete),
+		"keep":      len(plan.Keep),
+	}
+}
+
+// ImportFromCaddy pulls config from Caddy into local routes. In replace mode
+// local routes are overwritten; in merge mode routes are matched by
+// domain+path and only changed ones are updated.
+func (h *Handler) ImportFromCaddy(c *gin.Context) {
+	mode, keepLocal, ok := importOptions(c)
+	if !ok {
 		return
 	}
 
-	// 3. Overwrite local storage
-	if err := h.store.DeleteAllRoutes(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear routes: " + err.Error()})
+	// 1. Get and parse Caddy config
+	live, ok := h.fetchCaddyConfig(c)
+	if !ok {
 		return
 	}
 
-	count := 0
-	for _, r := range routes {
-		if err := h.store.CreateRoute(r); err == nil {
-			count++
+	// 2. Compare with local storage and apply in a single transaction,
+	// adopting Caddy's servers and non-route config for future syncs
+	var plan *storage.ImportPlan
+	var existing []*storage.Route
+	var result *storage.ImportResult
+	err := h.store.WithTx(func(tx storage.RouteStore) error {
+		var err error
+		if plan, existing, err = planImport(tx, live.routes, mode, keepLocal); err != nil {
+			return err
 		}
+		result = storage.ApplyImport(tx, plan)
+
+		if mode == storage.ImportModeMerge {
+			err = mergeServers(tx, live.servers)
+		} else {
+			err = replaceServers(tx, live.servers)
+		}
+		if err != nil {
+			return err
+		}
+
+		// Keep Caddy's admin endpoint where it is
+		if live.admin != nil {
+			global, err := tx.GetGlobalConfig()
+			if err != nil {
+				return err
+			}
+			global.Admin = live.admin
+			if err := tx.SetGlobalConfig(global); err != nil {
+				return err
+			}
+		}
+		return tx.SetBaseConfig(live.base)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import routes: " + err.Error()})
+		return
 	}
+	recordImport(c, existing, plan, result)
 
 	c.JSON(http.StatusOK, gin.H{
-		"imported": count,
+		"imported": result.Created + result.Updated,
+		"mode":     mode,
+		"result":   result,
 		"message":  "Configuration imported successfully",
 	})
 }
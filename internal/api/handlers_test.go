@@ -2,15 +2,19 @@
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
-	"os"
-	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/gin-gonic/gin"
 
+	"github.com/ArtemStepanov/caddy-admin-ui/internal/config"
 	"github.com/ArtemStepanov/caddy-admin-ui/internal/storage"
 )
 
@@ -19,34 +23,215 @@ func init() {
 	gin.SetMode(gin.TestMode)
 }
 
-// setupTestRouter creates a test router with a temporary database
-func setupTestRouter(t *testing.T) (*gin.Engine, *storage.SQLiteStorage, func()) {
+// setupTestRouter creates a test router backed by an in-memory store
+func setupTestRouter(t *testing.T) (*gin.Engine, storage.Store, func()) {
 	t.Helper()
 
-	tmpDir, err := os.MkdirTemp("", "api_test")
+	store, err := storage.NewJSONStorage("")
 	if err != nil {
-		t.Fatalf("Failed to create temp dir: %v", err)
-	}
-
-	dbPath := filepath.Join(tmpDir, "test.db")
-	store, err := storage.NewSQLiteStorage(dbPath)
-	if err != nil {
-		os.RemoveAll(tmpDir)
 		t.Fatalf("Failed to create storage: %v", err)
 	}
 
 	router := gin.New()
 	// Use a fake Caddy URL that will fail - tests should handle sync errors gracefully
-	SetupRoutes(router, store, "http://localhost:29999")
+	SetupRoutes(router, store, "http://localhost:29999", nil)
 
 	cleanup := func() {
 		store.Close()
-		os.RemoveAll(tmpDir)
 	}
 
 	return router, store, cleanup
 }
 
+// fakeCaddy is a minimal stand-in for the Caddy admin API that accepts
+// /load and POST /config/ and serves the last loaded config from /config/.
+// Like Caddy, it ignores If-Match on /load.
+type fakeCaddy struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	config json.RawMessage
+	loads  int      // full replaces, through /load or POST /config/
+	ops    []string // per-route changes, e.g. "PATCH /id/<route-id>"
+
+	// With failOps, route changes fail once okOps more have succeeded, and
+	// the next failLoads loads fail, so a push breaks off halfway
+	failOps   bool
+	okOps     int
+	failLoads int
+
+	// editAfterGet, if set, replaces the config right after the next GET,
+	// like an edit that lands between a sync's read and its write
+	editAfterGet json.RawMessage
+}
+
+func newFakeCaddy(t *testing.T) *fakeCaddy {
+	t.Helper()
+
+	fc := &fakeCaddy{config: json.RawMessage("null")}
+	fc.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fc.mu.Lock()
+		defer fc.mu.Unlock()
+
+		if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && ifMatch != fc.etag() && r.URL.Path != "/load" {
+			http.Error(w, `{"error":"If-Match header did not match current config hash"}`, http.StatusPreconditionFailed)
+			return
+		}
+
+		switch {
+		case r.Method == http.MethodPost && (r.URL.Path == "/load" || r.URL.Path == "/config/"):
+			if fc.failLoads > 0 {
+				fc.failLoads--
+				http.Error(w, `{"error":"load failed"}`, http.StatusInternalServerError)
+				return
+			}
+			var body json.RawMessage
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				http.Error(w, `{"error":"invalid JSON"}`, http.StatusBadRequest)
+				return
+			}
+			fc.config = body
+			fc.loads++
+			w.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodGet && r.URL.Path == "/config/":
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Etag", fc.etag())
+			w.Write(fc.config)
+			if fc.editAfterGet != nil {
+				fc.config, fc.editAfterGet = fc.editAfterGet, nil
+			}
+		default:
+			if fc.failOps {
+				if fc.okOps == 0 {
+					http.Error(w, `{"error":"route change failed"}`, http.StatusInternalServerError)
+					return
+				}
+				fc.okOps--
+			}
+			if err := fc.applyRouteChange(r); err != nil {
+				http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusNotFound)
+				return
+			}
+			fc.ops = append(fc.ops, r.Method+" "+r.URL.Path)
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	t.Cleanup(fc.Close)
+	return fc
+}
+
+// etag mimics Caddy's ETag for /config/: the path and a hash of the config
+func (fc *fakeCaddy) etag() string {
+	return fmt.Sprintf(`"/config/ %x"`, sha256.Sum256(fc.config))
+}
+
+// applyRouteChange handles the subset of config mutations used by
+// incremental sync: PATCH/DELETE on /id/<id> and POST/PUT on a server's
+// route list
+func (fc *fakeCaddy) applyRouteChange(r *http.Request) error {
+	var doc map[string]any
+	if err := json.Unmarshal(fc.config, &doc); err != nil || doc == nil {
+		return fmt.Errorf("no config loaded")
+	}
+	apps, _ := doc["apps"].(map[string]any)
+	httpApp, _ := apps["http"].(map[string]any)
+	servers, _ := httpApp["servers"].(map[string]any)
+
+	var body any
+	if r.Method == http.MethodPost || r.Method == http.MethodPut || r.Method == http.MethodPatch {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			return err
+		}
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	found := false
+	switch {
+	case len(parts) == 2 && parts[0] == "id":
+		for _, s := range servers {
+			srv := s.(map[string]any)
+			routes, _ := srv["routes"].([]any)
+			for i, route := range routes {
+				if route.(map[string]any)["@id"] != parts[1] {
+					continue
+				}
+				found = true
+				if r.Method == http.MethodDelete {
+					srv["routes"] = append(routes[:i], routes[i+1:]...)
+				} else if r.Method == http.MethodPatch {
+					routes[i] = body
+				}
+				break
+			}
+		}
+	case len(parts) >= 6 && parts[0] == "config" && parts[5] == "routes":
+		srv, ok := servers[parts[4]].(map[string]any)
+		if !ok {
+			break
+		}
+		routes, _ := srv["routes"].([]any)
+		found = true
+		if r.Method == http.MethodPost && len(parts) == 6 {
+			srv["routes"] = append(routes, body)
+		} else if r.Method == http.MethodPut && len(parts) == 7 {
+			idx, err := strconv.Atoi(parts[6])
+			if err != nil || idx < 0 || idx >= len(routes) {
+				return fmt.Errorf("index out of bounds")
+			}
+			srv["routes"] = append(routes[:idx], append([]any{body}, routes[idx:]...)...)
+		} else {
+			found = false
+		}
+	}
+	if !found {
+		return fmt.Errorf("unknown path %s", r.URL.Path)
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	fc.config = data
+	return nil
+}
+
+// routeOps returns the per-route changes applied since the last call
+func (fc *fakeCaddy) routeOps() []string {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	ops := fc.ops
+	fc.ops = nil
+	return ops
+}
+
+// loadedConfig returns the config most recently loaded into the fake
+func (fc *fakeCaddy) loadedConfig() json.RawMessage {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.config
+}
+
+// setConfig replaces the live config, simulating an edit made outside the UI
+func (fc *fakeCaddy) setConfig(cfg json.RawMessage) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.config = cfg
+}
+
+// setupTestRouterWithCaddy creates a test router whose global config points
+// at a fake Caddy admin API
+func setupTestRouterWithCaddy(t *testing.T) (*gin.Engine, storage.Store, *fakeCaddy, func()) {
+	t.Helper()
+
+	router, store, cleanup := setupTestRouter(t)
+	fc := newFakeCaddy(t)
+	if err := store.SetGlobalConfig(&storage.GlobalConfig{CaddyAdminURL: fc.URL}); err != nil {
+		cleanup()
+		t.Fatalf("Failed to set global config: %v", err)
+	}
+	return router, store, fc, cleanup
+}
+
 func TestListRoutes_Empty(t *testing.T) {
 	router, _, cleanup := setupTestRouter(t)
 	defer cleanup()
@@ -213,6 +398,7 @@ func TestUpdateRoute_Success(t *testing.T) {
 	store.CreateRoute(route)
 
 	body := `{
+		"version": 1,
 		"domain": "updated.example.com",
 		"handler_type": "reverse_proxy",
 		"config": {"upstreams": ["localhost:9090"]},
@@ -250,6 +436,7 @@ func TestUpdateRoute_PreservesEnabled(t *testing.T) {
 
 	// Update without "enabled" field
 	body := `{
+		"version": 1,
 		"domain": "example.com",
 		"handler_type": "reverse_proxy",
 		"config": {"upstreams": ["localhost:9090"]}
@@ -292,6 +479,7 @@ func TestUpdateRoute_PreservesRawCaddyRoute(t *testing.T) {
 
 	// Update
 	body := `{
+		"version": 1,
 		"domain": "example.com",
 		"handler_type": "reverse_proxy",
 		"config": {}
@@ -313,6 +501,60 @@ func TestUpdateRoute_PreservesRawCaddyRoute(t *testing.T) {
 	}
 }
 
+func TestUpdateRoute_PreservesBasicAuthPassword(t *testing.T) {
+	router, store, cleanup := setupTestRouter(t)
+	defer cleanup()
+
+	route := &storage.Route{
+		Domain:      "example.com",
+		HandlerType: "reverse_proxy",
+		Config:      json.RawMessage(`{"upstreams":["localhost:8080"]}`),
+		Enabled:     true,
+		BasicAuth: &storage.BasicAuthConfig{
+			Enabled: true,
+			Users:   []storage.BasicAuthUser{{Username: "admin", Password: "secret"}},
+		},
+	}
+	store.CreateRoute(route)
+	stored, _ := store.GetRoute(route.ID)
+	hash := stored.BasicAuth.Users[0].Password
+
+	// Existing user without a password, new user with a plaintext password
+	body := `{
+		"version": 1,
+		"domain": "example.com",
+		"handler_type": "reverse_proxy",
+		"config": {"upstreams": ["localhost:8080"]},
+		"basic_auth": {
+			"enabled": true,
+			"users": [
+				{"username": "admin", "password": ""},
+				{"username": "ops", "password": "hunter2"}
+			]
+		}
+	}`
+
+	req := httptest.NewRequest("PUT", "/api/routes/"+route.ID, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	updated, _ := store.GetRoute(route.ID)
+	if len(updated.BasicAuth.Users) != 2 {
+		t.Fatalf("Expected 2 users, got %d", len(updated.BasicAuth.Users))
+	}
+	if updated.BasicAuth.Users[0].Password != hash {
+		t.Error("Expected admin password hash to be preserved")
+	}
+	if !storage.IsBcryptHash(updated.BasicAuth.Users[1].Password) {
+		t.Errorf("Expected ops password to be hashed, got %s", updated.BasicAuth.Users[1].Password)
+	}
+}
+
 func TestUpdateRoute_NotFound(t *testing.T) {
 	router, _, cleanup := setupTestRouter(t)
 	defer cleanup()
@@ -358,6 +600,11 @@ func TestDeleteRoute_Success(t *testing.T) {
 	if err == nil {
 		t.Error("Expected route to be deleted")
 	}
+
+	w = doJSON(router, "DELETE", "/api/routes/"+route.ID, "")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected deleting a missing route to return %d, got %d", http.StatusNotFound, w.Code)
+	}
 }
 
 func TestToggleRoute(t *testing.T) {
@@ -375,6 +622,7 @@ func TestToggleRoute(t *testing.T) {
 
 	// Toggle (should disable)
 	req := httptest.NewRequest("POST", "/api/routes/"+route.ID+"/toggle", nil)
+	req.Header.Set("If-Match", `"1"`)
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
 
@@ -387,8 +635,9 @@ func TestToggleRoute(t *testing.T) {
 		t.Error("Expected route to be disabled after toggle")
 	}
 
-	// Toggle again (should enable)
-	req = httptest.NewRequest("POST", "/api/routes/"+route.ID+"/toggle", nil)
+	// Toggle again (should enable), passing the version in the body
+	req = httptest.NewRequest("POST", "/api/routes/"+route.ID+"/toggle", bytes.NewBufferString(`{"version": 2}`))
+	req.Header.Set("Content-Type", "application/json")
 	w = httptest.NewRecorder()
 	router.ServeHTTP(w, req)
 
@@ -398,6 +647,76 @@ func TestToggleRoute(t *testing.T) {
 	}
 }
 
+func TestUpdateRoute_VersionConflict(t *testing.T) {
+	router, store, cleanup := setupTestRouter(t)
+	defer cleanup()
+
+	route := &storage.Route{
+		Domain:      "example.com",
+		HandlerType: "reverse_proxy",
+		Config:      json.RawMessage(`{"upstreams":["localhost:8080"]}`),
+		Enabled:     true,
+	}
+	store.CreateRoute(route)
+
+	update := func(body, ifMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PUT", "/api/routes/"+route.ID, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	body := func(upstream string) string {
+		return `{"domain": "example.com", "handler_type": "reverse_proxy", "config": {"upstreams": ["` + upstream + `"]}}`
+	}
+
+	t.Run("missing version", func(t *testing.T) {
+		if w := update(body("localhost:1"), ""); w.Code != http.StatusPreconditionRequired {
+			t.Errorf("Expected status %d, got %d", http.StatusPreconditionRequired, w.Code)
+		}
+	})
+
+	t.Run("first editor wins", func(t *testing.T) {
+		w := update(body("localhost:1"), `"1"`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		if etag := w.Header().Get("ETag"); etag != `"2"` {
+			t.Errorf("Expected ETag \"2\", got %s", etag)
+		}
+	})
+
+	t.Run("second editor gets current row", func(t *testing.T) {
+		w := update(body("localhost:2"), `"1"`)
+		if w.Code != http.StatusConflict {
+			t.Fatalf("Expected status %d, got %d", http.StatusConflict, w.Code)
+		}
+		var resp struct {
+			Route storage.Route `json:"route"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if resp.Route.Version != 2 || !bytes.Contains(resp.Route.Config, []byte("localhost:1")) {
+			t.Errorf("Expected current route in conflict response, got %+v", resp.Route)
+		}
+	})
+
+	t.Run("stale toggle", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/api/routes/"+route.ID+"/toggle", bytes.NewBufferString(`{"version": 1}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusConflict {
+			t.Errorf("Expected status %d, got %d", http.StatusConflict, w.Code)
+		}
+		if current, _ := store.GetRoute(route.ID); !current.Enabled {
+			t.Error("Expected stale toggle to leave the route enabled")
+		}
+	})
+}
+
 func TestToggleRoute_NotFound(t *testing.T) {
 	router, _, cleanup := setupTestRouter(t)
 	defer cleanup()
@@ -465,6 +784,74 @@ func TestUpdateConfig(t *testing.T) {
 	}
 }
 
+func TestUpdateConfig_AdminSettings(t *testing.T) {
+	router, store, fc, cleanup := setupTestRouterWithCaddy(t)
+	defer cleanup()
+
+	remoteOnly := `{"caddy_admin_url": "` + fc.URL + `", "admin": {"remote": {"listen": ":2021"}}}`
+	if w := doJSON(router, "PUT", "/api/config", remoteOnly); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for remote admin without identity, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	body := `{"caddy_admin_url": "` + fc.URL + `", "admin": {"listen": "localhost:2019", "enforce_origin": true, "origins": ["localhost:2019"]}}`
+	if w := doJSON(router, "PUT", "/api/config", body); w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	store.CreateRoute(&storage.Route{Domain: "example.com", HandlerType: "reverse_proxy", Config: json.RawMessage(`{"upstreams":["localhost:8080"]}`), Enabled: true})
+	if w := doJSON(router, "POST", "/api/sync", ""); w.Code != http.StatusOK {
+		t.Fatalf("Sync failed: %d %s", w.Code, w.Body.String())
+	}
+
+	var loaded config.CaddyConfig
+	json.Unmarshal(fc.loadedConfig(), &loaded)
+	if loaded.Admin == nil || loaded.Admin.Listen != "localhost:2019" || !loaded.Admin.EnforceOrigin {
+		t.Errorf("Expected configured admin settings to be loaded, got %+v", loaded.Admin)
+	}
+}
+
+func TestAdminOrigin(t *testing.T) {
+	tests := []struct {
+		admin    *storage.AdminSettings
+		expected string
+	}{
+		{nil, ""},
+		{&storage.AdminSettings{Origins: []string{"localhost:2019"}}, ""},
+		{&storage.AdminSettings{EnforceOrigin: true}, ""},
+		{&storage.AdminSettings{EnforceOrigin: true, Origins: []string{"localhost:2019"}}, "http://localhost:2019"},
+		{&storage.AdminSettings{EnforceOrigin: true, Origins: []string{"https://admin.example.com"}}, "https://admin.example.com"},
+	}
+	for _, tt := range tests {
+		if got := adminOrigin(tt.admin); got != tt.expected {
+			t.Errorf("adminOrigin(%+v) = %q, expected %q", tt.admin, got, tt.expected)
+		}
+	}
+}
+
+func TestImportFromCaddy_AdminSettings(t *testing.T) {
+	router, store, fc, cleanup := setupTestRouterWithCaddy(t)
+	defer cleanup()
+
+	fc.setConfig(json.RawMessage(`{"admin": {"listen": "unix//run/caddy/admin.sock", "config": {"persist": false}}, "apps": {}}`))
+	if w := doJSON(router, "POST", "/api/import", ""); w.Code != http.StatusOK {
+		t.Fatalf("Import failed: %d %s", w.Code, w.Body.String())
+	}
+
+	cfg, _ := store.GetGlobalConfig()
+	if cfg.Admin == nil || cfg.Admin.Listen != "unix//run/caddy/admin.sock" {
+		t.Errorf("Expected admin listen address to be imported, got %+v", cfg.Admin)
+	}
+	if cfg.CaddyAdminURL != fc.URL {
+		t.Errorf("Expected admin URL to be kept, got %s", cfg.CaddyAdminURL)
+	}
+
+	// Admin options we don't manage stay in the base config
+	base, _ := store.GetBaseConfig()
+	if string(base) != `{"admin":{"config":{"persist":false}},"apps":{}}` {
+		t.Errorf("Unexpected base config: %s", base)
+	}
+}
+
 func TestGetStatus(t *testing.T) {
 	router, _, cleanup := setupTestRouter(t)
 	defer cleanup()
@@ -549,19 +936,31 @@ func TestTestConnection_MissingURL(t *testing.T) {
 }
 
 func TestCORSHeaders(t *testing.T) {
-	router, _, cleanup := setupTestRouter(t)
-	defer cleanup()
-
-	req := httptest.NewRequest("OPTIONS", "/api/routes", nil)
-	w := httptest.NewRecorder()
-	router.ServeHTTP(w, req)
+	store, _ := storage.NewJSONStorage("")
+	router := gin.New()
+	SetupRoutes(router, store, "http://localhost:29999", []string{"https://ops.example.com"})
+
+	preflight := func(origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("OPTIONS", "/api/routes", nil)
+		req.Header.Set("Origin", origin)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
 
+	w := preflight("https://ops.example.com")
 	if w.Code != 204 {
 		t.Errorf("Expected status 204 for OPTIONS, got %d", w.Code)
 	}
+	if w.Header().Get("Access-Control-Allow-Origin") != "https://ops.example.com" || w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Errorf("Expected CORS headers for allowed origin, got %v", w.Header())
+	}
+	if !strings.Contains(w.Header().Get("Access-Control-Allow-Headers"), "If-Match") || w.Header().Get("Access-Control-Expose-Headers") != "ETag" {
+		t.Errorf("Expected If-Match to be allowed and ETag exposed, got %v", w.Header())
+	}
 
-	if w.Header().Get("Access-Control-Allow-Origin") != "*" {
-		t.Error("Expected CORS header")
+	if w := preflight("https://evil.example.com"); w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Expected no CORS header for other origins, got %q", w.Header().Get("Access-Control-Allow-Origin"))
 	}
 }
 
@@ -624,3 +1023,553 @@ func TestCreateRoute_WithHeaders(t *testing.T) {
 		t.Errorf("Expected status %d, got %d. Body: %s", http.StatusCreated, w.Code, w.Body.String())
 	}
 }
+
+func TestCreateRoute_HeadersPersisted(t *testing.T) {
+	router, _, cleanup := setupTestRouter(t)
+	defer cleanup()
+
+	body := `{
+		"domain": "example.com",
+		"handler_type": "reverse_proxy",
+		"config": {"upstreams": ["localhost:8080"]},
+		"headers": {"set": {"X-Frame-Options": "DENY"}}
+	}`
+
+	req := httptest.NewRequest("POST", "/api/routes", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var created struct {
+		Route storage.Route `json:"route"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &created)
+
+	req = httptest.NewRequest("GET", "/api/routes/"+created.Route.ID, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var fetched struct {
+		Route storage.Route `json:"route"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &fetched)
+
+	if fetched.Route.Headers == nil || fetched.Route.Headers.Set["X-Frame-Options"] != "DENY" {
+		t.Errorf("Expected headers to survive a round-trip, got %+v", fetched.Route.Headers)
+	}
+}
+
+func TestPreviewConfig(t *testing.T) {
+	router, store, _, cleanup := setupTestRouterWithCaddy(t)
+	defer cleanup()
+
+	store.CreateRoute(&storage.Route{
+		Domain:      "example.com",
+		HandlerType: "reverse_proxy",
+		Config:      json.RawMessage(`{"upstreams":["localhost:8080"]}`),
+		Enabled:     true,
+	})
+
+	preview := func() map[string]any {
+		req := httptest.NewRequest("GET", "/api/config/preview", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+		}
+		var response map[string]any
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return response
+	}
+
+	// Nothing loaded yet: preview differs from live config
+	response := preview()
+	if response["config"] == nil {
+		t.Fatal("Expected rendered config in response")
+	}
+	if response["in_sync"] != false {
+		t.Errorf("Expected in_sync=false before sync, got %v", response["in_sync"])
+	}
+	if diff, _ := response["diff"].([]any); len(diff) == 0 {
+		t.Error("Expected diff before sync")
+	}
+
+	// After a sync the live config matches
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/sync", nil))
+
+	response = preview()
+	if response["in_sync"] != true {
+		t.Errorf("Expected in_sync=true after sync, got %v (diff %v)", response["in_sync"], response["diff"])
+	}
+}
+
+func TestPreviewConfig_CaddyOffline(t *testing.T) {
+	router, store, cleanup := setupTestRouter(t)
+	defer cleanup()
+
+	store.SetGlobalConfig(&storage.GlobalConfig{CaddyAdminURL: "http://localhost:29999"})
+
+	req := httptest.NewRequest("GET", "/api/config/preview", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var response map[string]any
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if response["config"] == nil {
+		t.Error("Expected rendered config even when Caddy is offline")
+	}
+	if response["live_error"] == nil {
+		t.Error("Expected live_error when Caddy is offline")
+	}
+}
+
+// liveConfigWithRoutes is a Caddy config serving a.example.com and b.example.com
+const liveConfigWithRoutes = `{
+	"apps": {"http": {"servers": {"srv0": {
+		"listen": [":443"],
+		"routes": [
+			{"match": [{"host": ["a.example.com"]}], "handle": [{"handler": "reverse_proxy", "upstreams": [{"dial": "localhost:9000"}]}]},
+			{"match": [{"host": ["b.example.com"]}], "handle": [{"handler": "file_server", "root": "/srv"}]}
+		]
+	}}}}
+}`
+
+func TestImportFromCaddy_Replace(t *testing.T) {
+	router, store, fc, cleanup := setupTestRouterWithCaddy(t)
+	defer cleanup()
+
+	fc.setConfig(json.RawMessage(liveConfigWithRoutes))
+	store.CreateRoute(&storage.Route{Domain: "local.example.com", HandlerType: "reverse_proxy", Config: json.RawMessage(`{}`), Enabled: true})
+
+	req := httptest.NewRequest("POST", "/api/import", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response struct {
+		Imported int                  `json:"imported"`
+		Result   storage.ImportResult `json:"result"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+
+	if response.Imported != 2 || response.Result.Deleted != 1 {
+		t.Errorf("Expected 2 imported and 1 deleted, got %+v", response)
+	}
+
+	routes, _ := store.ListRoutes()
+	if len(routes) != 2 {
+		t.Errorf("Expected local routes to be replaced, got %d routes", len(routes))
+	}
+}
+
+func TestImportFromCaddy_KeepsBaseConfig(t *testing.T) {
+	router, _, fc, cleanup := setupTestRouterWithCaddy(t)
+	defer cleanup()
+
+	fc.setConfig(json.RawMessage(`{
+		"logging": {"logs": {"default": {"level": "DEBUG"}}},
+		"apps": {
+			"tls": {"automation": {"policies": [{"issuers": [{"module": "acme", "email": "ops@example.com"}]}]}},
+			"http": {"servers": {"srv0": {
+				"listen": [":443", ":80"],
+				"timeouts": {"read_body": "10s"},
+				"routes": [{"match": [{"host": ["a.example.com"]}], "handle": [{"handler": "static_response", "body": "hi"}]}]
+			}}}
+		}
+	}`))
+
+	req := httptest.NewRequest("POST", "/api/import", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Import failed: %d %s", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/api/config/base", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if !strings.Contains(w.Body.String(), "ops@example.com") || strings.Contains(w.Body.String(), "a.example.com") {
+		t.Errorf("Expected base config without routes, got %s", w.Body.String())
+	}
+
+	// Adding a route loads a new config; everything outside the routes survives
+	body := `{"domain": "new.example.com", "handler_type": "reverse_proxy", "config": {"upstreams": ["localhost:8080"]}}`
+	req = httptest.NewRequest("POST", "/api/routes", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Create failed: %d %s", w.Code, w.Body.String())
+	}
+
+	loaded := string(fc.loadedConfig())
+	for _, want := range []string{"ops@example.com", `"level":"DEBUG"`, `"read_body":"10s"`, "new.example.com", "a.example.com"} {
+		if !strings.Contains(loaded, want) {
+			t.Errorf("Expected loaded config to contain %s, got %s", want, loaded)
+		}
+	}
+}
+
+func TestUpdateBaseConfig(t *testing.T) {
+	router, _, cleanup := setupTestRouter(t)
+	defer cleanup()
+
+	body := `{"apps": {"http": {"servers": {"srv0": {"routes": [{"handle": []}]}}}, "pki": {}}}`
+	req := httptest.NewRequest("PUT", "/api/config/base", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/api/config/base", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if !strings.Contains(w.Body.String(), "pki") || strings.Contains(w.Body.String(), "routes") {
+		t.Errorf("Expected routes to be stripped from base config, got %s", w.Body.String())
+	}
+
+	req = httptest.NewRequest("PUT", "/api/config/base", bytes.NewBufferString(`[1, 2]`))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for non-object, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestImportFromCaddy_Merge(t *testing.T) {
+	router, store, fc, cleanup := setupTestRouterWithCaddy(t)
+	defer cleanup()
+
+	fc.setConfig(json.RawMessage(liveConfigWithRoutes))
+
+	existing := &storage.Route{Domain: "a.example.com", HandlerType: "reverse_proxy", Config: json.RawMessage(`{"upstreams":["localhost:8080"]}`), Enabled: true}
+	local := &storage.Route{Domain: "local.example.com", HandlerType: "reverse_proxy", Config: json.RawMessage(`{}`), Enabled: true}
+	store.CreateRoute(existing)
+	store.CreateRoute(local)
+
+	req := httptest.NewRequest("POST", "/api/import?mode=merge", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response struct {
+		Result storage.ImportResult `json:"result"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+
+	r := response.Result
+	if r.Created != 1 || r.Updated != 1 || r.Skipped != 1 || r.Failed != 0 || r.Deleted != 0 {
+		t.Errorf("Unexpected import counts: %+v", r)
+	}
+
+	updated, err := store.GetRoute(existing.ID)
+	if err != nil {
+		t.Fatalf("Expected matched route to keep its ID: %v", err)
+	}
+	if !strings.Contains(string(updated.Config), "localhost:9000") {
+		t.Errorf("Expected matched route to be updated, got %s", updated.Config)
+	}
+	if _, err := store.GetRoute(local.ID); err != nil {
+		t.Error("Expected local-only route to be kept")
+	}
+
+	t.Run("second import is a no-op", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/api/import?mode=merge", nil))
+
+		var again struct {
+			Result storage.ImportResult `json:"result"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &again)
+		if again.Result.Created != 0 || again.Result.Updated != 0 || again.Result.Skipped != 3 {
+			t.Errorf("Expected everything to be skipped, got %+v", again.Result)
+		}
+	})
+
+	t.Run("drop local", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/api/import?mode=merge&keep_local=false", nil))
+
+		if _, err := store.GetRoute(local.ID); err == nil {
+			t.Error("Expected local-only route to be deleted with keep_local=false")
+		}
+	})
+}
+
+func TestImportFromCaddy_InvalidMode(t *testing.T) {
+	router, _, cleanup := setupTestRouter(t)
+	defer cleanup()
+
+	req := httptest.NewRequest("POST", "/api/import?mode=upsert", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestPreviewImport_MergePlan(t *testing.T) {
+	router, store, fc, cleanup := setupTestRouterWithCaddy(t)
+	defer cleanup()
+
+	fc.setConfig(json.RawMessage(liveConfigWithRoutes))
+	store.CreateRoute(&storage.Route{Domain: "a.example.com", HandlerType: "reverse_proxy", Config: json.RawMessage(`{}`), Enabled: true})
+
+	req := httptest.NewRequest("POST", "/api/import-preview?mode=merge", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var response struct {
+		Count int            `json:"count"`
+		Plan  map[string]int `json:"plan"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+
+	if response.Count != 2 || response.Plan["create"] != 1 || response.Plan["update"] != 1 {
+		t.Errorf("Unexpected preview: %+v", response)
+	}
+}
+
+func TestBulkRouteAction(t *testing.T) {
+	router, store, cleanup := setupTestRouter(t)
+	defer cleanup()
+
+	var ids []string
+	for _, domain := range []string{"a.example.com", "b.example.com", "c.example.com"} {
+		route := &storage.Route{Domain: domain, HandlerType: "reverse_proxy", Config: json.RawMessage(`{}`), Enabled: true}
+		store.CreateRoute(route)
+		ids = append(ids, route.ID)
+	}
+
+	bulk := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/routes/bulk", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("disable", func(t *testing.T) {
+		w := bulk(`{"action": "disable", "ids": ["` + ids[0] + `", "` + ids[1] + `"]}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+		}
+		for i, id := range ids {
+			route, _ := store.GetRoute(id)
+			if route.Enabled != (i == 2) {
+				t.Errorf("Unexpected enabled state for route %d: %v", i, route.Enabled)
+			}
+		}
+	})
+
+	t.Run("unknown id changes nothing", func(t *testing.T) {
+		w := bulk(`{"action": "delete", "ids": ["` + ids[2] + `", "missing"]}`)
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+		}
+		if _, err := store.GetRoute(ids[2]); err != nil {
+			t.Error("Expected delete to be rolled back")
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		w := bulk(`{"action": "delete", "ids": ["` + ids[2] + `"]}`)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+		}
+		routes, _ := store.ListRoutes()
+		if len(routes) != 2 {
+			t.Errorf("Expected 2 routes after delete, got %d", len(routes))
+		}
+	})
+
+	t.Run("invalid action", func(t *testing.T) {
+		if w := bulk(`{"action": "explode", "ids": []}`); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+		}
+	})
+}
+
+func TestSyncToCaddy_Incremental(t *testing.T) {
+	router, store, fc, cleanup := setupTestRouterWithCaddy(t)
+	defer cleanup()
+
+	send := func(method, path, body string) {
+		t.Helper()
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK && w.Code != http.StatusCreated {
+			t.Fatalf("%s %s: expected success, got %d. Body: %s", method, path, w.Code, w.Body.String())
+		}
+	}
+	create := func(domain string) string {
+		t.Helper()
+		send("POST", "/api/routes", `{"domain": "`+domain+`", "handler_type": "reverse_proxy", "config": {"upstreams": ["localhost:8080"]}}`)
+		routes, _ := store.ListRoutes()
+		for _, r := range routes {
+			if r.Domain == domain {
+				return r.ID
+			}
+		}
+		t.Fatalf("Route %s not created", domain)
+		return ""
+	}
+	expectOps := func(expected ...string) {
+		t.Helper()
+		got := fc.routeOps()
+		if strings.Join(got, ",") != strings.Join(expected, ",") {
+			t.Errorf("Expected ops %v, got %v", expected, got)
+		}
+	}
+
+	// The first route changes the structure (no HTTP app yet), so it's a full load
+	b := create("b.example.com")
+	if fc.loads != 1 {
+		t.Fatalf("Expected initial full load, got %d loads", fc.loads)
+	}
+
+	create("c.example.com")
+	expectOps("POST /config/apps/http/servers/srv0/routes")
+
+	a := create("a.example.com")
+	expectOps("PUT /config/apps/http/servers/srv0/routes/0")
+
+	send("PUT", "/api/routes/"+b, `{"version": 1, "domain": "b.example.com", "handler_type": "reverse_proxy", "config": {"upstreams": ["localhost:9090"]}, "enabled": true}`)
+	expectOps("PATCH /id/" + b)
+
+	send("POST", "/api/routes/"+a+"/toggle", `{"version": 1}`)
+	expectOps("DELETE /id/" + a)
+
+	if fc.loads != 1 {
+		t.Errorf("Expected no further full loads, got %d", fc.loads)
+	}
+
+	// Incremental changes must leave Caddy with exactly the built config
+	_, desired, _ := NewHandler(store, "").buildConfig()
+	changes, _ := config.Diff(fc.loadedConfig(), desired)
+	if len(changes) != 0 {
+		t.Errorf("Expected live config to match built config, got %+v", changes)
+	}
+
+	// Moving a route past another one reorders the list: fall back to /load
+	send("PUT", "/api/routes/"+b, `{"version": 2, "domain": "d.example.com", "handler_type": "reverse_proxy", "config": {"upstreams": ["localhost:9090"]}, "enabled": true}`)
+	expectOps()
+	if fc.loads != 2 {
+		t.Errorf("Expected a full load after reorder, got %d loads", fc.loads)
+	}
+}
+
+func TestSyncToCaddy_Concurrent(t *testing.T) {
+	router, _, fc, cleanup := setupTestRouterWithCaddy(t)
+	defer cleanup()
+
+	// Concurrent writes each sync; none of them may take another's push
+	// for an outside change or leave Caddy behind the store
+	const n = 8
+	var wg sync.WaitGroup
+	bodies := make([]string, n)
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := doJSON(router, "POST", "/api/routes", fmt.Sprintf(`{"domain": "app%d.example.com", "handler_type": "reverse_proxy", "config": {"upstreams": ["localhost:%d"]}}`, i, 8000+i))
+			bodies[i] = w.Body.String()
+		}()
+	}
+	wg.Wait()
+
+	for i, body := range bodies {
+		if strings.Contains(body, "warning") {
+			t.Errorf("Expected route %d to sync cleanly, got %s", i, body)
+		}
+	}
+	live := string(fc.loadedConfig())
+	for i := range n {
+		if !strings.Contains(live, fmt.Sprintf("app%d.example.com", i)) {
+			t.Errorf("Expected app%d.example.com to be live", i)
+		}
+	}
+}
+
+func TestSyncToCaddy_Conflict(t *testing.T) {
+	router, store, fc, cleanup := setupTestRouterWithCaddy(t)
+	defer cleanup()
+
+	store.CreateRoute(&storage.Route{
+		Domain:      "example.com",
+		HandlerType: "reverse_proxy",
+		Config:      json.RawMessage(`{"upstreams":["localhost:8080"]}`),
+		Enabled:     true,
+	})
+
+	sync := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/sync"+query, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := sync(""); w.Code != http.StatusOK {
+		t.Fatalf("Expected initial sync to succeed, got %d. Body: %s", w.Code, w.Body.String())
+	}
+
+	// Someone else edits Caddy's config directly
+	edited := json.RawMessage(strings.Replace(string(fc.loadedConfig()), "localhost:8080", "localhost:9999", 1))
+	fc.setConfig(edited)
+
+	w := sync("")
+	if w.Code != http.StatusConflict {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusConflict, w.Code, w.Body.String())
+	}
+	var resp struct {
+		Changes []config.Change `json:"changes"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if len(resp.Changes) != 1 || resp.Changes[0].New != "localhost:9999" {
+		t.Errorf("Expected the outside change in the response, got %+v", resp.Changes)
+	}
+	if string(fc.loadedConfig()) != string(edited) {
+		t.Error("Expected the edited config to be left alone")
+	}
+
+	if w := sync("?force=true"); w.Code != http.StatusOK {
+		t.Fatalf("Expected forced sync to succeed, got %d. Body: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(string(fc.loadedConfig()), "localhost:8080") {
+		t.Error("Expected forced sync to restore the stored config")
+	}
+
+	// With the baseline updated, a normal sync works again
+	if w := sync(""); w.Code != http.StatusOK {
+		t.Errorf("Expected sync after force to succeed, got %d", w.Code)
+	}
+
+	// An edit landing between the sync's read and its full replace is
+	// caught by If-Match rather than overwritten
+	store.CreateServer(&storage.Server{Name: "internal", Listen: []string{":8080"}})
+	fc.mu.Lock()
+	fc.editAfterGet = edited
+	fc.mu.Unlock()
+	if w := sync(""); w.Code != http.StatusConflict {
+		t.Fatalf("Expected status %d for an edit during the sync, got %d. Body: %s", http.StatusConflict, w.Code, w.Body.String())
+	}
+	if string(fc.loadedConfig()) != string(edited) {
+		t.Error("Expected the edit made during the sync to be left alone")
+	}
+}
@@ -0,0 +1,314 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ArtemStepanov/caddy-admin-ui/internal/storage"
+)
+
+// InstanceStatus is the health and last sync of a managed instance as
+// reported by GET /api/status
+type InstanceStatus struct {
+	Name          string            `json:"name"`
+	AdminURL      string            `json:"admin_url"`
+	Labels        map[string]string `json:"labels,omitempty"`
+	Status        string            `json:"status"`
+	Error         string            `json:"error,omitempty"`
+	Latency       int64             `json:"latency"`
+	RouteCount    int               `json:"route_count"`
+	LastSyncedAt  *time.Time        `json:"last_synced_at,omitempty"`
+	LastSyncError string            `json:"last_sync_error,omitempty"`
+	LastSyncMode  string            `json:"last_sync_mode,omitempty"`
+}
+
+// ListInstances returns all managed instances
+func (h *Handler) ListInstances(c *gin.Context) {
+	instances, err := h.store.ListInstances()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if instances == nil {
+		instances = []*storage.Instance{}
+	}
+	c.JSON(http.StatusOK, gin.H{"instances": instances})
+}
+
+// GetInstance returns a single instance
+func (h *Handler) GetInstance(c *gin.Context) {
+	instance, err := h.store.GetInstance(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "instance not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"instance": instance})
+}
+
+// CreateInstance registers a new instance and pushes its routes to it
+func (h *Handler) CreateInstance(c *gin.Context) {
+	var instance storage.Instance
+	if err := c.ShouldBindJSON(&instance); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !validateInstance(c, &instance) {
+		return
+	}
+
+	err := h.store.CreateInstance(&instance)
+	if errors.Is(err, storage.ErrInstanceExists) {
+		c.JSON(http.StatusConflict, gin.H{"error": "instance " + instance.Name + " already exists"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	recordChange(c, "", instance.Name, nil, &instance)
+
+	// Auto-sync to the new instance
+	if err := h.syncInstance(&instance, storage.RevisionActionCreateInstance); err != nil {
+		c.JSON(http.StatusCreated, gin.H{
+			"instance": instance,
+			"warning":  "Instance created but sync to Caddy failed: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"instance": instance})
+}
+
+// UpdateInstance updates an existing instance. The name can't be changed.
+func (h *Handler) UpdateInstance(c *gin.Context) {
+	var instance storage.Instance
+	if err := c.ShouldBindJSON(&instance); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	instance.Name = c.Param("name")
+	if !validateInstance(c, &instance) {
+		return
+	}
+
+	var before *storage.Instance
+	err := h.store.WithTx(func(tx storage.RouteStore) error {
+		var err error
+		if before, err = tx.GetInstance(instance.Name); err != nil {
+			return err
+		}
+		return tx.UpdateInstance(&instance)
+	})
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "instance not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	recordChange(c, "", instance.Name, before, &instance)
+
+	// Auto-sync to the instance, which may be a different Caddy now
+	if err := h.syncInstance(&instance, storage.RevisionActionUpdateInstance); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"instance": instance,
+			"warning":  "Instance updated but sync to Caddy failed: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"instance": instance})
+}
+
+// DeleteInstance stops managing an instance that no route is assigned to
+// anymore. Its Caddy config is left as it is.
+func (h *Handler) DeleteInstance(c *gin.Context) {
+	name := c.Param("name")
+
+	var deleted *storage.Instance
+	var inUse int
+	err := h.store.WithTx(func(tx storage.RouteStore) error {
+		var err error
+		if deleted, err = tx.GetInstance(name); err != nil {
+			return err
+		}
+		routes, err := tx.ListRoutes()
+		if err != nil {
+			return err
+		}
+		for _, r := range routes {
+			for _, inst := range r.Instances {
+				if inst == name {
+					inUse++
+				}
+			}
+		}
+		if inUse > 0 {
+			return nil
+		}
+		return tx.DeleteInstance(name)
+	})
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "instance not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if inUse > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "instance is used by routes", "routes": inUse})
+		return
+	}
+	recordChange(c, "", name, deleted, nil)
+
+	h.forgetTarget(name)
+	c.JSON(http.StatusOK, gin.H{"message": "instance deleted"})
+}
+
+// syncInstance pushes the routes deployed to a single instance
+func (h *Handler) syncInstance(instance *storage.Instance, action string) error {
+	var admin *storage.AdminSettings
+	if cfg, err := h.store.GetGlobalConfig(); err == nil {
+		admin = cfg.Admin
+	}
+	target := syncTarget{name: instance.Name, instance: instance, client: newCaddyClient(instance.AdminURL, admin)}
+	return h.syncTarget(target, action, false)
+}
+
+// validateInstance checks an instance's fields, writing a 400 if they're invalid
+func validateInstance(c *gin.Context, instance *storage.Instance) bool {
+	if !namePattern.MatchString(instance.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name must only contain letters, digits, '-' and '_'"})
+		return false
+	}
+	if instance.AdminURL == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "admin_url is required"})
+		return false
+	}
+	return true
+}
+
+// checkRouteInstances writes a 400 if a route is assigned to an instance
+// that isn't registered
+func (h *Handler) checkRouteInstances(c *gin.Context, route *storage.Route) bool {
+	for _, name := range route.Instances {
+		if _, err := h.store.GetInstance(name); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown instance " + name})
+			return false
+		}
+	}
+	return true
+}
+
+// requestTarget returns the target named by the ?instance= query parameter,
+// writing an error response if there is none. Without the parameter it is
+// the default Caddy, or the only instance if exactly one is registered.
+func (h *Handler) requestTarget(c *gin.Context) (syncTarget, bool) {
+	targets, err := h.syncTargets()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return syncTarget{}, false
+	}
+
+	name := c.Query("instance")
+	if name == "" {
+		if len(targets) > 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "instance is required when several instances are registered"})
+			return syncTarget{}, false
+		}
+		return targets[0], true
+	}
+	for _, t := range targets {
+		if t.name == name {
+			return t, true
+		}
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": "instance not found"})
+	return syncTarget{}, false
+}
+
+// getFleetStatus writes the status of every managed instance, checking
+// their health concurrently. The overall status is "online" if all of them
+// are, "offline" if none are and "degraded" otherwise.
+func (h *Handler) getFleetStatus(c *gin.Context, targets []syncTarget) {
+	routes, err := h.store.ListRoutes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	statuses := make([]InstanceStatus, len(targets))
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses[i] = h.instanceStatus(t, routes)
+		}()
+	}
+	wg.Wait()
+
+	online := 0
+	for _, s := range statuses {
+		if s.Status == "online" {
+			online++
+		}
+	}
+	status := "degraded"
+	switch online {
+	case len(statuses):
+		status = "online"
+	case 0:
+		status = "offline"
+	}
+
+	resp := gin.H{
+		"status":      status,
+		"route_count": len(routes),
+		"instances":   statuses,
+	}
+	h.mu.RLock()
+	if h.drift != nil {
+		resp["drift"] = h.drift
+	}
+	h.mu.RUnlock()
+	c.JSON(http.StatusOK, resp)
+}
+
+// instanceStatus checks a single instance's health and adds its last sync
+func (h *Handler) instanceStatus(t syncTarget, routes []*storage.Route) InstanceStatus {
+	status := InstanceStatus{
+		Name:     t.instance.Name,
+		AdminURL: t.instance.AdminURL,
+		Labels:   t.instance.Labels,
+		Status:   "online",
+	}
+	for _, r := range routes {
+		if r.DeployedTo(t.name) {
+			status.RouteCount++
+		}
+	}
+
+	start := time.Now()
+	if err := t.client.Health(); err != nil {
+		status.Status = "offline"
+		status.Error = err.Error()
+	}
+	status.Latency = time.Since(start).Milliseconds()
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if st := h.targets[t.name]; st != nil && !st.syncedAt.IsZero() {
+		syncedAt := st.syncedAt
+		status.LastSyncedAt = &syncedAt
+		status.LastSyncError = st.syncError
+		status.LastSyncMode = st.syncMode
+	}
+	return status
+}
@@ -0,0 +1,195 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ArtemStepanov/caddy-admin-ui/internal/storage"
+)
+
+func TestInstanceCRUD(t *testing.T) {
+	router, store, cleanup := setupTestRouter(t)
+	defer cleanup()
+
+	w := doJSON(router, "POST", "/api/instances", `{"name": "edge-1", "admin_url": "http://localhost:29999", "labels": {"region": "eu"}}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "warning") {
+		t.Errorf("Expected a sync warning for an unreachable instance, got %s", w.Body.String())
+	}
+
+	if w := doJSON(router, "POST", "/api/instances", `{"name": "edge-1", "admin_url": "http://localhost:29998"}`); w.Code != http.StatusConflict {
+		t.Errorf("Expected status %d for duplicate name, got %d", http.StatusConflict, w.Code)
+	}
+	if w := doJSON(router, "POST", "/api/instances", `{"name": "edge/2", "admin_url": "http://localhost:29998"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for invalid name, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w := doJSON(router, "POST", "/api/instances", `{"name": "edge-2"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for missing admin_url, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	w = doJSON(router, "PUT", "/api/instances/edge-1", `{"name": "ignored", "admin_url": "http://localhost:29997"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	w = doJSON(router, "GET", "/api/instances/edge-1", "")
+	var response struct {
+		Instance storage.Instance `json:"instance"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if response.Instance.Name != "edge-1" || response.Instance.AdminURL != "http://localhost:29997" || response.Instance.Labels != nil {
+		t.Errorf("Unexpected instance after update: %+v", response.Instance)
+	}
+
+	if w := doJSON(router, "DELETE", "/api/instances/edge-1", ""); w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if w := doJSON(router, "GET", "/api/instances/edge-1", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected deleted instance to be gone, got %d", w.Code)
+	}
+
+	// Updates and deletes are audited with the instance as it was
+	update, _ := store.ListAuditEvents(storage.AuditFilter{Action: "update_instance"})
+	if len(update) != 1 || !strings.Contains(string(update[0].Before), "29999") || !strings.Contains(string(update[0].After), "29997") {
+		t.Errorf("Expected the update to record the instance before and after, got %+v", update)
+	}
+	del, _ := store.ListAuditEvents(storage.AuditFilter{Action: "delete_instance"})
+	if len(del) != 1 || !strings.Contains(string(del[0].Before), "29997") || del[0].After != nil {
+		t.Errorf("Expected the delete to record the deleted instance, got %+v", del)
+	}
+}
+
+// setupFleet registers two fake Caddy instances, edge-a and edge-b
+func setupFleet(t *testing.T) (*fakeCaddy, *fakeCaddy, func(method, path, body string) (int, map[string]any), storage.Store) {
+	t.Helper()
+
+	router, store, cleanup := setupTestRouter(t)
+	t.Cleanup(cleanup)
+	a, b := newFakeCaddy(t), newFakeCaddy(t)
+	store.CreateInstance(&storage.Instance{Name: "edge-a", AdminURL: a.URL})
+	store.CreateInstance(&storage.Instance{Name: "edge-b", AdminURL: b.URL})
+
+	do := func(method, path, body string) (int, map[string]any) {
+		w := doJSON(router, method, path, body)
+		var response map[string]any
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response
+	}
+	return a, b, do, store
+}
+
+func TestInstances_RouteAssignment(t *testing.T) {
+	a, b, do, _ := setupFleet(t)
+
+	if code, _ := do("POST", "/api/routes", `{"domain": "a.example.com", "handler_type": "reverse_proxy", "config": {"upstreams": ["localhost:8080"]}, "instances": ["edge-c"]}`); code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for unknown instance, got %d", http.StatusBadRequest, code)
+	}
+
+	code, response := do("POST", "/api/routes", `{"domain": "a.example.com", "handler_type": "reverse_proxy", "config": {"upstreams": ["localhost:8080"]}, "instances": ["edge-a"]}`)
+	if code != http.StatusCreated || response["warning"] != nil {
+		t.Fatalf("Expected clean create, got %d %v", code, response)
+	}
+	do("POST", "/api/routes", `{"domain": "all.example.com", "handler_type": "reverse_proxy", "config": {"upstreams": ["localhost:9000"]}}`)
+
+	if cfg := string(a.loadedConfig()); !strings.Contains(cfg, "a.example.com") || !strings.Contains(cfg, "all.example.com") {
+		t.Errorf("Expected edge-a to get both routes, got %s", cfg)
+	}
+	if cfg := string(b.loadedConfig()); strings.Contains(cfg, "a.example.com\"") || !strings.Contains(cfg, "all.example.com") {
+		t.Errorf("Expected edge-b to get only the unassigned route, got %s", cfg)
+	}
+
+	if code, _ := do("DELETE", "/api/instances/edge-a", ""); code != http.StatusConflict {
+		t.Errorf("Expected status %d for instance in use, got %d", http.StatusConflict, code)
+	}
+}
+
+func TestInstances_SyncFanOut(t *testing.T) {
+	_, _, do, store := setupFleet(t)
+	store.CreateRoute(&storage.Route{
+		Domain:      "example.com",
+		HandlerType: "reverse_proxy",
+		Config:      json.RawMessage(`{"upstreams":["localhost:8080"]}`),
+		Enabled:     true,
+	})
+
+	code, response := do("POST", "/api/sync", "")
+	if code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %v", http.StatusOK, code, response)
+	}
+	results, _ := response["results"].([]any)
+	if len(results) != 2 {
+		t.Fatalf("Expected a result per instance, got %v", response)
+	}
+	for _, r := range results {
+		if result := r.(map[string]any); result["error"] != nil || result["mode"] == "" {
+			t.Errorf("Unexpected result %v", result)
+		}
+	}
+
+	revisions, _ := store.ListRevisions(2)
+	if len(revisions) != 2 || revisions[0].Instance == revisions[1].Instance {
+		t.Errorf("Expected a revision per instance, got %+v", revisions)
+	}
+
+	// An unreachable instance fails on its own; the rest are still synced
+	store.CreateInstance(&storage.Instance{Name: "edge-c", AdminURL: "http://localhost:29999"})
+	code, response = do("POST", "/api/sync", "")
+	if code != http.StatusBadGateway {
+		t.Fatalf("Expected status %d, got %d: %v", http.StatusBadGateway, code, response)
+	}
+	results, _ = response["results"].([]any)
+	if len(results) != 3 || results[2].(map[string]any)["error"] == nil || results[0].(map[string]any)["error"] != nil {
+		t.Errorf("Expected only edge-c to fail, got %v", results)
+	}
+}
+
+func TestInstances_Status(t *testing.T) {
+	_, _, do, store := setupFleet(t)
+	store.CreateRoute(&storage.Route{Domain: "a.example.com", HandlerType: "static_response", Config: json.RawMessage(`{}`), Instances: []string{"edge-a"}})
+	store.CreateRoute(&storage.Route{Domain: "all.example.com", HandlerType: "static_response", Config: json.RawMessage(`{}`)})
+	do("POST", "/api/sync", "")
+	store.CreateInstance(&storage.Instance{Name: "edge-c", AdminURL: "http://localhost:29999", Labels: map[string]string{"role": "canary"}})
+
+	code, response := do("GET", "/api/status", "")
+	if code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, code)
+	}
+	if response["status"] != "degraded" {
+		t.Errorf("Expected degraded status with one instance down, got %v", response["status"])
+	}
+
+	instances, _ := response["instances"].([]any)
+	if len(instances) != 3 {
+		t.Fatalf("Expected 3 instances in status, got %v", response)
+	}
+	edgeA := instances[0].(map[string]any)
+	if edgeA["status"] != "online" || edgeA["route_count"] != float64(2) || edgeA["last_synced_at"] == nil {
+		t.Errorf("Unexpected edge-a status: %v", edgeA)
+	}
+	edgeB := instances[1].(map[string]any)
+	if edgeB["route_count"] != float64(1) {
+		t.Errorf("Expected one route on edge-b, got %v", edgeB)
+	}
+	edgeC := instances[2].(map[string]any)
+	if edgeC["status"] != "offline" || edgeC["last_synced_at"] != nil || edgeC["labels"] == nil {
+		t.Errorf("Unexpected edge-c status: %v", edgeC)
+	}
+}
+
+func TestInstances_PreviewRequiresInstance(t *testing.T) {
+	_, _, do, _ := setupFleet(t)
+
+	if code, _ := do("GET", "/api/config/preview", ""); code != http.StatusBadRequest {
+		t.Errorf("Expected status %d without instance, got %d", http.StatusBadRequest, code)
+	}
+	if code, _ := do("GET", "/api/config/preview?instance=edge-z", ""); code != http.StatusNotFound {
+		t.Errorf("Expected status %d for unknown instance, got %d", http.StatusNotFound, code)
+	}
+	if code, response := do("GET", "/api/config/preview?instance=edge-b", ""); code != http.StatusOK || response["config"] == nil {
+		t.Errorf("Expected preview for edge-b, got %d %v", code, response)
+	}
+}
@@ -0,0 +1,495 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ArtemStepanov/caddy-admin-ui/internal/config"
+	"github.com/ArtemStepanov/caddy-admin-ui/internal/storage"
+)
+
+// manifestContentTypes are the response content types of the manifest
+// formats
+var manifestContentTypes = map[string]string{
+	config.ManifestFormatYAML: "application/yaml",
+	config.ManifestFormatJSON: "application/json",
+}
+
+// Actions of a manifest plan entry
+const (
+	planCreate    = "create"
+	planUpdate    = "update"
+	planDelete    = "delete"
+	planUnchanged = "unchanged"
+)
+
+// errApplyFailed rolls back the apply transaction when a route couldn't
+// be written
+var errApplyFailed = errors.New("manifest could not be applied")
+
+// errManifestInvalid rolls back the apply transaction when the manifest
+// doesn't validate against the stored servers and instances
+var errManifestInvalid = errors.New("invalid manifest")
+
+// ExportManifest returns the stored routes, servers and global config as a
+// manifest for POST /api/apply, in YAML or with ?format=json in JSON
+func (h *Handler) ExportManifest(c *gin.Context) {
+	format := c.DefaultQuery("format", config.ManifestFormatYAML)
+	contentType, ok := manifestContentTypes[format]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be \"yaml\" or \"json\""})
+		return
+	}
+
+	routes, err := h.store.ListRoutes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	servers, err := h.store.ListServers()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	global, err := h.store.GetGlobalConfig()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	data, err := config.EncodeManifest(config.NewManifest(routes, servers, global), format)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, contentType+"; charset=utf-8", data)
+}
+
+// planEntry is one route or server in a manifest plan. Fields lists what
+// an update changes.
+type planEntry struct {
+	Action  string   `json:"action"`
+	RouteID string   `json:"route_id,omitempty"`
+	Domain  string   `json:"domain,omitempty"`
+	Path    string   `json:"path,omitempty"`
+	Name    string   `json:"name,omitempty"`
+	Fields  []string `json:"fields,omitempty"`
+}
+
+// manifestPlan is what applying a manifest changes. Servers and global
+// are only planned if the manifest has them.
+type manifestPlan struct {
+	routes *storage.ImportPlan
+	before map[string]*storage.Route
+
+	servers       []*storage.Server
+	serverEntries []planEntry
+	deleteServers []*storage.Server
+
+	global       *storage.GlobalConfig
+	globalBefore *storage.GlobalConfig
+	globalAction string
+}
+
+// routeEntries lists the plan's routes: creations, updates, unchanged
+// routes and deletions
+func (p *manifestPlan) routeEntries() []planEntry {
+	entries := []planEntry{}
+	add := func(action string, r *storage.Route, fields []string) {
+		entries = append(entries, planEntry{Action: action, RouteID: r.ID, Domain: r.Domain, Path: r.Path, Fields: fields})
+	}
+	for _, r := range p.routes.Create {
+		add(planCreate, r, nil)
+	}
+	for _, r := range p.routes.Update {
+		add(planUpdate, r, storage.RouteDiff(p.before[r.ID], r))
+	}
+	for _, r := range p.routes.Unchanged {
+		add(planUnchanged, r, nil)
+	}
+	for _, r := range p.routes.Delete {
+		add(planDelete, r, nil)
+	}
+	return entries
+}
+
+// response describes the plan for the API
+func (p *manifestPlan) response() gin.H {
+	plan := gin.H{"routes": p.routeEntries()}
+	if p.serverEntries != nil {
+		plan["servers"] = p.serverEntries
+	}
+	if p.globalAction != "" {
+		plan["global"] = p.globalAction
+	}
+
+	// Unchanged only counts routes
+	summary := map[string]int{
+		planCreate:    len(p.routes.Create),
+		planUpdate:    len(p.routes.Update),
+		planDelete:    len(p.routes.Delete),
+		planUnchanged: len(p.routes.Unchanged),
+	}
+	for _, e := range p.serverEntries {
+		if e.Action != planUnchanged {
+			summary[e.Action]++
+		}
+	}
+	if p.globalAction == planUpdate {
+		summary[planUpdate]++
+	}
+	return gin.H{"plan": plan, "summary": summary}
+}
+
+// changes reports whether applying the plan changes anything
+func (p *manifestPlan) changes() bool {
+	if len(p.routes.Create)+len(p.routes.Update)+len(p.routes.Delete) > 0 || p.globalAction == planUpdate {
+		return true
+	}
+	for _, e := range p.serverEntries {
+		if e.Action != planUnchanged {
+			return true
+		}
+	}
+	return false
+}
+
+// validateManifest returns everything that is wrong with a manifest,
+// checking server and instance names against rs
+func validateManifest(rs storage.RouteStore, m *config.Manifest) ([]string, error) {
+	var problems []string
+	problem := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if m.Global != nil {
+		if msg := validateGlobalConfig(m.Global); msg != "" {
+			problem("global: %s", msg)
+		}
+	}
+
+	servers := map[string]bool{"": true, storage.DefaultServerName: true}
+	if m.Servers != nil {
+		declared := make(map[string]bool, len(m.Servers))
+		for i, ms := range m.Servers {
+			if msg := serverProblem(ms.Server()); msg != "" {
+				problem("servers[%d]: %s", i, msg)
+			}
+			if declared[ms.Name] {
+				problem("servers[%d]: duplicate server %s", i, ms.Name)
+			}
+			declared[ms.Name], servers[ms.Name] = true, true
+		}
+	} else {
+		stored, err := rs.ListServers()
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range stored {
+			servers[s.Name] = true
+		}
+	}
+
+	instances, err := rs.ListInstances()
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool, len(instances))
+	for _, inst := range instances {
+		known[inst.Name] = true
+	}
+
+	seen := make(map[string]int)
+	for i, mr := range m.Routes {
+		r := mr.Route()
+		if r.Domain == "" {
+			problem("routes[%d]: domain is required", i)
+		}
+		if r.HandlerType == "" {
+			problem("routes[%d]: handler_type is required", i)
+		}
+		if msg := handlerConfigProblem(r); msg != "" {
+			problem("routes[%d]: %s", i, msg)
+		}
+		if !servers[r.Server] {
+			problem("routes[%d]: unknown server %s", i, r.Server)
+		}
+		for _, name := range r.Instances {
+			if !known[name] {
+				problem("routes[%d]: unknown instance %s", i, name)
+			}
+		}
+		key := storage.RouteKey(r)
+		if first, ok := seen[key]; ok {
+			problem("routes[%d]: same domain and path as routes[%d]", i, first)
+		} else {
+			seen[key] = i
+		}
+	}
+	return problems, nil
+}
+
+// handlerConfigProblem returns why a route's config doesn't fit its
+// handler type, or ""
+func handlerConfigProblem(r *storage.Route) string {
+	var target any
+	switch r.HandlerType {
+	case "reverse_proxy":
+		target = &storage.ReverseProxyConfig{}
+	case "file_server":
+		target = &storage.FileServerConfig{}
+	case "redir":
+		target = &storage.RedirectConfig{}
+	default:
+		return ""
+	}
+	if err := json.Unmarshal(r.Config, target); err != nil {
+		return "invalid " + r.HandlerType + " config: " + err.Error()
+	}
+	return ""
+}
+
+// planManifest works out what applying a validated manifest to rs changes
+func planManifest(rs storage.RouteStore, m *config.Manifest) (*manifestPlan, error) {
+	existing, err := rs.ListRoutes()
+	if err != nil {
+		return nil, err
+	}
+	p := &manifestPlan{before: make(map[string]*storage.Route, len(existing))}
+	byKey := make(map[string]*storage.Route, len(existing))
+	for _, r := range existing {
+		p.before[r.ID] = r
+		if _, ok := byKey[storage.RouteKey(r)]; !ok {
+			byKey[storage.RouteKey(r)] = r
+		}
+	}
+
+	incoming := make([]*storage.Route, 0, len(m.Routes))
+	for _, mr := range m.Routes {
+		r := mr.Route()
+		if current, ok := byKey[storage.RouteKey(r)]; ok {
+			r.BasicAuth.ReuseHashes(current.BasicAuth)
+		}
+		incoming = append(incoming, r)
+	}
+	p.routes = storage.PlanApply(existing, incoming)
+
+	if m.Servers != nil {
+		if err := p.planServers(rs, m.Servers); err != nil {
+			return nil, err
+		}
+	}
+
+	if m.Global != nil {
+		current, err := rs.GetGlobalConfig()
+		if err != nil {
+			return nil, err
+		}
+		a, _ := json.Marshal(current)
+		b, _ := json.Marshal(m.Global)
+		p.global, p.globalBefore, p.globalAction = m.Global, current, planUnchanged
+		if !bytes.Equal(a, b) {
+			p.globalAction = planUpdate
+		}
+	}
+	return p, nil
+}
+
+// planServers plans making the stored servers match the manifest's
+func (p *manifestPlan) planServers(rs storage.RouteStore, servers []*config.ManifestServer) error {
+	stored, err := rs.ListServers()
+	if err != nil {
+		return err
+	}
+	byName := make(map[string]*storage.Server, len(stored))
+	for _, s := range stored {
+		byName[s.Name] = s
+	}
+
+	p.serverEntries = []planEntry{}
+	for _, ms := range servers {
+		s := ms.Server()
+		current, ok := byName[s.Name]
+		delete(byName, s.Name)
+		if !ok {
+			p.servers = append(p.servers, s)
+			p.serverEntries = append(p.serverEntries, planEntry{Action: planCreate, Name: s.Name})
+			continue
+		}
+		fields := serverDiff(current, s)
+		if len(fields) == 0 {
+			p.serverEntries = append(p.serverEntries, planEntry{Action: planUnchanged, Name: s.Name})
+			continue
+		}
+		p.servers = append(p.servers, s)
+		p.serverEntries = append(p.serverEntries, planEntry{Action: planUpdate, Name: s.Name, Fields: fields})
+	}
+	for _, s := range stored {
+		if _, ok := byName[s.Name]; ok {
+			p.deleteServers = append(p.deleteServers, s)
+			p.serverEntries = append(p.serverEntries, planEntry{Action: planDelete, Name: s.Name})
+		}
+	}
+	return nil
+}
+
+// serverDiff lists the JSON names of the fields that differ between two
+// servers
+func serverDiff(a, b *storage.Server) []string {
+	var fields []string
+	if !slices.Equal(a.Listen, b.Listen) {
+		fields = append(fields, "listen")
+	}
+	if !slices.Equal(a.Protocols, b.Protocols) {
+		fields = append(fields, "protocols")
+	}
+	if !reflect.DeepEqual(a.AutomaticHTTPS, b.AutomaticHTTPS) {
+		fields = append(fields, "automatic_https")
+	}
+	return fields
+}
+
+// apply writes the plan to rs. Servers are created and updated before the
+// routes that may use them and deleted after the routes that did.
+func (p *manifestPlan) apply(rs storage.RouteStore) (*storage.ImportResult, error) {
+	if err := mergeServers(rs, p.servers); err != nil {
+		return nil, err
+	}
+	result := storage.ApplyImport(rs, p.routes)
+	if result.Failed > 0 {
+		return result, errApplyFailed
+	}
+	for _, s := range p.deleteServers {
+		if err := deleteServer(rs, s.Name); err != nil {
+			return nil, err
+		}
+	}
+	if p.globalAction == planUpdate {
+		if err := rs.SetGlobalConfig(p.global); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// record adds the applied changes to the audit log
+func (p *manifestPlan) record(c *gin.Context) {
+	for _, r := range p.routes.Create {
+		recordChange(c, r.ID, "", nil, r)
+	}
+	for _, r := range p.routes.Update {
+		recordChange(c, r.ID, "", p.before[r.ID], r)
+	}
+	for _, r := range p.routes.Delete {
+		recordChange(c, r.ID, "", r, nil)
+	}
+	for _, s := range p.servers {
+		recordChange(c, "", s.Name, nil, s)
+	}
+	for _, s := range p.deleteServers {
+		recordChange(c, "", s.Name, s, nil)
+	}
+	if p.globalAction == planUpdate {
+		recordChange(c, "", "", p.globalBefore, p.global)
+	}
+}
+
+// ApplyManifest validates a YAML or JSON manifest and plans the route,
+// server and global config changes that make the stored configuration
+// match it. Routes missing from the manifest are deleted. Without
+// ?confirm=true only the plan is returned; with it the plan is applied in
+// a single transaction and synced to Caddy. The manifest is validated again
+// in that transaction, so the servers and instances it names can't be
+// deleted in between.
+func (h *Handler) ApplyManifest(c *gin.Context) {
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	m, err := config.ParseManifest(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid manifest: " + err.Error()})
+		return
+	}
+
+	if c.Query("confirm") != "true" {
+		problems, err := validateManifest(h.store, m)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if len(problems) > 0 {
+			writeManifestProblems(c, problems)
+			return
+		}
+		plan, err := planManifest(h.store, m)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		skipAudit(c)
+		response := plan.response()
+		response["applied"] = false
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	var plan *manifestPlan
+	var result *storage.ImportResult
+	var problems []string
+	err = h.store.WithTx(func(tx storage.RouteStore) error {
+		var err error
+		if problems, err = validateManifest(tx, m); err != nil {
+			return err
+		}
+		if len(problems) > 0 {
+			return errManifestInvalid
+		}
+		if plan, err = planManifest(tx, m); err != nil {
+			return err
+		}
+		result, err = plan.apply(tx)
+		return err
+	})
+	if errors.Is(err, errManifestInvalid) {
+		writeManifestProblems(c, problems)
+		return
+	}
+	if errors.Is(err, errApplyFailed) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error() + ", nothing was changed", "result": result})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply manifest: " + err.Error()})
+		return
+	}
+
+	response := plan.response()
+	response["applied"] = true
+	response["result"] = result
+	if !plan.changes() {
+		response["message"] = "Nothing to change"
+		c.JSON(http.StatusOK, response)
+		return
+	}
+	plan.record(c)
+
+	response["message"] = "Manifest applied"
+	if err := h.syncToCaddy(storage.RevisionActionApply); err != nil {
+		response["warning"] = "Manifest applied but sync to Caddy failed: " + err.Error()
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// writeManifestProblems writes a 400 listing every problem of a manifest
+func writeManifestProblems(c *gin.Context, problems []string) {
+	c.JSON(http.StatusBadRequest, gin.H{"error": "invalid manifest: " + problems[0], "problems": problems})
+}
@@ -0,0 +1,242 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ArtemStepanov/caddy-admin-ui/internal/config"
+	"github.com/ArtemStepanov/caddy-admin-ui/internal/storage"
+)
+
+const testManifest = `version: 1
+global:
+  enable_encode: true
+servers:
+  - name: internal
+    listen: [":8443"]
+routes:
+  - domain: keep.example.com
+    handler_type: reverse_proxy
+    config:
+      upstreams: ["app:8080"]
+  - domain: change.example.com
+    path: /api/*
+    handler_type: reverse_proxy
+    config:
+      upstreams: ["api:9000"]
+    strip_path_prefix: /api
+    server: internal
+  - domain: new.example.com
+    handler_type: redir
+    config:
+      to: https://example.com{uri}
+    basic_auth:
+      enabled: true
+      users:
+        - username: alice
+          password: secret
+`
+
+// manifestResponse is the response of POST /api/apply
+type manifestResponse struct {
+	Plan struct {
+		Routes  []planEntry `json:"routes"`
+		Servers []planEntry `json:"servers"`
+		Global  string      `json:"global"`
+	} `json:"plan"`
+	Summary map[string]int `json:"summary"`
+	Applied bool           `json:"applied"`
+	Message string         `json:"message"`
+	Warning string         `json:"warning"`
+}
+
+// seedManifestRoutes stores the routes testManifest keeps, changes and
+// deletes
+func seedManifestRoutes(store storage.Store) {
+	store.CreateRoute(&storage.Route{Domain: "keep.example.com", HandlerType: "reverse_proxy", Config: json.RawMessage(`{"upstreams":["app:8080"]}`), Enabled: true})
+	store.CreateRoute(&storage.Route{Domain: "change.example.com", Path: "/api/*", HandlerType: "reverse_proxy", Config: json.RawMessage(`{"upstreams":["api:8000"]}`), Enabled: true})
+	store.CreateRoute(&storage.Route{Domain: "gone.example.com", HandlerType: "reverse_proxy", Config: json.RawMessage(`{"upstreams":["old:80"]}`), Enabled: true})
+	store.CreateServer(&storage.Server{Name: "legacy", Listen: []string{":8081"}})
+}
+
+func TestApplyManifest_Plan(t *testing.T) {
+	router, store, cleanup := setupTestRouter(t)
+	defer cleanup()
+	seedManifestRoutes(store)
+
+	w := doJSON(router, "POST", "/api/apply", testManifest)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var response manifestResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if response.Applied {
+		t.Error("Expected the plan not to be applied without confirm")
+	}
+
+	actions := make(map[string]planEntry)
+	for _, e := range response.Plan.Routes {
+		actions[e.Domain] = e
+	}
+	if actions["keep.example.com"].Action != "unchanged" || actions["new.example.com"].Action != "create" || actions["gone.example.com"].Action != "delete" {
+		t.Errorf("Unexpected route plan %+v", response.Plan.Routes)
+	}
+	if change := actions["change.example.com"]; change.Action != "update" || strings.Join(change.Fields, ",") != "config,strip_path_prefix,server" {
+		t.Errorf("Expected change.example.com to update config, strip prefix and server, got %+v", change)
+	}
+	if len(response.Plan.Servers) != 2 || response.Plan.Servers[0].Action != "create" || response.Plan.Servers[1].Action != "delete" {
+		t.Errorf("Expected internal created and legacy deleted, got %+v", response.Plan.Servers)
+	}
+	if response.Plan.Global != "update" {
+		t.Errorf("Expected the global config to be updated, got %q", response.Plan.Global)
+	}
+	// 1 route + 1 server created, 1 route + global updated, 1 route + 1 server deleted
+	if response.Summary["create"] != 2 || response.Summary["update"] != 2 || response.Summary["delete"] != 2 || response.Summary["unchanged"] != 1 {
+		t.Errorf("Unexpected summary %+v", response.Summary)
+	}
+
+	if routes, _ := store.ListRoutes(); len(routes) != 3 {
+		t.Errorf("Expected the plan not to write, got %d routes", len(routes))
+	}
+	if events, _ := store.ListAuditEvents(storage.AuditFilter{}); len(events) != 0 {
+		t.Errorf("Expected a plan not to be audited, got %+v", events)
+	}
+}
+
+func TestApplyManifest_Confirm(t *testing.T) {
+	router, store, fc, cleanup := setupTestRouterWithCaddy(t)
+	defer cleanup()
+	seedManifestRoutes(store)
+
+	// The manifest's global config would otherwise drop the test Caddy's URL
+	manifest := parseManifest(t, testManifest)
+	manifest.Global.CaddyAdminURL = fc.URL
+	body, _ := config.EncodeManifest(manifest, config.ManifestFormatJSON)
+
+	w := doJSON(router, "POST", "/api/apply?confirm=true", string(body))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var response manifestResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if !response.Applied || response.Warning != "" {
+		t.Errorf("Expected the manifest to be applied and synced, got %+v", response)
+	}
+
+	routes, _ := store.ListRoutes()
+	if len(routes) != 3 {
+		t.Fatalf("Expected 3 routes, got %d", len(routes))
+	}
+	for _, r := range routes {
+		if r.Domain == "gone.example.com" {
+			t.Error("Expected gone.example.com to be deleted")
+		}
+		if r.Domain == "new.example.com" && !storage.IsBcryptHash(r.BasicAuth.Users[0].Password) {
+			t.Error("Expected the basic auth password to be hashed")
+		}
+	}
+	if _, err := store.GetServer("legacy"); err == nil {
+		t.Error("Expected the legacy server to be deleted")
+	}
+	if cfg, _ := store.GetGlobalConfig(); !cfg.EnableEncode {
+		t.Error("Expected the global config to be applied")
+	}
+	if fc.loads == 0 && len(fc.routeOps()) == 0 {
+		t.Error("Expected the changes to be synced to Caddy")
+	}
+	if events, _ := store.ListAuditEvents(storage.AuditFilter{Action: "apply_manifest"}); len(events) != 6 {
+		t.Errorf("Expected an audit event per change, got %d", len(events))
+	}
+
+	// Applying again changes nothing, even with the password in plaintext
+	w = doJSON(router, "POST", "/api/apply?confirm=true", string(body))
+	response = manifestResponse{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if response.Message != "Nothing to change" || response.Summary["unchanged"] != 3 {
+		t.Errorf("Expected a second apply to change nothing, got %s", w.Body.String())
+	}
+}
+
+// parseManifest parses a manifest so a test can adjust it
+func parseManifest(t *testing.T, src string) *config.Manifest {
+	t.Helper()
+	m, err := config.ParseManifest([]byte(src))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return m
+}
+
+func TestApplyManifest_Invalid(t *testing.T) {
+	router, store, cleanup := setupTestRouter(t)
+	defer cleanup()
+	seedManifestRoutes(store)
+
+	if w := doJSON(router, "POST", "/api/apply?confirm=true", "version: 1\nroutes:\n  - domian: x\n"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an unknown field, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	src := `{"version": 1, "routes": [
+		{"domain": "a.example.com", "handler_type": "redir", "config": {"to": 301}},
+		{"handler_type": "reverse_proxy", "server": "missing"},
+		{"domain": "a.example.com", "handler_type": "file_server", "instances": ["nope"]}
+	]}`
+	w := doJSON(router, "POST", "/api/apply?confirm=true", src)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusBadRequest, w.Code, w.Body.String())
+	}
+	var response struct {
+		Problems []string `json:"problems"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	want := []string{
+		"routes[0]: invalid redir config",
+		"routes[1]: domain is required",
+		"routes[1]: unknown server missing",
+		"routes[2]: unknown instance nope",
+		"routes[2]: same domain and path as routes[0]",
+	}
+	if len(response.Problems) != len(want) {
+		t.Fatalf("Expected %d problems, got %+v", len(want), response.Problems)
+	}
+	for i := range want {
+		if !strings.HasPrefix(response.Problems[i], want[i]) {
+			t.Errorf("Expected problem %q, got %q", want[i], response.Problems[i])
+		}
+	}
+	if routes, _ := store.ListRoutes(); len(routes) != 3 {
+		t.Errorf("Expected routes to be untouched, got %d", len(routes))
+	}
+	if w := doJSON(router, "POST", "/api/apply", src); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "problems") {
+		t.Errorf("Expected the plan to report the problems too, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestExportManifest(t *testing.T) {
+	router, store, cleanup := setupTestRouter(t)
+	defer cleanup()
+	seedManifestRoutes(store)
+
+	w := doJSON(router, "GET", "/api/export/manifest", "")
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "application/yaml") {
+		t.Fatalf("Expected a YAML manifest, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	m, err := config.ParseManifest(w.Body.Bytes())
+	if err != nil || len(m.Routes) != 3 || len(m.Servers) != 1 || m.Global == nil {
+		t.Fatalf("Expected 3 routes, a server and the global config, got %v:\n%s", err, w.Body.String())
+	}
+
+	// The export applies cleanly
+	w = doJSON(router, "POST", "/api/apply", w.Body.String())
+	var response manifestResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if response.Summary["unchanged"] != 3 || response.Summary["create"]+response.Summary["update"]+response.Summary["delete"] != 0 {
+		t.Errorf("Expected the exported manifest to plan no changes, got %s", w.Body.String())
+	}
+
+	if w := doJSON(router, "GET", "/api/export/manifest?format=xml", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an unknown format, got %d", http.StatusBadRequest, w.Code)
+	}
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ArtemStepanov/caddy-admin-ui/internal/storage"
+)
+
+// requireRole rejects requests from users below role. While no users exist
+// there is nobody to check, so every request is allowed.
+func requireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := currentUser(c)
+		if user != nil && !user.HasRole(role) {
+			c.Abort()
+			forbid(c, fmt.Sprintf("this action requires the %s role, but %s is a %s", role, user.Username, user.Role))
+			return
+		}
+		c.Next()
+	}
+}
+
+// forbid writes a 403 with the reason a request was refused
+func forbid(c *gin.Context, reason string) {
+	c.JSON(http.StatusForbidden, gin.H{"error": reason})
+}
+
+// errDomainForbidden is returned from transactions that touch a route the
+// user may not manage
+var errDomainForbidden = errors.New("domain not allowed")
+
+// checkDomain writes a 403 if the signed-in user may not manage routes for
+// domain
+func checkDomain(c *gin.Context, domain string) bool {
+	user := currentUser(c)
+	if user == nil || user.CanManageDomain(domain) {
+		return true
+	}
+	forbid(c, domainReason(user, domain))
+	return false
+}
+
+// domainReason explains why user may not manage routes for domain
+func domainReason(user *storage.User, domain string) string {
+	return fmt.Sprintf("route domain %s is outside the domains assigned to %s (%s)",
+		domain, user.Username, strings.Join(user.Domains, ", "))
+}
+
+// isAdmin reports whether the signed-in user is an admin. While no users
+// exist everyone is.
+func isAdmin(c *gin.Context) bool {
+	user := currentUser(c)
+	return user == nil || user.HasRole(storage.RoleAdmin)
+}
+
+// redactRoute returns route as non-admins may see it, without basic auth
+// password hashes. Updates keep the stored hash of users sent without a
+// password, so a redacted route can be edited and sent back.
+func redactRoute(c *gin.Context, route *storage.Route) *storage.Route {
+	if route == nil || route.BasicAuth == nil || isAdmin(c) {
+		return route
+	}
+	redacted := *route
+	auth := *route.BasicAuth
+	auth.Users = make([]storage.BasicAuthUser, len(route.BasicAuth.Users))
+	for i, u := range route.BasicAuth.Users {
+		auth.Users[i] = storage.BasicAuthUser{Username: u.Username}
+	}
+	redacted.BasicAuth = &auth
+	return &redacted
+}
+
+// redactRoutes applies redactRoute to each route
+func redactRoutes(c *gin.Context, routes []*storage.Route) []*storage.Route {
+	if isAdmin(c) {
+		return routes
+	}
+	redacted := make([]*storage.Route, len(routes))
+	for i, r := range routes {
+		redacted[i] = redactRoute(c, r)
+	}
+	return redacted
+}
+
+// redactGlobalConfig returns cfg as non-admins may see it, without the
+// admin endpoint's identity and remote access settings, which hold issuer
+// credentials and client keys
+func redactGlobalConfig(c *gin.Context, cfg *storage.GlobalConfig) *storage.GlobalConfig {
+	if cfg == nil || cfg.Admin == nil || isAdmin(c) {
+		return cfg
+	}
+	redacted := *cfg
+	admin := *cfg.Admin
+	admin.Identity, admin.Remote = nil, nil
+	redacted.Admin = &admin
+	return &redacted
+}
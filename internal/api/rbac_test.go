@@ -0,0 +1,206 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ArtemStepanov/caddy-admin-ui/internal/storage"
+)
+
+// addUser creates a user with an API token and returns the token's secret
+func addUser(t *testing.T, store storage.Store, user *storage.User) string {
+	t.Helper()
+
+	user.SetPassword(user.Username + "-password")
+	if err := store.CreateUser(user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	secret := user.Username + "-token"
+	store.CreateAPIToken(&storage.APIToken{Name: "test", Username: user.Username, TokenHash: storage.HashToken(secret)})
+	return secret
+}
+
+// createRoute stores an enabled route for domain and returns its ID
+func createRoute(store storage.Store, domain string) string {
+	route := &storage.Route{Domain: domain, HandlerType: "static_response", Config: json.RawMessage(`{}`), Enabled: true}
+	store.CreateRoute(route)
+	return route.ID
+}
+
+func TestRBAC_Viewer(t *testing.T) {
+	router, store := setupAuth(t)
+	viewer := addUser(t, store, &storage.User{Username: "vera", Role: storage.RoleViewer})
+	id := createRoute(store, "app.example.com")
+
+	for _, path := range []string{"/api/routes", "/api/routes/" + id, "/api/servers", "/api/config", "/api/revisions", "/api/auth/me"} {
+		if w := doAuth(router, "GET", path, "", viewer, nil); w.Code != http.StatusOK {
+			t.Errorf("Expected viewer to read %s, got %d", path, w.Code)
+		}
+	}
+
+	tests := []struct {
+		method, path, body string
+	}{
+		{"POST", "/api/routes", `{"domain": "new.example.com", "handler_type": "static_response", "config": {}}`},
+		{"PUT", "/api/routes/" + id, `{"domain": "app.example.com", "handler_type": "static_response", "config": {}, "version": 1}`},
+		{"DELETE", "/api/routes/" + id, ""},
+		{"POST", "/api/routes/" + id + "/toggle", `{"version": 1}`},
+		{"POST", "/api/sync", ""},
+		{"PUT", "/api/config", `{"caddy_admin_url": "http://evil:2019"}`},
+		{"GET", "/api/users", ""},
+		{"GET", "/api/config/base", ""},
+		{"GET", "/api/config/preview", ""},
+		{"GET", "/api/revisions/1", ""},
+		{"GET", "/api/export/manifest", ""},
+		{"GET", "/api/export/caddyfile", ""},
+	}
+	for _, tt := range tests {
+		w := doAuth(router, tt.method, tt.path, tt.body, viewer, nil)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("Expected %s %s to be forbidden for a viewer, got %d", tt.method, tt.path, w.Code)
+		}
+		if !strings.Contains(w.Body.String(), "requires the") {
+			t.Errorf("Expected a reason for %s %s, got %s", tt.method, tt.path, w.Body.String())
+		}
+	}
+	if cfg, _ := store.GetGlobalConfig(); cfg.CaddyAdminURL == "http://evil:2019" {
+		t.Error("Expected the config to be unchanged")
+	}
+
+	// Everyone can change their own password, but not their role
+	if w := doAuth(router, "PUT", "/api/users/vera", `{"password": "better-password", "current_password": "vera-password"}`, viewer, nil); w.Code != http.StatusOK {
+		t.Errorf("Expected viewer to change their password, got %d", w.Code)
+	}
+	if w := doAuth(router, "PUT", "/api/users/vera", `{"role": "admin"}`, viewer, nil); w.Code != http.StatusForbidden {
+		t.Errorf("Expected viewer not to change their role, got %d", w.Code)
+	}
+	if w := doAuth(router, "PUT", "/api/users/admin", `{"password": "taken-over"}`, viewer, nil); w.Code != http.StatusForbidden {
+		t.Errorf("Expected viewer not to change another user's password, got %d", w.Code)
+	}
+}
+
+func TestRBAC_Redaction(t *testing.T) {
+	router, store := setupAuth(t)
+	viewer := addUser(t, store, &storage.User{Username: "vera", Role: storage.RoleViewer})
+	admin := addUser(t, store, &storage.User{Username: "ada", Role: storage.RoleAdmin})
+	auth := &storage.BasicAuthConfig{Enabled: true, Users: []storage.BasicAuthUser{{Username: "alice", Password: "secret"}}}
+	auth.HashPasswords()
+	route := &storage.Route{Domain: "app.example.com", HandlerType: "static_response", Config: json.RawMessage(`{}`), BasicAuth: auth, Enabled: true}
+	store.CreateRoute(route)
+	store.SetGlobalConfig(&storage.GlobalConfig{Admin: &storage.AdminSettings{
+		Listen:   "0.0.0.0:2019",
+		Identity: &storage.AdminIdentity{Identifiers: []string{"admin.example.com"}, Issuers: []json.RawMessage{json.RawMessage(`{"module":"acme","api_key":"hush"}`)}},
+	}})
+
+	for _, path := range []string{"/api/routes", "/api/routes/" + route.ID, "/api/config"} {
+		w := doAuth(router, "GET", path, "", viewer, nil)
+		if body := w.Body.String(); strings.Contains(body, auth.Users[0].Password) || strings.Contains(body, "hush") {
+			t.Errorf("Expected %s to hide credentials from a viewer, got %s", path, body)
+		}
+		if w := doAuth(router, "GET", path, "", admin, nil); w.Code != http.StatusOK {
+			t.Errorf("Expected admin to read %s, got %d", path, w.Code)
+		}
+	}
+	w := doAuth(router, "GET", "/api/routes/"+route.ID, "", admin, nil)
+	if !strings.Contains(w.Body.String(), auth.Users[0].Password) {
+		t.Errorf("Expected admins to see password hashes, got %s", w.Body.String())
+	}
+	if w := doAuth(router, "GET", "/api/config", "", viewer, nil); !strings.Contains(w.Body.String(), "0.0.0.0:2019") {
+		t.Errorf("Expected viewers to see the admin listen address, got %s", w.Body.String())
+	}
+	if stored, _ := store.GetRoute(route.ID); stored.BasicAuth.Users[0].Password != auth.Users[0].Password {
+		t.Error("Expected redaction not to change the stored route")
+	}
+}
+
+func TestRBAC_Editor(t *testing.T) {
+	router, store := setupAuth(t)
+	editor := addUser(t, store, &storage.User{Username: "ed", Role: storage.RoleEditor})
+	id := createRoute(store, "app.example.com")
+
+	if w := doAuth(router, "POST", "/api/routes/"+id+"/toggle", `{"version": 1}`, editor, nil); w.Code != http.StatusOK {
+		t.Errorf("Expected editor to toggle a route, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := doAuth(router, "POST", "/api/sync", "", editor, nil); w.Code == http.StatusForbidden {
+		t.Error("Expected editor to sync")
+	}
+	for _, path := range []string{"/api/import", "/api/import-preview", "/api/test-connection"} {
+		if w := doAuth(router, "POST", path, `{}`, editor, nil); w.Code != http.StatusForbidden {
+			t.Errorf("Expected %s to be forbidden for an editor, got %d", path, w.Code)
+		}
+	}
+	if w := doAuth(router, "POST", "/api/servers", `{"name": "internal", "listen": [":8080"]}`, editor, nil); w.Code != http.StatusForbidden {
+		t.Errorf("Expected server changes to be forbidden for an editor, got %d", w.Code)
+	}
+}
+
+func TestRBAC_DomainScope(t *testing.T) {
+	router, store := setupAuth(t)
+	editor := addUser(t, store, &storage.User{Username: "ed", Role: storage.RoleEditor, Domains: []string{"*.dev.example.com"}})
+	own := createRoute(store, "api.dev.example.com")
+	other := createRoute(store, "shop.example.com")
+
+	expect := func(method, path, body string, code int, what string) string {
+		t.Helper()
+		w := doAuth(router, method, path, body, editor, nil)
+		if w.Code != code {
+			t.Errorf("Expected %s to return %d, got %d: %s", what, code, w.Code, w.Body.String())
+		}
+		var response struct {
+			Error string `json:"error"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return response.Error
+	}
+
+	expect("POST", "/api/routes", `{"domain": "web.dev.example.com", "handler_type": "static_response", "config": {}}`, http.StatusCreated, "create in scope")
+	msg := expect("POST", "/api/routes", `{"domain": "shop.example.com", "handler_type": "static_response", "config": {}}`, http.StatusForbidden, "create out of scope")
+	if !strings.Contains(msg, "shop.example.com") || !strings.Contains(msg, "*.dev.example.com") {
+		t.Errorf("Expected the reason to name the domain and patterns, got %q", msg)
+	}
+
+	expect("PUT", "/api/routes/"+own, `{"domain": "shop.example.com", "handler_type": "static_response", "config": {}, "version": 1}`, http.StatusForbidden, "moving a route out of scope")
+	expect("PUT", "/api/routes/"+other, `{"domain": "shop.example.com", "handler_type": "static_response", "config": {}, "version": 1}`, http.StatusForbidden, "update out of scope")
+	expect("POST", "/api/routes/"+other+"/toggle", `{"version": 1}`, http.StatusForbidden, "toggle out of scope")
+	expect("DELETE", "/api/routes/"+other, "", http.StatusForbidden, "delete out of scope")
+	expect("POST", "/api/routes/bulk", `{"action": "disable", "ids": ["`+own+`", "`+other+`"]}`, http.StatusForbidden, "bulk including out of scope")
+	if route, _ := store.GetRoute(own); !route.Enabled {
+		t.Error("Expected a refused bulk action to change nothing")
+	}
+
+	expect("DELETE", "/api/routes/"+own, "", http.StatusOK, "delete in scope")
+	if _, err := store.GetRoute(other); err != nil {
+		t.Error("Expected the out of scope route to survive")
+	}
+}
+
+func TestRBAC_ManageUsers(t *testing.T) {
+	router, store := setupAuth(t)
+	cookie := login(t, router)
+
+	w := doAuth(router, "POST", "/api/users", `{"username": "ed", "password": "eds-password", "role": "editor", "domains": ["*.example.com"]}`, "", cookie)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	if w := doAuth(router, "POST", "/api/users", `{"username": "vera", "password": "veras-password"}`, "", cookie); !strings.Contains(w.Body.String(), `"role":"viewer"`) {
+		t.Errorf("Expected new users to be viewers by default, got %s", w.Body.String())
+	}
+	if w := doAuth(router, "POST", "/api/users", `{"username": "x", "password": "xs-password", "role": "root"}`, "", cookie); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an unknown role, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w := doAuth(router, "POST", "/api/users", `{"username": "x", "password": "xs-password", "domains": ["a.*.com"]}`, "", cookie); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a bad domain pattern, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	if w := doAuth(router, "PUT", "/api/users/admin", `{"role": "editor"}`, "", cookie); w.Code != http.StatusConflict {
+		t.Errorf("Expected status %d for demoting the last admin, got %d", http.StatusConflict, w.Code)
+	}
+	if w := doAuth(router, "PUT", "/api/users/ed", `{"domains": []}`, "", cookie); w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if ed, _ := store.GetUser("ed"); ed.Role != storage.RoleEditor || len(ed.Domains) != 0 || !ed.CheckPassword("eds-password") {
+		t.Errorf("Expected only the domains to change, got %+v", ed)
+	}
+}
@@ -0,0 +1,192 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ArtemStepanov/caddy-admin-ui/internal/config"
+	"github.com/ArtemStepanov/caddy-admin-ui/internal/storage"
+)
+
+const defaultRevisionLimit = 50
+
+// ListRevisions returns revision summaries, newest first
+func (h *Handler) ListRevisions(c *gin.Context) {
+	limit := defaultRevisionLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+			return
+		}
+		limit = n
+	}
+
+	revisions, err := h.store.ListRevisions(limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if revisions == nil {
+		revisions = []*storage.Revision{}
+	}
+	c.JSON(http.StatusOK, gin.H{"revisions": revisions})
+}
+
+// GetRevision returns a single revision with its config and route snapshot
+func (h *Handler) GetRevision(c *gin.Context) {
+	rev, ok := h.lookupRevision(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"revision": rev})
+}
+
+// RollbackRevision restores the route table from a revision and reloads
+// Caddy with the exact config stored in it. Other managed instances are
+// synced with the restored routes.
+func (h *Handler) RollbackRevision(c *gin.Context) {
+	rev, ok := h.lookupRevision(c)
+	if !ok {
+		return
+	}
+
+	// 1. Restore routes; any failure leaves the current routes untouched
+	var current []*storage.Route
+	err := h.store.WithTx(func(tx storage.RouteStore) error {
+		var err error
+		if current, err = tx.ListRoutes(); err != nil {
+			return err
+		}
+		versions := make(map[string]int64, len(current))
+		for _, r := range current {
+			versions[r.ID] = r.Version
+		}
+
+		if err := tx.DeleteAllRoutes(); err != nil {
+			return fmt.Errorf("failed to clear routes: %w", err)
+		}
+		for _, r := range rev.Routes {
+			// Versions keep increasing so edits based on the pre-rollback
+			// state are rejected
+			r.Version = max(r.Version, versions[r.ID]) + 1
+			if err := tx.CreateRoute(r); err != nil {
+				return fmt.Errorf("failed to restore route %s: %w", r.ID, err)
+			}
+		}
+
+		// Keep later syncs building on the revision's servers and
+		// non-route config
+		var revConfig config.CaddyConfig
+		if err := json.Unmarshal(rev.Config, &revConfig); err != nil {
+			return fmt.Errorf("failed to parse revision config: %w", err)
+		}
+		if err := replaceServers(tx, config.ParseCaddyServers(&revConfig)); err != nil {
+			return fmt.Errorf("failed to restore servers: %w", err)
+		}
+		base, err := config.ExtractBaseConfig(rev.Config)
+		if err != nil {
+			return fmt.Errorf("failed to restore base config: %w", err)
+		}
+		return tx.SetBaseConfig(base)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	recordRollback(c, rev, current)
+
+	// 2. Reload Caddy with the revision's config
+	if err := h.reloadRevision(rev); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"revision": rev.ID,
+			"restored": len(rev.Routes),
+			"warning":  "Routes restored but sync to Caddy failed: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"revision": rev.ID,
+		"restored": len(rev.Routes),
+		"message":  "Rolled back successfully",
+	})
+}
+
+// recordRollback records an audit event for every route a rollback to rev
+// changed, created or deleted, given the routes before it. The events name
+// the revision as their target.
+func recordRollback(c *gin.Context, rev *storage.Revision, current []*storage.Route) {
+	target := strconv.FormatInt(rev.ID, 10)
+	before := make(map[string]*storage.Route, len(current))
+	for _, r := range current {
+		before[r.ID] = r
+	}
+
+	restored := make(map[string]bool, len(rev.Routes))
+	for _, r := range rev.Routes {
+		restored[r.ID] = true
+		if prev := before[r.ID]; prev == nil || !storage.RoutesEqual(prev, r) {
+			recordChange(c, r.ID, target, prev, r)
+		}
+	}
+	for _, r := range current {
+		if !restored[r.ID] {
+			recordChange(c, r.ID, target, r, nil)
+		}
+	}
+}
+
+// reloadRevision loads a revision's config into the Caddy it was recorded
+// for and brings every other target in line with the restored routes
+func (h *Handler) reloadRevision(rev *storage.Revision) error {
+	targets, err := h.syncTargets()
+	if err != nil {
+		return err
+	}
+
+	found := false
+	var errs []error
+	for _, t := range targets {
+		if t.name != rev.Instance {
+			if err := h.syncTarget(t, storage.RevisionActionRollback, true); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", t.name, err))
+			}
+			continue
+		}
+		found = true
+		if err := h.loadConfig(t, storage.RevisionActionRollback, rev.Routes, rev.Config); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if !found {
+		errs = append(errs, fmt.Errorf("instance %q of the revision is no longer managed", rev.Instance))
+	}
+	return errors.Join(errs...)
+}
+
+// lookupRevision loads the revision named by the :id parameter and writes
+// an error response if it can't
+func (h *Handler) lookupRevision(c *gin.Context) (*storage.Revision, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid revision id"})
+		return nil, false
+	}
+
+	rev, err := h.store.GetRevision(id)
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "revision not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return rev, true
+}
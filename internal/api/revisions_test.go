@@ -0,0 +1,188 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ArtemStepanov/caddy-admin-ui/internal/storage"
+)
+
+func TestSync_RecordsRevision(t *testing.T) {
+	router, store, _, cleanup := setupTestRouterWithCaddy(t)
+	defer cleanup()
+
+	body := `{"domain": "example.com", "handler_type": "reverse_proxy", "config": {"upstreams": ["localhost:8080"]}}`
+	req := httptest.NewRequest("POST", "/api/routes", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	req = httptest.NewRequest("GET", "/api/revisions", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var response struct {
+		Revisions []storage.Revision `json:"revisions"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+
+	if len(response.Revisions) != 1 {
+		t.Fatalf("Expected 1 revision, got %d", len(response.Revisions))
+	}
+	rev := response.Revisions[0]
+	if rev.Action != storage.RevisionActionCreateRoute {
+		t.Errorf("Expected action %s, got %s", storage.RevisionActionCreateRoute, rev.Action)
+	}
+	if rev.RouteCount != 1 {
+		t.Errorf("Expected route count 1, got %d", rev.RouteCount)
+	}
+	if rev.Config != nil {
+		t.Error("Expected list to omit the full config")
+	}
+
+	stored, _ := store.GetRevision(rev.ID)
+	if len(stored.Routes) != 1 || stored.Routes[0].Domain != "example.com" {
+		t.Errorf("Expected route snapshot, got %+v", stored.Routes)
+	}
+}
+
+func TestSync_FailureRecordsNoRevision(t *testing.T) {
+	router, store, cleanup := setupTestRouter(t)
+	defer cleanup()
+
+	store.SetGlobalConfig(&storage.GlobalConfig{CaddyAdminURL: "http://localhost:29999"})
+
+	req := httptest.NewRequest("POST", "/api/sync", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	revisions, _ := store.ListRevisions(10)
+	if len(revisions) != 0 {
+		t.Errorf("Expected no revisions after failed sync, got %d", len(revisions))
+	}
+}
+
+func TestGetRevision(t *testing.T) {
+	router, store, cleanup := setupTestRouter(t)
+	defer cleanup()
+
+	rev := &storage.Revision{
+		Action: storage.RevisionActionSync,
+		Config: json.RawMessage(`{"admin":{"listen":"0.0.0.0:2019"}}`),
+	}
+	store.CreateRevision(rev)
+
+	t.Run("existing", func(t *testing.T) {
+		req := httptest.NewRequest("GET", fmt.Sprintf("/api/revisions/%d", rev.ID), nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+		}
+
+		var response struct {
+			Revision storage.Revision `json:"revision"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		if string(response.Revision.Config) != string(rev.Config) {
+			t.Errorf("Expected config %s, got %s", rev.Config, response.Revision.Config)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/revisions/999", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+		}
+	})
+
+	t.Run("invalid id", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/revisions/abc", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+		}
+	})
+}
+
+func TestRollbackRevision(t *testing.T) {
+	router, store, fc, cleanup := setupTestRouterWithCaddy(t)
+	defer cleanup()
+
+	// Revision 1: a single route
+	first := &storage.Route{
+		Domain:        "first.example.com",
+		HandlerType:   "reverse_proxy",
+		Config:        json.RawMessage(`{"upstreams":["localhost:8080"]}`),
+		Enabled:       true,
+		RawCaddyRoute: json.RawMessage(`{"handle":[{"handler":"custom"}]}`),
+	}
+	store.CreateRoute(first)
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/sync", nil))
+	firstConfig := fc.loadedConfig()
+
+	revisions, _ := store.ListRevisions(1)
+	target := revisions[0].ID
+
+	// Change the route table
+	store.DeleteRoute(first.ID)
+	second := &storage.Route{
+		Domain:      "second.example.com",
+		HandlerType: "reverse_proxy",
+		Config:      json.RawMessage(`{"upstreams":["localhost:9090"]}`),
+		Enabled:     true,
+	}
+	store.CreateRoute(second)
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/sync", nil))
+
+	// Roll back to revision 1
+	req := httptest.NewRequest("POST", fmt.Sprintf("/api/revisions/%d/rollback", target), nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	routes, _ := store.ListRoutes()
+	if len(routes) != 1 || routes[0].ID != first.ID {
+		t.Fatalf("Expected routes to be restored to revision %d, got %+v", target, routes)
+	}
+	if string(routes[0].RawCaddyRoute) != string(first.RawCaddyRoute) {
+		t.Errorf("Expected RawCaddyRoute to be restored, got %s", routes[0].RawCaddyRoute)
+	}
+	if !routes[0].CreatedAt.Equal(first.CreatedAt) {
+		t.Errorf("Expected the route to keep its creation time %v, got %v", first.CreatedAt, routes[0].CreatedAt)
+	}
+
+	if string(fc.loadedConfig()) != string(firstConfig) {
+		t.Errorf("Expected Caddy to be reloaded with revision config\nExpected: %s\nGot: %s", firstConfig, fc.loadedConfig())
+	}
+
+	latest, _ := store.ListRevisions(1)
+	if latest[0].Action != storage.RevisionActionRollback {
+		t.Errorf("Expected rollback to be recorded as a revision, got %s", latest[0].Action)
+	}
+
+	// The restored and the removed route are audited, naming the revision
+	restored, _ := store.ListAuditEvents(storage.AuditFilter{RouteID: first.ID, Action: "rollback"})
+	if len(restored) != 1 || restored[0].Before != nil || restored[0].After == nil || restored[0].Target != fmt.Sprint(target) {
+		t.Errorf("Expected a rollback event recreating the first route, got %+v", restored)
+	}
+	removed, _ := store.ListAuditEvents(storage.AuditFilter{RouteID: second.ID, Action: "rollback"})
+	if len(removed) != 1 || removed[0].Before == nil || removed[0].After != nil {
+		t.Errorf("Expected a rollback event deleting the second route, got %+v", removed)
+	}
+}
@@ -0,0 +1,218 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ArtemStepanov/caddy-admin-ui/internal/storage"
+)
+
+// probeTimeout bounds each rollout probe request
+const probeTimeout = 5 * time.Second
+
+// rollout syncs targets in stages: the canary first, then the rest in
+// batches. An instance counts as updated once its config was pushed and it
+// passed verification. If any instance in a stage fails, every instance
+// attempted so far is loaded with the config it ran before and the
+// remaining stages are skipped. Revisions are only recorded if the whole rollout
+// succeeds.
+func (h *Handler) rollout(targets []syncTarget, action string, force bool, settings *storage.RolloutSettings) ([]InstanceSyncResult, error) {
+	stages, err := rolloutStages(targets, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]InstanceSyncResult, len(targets))
+	for i, t := range targets {
+		results[i] = InstanceSyncResult{Instance: t.name}
+	}
+	pushed := make([]*pushedConfig, len(targets))
+	previous := make([]json.RawMessage, len(targets))
+
+	for n, stage := range stages {
+		var wg sync.WaitGroup
+		for _, i := range stage {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				t := targets[i]
+				results[i].Stage = n + 1
+
+				prev, err := t.client.GetConfig("")
+				if err != nil {
+					results[i].Error = err.Error()
+					return
+				}
+				previous[i] = prev
+
+				pushed[i] = h.pushResult(t, force, &results[i])
+				if pushed[i] == nil {
+					return
+				}
+				if err := verifyInstance(t, settings.Probes); err != nil {
+					results[i].Error = "verification failed: " + err.Error()
+				}
+			}()
+		}
+		wg.Wait()
+
+		failed := false
+		for _, i := range stage {
+			failed = failed || results[i].Error != ""
+		}
+		if !failed {
+			continue
+		}
+
+		// Restore every instance that was attempted, including those whose
+		// push failed halfway and left part of the new config live
+		cause := fmt.Sprintf("stage %d of the rollout failed", n+1)
+		for i, t := range targets {
+			switch {
+			case previous[i] != nil:
+				h.restoreTarget(t, previous[i], cause, &results[i])
+			case results[i].Stage == 0:
+				results[i].Skipped = true
+			}
+		}
+		return results, &fleetSyncError{Results: results}
+	}
+
+	for i, t := range targets {
+		h.recordRevision(t, action, pushed[i])
+	}
+	return results, nil
+}
+
+// validateRollout returns what is wrong with rollout settings, or ""
+func validateRollout(settings *storage.RolloutSettings) string {
+	if settings == nil {
+		return ""
+	}
+	if settings.BatchSize < 0 {
+		return "rollout batch_size must not be negative"
+	}
+	for _, p := range settings.Probes {
+		if !strings.HasPrefix(p.URL, "http://") && !strings.HasPrefix(p.URL, "https://") {
+			return "rollout probe url must be an http:// or https:// URL"
+		}
+		if p.ExpectStatus != 0 && (p.ExpectStatus < 100 || p.ExpectStatus > 599) {
+			return "rollout probe expect_status must be an HTTP status code"
+		}
+	}
+	return ""
+}
+
+// rolloutStages splits targets into stages of target indexes: the canary
+// on its own, then batches of the others in name order
+func rolloutStages(targets []syncTarget, settings *storage.RolloutSettings) ([][]int, error) {
+	canary := 0
+	if settings.Canary != "" {
+		canary = -1
+		for i, t := range targets {
+			if t.name == settings.Canary {
+				canary = i
+			}
+		}
+		if canary < 0 {
+			return nil, fmt.Errorf("rollout canary %q is not a registered instance", settings.Canary)
+		}
+	}
+
+	batchSize := max(settings.BatchSize, 1)
+	stages := [][]int{{canary}}
+	var batch []int
+	for i := range targets {
+		if i == canary {
+			continue
+		}
+		batch = append(batch, i)
+		if len(batch) == batchSize {
+			stages = append(stages, batch)
+			batch = nil
+		}
+	}
+	if len(batch) > 0 {
+		stages = append(stages, batch)
+	}
+	return stages, nil
+}
+
+// restoreTarget loads the config a target ran before the rollout, marking
+// the result as rolled back. The target's sync state keeps the cause.
+func (h *Handler) restoreTarget(t syncTarget, previous json.RawMessage, cause string, result *InstanceSyncResult) {
+	if err := h.load(t, previous); err != nil {
+		msg := "rollback failed: " + err.Error()
+		if result.Error != "" {
+			msg = result.Error + "; " + msg
+		}
+		result.Error = msg
+		return
+	}
+	result.RolledBack = true
+	h.recordSync(t, syncModeLoad, fmt.Errorf("rolled back: %s", cause))
+}
+
+// verifyInstance checks that an instance works after an update: its admin
+// API answers and every probe gets the expected status
+func verifyInstance(t syncTarget, probes []storage.RolloutProbe) error {
+	if err := t.client.Health(); err != nil {
+		return fmt.Errorf("health check: %w", err)
+	}
+	for _, p := range probes {
+		if err := runProbe(instanceHost(t.instance.AdminURL), p); err != nil {
+			return fmt.Errorf("probe %s: %w", p.URL, err)
+		}
+	}
+	return nil
+}
+
+// runProbe sends a probe to the node at host. Redirects are not followed,
+// so a redirecting route can be probed for its 3xx.
+func runProbe(host string, p storage.RolloutProbe) error {
+	req, err := http.NewRequest(http.MethodGet, strings.ReplaceAll(p.URL, "{host}", host), nil)
+	if err != nil {
+		return err
+	}
+	if p.Host != "" {
+		req.Host = p.Host
+	}
+
+	client := &http.Client{
+		Timeout: probeTimeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if p.ExpectStatus != 0 && resp.StatusCode != p.ExpectStatus {
+		return fmt.Errorf("expected status %d, got %d", p.ExpectStatus, resp.StatusCode)
+	}
+	if p.ExpectStatus == 0 && (resp.StatusCode < 200 || resp.StatusCode >= 400) {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// instanceHost returns the host of an instance's admin URL. Instances
+// reached over a unix socket are assumed to be local.
+func instanceHost(adminURL string) string {
+	if strings.HasPrefix(adminURL, "unix/") {
+		return "localhost"
+	}
+	u, err := url.Parse(adminURL)
+	if err != nil || u.Hostname() == "" {
+		return "localhost"
+	}
+	return u.Hostname()
+}
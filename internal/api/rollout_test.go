@@ -0,0 +1,204 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/ArtemStepanov/caddy-admin-ui/internal/storage"
+)
+
+func TestRolloutStages(t *testing.T) {
+	targets := []syncTarget{{name: "a"}, {name: "b"}, {name: "c"}, {name: "d"}}
+
+	stages, err := rolloutStages(targets, &storage.RolloutSettings{Canary: "c", BatchSize: 2})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := [][]int{{2}, {0, 1}, {3}}; !reflect.DeepEqual(stages, want) {
+		t.Errorf("Expected stages %v, got %v", want, stages)
+	}
+
+	stages, _ = rolloutStages(targets, &storage.RolloutSettings{})
+	if want := [][]int{{0}, {1}, {2}, {3}}; !reflect.DeepEqual(stages, want) {
+		t.Errorf("Expected one instance per stage by default, got %v", stages)
+	}
+
+	if _, err := rolloutStages(targets, &storage.RolloutSettings{Canary: "z"}); err == nil {
+		t.Error("Expected error for unknown canary")
+	}
+}
+
+// probeServer answers every request with status
+func probeServer(t *testing.T, status int) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// setupRollout registers two fake instances with a route and a staged
+// rollout that probes url
+func setupRollout(t *testing.T, url string) (*fakeCaddy, *fakeCaddy, func(method, path, body string) (int, map[string]any), storage.Store) {
+	t.Helper()
+
+	a, b, do, store := setupFleet(t)
+	store.SetGlobalConfig(&storage.GlobalConfig{Rollout: &storage.RolloutSettings{
+		Probes: []storage.RolloutProbe{{URL: url, Host: "example.com"}},
+	}})
+	store.CreateRoute(&storage.Route{
+		Domain:      "example.com",
+		HandlerType: "reverse_proxy",
+		Config:      json.RawMessage(`{"upstreams":["localhost:8080"]}`),
+		Enabled:     true,
+	})
+	return a, b, do, store
+}
+
+func TestRollout_Success(t *testing.T) {
+	probe := probeServer(t, http.StatusOK)
+	_, _, do, store := setupRollout(t, probe.URL+"/healthz")
+
+	code, response := do("POST", "/api/sync", "")
+	if code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %v", http.StatusOK, code, response)
+	}
+	results, _ := response["results"].([]any)
+	if len(results) != 2 {
+		t.Fatalf("Expected a result per instance, got %v", response)
+	}
+	for i, r := range results {
+		if stage := r.(map[string]any)["stage"]; stage != float64(i+1) {
+			t.Errorf("Expected %v in stage %d, got %v", r, i+1, stage)
+		}
+	}
+	if revisions, _ := store.ListRevisions(10); len(revisions) != 2 {
+		t.Errorf("Expected a revision per instance, got %d", len(revisions))
+	}
+}
+
+func TestRollout_CanaryFailureSkipsRest(t *testing.T) {
+	probe := probeServer(t, http.StatusServiceUnavailable)
+	a, b, do, store := setupRollout(t, probe.URL+"/healthz")
+	before := a.loadedConfig()
+
+	code, response := do("POST", "/api/sync", "")
+	if code != http.StatusBadGateway {
+		t.Fatalf("Expected status %d, got %d: %v", http.StatusBadGateway, code, response)
+	}
+	results, _ := response["results"].([]any)
+	canary, rest := results[0].(map[string]any), results[1].(map[string]any)
+	if canary["rolled_back"] != true || canary["error"] == nil {
+		t.Errorf("Expected canary to fail verification and be rolled back, got %v", canary)
+	}
+	if rest["skipped"] != true {
+		t.Errorf("Expected edge-b to be skipped, got %v", rest)
+	}
+
+	if string(a.loadedConfig()) != string(before) {
+		t.Errorf("Expected canary config to be restored, got %s", a.loadedConfig())
+	}
+	if b.loads != 0 || len(b.routeOps()) != 0 {
+		t.Error("Expected edge-b to be left alone")
+	}
+	if revisions, _ := store.ListRevisions(10); len(revisions) != 0 {
+		t.Errorf("Expected no revisions for a failed rollout, got %d", len(revisions))
+	}
+}
+
+func TestRollout_BatchFailureRollsBackUpdated(t *testing.T) {
+	probe := probeServer(t, http.StatusOK)
+	a, b, do, store := setupRollout(t, probe.URL)
+	previous := json.RawMessage(`{"apps":{"http":{"servers":{"old":{"listen":[":80"]}}}}}`)
+	a.setConfig(previous)
+	b.setConfig(previous)
+	store.CreateInstance(&storage.Instance{Name: "edge-c", AdminURL: "http://localhost:29999"})
+
+	code, response := do("POST", "/api/sync", "")
+	if code != http.StatusBadGateway {
+		t.Fatalf("Expected status %d, got %d: %v", http.StatusBadGateway, code, response)
+	}
+	results, _ := response["results"].([]any)
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %v", response)
+	}
+	for _, r := range results[:2] {
+		if result := r.(map[string]any); result["rolled_back"] != true || result["error"] != nil {
+			t.Errorf("Expected updated instance to be rolled back cleanly, got %v", result)
+		}
+	}
+	if failed := results[2].(map[string]any); failed["error"] == nil || failed["stage"] != float64(3) {
+		t.Errorf("Expected edge-c to fail in stage 3, got %v", failed)
+	}
+
+	for _, fc := range []*fakeCaddy{a, b} {
+		if string(fc.loadedConfig()) != string(previous) {
+			t.Errorf("Expected previous config to be restored, got %s", fc.loadedConfig())
+		}
+	}
+
+	// The restored config is the baseline, so the next sync isn't a conflict
+	store.DeleteInstance("edge-c")
+	if code, response := do("POST", "/api/sync", ""); code != http.StatusOK {
+		t.Errorf("Expected sync after rollback to succeed, got %d: %v", code, response)
+	}
+}
+
+func TestRollout_PartialPushIsRolledBack(t *testing.T) {
+	probe := probeServer(t, http.StatusOK)
+	a, b, do, store := setupRollout(t, probe.URL)
+	if code, response := do("POST", "/api/sync", ""); code != http.StatusOK {
+		t.Fatalf("Expected the first sync to succeed, got %d: %v", code, response)
+	}
+	previousA, previousB := a.loadedConfig(), b.loadedConfig()
+	a.routeOps()
+
+	// edge-b applies the first new route, then fails on the second and on
+	// the full load that follows
+	for _, domain := range []string{"one.example.com", "two.example.com"} {
+		store.CreateRoute(&storage.Route{Domain: domain, HandlerType: "reverse_proxy", Config: json.RawMessage(`{"upstreams":["localhost:8080"]}`), Enabled: true})
+	}
+	b.mu.Lock()
+	b.failOps, b.okOps, b.failLoads = true, 1, 1
+	b.mu.Unlock()
+
+	code, response := do("POST", "/api/sync", "")
+	if code != http.StatusBadGateway {
+		t.Fatalf("Expected status %d, got %d: %v", http.StatusBadGateway, code, response)
+	}
+	results, _ := response["results"].([]any)
+	if failed := results[1].(map[string]any); failed["rolled_back"] != true || failed["error"] == nil {
+		t.Errorf("Expected edge-b to fail and be rolled back, got %v", failed)
+	}
+	if string(b.loadedConfig()) != string(previousB) {
+		t.Errorf("Expected the half-applied config of edge-b to be restored, got %s", b.loadedConfig())
+	}
+	if string(a.loadedConfig()) != string(previousA) {
+		t.Errorf("Expected the canary to be restored, got %s", a.loadedConfig())
+	}
+}
+
+func TestUpdateConfig_InvalidRollout(t *testing.T) {
+	router, _, cleanup := setupTestRouter(t)
+	defer cleanup()
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"negative batch size", `{"rollout": {"batch_size": -1}}`},
+		{"probe without scheme", `{"rollout": {"probes": [{"url": "example.com/healthz"}]}}`},
+		{"bad expected status", `{"rollout": {"probes": [{"url": "http://{host}/", "expect_status": 42}]}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := doJSON(router, "PUT", "/api/config", tt.body); w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+			}
+		})
+	}
+}
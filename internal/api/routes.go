@@ -1,46 +1,122 @@
 package api
 
 import (
+	"slices"
+
 	"github.com/gin-gonic/gin"
 
 	"github.com/ArtemStepanov/caddy-admin-ui/internal/storage"
 )
 
-// SetupRoutes configures all API routes
-func SetupRoutes(r *gin.Engine, store *storage.SQLiteStorage, defaultCaddyURL string) {
+// SetupRoutes configures all API routes and returns the handler so callers
+// can start its background jobs. corsOrigins lists the origins allowed to
+// call the API from a browser besides the UI itself; "*" allows any.
+func SetupRoutes(r *gin.Engine, store storage.Store, defaultCaddyURL string, corsOrigins []string) *Handler {
 	h := NewHandler(store, defaultCaddyURL)
 
 	// Enable CORS
-	r.Use(corsMiddleware())
+	r.Use(corsMiddleware(corsOrigins))
+
+	// Login and the liveness check don't need a signed-in user
+	r.POST("/api/auth/login", h.auditTrail, h.Login)
+	r.GET("/api/health", h.Health)
 
-	api := r.Group("/api")
+	// Viewers can read routes, servers, instances and status, editors can
+	// also change routes and sync, and admins can do everything else,
+	// including reading the full configs, which hold credentials. Changes
+	// are recorded in the audit log.
+	api := r.Group("/api", h.requireAuth, h.auditTrail)
+	editor := requireRole(storage.RoleEditor)
+	admin := requireRole(storage.RoleAdmin)
 	{
-		// Routes CRUD
+		// Authentication
+		api.POST("/auth/logout", h.Logout)
+		api.GET("/auth/me", h.GetCurrentUser)
+
+		// Users and API tokens. Anyone can change their own password and
+		// manage their own tokens.
+		api.GET("/users", admin, h.ListUsers)
+		api.POST("/users", admin, h.CreateUser)
+		api.PUT("/users/:username", h.UpdateUser)
+		api.DELETE("/users/:username", admin, h.DeleteUser)
+		api.GET("/tokens", h.ListAPITokens)
+		api.POST("/tokens", h.CreateAPIToken)
+		api.DELETE("/tokens/:id", h.DeleteAPIToken)
+
+		// Routes CRUD, limited to their domains for scoped editors
 		api.GET("/routes", h.ListRoutes)
-		api.POST("/routes", h.CreateRoute)
+		api.POST("/routes", editor, h.CreateRoute)
+		api.POST("/routes/bulk", editor, h.BulkRouteAction)
 		api.GET("/routes/:id", h.GetRoute)
-		api.PUT("/routes/:id", h.UpdateRoute)
-		api.DELETE("/routes/:id", h.DeleteRoute)
-		api.POST("/routes/:id/toggle", h.ToggleRoute)
+		api.PUT("/routes/:id", editor, h.UpdateRoute)
+		api.DELETE("/routes/:id", editor, h.DeleteRoute)
+		api.POST("/routes/:id/toggle", editor, h.ToggleRoute)
+
+		// Servers CRUD
+		api.GET("/servers", h.ListServers)
+		api.POST("/servers", admin, h.CreateServer)
+		api.GET("/servers/:name", h.GetServer)
+		api.PUT("/servers/:name", admin, h.UpdateServer)
+		api.DELETE("/servers/:name", admin, h.DeleteServer)
+
+		// Managed Caddy instances
+		api.GET("/instances", h.ListInstances)
+		api.POST("/instances", admin, h.CreateInstance)
+		api.GET("/instances/:name", h.GetInstance)
+		api.PUT("/instances/:name", admin, h.UpdateInstance)
+		api.DELETE("/instances/:name", admin, h.DeleteInstance)
 
 		// Global config
 		api.GET("/config", h.GetConfig)
-		api.PUT("/config", h.UpdateConfig)
+		api.PUT("/config", admin, h.UpdateConfig)
+		api.GET("/config/preview", admin, h.PreviewConfig)
+		api.GET("/config/base", admin, h.GetBaseConfig)
+		api.PUT("/config/base", admin, h.UpdateBaseConfig)
 
 		// Caddy status
 		api.GET("/status", h.GetStatus)
-		api.POST("/sync", h.SyncToCaddy)
-		api.POST("/test-connection", h.TestConnection)
-		api.POST("/import-preview", h.PreviewImport)
-		api.POST("/import", h.ImportFromCaddy)
+		api.POST("/sync", editor, h.SyncToCaddy)
+		api.POST("/test-connection", admin, h.TestConnection)
+		api.POST("/import-preview", admin, h.PreviewImport)
+		api.POST("/import", admin, h.ImportFromCaddy)
+		api.POST("/import-preview/caddyfile", admin, h.PreviewCaddyfileImport)
+		api.POST("/import/caddyfile", admin, h.ImportCaddyfile)
+		api.GET("/export/caddyfile", admin, h.ExportCaddyfile)
+		api.GET("/export/manifest", admin, h.ExportManifest)
+		api.POST("/apply", admin, h.ApplyManifest)
+
+		// Revision history
+		api.GET("/revisions", h.ListRevisions)
+		api.GET("/revisions/:id", admin, h.GetRevision)
+		api.POST("/revisions/:id/rollback", admin, h.RollbackRevision)
+
+		// Audit log
+		api.GET("/audit", admin, h.ListAuditEvents)
+		api.GET("/audit/export", admin, h.ExportAuditEvents)
 	}
+
+	return h
 }
 
-func corsMiddleware() gin.HandlerFunc {
+// corsMiddleware allows cross-origin requests from the given origins. Only
+// listed origins may send the session cookie; with "*" any origin can call
+// the API, but only with an API token.
+func corsMiddleware(origins []string) gin.HandlerFunc {
+	anyOrigin := slices.Contains(origins, "*")
 	return func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
+		c.Header("Vary", "Origin")
+		origin := c.GetHeader("Origin")
+		switch {
+		case origin != "" && slices.Contains(origins, origin):
+			c.Header("Access-Control-Allow-Origin", origin)
+			c.Header("Access-Control-Allow-Credentials", "true")
+		case anyOrigin:
+			c.Header("Access-Control-Allow-Origin", "*")
+		}
 		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, If-Match")
+		// Clients need the ETag of a route to send it back in If-Match
+		c.Header("Access-Control-Expose-Headers", "ETag")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
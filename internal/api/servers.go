@@ -0,0 +1,249 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ArtemStepanov/caddy-admin-ui/internal/config"
+	"github.com/ArtemStepanov/caddy-admin-ui/internal/storage"
+)
+
+// namePattern limits server and instance names to what is safe in config
+// paths and URLs
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// serverProtocols are the protocols a Caddy server can be configured with
+var serverProtocols = map[string]bool{"h1": true, "h2": true, "h2c": true, "h3": true}
+
+// ListServers returns all servers
+func (h *Handler) ListServers(c *gin.Context) {
+	servers, err := h.store.ListServers()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if servers == nil {
+		servers = []*storage.Server{}
+	}
+	c.JSON(http.StatusOK, gin.H{"servers": servers})
+}
+
+// GetServer returns a single server
+func (h *Handler) GetServer(c *gin.Context) {
+	server, err := h.store.GetServer(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "server not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"server": server})
+}
+
+// CreateServer creates a new server
+func (h *Handler) CreateServer(c *gin.Context) {
+	var server storage.Server
+	if err := c.ShouldBindJSON(&server); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !validateServer(c, &server) {
+		return
+	}
+
+	err := h.store.CreateServer(&server)
+	if errors.Is(err, storage.ErrServerExists) {
+		c.JSON(http.StatusConflict, gin.H{"error": "server " + server.Name + " already exists"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	recordChange(c, "", server.Name, nil, &server)
+
+	// Auto-sync to Caddy
+	if err := h.syncToCaddy(storage.RevisionActionCreateServer); err != nil {
+		c.JSON(http.StatusCreated, gin.H{
+			"server":  server,
+			"warning": "Server created but sync to Caddy failed: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"server": server})
+}
+
+// UpdateServer updates an existing server. The name can't be changed.
+func (h *Handler) UpdateServer(c *gin.Context) {
+	var server storage.Server
+	if err := c.ShouldBindJSON(&server); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	server.Name = c.Param("name")
+	if !validateServer(c, &server) {
+		return
+	}
+
+	var before *storage.Server
+	err := h.store.WithTx(func(tx storage.RouteStore) error {
+		var err error
+		if before, err = tx.GetServer(server.Name); err != nil {
+			return err
+		}
+		return tx.UpdateServer(&server)
+	})
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "server not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	recordChange(c, "", server.Name, before, &server)
+
+	// Auto-sync to Caddy
+	if err := h.syncToCaddy(storage.RevisionActionUpdateServer); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"server":  server,
+			"warning": "Server updated but sync to Caddy failed: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"server": server})
+}
+
+// DeleteServer deletes a server that no route references anymore
+func (h *Handler) DeleteServer(c *gin.Context) {
+	name := c.Param("name")
+
+	var deleted *storage.Server
+	var inUse int
+	err := h.store.WithTx(func(tx storage.RouteStore) error {
+		var err error
+		if deleted, err = tx.GetServer(name); err != nil {
+			return err
+		}
+		routes, err := tx.ListRoutes()
+		if err != nil {
+			return err
+		}
+		for _, r := range routes {
+			if r.Server == name {
+				inUse++
+			}
+		}
+		if inUse > 0 {
+			return nil
+		}
+		return deleteServer(tx, name)
+	})
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "server not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if inUse > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "server is used by routes", "routes": inUse})
+		return
+	}
+	recordChange(c, "", name, deleted, nil)
+
+	// Auto-sync to Caddy
+	if err := h.syncToCaddy(storage.RevisionActionDeleteServer); err != nil {
+		msg := "Server deleted but sync to Caddy failed: " + err.Error()
+		recordWarning(c, msg)
+		c.JSON(http.StatusOK, gin.H{"message": msg})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "server deleted"})
+}
+
+// validateServer checks a server's fields, writing a 400 if they're invalid
+func validateServer(c *gin.Context, server *storage.Server) bool {
+	if msg := serverProblem(server); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return false
+	}
+	return true
+}
+
+// serverProblem returns what is wrong with a server's fields, or ""
+func serverProblem(server *storage.Server) string {
+	if !namePattern.MatchString(server.Name) {
+		return "name must only contain letters, digits, '-' and '_'"
+	}
+	if len(server.Listen) == 0 {
+		return "listen is required"
+	}
+	for _, p := range server.Protocols {
+		if !serverProtocols[p] {
+			return "unknown protocol " + p + " (use h1, h2, h2c or h3)"
+		}
+	}
+	return ""
+}
+
+// checkRouteServer writes a 400 if a route references a server that
+// doesn't exist. No server and the default server are always fine.
+func (h *Handler) checkRouteServer(c *gin.Context, route *storage.Route) bool {
+	if route.Server == "" || route.Server == storage.DefaultServerName {
+		return true
+	}
+	if _, err := h.store.GetServer(route.Server); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown server " + route.Server})
+		return false
+	}
+	return true
+}
+
+// replaceServers makes servers the only stored servers
+func replaceServers(rs storage.RouteStore, servers []*storage.Server) error {
+	if err := rs.DeleteAllServers(); err != nil {
+		return err
+	}
+	for _, s := range servers {
+		if err := rs.CreateServer(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteServer deletes a server along with its options in the base config
+func deleteServer(rs storage.RouteStore, name string) error {
+	if err := rs.DeleteServer(name); err != nil {
+		return err
+	}
+	base, err := rs.GetBaseConfig()
+	if err != nil {
+		return err
+	}
+	base, removed, err := config.RemoveBaseServer(base, name)
+	if err != nil || !removed {
+		return err
+	}
+	return rs.SetBaseConfig(base)
+}
+
+// mergeServers creates or updates servers by name, keeping any others
+func mergeServers(rs storage.RouteStore, servers []*storage.Server) error {
+	for _, s := range servers {
+		err := rs.UpdateServer(s)
+		if errors.Is(err, storage.ErrNotFound) {
+			err = rs.CreateServer(s)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ArtemStepanov/caddy-admin-ui/internal/config"
+	"github.com/ArtemStepanov/caddy-admin-ui/internal/storage"
+)
+
+// doJSON sends a JSON request to router and returns the recorder
+func doJSON(router *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestServerCRUD(t *testing.T) {
+	router, store, cleanup := setupTestRouter(t)
+	defer cleanup()
+
+	w := doJSON(router, "POST", "/api/servers", `{"name": "internal", "listen": [":8080"], "protocols": ["h1", "h2"], "automatic_https": {"disable": true}}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	if w := doJSON(router, "POST", "/api/servers", `{"name": "internal", "listen": [":8081"]}`); w.Code != http.StatusConflict {
+		t.Errorf("Expected status %d for duplicate name, got %d", http.StatusConflict, w.Code)
+	}
+
+	w = doJSON(router, "PUT", "/api/servers/internal", `{"name": "ignored", "listen": [":9090"]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	w = doJSON(router, "GET", "/api/servers/internal", "")
+	var response struct {
+		Server storage.Server `json:"server"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if response.Server.Name != "internal" || response.Server.Listen[0] != ":9090" || response.Server.AutomaticHTTPS != nil {
+		t.Errorf("Unexpected server after update: %+v", response.Server)
+	}
+
+	if w := doJSON(router, "PUT", "/api/servers/missing", `{"listen": [":80"]}`); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	// Options of the server kept in the base config go with it
+	store.SetBaseConfig(json.RawMessage(`{"apps":{"http":{"servers":{"internal":{"idle_timeout":"1m"},"srv0":{"idle_timeout":"2m"}}}}}`))
+	w = doJSON(router, "DELETE", "/api/servers/internal", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if base, _ := store.GetBaseConfig(); strings.Contains(string(base), "internal") || !strings.Contains(string(base), "srv0") {
+		t.Errorf("Expected only the deleted server to be removed from the base config, got %s", base)
+	}
+	if w := doJSON(router, "GET", "/api/servers/internal", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected deleted server to be gone, got %d", w.Code)
+	}
+	if w := doJSON(router, "DELETE", "/api/servers/internal", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for a missing server, got %d", http.StatusNotFound, w.Code)
+	}
+
+	// Updates and deletes are audited with the server as it was
+	update, _ := store.ListAuditEvents(storage.AuditFilter{Action: "update_server"})
+	if len(update) != 2 || !strings.Contains(string(update[1].Before), ":8080") || !strings.Contains(string(update[1].After), ":9090") {
+		t.Errorf("Expected the update to record the server before and after, got %+v", update)
+	}
+	del, _ := store.ListAuditEvents(storage.AuditFilter{Action: "delete_server"})
+	if len(del) != 2 || !strings.Contains(string(del[1].Before), ":9090") || del[1].After != nil {
+		t.Errorf("Expected the delete to record the deleted server, got %+v", del)
+	}
+}
+
+func TestCreateServer_Validation(t *testing.T) {
+	router, _, cleanup := setupTestRouter(t)
+	defer cleanup()
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"invalid name", `{"name": "a/b", "listen": [":80"]}`},
+		{"missing listen", `{"name": "web"}`},
+		{"unknown protocol", `{"name": "web", "listen": [":80"], "protocols": ["spdy"]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := doJSON(router, "POST", "/api/servers", tt.body); w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+			}
+		})
+	}
+}
+
+func TestServers_RouteReferences(t *testing.T) {
+	router, store, fc, cleanup := setupTestRouterWithCaddy(t)
+	defer cleanup()
+
+	route := `{"domain": "admin.internal", "handler_type": "reverse_proxy", "config": {"upstreams": ["localhost:8080"]}, "server": "internal"}`
+	if w := doJSON(router, "POST", "/api/routes", route); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for unknown server, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	doJSON(router, "POST", "/api/servers", `{"name": "internal", "listen": [":8080"]}`)
+	if w := doJSON(router, "POST", "/api/routes", route); w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	doJSON(router, "POST", "/api/routes", `{"domain": "example.com", "handler_type": "reverse_proxy", "config": {"upstreams": ["localhost:9000"]}}`)
+
+	var loaded config.CaddyConfig
+	json.Unmarshal(fc.loadedConfig(), &loaded)
+	servers := loaded.Apps.HTTP.Servers
+	if servers["internal"] == nil || len(servers["internal"].Routes) != 1 || servers["internal"].Listen[0] != ":8080" {
+		t.Errorf("Expected admin.internal on the internal server, got %+v", servers["internal"])
+	}
+	if servers["srv0"] == nil || len(servers["srv0"].Routes) != 1 {
+		t.Errorf("Expected example.com on the default server, got %+v", servers["srv0"])
+	}
+
+	w := doJSON(router, "DELETE", "/api/servers/internal", "")
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status %d for server in use, got %d", http.StatusConflict, w.Code)
+	}
+	if _, err := store.GetServer("internal"); err != nil {
+		t.Errorf("Expected server to be kept: %v", err)
+	}
+}
+
+func TestImportFromCaddy_Servers(t *testing.T) {
+	router, store, fc, cleanup := setupTestRouterWithCaddy(t)
+	defer cleanup()
+
+	fc.setConfig(json.RawMessage(`{"apps": {"http": {"servers": {
+		"public": {"listen": [":443"], "protocols": ["h1", "h2"], "routes": [
+			{"match": [{"host": ["example.com"]}], "handle": [{"handler": "reverse_proxy", "upstreams": [{"dial": "app:8080"}]}]}
+		]},
+		"internal": {"listen": [":8080"], "automatic_https": {"disable": true}, "routes": [
+			{"match": [{"host": ["admin.internal"]}], "handle": [{"handler": "file_server", "root": "/srv"}]}
+		]}
+	}}}}`))
+
+	if w := doJSON(router, "POST", "/api/import", ""); w.Code != http.StatusOK {
+		t.Fatalf("Import failed: %d %s", w.Code, w.Body.String())
+	}
+
+	servers, _ := store.ListServers()
+	if len(servers) != 2 || servers[0].Name != "internal" || servers[1].Name != "public" {
+		t.Fatalf("Expected imported servers, got %+v", servers)
+	}
+	routes, _ := store.ListRoutes()
+	for _, r := range routes {
+		if (r.Domain == "example.com") != (r.Server == "public") {
+			t.Errorf("Route %s imported with server %q", r.Domain, r.Server)
+		}
+	}
+
+	// Syncing back keeps every route on its own server
+	if w := doJSON(router, "POST", "/api/sync?force=true", ""); w.Code != http.StatusOK {
+		t.Fatalf("Sync failed: %d %s", w.Code, w.Body.String())
+	}
+	var loaded config.CaddyConfig
+	json.Unmarshal(fc.loadedConfig(), &loaded)
+	public := loaded.Apps.HTTP.Servers["public"]
+	if public == nil || len(public.Routes) != 1 || len(public.Protocols) != 2 {
+		t.Errorf("Expected public server to round-trip, got %+v", public)
+	}
+	if internal := loaded.Apps.HTTP.Servers["internal"]; internal == nil || internal.AutomaticHTTPS == nil || !internal.AutomaticHTTPS.Disable {
+		t.Errorf("Expected internal server to round-trip, got %+v", internal)
+	}
+	if _, ok := loaded.Apps.HTTP.Servers["srv0"]; ok {
+		t.Error("Did not expect a default server")
+	}
+}
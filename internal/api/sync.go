@@ -0,0 +1,490 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ArtemStepanov/caddy-admin-ui/internal/caddy"
+	"github.com/ArtemStepanov/caddy-admin-ui/internal/config"
+	"github.com/ArtemStepanov/caddy-admin-ui/internal/storage"
+)
+
+// Sync modes reported in the status
+const (
+	syncModeIncremental = "incremental"
+	syncModeLoad        = "load"
+)
+
+// syncTarget is a Caddy instance that syncs push config to. Without any
+// registered instances the only target is the default Caddy from
+// GlobalConfig, which has no name and no instance.
+type syncTarget struct {
+	name     string
+	instance *storage.Instance
+	client   *caddy.Client
+}
+
+// targetState is the outcome of the last sync to one target
+type targetState struct {
+	syncedAt  time.Time
+	syncError string
+	syncMode  string
+	applied   *appliedConfig
+}
+
+// appliedConfig is the config most recently pushed to a Caddy instance,
+// with the ETag Caddy reported for it afterwards
+type appliedConfig struct {
+	adminURL string
+	etag     string
+	config   json.RawMessage
+}
+
+// pushedConfig is a config that is now live on a target, with the routes
+// it was built from
+type pushedConfig struct {
+	routes []*storage.Route
+	data   json.RawMessage
+}
+
+// syncConflictError is returned when Caddy's config was changed by someone
+// else since our last sync. Changes turn our last config into the live one.
+type syncConflictError struct {
+	Changes []config.Change
+}
+
+func (e *syncConflictError) Error() string {
+	return fmt.Sprintf("Caddy config was modified outside of this app since the last sync (%d change(s)); sync again with force to overwrite", len(e.Changes))
+}
+
+// InstanceSyncResult is the outcome of syncing one managed instance. Stage,
+// RolledBack and Skipped are only set by staged rollouts.
+type InstanceSyncResult struct {
+	Instance   string          `json:"instance"`
+	Stage      int             `json:"stage,omitempty"`
+	Mode       string          `json:"mode,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	Conflict   bool            `json:"conflict,omitempty"`
+	Changes    []config.Change `json:"changes,omitempty"`
+	RolledBack bool            `json:"rolled_back,omitempty"`
+	Skipped    bool            `json:"skipped,omitempty"`
+}
+
+// fleetSyncError is returned when a sync failed on some of the managed
+// instances. The others were synced anyway.
+type fleetSyncError struct {
+	Results []InstanceSyncResult
+}
+
+func (e *fleetSyncError) Error() string {
+	var failed []string
+	rolledBack, skipped := 0, 0
+	for _, r := range e.Results {
+		if r.Error != "" {
+			failed = append(failed, r.Instance+": "+r.Error)
+		}
+		if r.RolledBack {
+			rolledBack++
+		}
+		if r.Skipped {
+			skipped++
+		}
+	}
+	msg := fmt.Sprintf("sync failed on %d of %d instance(s): %s", len(failed), len(e.Results), strings.Join(failed, "; "))
+	if rolledBack > 0 || skipped > 0 {
+		msg += fmt.Sprintf(" (%d rolled back, %d skipped)", rolledBack, skipped)
+	}
+	return msg
+}
+
+// conflictsOnly reports whether every failure was a sync conflict
+func (e *fleetSyncError) conflictsOnly() bool {
+	for _, r := range e.Results {
+		if (r.Error != "" && !r.Conflict) || r.RolledBack || r.Skipped {
+			return false
+		}
+	}
+	return true
+}
+
+// newCaddyClient returns a client for the admin API at adminURL that sends
+// the Origin Caddy expects
+func newCaddyClient(adminURL string, admin *storage.AdminSettings) *caddy.Client {
+	client := caddy.NewClient(adminURL)
+	if origin := adminOrigin(admin); origin != "" {
+		client = client.WithOrigin(origin)
+	}
+	return client
+}
+
+// syncTargets returns a target per registered instance, ordered by name,
+// or the default Caddy if there are none
+func (h *Handler) syncTargets() ([]syncTarget, error) {
+	instances, err := h.store.ListInstances()
+	if err != nil {
+		return nil, err
+	}
+	if len(instances) == 0 {
+		return []syncTarget{{client: h.getCaddyClient()}}, nil
+	}
+
+	var admin *storage.AdminSettings
+	if cfg, err := h.store.GetGlobalConfig(); err == nil {
+		admin = cfg.Admin
+	}
+	targets := make([]syncTarget, 0, len(instances))
+	for _, inst := range instances {
+		targets = append(targets, syncTarget{
+			name:     inst.Name,
+			instance: inst,
+			client:   newCaddyClient(inst.AdminURL, admin),
+		})
+	}
+	return targets, nil
+}
+
+// targetState returns the sync state of the named target, creating it if
+// needed. The caller must hold h.mu for writing.
+func (h *Handler) targetState(name string) *targetState {
+	st, ok := h.targets[name]
+	if !ok {
+		st = &targetState{}
+		h.targets[name] = st
+	}
+	return st
+}
+
+// lockTargets takes the sync locks of targets, in name order so that
+// concurrent callers can't deadlock, and returns a function releasing them.
+// Without them a sync could read the config another one just pushed
+// before it was recorded, and report it as a conflict, or push a config
+// built before the other's store write.
+func (h *Handler) lockTargets(targets ...syncTarget) func() {
+	names := make([]string, len(targets))
+	for i, t := range targets {
+		names[i] = t.name
+	}
+	slices.Sort(names)
+
+	locks := make([]*sync.Mutex, len(names))
+	h.mu.Lock()
+	for i, name := range names {
+		if h.syncLocks[name] == nil {
+			h.syncLocks[name] = &sync.Mutex{}
+		}
+		locks[i] = h.syncLocks[name]
+	}
+	h.mu.Unlock()
+
+	for _, l := range locks {
+		l.Lock()
+	}
+	return func() {
+		for _, l := range locks {
+			l.Unlock()
+		}
+	}
+}
+
+// forgetTarget drops the sync state of a target that is no longer managed
+func (h *Handler) forgetTarget(name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.targets, name)
+}
+
+// recordSync stores the outcome of a sync attempt
+func (h *Handler) recordSync(t syncTarget, mode string, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	st := h.targetState(t.name)
+	st.syncedAt = time.Now()
+	st.syncMode = mode
+	if err != nil {
+		st.syncError = err.Error()
+	} else {
+		st.syncError = ""
+	}
+}
+
+// syncToCaddy builds config from routes and pushes it to every target, as
+// per-route changes when possible and as a full replace otherwise. It refuses
+// to overwrite changes made to Caddy's config since the last sync.
+// The action describes what triggered the sync and is recorded in the revision.
+func (h *Handler) syncToCaddy(action string) error {
+	_, err := h.syncAll(action, false)
+	return err
+}
+
+// forceSyncToCaddy is syncToCaddy without the conflict check, for callers
+// that mean to overwrite whatever Caddy is running
+func (h *Handler) forceSyncToCaddy(action string) error {
+	_, err := h.syncAll(action, true)
+	return err
+}
+
+// syncAll syncs every target. Managed instances are synced concurrently, or
+// in stages if the global config asks for a rollout, and get a result each;
+// if any of them failed the error is a *fleetSyncError.
+func (h *Handler) syncAll(action string, force bool) ([]InstanceSyncResult, error) {
+	targets, err := h.syncTargets()
+	if err != nil {
+		return nil, err
+	}
+	if targets[0].instance == nil {
+		return nil, h.syncTarget(targets[0], action, force)
+	}
+	defer h.lockTargets(targets...)()
+	if cfg, err := h.store.GetGlobalConfig(); err == nil && cfg.Rollout != nil {
+		return h.rollout(targets, action, force, cfg.Rollout)
+	}
+
+	results := make([]InstanceSyncResult, len(targets))
+	pushed := make([]*pushedConfig, len(targets))
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = InstanceSyncResult{Instance: t.name}
+			pushed[i] = h.pushResult(t, force, &results[i])
+		}()
+	}
+	wg.Wait()
+
+	// Revisions are written one at a time; not every backend likes
+	// concurrent writers
+	failed := false
+	for i, t := range targets {
+		if pushed[i] != nil {
+			h.recordRevision(t, action, pushed[i])
+		} else {
+			failed = true
+		}
+	}
+	if failed {
+		return results, &fleetSyncError{Results: results}
+	}
+	return results, nil
+}
+
+// pushResult pushes config to a target like pushConfig, reporting the
+// outcome in result
+func (h *Handler) pushResult(t syncTarget, force bool, result *InstanceSyncResult) *pushedConfig {
+	pushed, err := h.pushConfig(t, force)
+	if err != nil {
+		result.Error = err.Error()
+		var conflict *syncConflictError
+		if errors.As(err, &conflict) {
+			result.Conflict = true
+			result.Changes = conflict.Changes
+		}
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if st := h.targets[t.name]; st != nil {
+		result.Mode = st.syncMode
+	}
+	return pushed
+}
+
+// syncTarget brings a single target up to date and records a revision
+func (h *Handler) syncTarget(t syncTarget, action string, force bool) error {
+	defer h.lockTargets(t)()
+	return h.syncTargetLocked(t, action, force)
+}
+
+// syncTargetLocked is syncTarget for callers holding the target's sync lock
+func (h *Handler) syncTargetLocked(t syncTarget, action string, force bool) error {
+	pushed, err := h.pushConfig(t, force)
+	if err != nil {
+		return err
+	}
+	h.recordRevision(t, action, pushed)
+	return nil
+}
+
+// pushConfig builds the target's config and pushes it, returning the
+// config that is now live
+func (h *Handler) pushConfig(t syncTarget, force bool) (*pushedConfig, error) {
+	routes, caddyConfig, err := h.buildConfigFor(t.instance)
+	if err != nil {
+		h.recordSync(t, syncModeLoad, err)
+		return nil, err
+	}
+
+	var data json.RawMessage
+	data, err = json.Marshal(caddyConfig)
+	if err != nil {
+		h.recordSync(t, syncModeLoad, err)
+		return nil, err
+	}
+	pushed := &pushedConfig{routes: routes, data: data}
+
+	live, etag, err := t.client.GetConfigWithETag("")
+	if err != nil {
+		// Let the full load report the connection error
+		if err := h.load(t, data); err != nil {
+			return nil, err
+		}
+		return pushed, nil
+	}
+
+	if !force {
+		if err := h.checkConflict(t, live, etag); err != nil {
+			h.recordSync(t, "", err)
+			return nil, err
+		}
+	}
+
+	applied, err := h.syncIncremental(t.client, live, caddyConfig)
+	if err != nil {
+		log.Printf("Incremental sync failed, loading full config: %v", err)
+	}
+	if applied {
+		h.recordSync(t, syncModeIncremental, nil)
+		h.applied(t, data)
+		return pushed, nil
+	}
+
+	// Guard the replace itself, unless a failed incremental sync already
+	// changed the config and made etag stale. Caddy only honors If-Match
+	// under /config/, so /load is left for forced syncs.
+	switch {
+	case force:
+		err = t.client.LoadConfig(data)
+	case etag != "" && err == nil:
+		err = t.client.IfMatch(etag).ReplaceConfig(data)
+	default:
+		err = t.client.ReplaceConfig(data)
+	}
+	if caddy.IsPreconditionFailed(err) {
+		err = conflictSince(t.client, live)
+	}
+	h.recordSync(t, syncModeLoad, err)
+	if err != nil {
+		return nil, err
+	}
+
+	h.applied(t, data)
+	return pushed, nil
+}
+
+// checkConflict compares the live config's ETag with the one remembered from
+// our last sync to the same Caddy instance
+func (h *Handler) checkConflict(t syncTarget, live json.RawMessage, etag string) error {
+	h.mu.RLock()
+	var last *appliedConfig
+	if st := h.targets[t.name]; st != nil {
+		last = st.applied
+	}
+	h.mu.RUnlock()
+
+	// Without an ETag on both sides (older Caddy, first sync) there is
+	// nothing to compare
+	if last == nil || last.adminURL != t.client.GetAdminURL() || last.etag == "" || etag == "" || last.etag == etag {
+		return nil
+	}
+
+	changes, err := config.Diff(last.config, live)
+	if err != nil || len(changes) == 0 {
+		return nil
+	}
+	return &syncConflictError{Changes: changes}
+}
+
+// conflictSince builds the conflict error for a load Caddy rejected with 412,
+// diffing the config we read before the load against the current one
+func conflictSince(client *caddy.Client, before json.RawMessage) error {
+	conflict := &syncConflictError{}
+	if now, err := client.GetConfig(""); err == nil {
+		conflict.Changes, _ = config.Diff(before, now)
+	}
+	return conflict
+}
+
+// syncIncremental applies the difference between Caddy's live config and
+// desired as PATCH/PUT/DELETE calls on individual routes. It returns false
+// if the change needs a full /load instead.
+func (h *Handler) syncIncremental(client *caddy.Client, live json.RawMessage, desired *config.CaddyConfig) (bool, error) {
+	ops, ok, err := config.PlanRouteOps(live, desired)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	for _, op := range ops {
+		if err := applyRouteOp(client, op); err != nil {
+			return false, fmt.Errorf("%s route %s: %w", op.Op, op.ID, err)
+		}
+	}
+	return true, nil
+}
+
+func applyRouteOp(client *caddy.Client, op config.RouteOp) error {
+	switch op.Op {
+	case config.RouteOpDelete:
+		return client.DeleteByID(op.ID)
+	case config.RouteOpUpdate:
+		return client.PatchByID(op.ID, op.Route)
+	case config.RouteOpAdd:
+		routesPath := "apps/http/servers/" + op.Server + "/routes"
+		if op.Append {
+			return client.SetConfig(routesPath, op.Route)
+		}
+		return client.PutConfig(fmt.Sprintf("%s/%d", routesPath, op.Index), op.Route)
+	}
+	return fmt.Errorf("unknown route operation %q", op.Op)
+}
+
+// loadConfig loads a serialized config into a target, overwriting whatever
+// it runs, and on success records it as a new revision together with the
+// routes it was built from
+func (h *Handler) loadConfig(t syncTarget, action string, routes []*storage.Route, data json.RawMessage) error {
+	defer h.lockTargets(t)()
+	if err := h.load(t, data); err != nil {
+		return err
+	}
+	h.recordRevision(t, action, &pushedConfig{routes: routes, data: data})
+	return nil
+}
+
+// load posts a full config to a target's /load
+func (h *Handler) load(t syncTarget, data json.RawMessage) error {
+	err := t.client.LoadConfig(data)
+	h.recordSync(t, syncModeLoad, err)
+	if err != nil {
+		return err
+	}
+	h.applied(t, data)
+	return nil
+}
+
+// applied remembers a config that is now live on a target as the baseline
+// for the next sync's conflict check
+func (h *Handler) applied(t syncTarget, data json.RawMessage) {
+	last := &appliedConfig{adminURL: t.client.GetAdminURL(), config: data}
+	if _, etag, err := t.client.GetConfigWithETag(""); err == nil {
+		last.etag = etag
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.targetState(t.name).applied = last
+}
+
+// recordRevision stores a config that was pushed to a target as a revision.
+// A missing revision must not turn a successful sync into a failure.
+func (h *Handler) recordRevision(t syncTarget, action string, pushed *pushedConfig) {
+	rev := &storage.Revision{Action: action, Instance: t.name, Config: pushed.data, Routes: pushed.routes}
+	if err := h.store.CreateRevision(rev); err != nil {
+		log.Printf("Failed to record revision: %v", err)
+	}
+}
@@ -2,129 +2,340 @@
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 )
 
 // Client is a simple Caddy Admin API client
 type Client struct {
 	adminURL   string
+	baseURL    string
 	httpClient *http.Client
+	ifMatch    string
+	origin     string
 }
 
-// NewClient creates a new Caddy client
+// NewClient creates a new Caddy client. adminURL is either an HTTP URL or
+// a unix socket in Caddy's "unix//path/to/admin.sock" form ("unix:///path"
+// works too).
 func NewClient(adminURL string) *Client {
-	return &Client{
+	c := &Client{
 		adminURL: adminURL,
+		baseURL:  adminURL,
 		httpClient: &http.Client{
 			Timeout: 10 * time.Second,
 		},
 	}
-}
 
-// GetConfig retrieves the current Caddy configuration at the given path
-func (c *Client) GetConfig(path string) (json.RawMessage, error) {
-	url := c.adminURL + "/config/"
-	if path != "" {
-		url += path
+	if socket := unixSocketPath(adminURL); socket != "" {
+		// The host is never dialed; Caddy's own examples use localhost
+		c.baseURL = "http://localhost"
+		c.httpClient.Transport = socketTransport(socket)
 	}
+	return c
+}
 
-	resp, err := c.httpClient.Get(url)
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to Caddy: %w", err)
-	}
-	defer resp.Body.Close()
+// socketTransports holds one transport per unix socket path. A client is
+// created per request, and a transport each would leave its idle
+// connections open.
+var socketTransports sync.Map
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+// socketTransport returns the shared transport dialing socket
+func socketTransport(socket string) *http.Transport {
+	if t, ok := socketTransports.Load(socket); ok {
+		return t.(*http.Transport)
 	}
+	t, _ := socketTransports.LoadOrStore(socket, &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	})
+	return t.(*http.Transport)
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("caddy returned status %d: %s", resp.StatusCode, string(body))
+// unixSocketPath returns the socket path of a unix admin address, or "" if
+// adminURL is not one. A "|mode" suffix (socket file permissions in Caddy's
+// listen syntax) is ignored.
+func unixSocketPath(adminURL string) string {
+	path, ok := strings.CutPrefix(adminURL, "unix://")
+	if !ok {
+		path, ok = strings.CutPrefix(adminURL, "unix/")
+	}
+	if !ok {
+		return ""
 	}
+	path, _, _ = strings.Cut(path, "|")
+	return path
+}
 
-	return body, nil
+// APIError is returned when Caddy answers with a non-2xx status.
+// Message holds the "error" field of Caddy's JSON error body, if any.
+type APIError struct {
+	StatusCode int
+	Message    string
+	Body       string
 }
 
-// SetConfig sets the Caddy configuration at the given path
-func (c *Client) SetConfig(path string, config any) error {
-	data, err := json.Marshal(config)
-	if err != nil {
-		return fmt.Errorf("failed to marshal config: %w", err)
+func (e *APIError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("caddy returned status %d: %s", e.StatusCode, e.Message)
 	}
+	return fmt.Sprintf("caddy returned status %d: %s", e.StatusCode, e.Body)
+}
 
-	url := c.adminURL + "/config/"
-	if path != "" {
-		url += path
-	}
+// IsNotFound reports whether err is a Caddy 404, e.g. an unknown config
+// path or @id
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
 
-	req, err := http.NewRequest("POST", url, bytes.NewReader(data))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-	req.Header.Set("Content-Type", "application/json")
+// IsPreconditionFailed reports whether err is a Caddy 412, returned when an
+// If-Match ETag no longer matches the running config
+func IsPreconditionFailed(err error) bool {
+	return hasStatus(err, http.StatusPreconditionFailed)
+}
 
-	resp, err := c.httpClient.Do(req)
+func hasStatus(err error, code int) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == code
+}
+
+// IfMatch returns a copy of the client that sends If-Match: etag with every
+// config change, so Caddy rejects it with 412 if the config was modified
+// since etag was read
+func (c *Client) IfMatch(etag string) *Client {
+	cp := *c
+	cp.ifMatch = etag
+	return &cp
+}
+
+// WithOrigin returns a copy of the client that sends Origin: origin with
+// every request, which Caddy requires when enforce_origin is enabled
+func (c *Client) WithOrigin(origin string) *Client {
+	cp := *c
+	cp.origin = origin
+	return &cp
+}
+
+// GetConfig retrieves the current Caddy configuration at the given path
+func (c *Client) GetConfig(path string) (json.RawMessage, error) {
+	body, _, err := c.GetConfigWithETag(path)
+	return body, err
+}
+
+// GetConfigWithETag retrieves the configuration at the given path together
+// with the ETag Caddy reports for it
+func (c *Client) GetConfigWithETag(path string) (json.RawMessage, string, error) {
+	body, header, err := c.do(http.MethodGet, "/config/"+path, nil)
 	if err != nil {
-		return fmt.Errorf("failed to connect to Caddy: %w", err)
+		return nil, "", err
 	}
-	defer resp.Body.Close()
+	return body, header.Get("Etag"), nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("caddy returned status %d: %s", resp.StatusCode, string(body))
-	}
+// SetConfig sets the Caddy configuration at the given path. On arrays POST
+// appends rather than replaces.
+func (c *Client) SetConfig(path string, config any) error {
+	_, _, err := c.do(http.MethodPost, "/config/"+path, config)
+	return err
+}
+
+// PutConfig creates a new value at the given path; on arrays it inserts
+// before the given index
+func (c *Client) PutConfig(path string, config any) error {
+	_, _, err := c.do(http.MethodPut, "/config/"+path, config)
+	return err
+}
+
+// PatchConfig replaces an existing value at the given path
+func (c *Client) PatchConfig(path string, config any) error {
+	_, _, err := c.do(http.MethodPatch, "/config/"+path, config)
+	return err
+}
+
+// DeleteConfig removes the value at the given path
+func (c *Client) DeleteConfig(path string) error {
+	_, _, err := c.do(http.MethodDelete, "/config/"+path, nil)
+	return err
+}
+
+// GetByID retrieves the config object tagged with "@id": id. A sub-path may
+// be appended, e.g. "my-route/handle/0".
+func (c *Client) GetByID(id string) (json.RawMessage, error) {
+	body, _, err := c.do(http.MethodGet, "/id/"+id, nil)
+	return body, err
+}
+
+// SetByID posts to the object tagged with id (appends if it is an array)
+func (c *Client) SetByID(id string, config any) error {
+	_, _, err := c.do(http.MethodPost, "/id/"+id, config)
+	return err
+}
+
+// PutByID creates a value at the object tagged with id
+func (c *Client) PutByID(id string, config any) error {
+	_, _, err := c.do(http.MethodPut, "/id/"+id, config)
+	return err
+}
+
+// PatchByID replaces the object tagged with id
+func (c *Client) PatchByID(id string, config any) error {
+	_, _, err := c.do(http.MethodPatch, "/id/"+id, config)
+	return err
+}
+
+// DeleteByID removes the object tagged with id
+func (c *Client) DeleteByID(id string) error {
+	_, _, err := c.do(http.MethodDelete, "/id/"+id, nil)
+	return err
+}
 
-	return nil
+// ReplaceConfig replaces the entire configuration through /config/. Unlike
+// /load, it honors If-Match.
+func (c *Client) ReplaceConfig(config any) error {
+	return c.SetConfig("", config)
 }
 
-// LoadConfig loads an entire configuration into Caddy
+// LoadConfig loads an entire configuration into Caddy. Caddy ignores
+// If-Match on /load; use ReplaceConfig for a guarded replace.
 func (c *Client) LoadConfig(config any) error {
-	data, err := json.Marshal(config)
+	_, _, err := c.do(http.MethodPost, "/load", config)
+	return err
+}
+
+// UpstreamStatus is the state of a reverse proxy upstream as reported by
+// /reverse_proxy/upstreams
+type UpstreamStatus struct {
+	Address     string `json:"address"`
+	NumRequests int    `json:"num_requests"`
+	Fails       int    `json:"fails"`
+}
+
+// Upstreams returns the status of all configured reverse proxy upstreams
+func (c *Client) Upstreams() ([]UpstreamStatus, error) {
+	body, _, err := c.do(http.MethodGet, "/reverse_proxy/upstreams", nil)
 	if err != nil {
-		return fmt.Errorf("failed to marshal config: %w", err)
+		return nil, err
 	}
 
-	req, err := http.NewRequest("POST", c.adminURL+"/load", bytes.NewReader(data))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+	var upstreams []UpstreamStatus
+	if err := json.Unmarshal(body, &upstreams); err != nil {
+		return nil, fmt.Errorf("failed to decode upstreams: %w", err)
 	}
-	req.Header.Set("Content-Type", "application/json")
+	return upstreams, nil
+}
 
-	resp, err := c.httpClient.Do(req)
+// CAInfo describes a certificate authority managed by Caddy's PKI app
+type CAInfo struct {
+	ID                      string `json:"id"`
+	Name                    string `json:"name"`
+	RootCommonName          string `json:"root_common_name"`
+	IntermediateCommonName  string `json:"intermediate_common_name"`
+	RootCertificate         string `json:"root_certificate"`
+	IntermediateCertificate string `json:"intermediate_certificate"`
+}
+
+// GetCA returns information about the CA with the given ID ("local" is
+// Caddy's default)
+func (c *Client) GetCA(id string) (*CAInfo, error) {
+	body, _, err := c.do(http.MethodGet, "/pki/ca/"+id, nil)
 	if err != nil {
-		return fmt.Errorf("failed to connect to Caddy: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("caddy returned status %d: %s", resp.StatusCode, string(body))
+	var ca CAInfo
+	if err := json.Unmarshal(body, &ca); err != nil {
+		return nil, fmt.Errorf("failed to decode CA info: %w", err)
 	}
+	return &ca, nil
+}
 
-	return nil
+// GetCACertificates returns the PEM certificate chain of the CA with the
+// given ID
+func (c *Client) GetCACertificates(id string) (string, error) {
+	body, _, err := c.do(http.MethodGet, "/pki/ca/"+id+"/certificates", nil)
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
+
+// Stop gracefully shuts down Caddy
+func (c *Client) Stop() error {
+	_, _, err := c.do(http.MethodPost, "/stop", nil)
+	return err
 }
 
 // Health checks if Caddy is responsive
 func (c *Client) Health() error {
-	resp, err := c.httpClient.Get(c.adminURL + "/config/")
+	_, _, err := c.do(http.MethodGet, "/config/", nil)
+	return err
+}
+
+// GetAdminURL returns the configured admin URL
+func (c *Client) GetAdminURL() string {
+	return c.adminURL
+}
+
+// do sends a request to the admin API and returns the response body.
+// Non-nil payloads are sent as JSON.
+func (c *Client) do(method, endpoint string, payload any) ([]byte, http.Header, error) {
+	var reqBody io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to marshal config: %w", err)
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+endpoint, reqBody)
 	if err != nil {
-		return fmt.Errorf("failed to connect to Caddy: %w", err)
+		return nil, nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.origin != "" {
+		req.Header.Set("Origin", c.origin)
+	}
+	if c.ifMatch != "" && method != http.MethodGet {
+		req.Header.Set("If-Match", c.ifMatch)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to Caddy: %w", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("caddy returned status %d", resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read response: %w", err)
 	}
 
-	return nil
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, resp.Header, newAPIError(resp.StatusCode, body)
+	}
+	return body, resp.Header, nil
 }
 
-// GetAdminURL returns the configured admin URL
-func (c *Client) GetAdminURL() string {
-	return c.adminURL
+func newAPIError(status int, body []byte) *APIError {
+	apiErr := &APIError{StatusCode: status, Body: strings.TrimSpace(string(body))}
+	var parsed struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(body, &parsed) == nil {
+		apiErr.Message = parsed.Error
+	}
+	return apiErr
 }
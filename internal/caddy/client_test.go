@@ -0,0 +1,215 @@
+package caddy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// recordedRequest is what the test server saw for a single request
+type recordedRequest struct {
+	Method  string
+	Path    string
+	Body    string
+	IfMatch string
+	Origin  string
+}
+
+// newTestServer returns a server that records requests and replies with
+// the given status and body
+func newTestServer(t *testing.T, status int, body string, header http.Header) (*httptest.Server, *[]recordedRequest) {
+	t.Helper()
+
+	var requests []recordedRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		requests = append(requests, recordedRequest{
+			Method:  r.Method,
+			Path:    r.URL.Path,
+			Body:    string(data),
+			IfMatch: r.Header.Get("If-Match"),
+			Origin:  r.Header.Get("Origin"),
+		})
+		for k, v := range header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestConfigMethods(t *testing.T) {
+	srv, requests := newTestServer(t, http.StatusOK, "", nil)
+	c := NewClient(srv.URL)
+
+	c.PutConfig("apps/http/servers/srv0/routes/0", map[string]any{"@id": "r1"})
+	c.PatchConfig("apps/http/servers/srv0/listen", []string{":443"})
+	c.DeleteConfig("apps/tls")
+	c.PatchByID("r1", map[string]any{"@id": "r1"})
+	c.DeleteByID("r1")
+	c.Stop()
+
+	expected := []recordedRequest{
+		{Method: "PUT", Path: "/config/apps/http/servers/srv0/routes/0", Body: `{"@id":"r1"}`},
+		{Method: "PATCH", Path: "/config/apps/http/servers/srv0/listen", Body: `[":443"]`},
+		{Method: "DELETE", Path: "/config/apps/tls"},
+		{Method: "PATCH", Path: "/id/r1", Body: `{"@id":"r1"}`},
+		{Method: "DELETE", Path: "/id/r1"},
+		{Method: "POST", Path: "/stop"},
+	}
+	if len(*requests) != len(expected) {
+		t.Fatalf("Expected %d requests, got %d", len(expected), len(*requests))
+	}
+	for i, want := range expected {
+		if got := (*requests)[i]; got != want {
+			t.Errorf("Request %d: expected %+v, got %+v", i, want, got)
+		}
+	}
+}
+
+func TestETag(t *testing.T) {
+	srv, requests := newTestServer(t, http.StatusOK, `{"apps":{}}`, http.Header{"Etag": {`"/config/ abc123"`}})
+	c := NewClient(srv.URL)
+
+	cfg, etag, err := c.GetConfigWithETag("")
+	if err != nil {
+		t.Fatalf("GetConfigWithETag failed: %v", err)
+	}
+	if string(cfg) != `{"apps":{}}` || etag != `"/config/ abc123"` {
+		t.Errorf("Unexpected config %s / etag %s", cfg, etag)
+	}
+
+	c.IfMatch(etag).ReplaceConfig(map[string]any{})
+	c.SetConfig("", map[string]any{})
+
+	if got := (*requests)[1]; got.IfMatch != etag || got.Method != http.MethodPost || got.Path != "/config/" {
+		t.Errorf("Expected a guarded POST /config/, got %+v", got)
+	}
+	if got := (*requests)[2].IfMatch; got != "" {
+		t.Errorf("Expected original client to not send If-Match, got %q", got)
+	}
+}
+
+func TestUnixSocket(t *testing.T) {
+	// Socket paths are limited to ~100 bytes, so avoid t.TempDir's long names
+	dir, err := os.MkdirTemp("", "caddy")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "admin.sock")
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix sockets not available: %v", err)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"path":"` + r.URL.Path + `"}`))
+	}))
+	srv.Listener = listener
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	for _, adminURL := range []string{"unix/" + socket, "unix://" + socket, "unix/" + socket + "|0660"} {
+		c := NewClient(adminURL)
+		cfg, err := c.GetConfig("apps")
+		if err != nil {
+			t.Fatalf("%s: GetConfig failed: %v", adminURL, err)
+		}
+		if string(cfg) != `{"path":"/config/apps"}` {
+			t.Errorf("%s: unexpected response %s", adminURL, cfg)
+		}
+		if c.GetAdminURL() != adminURL {
+			t.Errorf("Expected admin URL to be kept, got %s", c.GetAdminURL())
+		}
+		if c.httpClient.Transport != NewClient("unix/"+socket).httpClient.Transport {
+			t.Errorf("%s: expected clients of the same socket to share a transport", adminURL)
+		}
+	}
+}
+
+func TestWithOrigin(t *testing.T) {
+	srv, requests := newTestServer(t, http.StatusOK, `{}`, nil)
+	c := NewClient(srv.URL)
+
+	c.WithOrigin("http://admin.example.com").Health()
+	c.Health()
+
+	if got := (*requests)[0].Origin; got != "http://admin.example.com" {
+		t.Errorf("Expected Origin header, got %q", got)
+	}
+	if got := (*requests)[1].Origin; got != "" {
+		t.Errorf("Expected original client to not send Origin, got %q", got)
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	srv, _ := newTestServer(t, http.StatusPreconditionFailed, `{"error":"ETag mismatch"}`, nil)
+	c := NewClient(srv.URL)
+
+	err := c.PatchByID("r1", map[string]any{})
+	if !IsPreconditionFailed(err) {
+		t.Fatalf("Expected precondition failed error, got %v", err)
+	}
+	if IsNotFound(err) {
+		t.Error("Did not expect not found")
+	}
+
+	apiErr := err.(*APIError)
+	if apiErr.Message != "ETag mismatch" {
+		t.Errorf("Expected Caddy error message, got %q", apiErr.Message)
+	}
+	if err.Error() != "caddy returned status 412: ETag mismatch" {
+		t.Errorf("Unexpected error string: %s", err)
+	}
+}
+
+func TestAPIError_PlainBody(t *testing.T) {
+	srv, _ := newTestServer(t, http.StatusNotFound, "not found\n", nil)
+
+	_, err := NewClient(srv.URL).GetByID("missing")
+	if !IsNotFound(err) {
+		t.Fatalf("Expected not found error, got %v", err)
+	}
+	if err.Error() != "caddy returned status 404: not found" {
+		t.Errorf("Unexpected error string: %s", err)
+	}
+}
+
+func TestUpstreams(t *testing.T) {
+	srv, requests := newTestServer(t, http.StatusOK,
+		`[{"address":"localhost:8080","num_requests":3,"fails":1}]`, nil)
+
+	upstreams, err := NewClient(srv.URL).Upstreams()
+	if err != nil {
+		t.Fatalf("Upstreams failed: %v", err)
+	}
+	if (*requests)[0].Path != "/reverse_proxy/upstreams" {
+		t.Errorf("Unexpected path %s", (*requests)[0].Path)
+	}
+	if len(upstreams) != 1 || upstreams[0].Address != "localhost:8080" || upstreams[0].NumRequests != 3 || upstreams[0].Fails != 1 {
+		t.Errorf("Unexpected upstreams: %+v", upstreams)
+	}
+}
+
+func TestGetCA(t *testing.T) {
+	srv, requests := newTestServer(t, http.StatusOK,
+		`{"id":"local","name":"Caddy Local Authority","root_common_name":"Caddy Local Authority - 2024 ECC Root"}`, nil)
+
+	ca, err := NewClient(srv.URL).GetCA("local")
+	if err != nil {
+		t.Fatalf("GetCA failed: %v", err)
+	}
+	if (*requests)[0].Path != "/pki/ca/local" {
+		t.Errorf("Unexpected path %s", (*requests)[0].Path)
+	}
+	if ca.ID != "local" || ca.Name != "Caddy Local Authority" {
+		t.Errorf("Unexpected CA info: %+v", ca)
+	}
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// MarshalJSON merges the managed parts of the config on top of Base, so
+// everything we don't manage (other apps, logging, storage, server options)
+// survives a /load. Objects are merged key by key; anything else we set
+// replaces the base value.
+func (c CaddyConfig) MarshalJSON() ([]byte, error) {
+	type plain CaddyConfig
+	managed, err := json.Marshal(plain(c))
+	if err != nil || len(c.Base) == 0 {
+		return managed, err
+	}
+
+	var base, overlay any
+	if err := json.Unmarshal(c.Base, &base); err != nil {
+		return nil, fmt.Errorf("invalid base config: %w", err)
+	}
+	if err := json.Unmarshal(managed, &overlay); err != nil {
+		return nil, err
+	}
+	return json.Marshal(mergeJSON(base, overlay))
+}
+
+func mergeJSON(base, overlay any) any {
+	b, ok := base.(map[string]any)
+	o, ok2 := overlay.(map[string]any)
+	if !ok || !ok2 {
+		return overlay
+	}
+	for k, v := range o {
+		b[k] = mergeJSON(b[k], v)
+	}
+	return b
+}
+
+// managedServerKeys are the server fields that come from storage.Server
+var managedServerKeys = []string{"listen", "protocols", "automatic_https"}
+
+// managedAdminKeys are the admin fields that come from storage.AdminSettings
+var managedAdminKeys = []string{"listen", "enforce_origin", "origins", "identity", "remote"}
+
+// ExtractBaseConfig returns a Caddy config with the routes and the managed
+// settings (listen, protocols, automatic_https) of every HTTP server and
+// the managed admin settings removed. This is the part of a live config
+// that BuildCaddyConfig doesn't produce and that has to be kept as
+// CaddyConfig.Base. Leaving the managed settings in would let a value
+// cleared in storage come back from the base.
+func ExtractBaseConfig(raw json.RawMessage) (json.RawMessage, error) {
+	var doc any
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		return nil, nil
+	}
+	if _, ok := doc.(map[string]any); !ok {
+		return nil, fmt.Errorf("config must be a JSON object")
+	}
+
+	detachRoutes(doc)
+
+	root := doc.(map[string]any)
+	if admin, ok := root["admin"].(map[string]any); ok {
+		for _, key := range managedAdminKeys {
+			delete(admin, key)
+		}
+		if len(admin) == 0 {
+			delete(root, "admin")
+		}
+	}
+
+	apps, _ := root["apps"].(map[string]any)
+	httpApp, _ := apps["http"].(map[string]any)
+	servers, _ := httpApp["servers"].(map[string]any)
+	for _, s := range servers {
+		if srv, ok := s.(map[string]any); ok {
+			for _, key := range managedServerKeys {
+				delete(srv, key)
+			}
+		}
+	}
+	return json.Marshal(doc)
+}
+
+// RemoveBaseServer returns base without the HTTP server name, and whether
+// it had one. Without this a deleted server's options would stay in the
+// base and be loaded into Caddy as a server without listen addresses.
+func RemoveBaseServer(base json.RawMessage, name string) (json.RawMessage, bool, error) {
+	if len(base) == 0 {
+		return base, false, nil
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(base, &doc); err != nil {
+		return nil, false, fmt.Errorf("invalid base config: %w", err)
+	}
+	apps, _ := doc["apps"].(map[string]any)
+	httpApp, _ := apps["http"].(map[string]any)
+	servers, _ := httpApp["servers"].(map[string]any)
+	if _, ok := servers[name]; !ok {
+		return base, false, nil
+	}
+	delete(servers, name)
+	updated, err := json.Marshal(doc)
+	return updated, true, err
+}
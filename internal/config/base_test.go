@@ -0,0 +1,136 @@
+package config
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ArtemStepanov/caddy-admin-ui/internal/storage"
+)
+
+const liveWithExtras = `{
+	"admin": {"listen": "localhost:2019", "enforce_origin": true},
+	"logging": {"logs": {"default": {"level": "INFO"}}},
+	"storage": {"module": "file_system", "root": "/data"},
+	"apps": {
+		"tls": {"automation": {"policies": [{"issuers": [{"module": "acme"}]}]}},
+		"pki": {"certificate_authorities": {"local": {"install_trust": false}}},
+		"http": {
+			"grace_period": "10s",
+			"servers": {
+				"srv0": {
+					"listen": [":443"],
+					"tls_connection_policies": [{}],
+					"routes": [{"handle": [{"handler": "static_response"}]}]
+				},
+				"metrics": {
+					"listen": [":9180"],
+					"routes": [{"handle": [{"handler": "metrics"}]}]
+				}
+			}
+		}
+	}
+}`
+
+func TestExtractBaseConfig(t *testing.T) {
+	base, err := ExtractBaseConfig(json.RawMessage(liveWithExtras))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var doc map[string]any
+	json.Unmarshal(base, &doc)
+	servers := doc["apps"].(map[string]any)["http"].(map[string]any)["servers"].(map[string]any)
+	for name, s := range servers {
+		for _, key := range []string{"routes", "listen"} {
+			if _, ok := s.(map[string]any)[key]; ok {
+				t.Errorf("Expected %s to be stripped from server %s", key, name)
+			}
+		}
+	}
+	if _, ok := servers["srv0"].(map[string]any)["tls_connection_policies"]; !ok {
+		t.Error("Expected server options to be kept")
+	}
+	if doc["logging"] == nil || doc["storage"] == nil {
+		t.Error("Expected top-level config to be kept")
+	}
+	if _, ok := doc["admin"]; ok {
+		t.Errorf("Expected managed admin settings to be stripped, got %v", doc["admin"])
+	}
+
+	if _, err := ExtractBaseConfig(json.RawMessage(`[1]`)); err == nil {
+		t.Error("Expected error for non-object config")
+	}
+	if base, err := ExtractBaseConfig(json.RawMessage(`null`)); err != nil || base != nil {
+		t.Errorf("Expected empty base for null config, got %s / %v", base, err)
+	}
+}
+
+func TestRemoveBaseServer(t *testing.T) {
+	base, _ := ExtractBaseConfig(json.RawMessage(liveWithExtras))
+
+	updated, removed, err := RemoveBaseServer(base, "srv0")
+	if err != nil || !removed {
+		t.Fatalf("Expected srv0 to be removed, got %v / %v", removed, err)
+	}
+	var doc map[string]any
+	json.Unmarshal(updated, &doc)
+	if _, ok := doc["apps"].(map[string]any)["http"].(map[string]any)["servers"].(map[string]any)["srv0"]; ok {
+		t.Errorf("Expected srv0 to be gone, got %s", updated)
+	}
+	if doc["logging"] == nil {
+		t.Error("Expected the rest of the base to be kept")
+	}
+
+	if same, removed, err := RemoveBaseServer(updated, "srv0"); err != nil || removed || string(same) != string(updated) {
+		t.Errorf("Expected a missing server to leave the base alone, got %v / %v", removed, err)
+	}
+	if same, removed, err := RemoveBaseServer(nil, "srv0"); err != nil || removed || same != nil {
+		t.Errorf("Expected an empty base to stay empty, got %s / %v / %v", same, removed, err)
+	}
+}
+
+func TestBuildCaddyConfig_KeepsBase(t *testing.T) {
+	live := json.RawMessage(liveWithExtras)
+	var parsed CaddyConfig
+	json.Unmarshal(live, &parsed)
+
+	base, _ := ExtractBaseConfig(live)
+	cfg := BuildCaddyConfigWithServers([]*storage.Route{{
+		ID:          "r1",
+		Domain:      "example.com",
+		HandlerType: "reverse_proxy",
+		Config:      json.RawMessage(`{"upstreams":["localhost:8080"]}`),
+		Enabled:     true,
+	}}, ParseCaddyServers(&parsed), nil)
+	cfg.Base = base
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatalf("Failed to marshal config: %v", err)
+	}
+
+	changes, _ := Diff(json.RawMessage(liveWithExtras), json.RawMessage(data))
+	// Only the parts we manage may differ: the admin settings, which
+	// aren't configured, the routes of srv0 and of the metrics server,
+	// whose routes weren't passed in
+	allowed := map[string]bool{
+		"/admin/listen":                             true,
+		"/admin/enforce_origin":                     true,
+		"/apps/http/servers/metrics/routes/0":       true,
+		"/apps/http/servers/srv0/routes/0/@id":      true,
+		"/apps/http/servers/srv0/routes/0/match":    true,
+		"/apps/http/servers/srv0/routes/0/terminal": true,
+	}
+	for _, c := range changes {
+		if !allowed[c.Path] && !strings.HasPrefix(c.Path, "/apps/http/servers/srv0/routes/0/handle") {
+			t.Errorf("Unexpected change outside managed config: %+v", c)
+		}
+	}
+
+	// A pointer and a value marshal the same way
+	byValue, _ := json.Marshal(*cfg)
+	if string(byValue) != string(data) {
+		t.Error("Expected value and pointer marshaling to match")
+	}
+}
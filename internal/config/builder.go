@@ -1,6 +1,7 @@
 package config
 
 import (
+	"cmp"
 	"encoding/json"
 	"sort"
 	"strings"
@@ -24,11 +25,19 @@ func normalizePath(path string) string {
 type CaddyConfig struct {
 	Admin *AdminConfig `json:"admin,omitempty"`
 	Apps  *Apps        `json:"apps,omitempty"`
+
+	// Base is the rest of the Caddy config, which we don't manage.
+	// See MarshalJSON.
+	Base json.RawMessage `json:"-"`
 }
 
 // AdminConfig is the admin endpoint configuration
 type AdminConfig struct {
-	Listen string `json:"listen,omitempty"`
+	Listen        string                 `json:"listen,omitempty"`
+	EnforceOrigin bool                   `json:"enforce_origin,omitempty"`
+	Origins       []string               `json:"origins,omitempty"`
+	Identity      *storage.AdminIdentity `json:"identity,omitempty"`
+	Remote        *storage.RemoteAdmin   `json:"remote,omitempty"`
 }
 
 // Apps contains Caddy applications
@@ -43,12 +52,16 @@ type HTTPApp struct {
 
 // Server is an HTTP server config
 type Server struct {
-	Listen []string `json:"listen"`
-	Routes []Route  `json:"routes"`
+	Listen         []string                      `json:"listen"`
+	Protocols      []string                      `json:"protocols,omitempty"`
+	AutomaticHTTPS *storage.AutomaticHTTPSConfig `json:"automatic_https,omitempty"`
+	Routes         []Route                       `json:"routes"`
 }
 
-// Route is a Caddy route
+// Route is a Caddy route. ID is emitted as "@id" so the route can be
+// addressed directly through the admin API's /id/ endpoint.
 type Route struct {
+	ID       string    `json:"@id,omitempty"`
 	Match    []Match   `json:"match,omitempty"`
 	Handle   []Handler `json:"handle"`
 	Terminal bool      `json:"terminal,omitempty"`
@@ -63,17 +76,31 @@ type Match struct {
 // Handler is a generic handler
 type Handler map[string]any
 
-// BuildCaddyConfig converts stored routes to Caddy JSON config
+// BuildCaddyConfig converts stored routes to Caddy JSON config, with every
+// route in the default server
 func BuildCaddyConfig(routes []*storage.Route, global *storage.GlobalConfig) *CaddyConfig {
-	// Always preserve admin listener on 0.0.0.0:2019 so we can continue managing Caddy
+	return BuildCaddyConfigWithServers(routes, nil, global)
+}
+
+// BuildCaddyConfigWithServers converts stored routes and servers to Caddy
+// JSON config. Every stored server is emitted with the enabled routes that
+// reference it. Routes without a server, or with one that isn't stored, go
+// to the default server, which listens on storage.DefaultServerListen
+// unless it is stored as well.
+func BuildCaddyConfigWithServers(routes []*storage.Route, servers []*storage.Server, global *storage.GlobalConfig) *CaddyConfig {
+	// Always emit the admin listener so we can continue managing Caddy
 	config := &CaddyConfig{
-		Admin: &AdminConfig{
-			Listen: "0.0.0.0:2019",
-		},
+		Admin: buildAdminConfig(global),
 	}
 
-	if len(routes) == 0 {
-		return config
+	caddyServers := make(map[string]*Server)
+	for _, s := range servers {
+		caddyServers[s.Name] = &Server{
+			Listen:         s.Listen,
+			Protocols:      s.Protocols,
+			AutomaticHTTPS: s.AutomaticHTTPS,
+			Routes:         []Route{},
+		}
 	}
 
 	// Filter enabled routes only
@@ -84,41 +111,89 @@ func BuildCaddyConfig(routes []*storage.Route, global *storage.GlobalConfig) *Ca
 		}
 	}
 
-	if len(enabledRoutes) == 0 {
-		return config
-	}
-
-	// Sort routes by domain for consistent output
-	sort.Slice(enabledRoutes, func(i, j int) bool {
-		if enabledRoutes[i].Domain != enabledRoutes[j].Domain {
-			return enabledRoutes[i].Domain < enabledRoutes[j].Domain
-		}
-		return enabledRoutes[i].Path < enabledRoutes[j].Path
+	// Every route is terminal, so more specific routes have to come first
+	sort.SliceStable(enabledRoutes, func(i, j int) bool {
+		return compareRoutes(enabledRoutes[i], enabledRoutes[j]) < 0
 	})
 
 	// Build Caddy routes
-	var caddyRoutes []Route
 	for _, sr := range enabledRoutes {
 		caddyRoute := buildRoute(sr, global)
-		if caddyRoute != nil {
-			caddyRoutes = append(caddyRoutes, *caddyRoute)
+		if caddyRoute == nil {
+			continue
 		}
+		caddyRoute.ID = sr.ID
+
+		server, ok := caddyServers[sr.Server]
+		if !ok {
+			server, ok = caddyServers[storage.DefaultServerName]
+			if !ok {
+				server = &Server{Listen: storage.DefaultServerListen}
+				caddyServers[storage.DefaultServerName] = server
+			}
+		}
+		server.Routes = append(server.Routes, *caddyRoute)
+	}
+
+	if len(caddyServers) == 0 {
+		return config
 	}
 
 	config.Apps = &Apps{
 		HTTP: &HTTPApp{
-			Servers: map[string]*Server{
-				"srv0": {
-					Listen: []string{":443", ":80"},
-					Routes: caddyRoutes,
-				},
-			},
+			Servers: caddyServers,
 		},
 	}
 
 	return config
 }
 
+// compareRoutes orders routes the way Caddy should try them, so that no
+// route shadows a more specific one: routes for given hosts before those
+// for any host, then longer paths first and routes without a path last.
+// Ties go by domain and path, for consistent output.
+func compareRoutes(a, b *storage.Route) int {
+	anyHostA, anyHostB := a.Domain == "" || a.Domain == "*", b.Domain == "" || b.Domain == "*"
+	if anyHostA != anyHostB {
+		if anyHostA {
+			return 1
+		}
+		return -1
+	}
+	if (a.Path == "") != (b.Path == "") {
+		if a.Path == "" {
+			return 1
+		}
+		return -1
+	}
+	if c := cmp.Compare(len(normalizePath(b.Path)), len(normalizePath(a.Path))); c != 0 {
+		return c
+	}
+	if c := strings.Compare(a.Domain, b.Domain); c != 0 {
+		return c
+	}
+	return strings.Compare(a.Path, b.Path)
+}
+
+// buildAdminConfig returns the admin settings from global, listening on
+// storage.DefaultAdminListen unless another address is configured
+func buildAdminConfig(global *storage.GlobalConfig) *AdminConfig {
+	admin := &AdminConfig{Listen: storage.DefaultAdminListen}
+	if global == nil || global.Admin == nil {
+		return admin
+	}
+
+	a := global.Admin
+	if a.Listen != "" {
+		admin.Listen = a.Listen
+	}
+	admin.EnforceOrigin = a.EnforceOrigin
+	admin.Origins = a.Origins
+	admin.Identity = a.Identity
+	admin.Remote = a.Remote
+	return admin
+}
+
 // buildRoute converts a single stored route to a Caddy route
 func buildRoute(r *storage.Route, global *storage.GlobalConfig) *Route {
 	// If we have preserved raw Caddy route, use it as base
@@ -176,6 +251,11 @@ func buildRoute(r *storage.Route, global *storage.GlobalConfig) *Route {
 		})
 	}
 
+	// Add authentication handler ahead of the main handler
+	if h := buildBasicAuthHandler(r.BasicAuth); h != nil {
+		handlers = append(handlers, h)
+	}
+
 	// Build handler based on type
 	switch r.HandlerType {
 	case "reverse_proxy":
@@ -286,6 +366,9 @@ func buildRouteMerged(r *storage.Route, global *storage.GlobalConfig) *Route {
 		})
 	}
 
+	// 2.75. Basic auth (Local)
+	authHandler := buildBasicAuthHandler(r.BasicAuth)
+
 	// 3. Main Handler (Local)
 	var mainHandler Handler
 	switch r.HandlerType {
@@ -315,6 +398,10 @@ func buildRouteMerged(r *storage.Route, global *storage.GlobalConfig) *Route {
 
 	for _, h := range original.Handle {
 		hType, _ := h["handler"].(string)
+		if hType == "authentication" && isBasicAuthHandler(h) {
+			// Basic auth is managed by us; other auth providers are kept as-is
+			continue
+		}
 		if !managedTypes[hType] {
 			unknownHandlers = append(unknownHandlers, h)
 		}
@@ -326,6 +413,10 @@ func buildRouteMerged(r *storage.Route, global *storage.GlobalConfig) *Route {
 	// If unknown handler is a terminal one (like `acme_server`), it might conflict if we also add reverse_proxy.
 	// But usually we only have one terminal handler.
 
+	// Authentication goes before the unknowns so they are protected as well.
+	if authHandler != nil {
+		newHandlers = append(newHandlers, authHandler)
+	}
 	newHandlers = append(newHandlers, unknownHandlers...)
 	if mainHandler != nil {
 		newHandlers = append(newHandlers, mainHandler)
@@ -484,3 +575,52 @@ func buildHeadersHandler(cfg *storage.HeaderConfig) Handler {
 		"response": response,
 	}
 }
+
+func buildBasicAuthHandler(cfg *storage.BasicAuthConfig) Handler {
+	if cfg == nil || !cfg.Enabled || len(cfg.Users) == 0 {
+		return nil
+	}
+
+	var accounts []map[string]any
+	for _, u := range cfg.Users {
+		if u.Username == "" || u.Password == "" {
+			continue
+		}
+		accounts = append(accounts, map[string]any{
+			"username": u.Username,
+			"password": u.Password,
+		})
+	}
+
+	if len(accounts) == 0 {
+		return nil
+	}
+
+	httpBasic := map[string]any{
+		"accounts": accounts,
+		"hash": map[string]any{
+			"algorithm": "bcrypt",
+		},
+	}
+	if cfg.Realm != "" {
+		httpBasic["realm"] = cfg.Realm
+	}
+
+	return Handler{
+		"handler": "authentication",
+		"providers": map[string]any{
+			"http_basic": httpBasic,
+		},
+	}
+}
+
+// isBasicAuthHandler reports whether an authentication handler uses only
+// the http_basic provider with bcrypt hashes, which is the one we manage
+func isBasicAuthHandler(h Handler) bool {
+	providers, ok := h["providers"].(map[string]any)
+	if !ok || len(providers) != 1 {
+		return false
+	}
+	httpBasic, ok := providers["http_basic"].(map[string]any)
+	return ok && basicAuthAlgorithm(httpBasic) == "bcrypt"
+}
@@ -18,6 +18,45 @@ func TestBuildCaddyConfig_Empty(t *testing.T) {
 	}
 }
 
+func TestBuildCaddyConfig_AdminSettings(t *testing.T) {
+	global := &storage.GlobalConfig{Admin: &storage.AdminSettings{
+		Listen:        "unix//run/caddy/admin.sock",
+		EnforceOrigin: true,
+		Origins:       []string{"admin.example.com"},
+		Identity:      &storage.AdminIdentity{Identifiers: []string{"caddy.example.com"}},
+		Remote: &storage.RemoteAdmin{
+			Listen: ":2021",
+			AccessControl: []storage.RemoteAdminAccess{{
+				PublicKeys:  []string{"MIIB..."},
+				Permissions: []storage.RemoteAdminPermission{{Paths: []string{"/config/"}, Methods: []string{"GET"}}},
+			}},
+		},
+	}}
+
+	data, err := json.Marshal(BuildCaddyConfig(nil, global))
+	if err != nil {
+		t.Fatalf("Failed to marshal config: %v", err)
+	}
+
+	expected := `{"admin":{"listen":"unix//run/caddy/admin.sock","enforce_origin":true,"origins":["admin.example.com"],` +
+		`"identity":{"identifiers":["caddy.example.com"]},` +
+		`"remote":{"listen":":2021","access_control":[{"public_keys":["MIIB..."],"permissions":[{"paths":["/config/"],"methods":["GET"]}]}]}}}`
+	if string(data) != expected {
+		t.Errorf("Unexpected admin config:\n got %s\nwant %s", data, expected)
+	}
+
+	// Settings without a listen address keep the default one
+	cfg := BuildCaddyConfig(nil, &storage.GlobalConfig{Admin: &storage.AdminSettings{EnforceOrigin: true}})
+	if cfg.Admin.Listen != storage.DefaultAdminListen || !cfg.Admin.EnforceOrigin {
+		t.Errorf("Expected default listen address, got %+v", cfg.Admin)
+	}
+
+	parsed := ParseAdminSettings(&CaddyConfig{Admin: &AdminConfig{Listen: "localhost:2019", Origins: []string{"localhost"}}})
+	if parsed == nil || parsed.Listen != "localhost:2019" || parsed.Origins[0] != "localhost" {
+		t.Errorf("Unexpected parsed admin settings: %+v", parsed)
+	}
+}
+
 func TestBuildCaddyConfig_EmptyRoutes(t *testing.T) {
 	cfg := BuildCaddyConfig([]*storage.Route{}, nil)
 
@@ -493,3 +532,106 @@ func TestBuildCaddyConfig_NormalizesPathAndStripPrefix(t *testing.T) {
 		t.Errorf("Expected strip_path_prefix to be normalized to /api, got %v", rewriteHandler["strip_path_prefix"])
 	}
 }
+
+func TestBuildCaddyConfig_WithBasicAuth(t *testing.T) {
+	routes := []*storage.Route{
+		{
+			Domain:      "example.com",
+			HandlerType: "reverse_proxy",
+			Config:      json.RawMessage(`{"upstreams":["localhost:8080"]}`),
+			BasicAuth: &storage.BasicAuthConfig{
+				Enabled: true,
+				Realm:   "restricted",
+				Users:   []storage.BasicAuthUser{{Username: "admin", Password: "$2a$10$hash"}},
+			},
+			Enabled: true,
+		},
+	}
+
+	cfg := BuildCaddyConfig(routes, nil)
+	route := cfg.Apps.HTTP.Servers["srv0"].Routes[0]
+
+	if len(route.Handle) != 2 {
+		t.Fatalf("Expected 2 handlers (authentication + reverse_proxy), got %d", len(route.Handle))
+	}
+
+	auth := route.Handle[0]
+	if auth["handler"] != "authentication" {
+		t.Fatalf("Expected first handler to be authentication, got %v", auth["handler"])
+	}
+
+	providers := auth["providers"].(map[string]any)
+	httpBasic := providers["http_basic"].(map[string]any)
+	if httpBasic["realm"] != "restricted" {
+		t.Errorf("Expected realm restricted, got %v", httpBasic["realm"])
+	}
+	accounts := httpBasic["accounts"].([]map[string]any)
+	if len(accounts) != 1 || accounts[0]["username"] != "admin" || accounts[0]["password"] != "$2a$10$hash" {
+		t.Errorf("Unexpected accounts: %v", accounts)
+	}
+
+	if route.Handle[1]["handler"] != "reverse_proxy" {
+		t.Errorf("Expected main handler last, got %v", route.Handle[1]["handler"])
+	}
+}
+
+func TestBuildBasicAuthHandler_Disabled(t *testing.T) {
+	t.Run("nil config", func(t *testing.T) {
+		if h := buildBasicAuthHandler(nil); h != nil {
+			t.Error("Expected nil handler for nil config")
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		h := buildBasicAuthHandler(&storage.BasicAuthConfig{
+			Enabled: false,
+			Users:   []storage.BasicAuthUser{{Username: "admin", Password: "$2a$10$hash"}},
+		})
+		if h != nil {
+			t.Error("Expected nil handler when basic auth is disabled")
+		}
+	})
+
+	t.Run("no users", func(t *testing.T) {
+		if h := buildBasicAuthHandler(&storage.BasicAuthConfig{Enabled: true}); h != nil {
+			t.Error("Expected nil handler without users")
+		}
+	})
+}
+
+func TestBuildCaddyConfig_MergedKeepsForeignAuthentication(t *testing.T) {
+	raw := `{"match":[{"host":["example.com"]}],"handle":[` +
+		`{"handler":"authentication","providers":{"http_basic":{"accounts":[{"username":"old","password":"x"}]}}},` +
+		`{"handler":"authentication","providers":{"jwt":{}}},` +
+		`{"handler":"reverse_proxy","upstreams":[{"dial":"localhost:8080"}]}]}`
+
+	routes := []*storage.Route{
+		{
+			Domain:        "example.com",
+			HandlerType:   "reverse_proxy",
+			Config:        json.RawMessage(`{"upstreams":["localhost:8080"]}`),
+			RawCaddyRoute: json.RawMessage(raw),
+			BasicAuth: &storage.BasicAuthConfig{
+				Enabled: true,
+				Users:   []storage.BasicAuthUser{{Username: "admin", Password: "$2a$10$hash"}},
+			},
+			Enabled: true,
+		},
+	}
+
+	cfg := BuildCaddyConfig(routes, nil)
+	handle := cfg.Apps.HTTP.Servers["srv0"].Routes[0].Handle
+
+	if len(handle) != 3 {
+		t.Fatalf("Expected 3 handlers, got %d: %v", len(handle), handle)
+	}
+
+	basic := handle[0]["providers"].(map[string]any)["http_basic"].(map[string]any)
+	accounts := basic["accounts"].([]map[string]any)
+	if accounts[0]["username"] != "admin" {
+		t.Errorf("Expected managed basic auth to replace the original, got %v", accounts)
+	}
+	if _, ok := handle[1]["providers"].(map[string]any)["jwt"]; !ok {
+		t.Errorf("Expected foreign authentication handler to be preserved, got %v", handle[1])
+	}
+}
@@ -0,0 +1,753 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ArtemStepanov/caddy-admin-ui/internal/storage"
+	"github.com/google/uuid"
+)
+
+// CaddyfileIssue is a line of a Caddyfile that couldn't be imported
+type CaddyfileIssue struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+// CaddyfileImport is what ParseCaddyfile found in a Caddyfile
+type CaddyfileImport struct {
+	Routes []*storage.Route
+	// EnableEncode is set if any site uses encode. Compression is a
+	// global setting here, so it applies to every route.
+	EnableEncode bool
+	// Unsupported lists everything that was skipped, ordered by line
+	Unsupported []CaddyfileIssue
+}
+
+// ParseCaddyfile converts the site blocks of a Caddyfile into routes. It
+// understands site addresses, snippets, reverse_proxy, file_server, root,
+// redir, header, encode, basicauth, handle and handle_path; everything else
+// is reported in Unsupported. Only syntax errors are returned as errors.
+func ParseCaddyfile(src []byte) (*CaddyfileImport, error) {
+	lines, err := lexCaddyfile(string(src))
+	if err != nil {
+		return nil, err
+	}
+	i := 0
+	nodes, err := parseCaddyfileBlock(lines, &i, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &caddyfileParser{result: &CaddyfileImport{}, snippets: map[string][]*caddyfileNode{}}
+	for _, n := range nodes {
+		if name, ok := snippetName(n); ok {
+			p.snippets[name] = n.block
+		}
+	}
+
+	for idx, n := range nodes {
+		if _, ok := snippetName(n); ok {
+			continue
+		}
+		switch {
+		case len(n.args) == 0:
+			for _, opt := range n.block {
+				p.unsupported(opt.line, "global option %q is not imported", opt.args[0])
+			}
+		case strings.HasPrefix(n.args[0], "&("):
+			p.unsupported(n.line, "named route %s is not supported", n.args[0])
+		case n.hasBlock:
+			p.site(n, n.block)
+		default:
+			// A Caddyfile with a single site may leave out the braces, in
+			// which case the rest of the file is its body
+			p.site(n, nodes[idx+1:])
+			return p.finish(), nil
+		}
+	}
+	return p.finish(), nil
+}
+
+// caddyfileToken is a word of a Caddyfile and the line it starts on
+type caddyfileToken struct {
+	text   string
+	line   int
+	quoted bool
+}
+
+// isBrace reports whether the token opens or closes a block
+func (t caddyfileToken) isBrace(brace string) bool {
+	return !t.quoted && t.text == brace
+}
+
+// lexCaddyfile splits a Caddyfile into lines of tokens, dropping comments
+// and joining lines that end in a backslash
+func lexCaddyfile(src string) ([][]caddyfileToken, error) {
+	var lines [][]caddyfileToken
+	var current []caddyfileToken
+	var word strings.Builder
+	inWord, lineNo, wordLine := false, 1, 0
+
+	endWord := func(quoted bool) {
+		if inWord || quoted {
+			current = append(current, caddyfileToken{text: word.String(), line: wordLine, quoted: quoted})
+		}
+		word.Reset()
+		inWord = false
+	}
+	endLine := func() {
+		endWord(false)
+		if len(current) > 0 {
+			lines = append(lines, current)
+			current = nil
+		}
+	}
+
+	for i := 0; i < len(src); i++ {
+		ch := src[i]
+		switch {
+		case ch == '\\' && strings.HasPrefix(src[i+1:], "\n"):
+			endWord(false)
+			lineNo++
+			i++
+		case ch == '\\' && strings.HasPrefix(src[i+1:], "\r\n"):
+			endWord(false)
+			lineNo++
+			i += 2
+		case ch == '\n':
+			endLine()
+			lineNo++
+		case ch == ' ' || ch == '\t' || ch == '\r':
+			endWord(false)
+		case ch == '#' && !inWord:
+			for i+1 < len(src) && src[i+1] != '\n' {
+				i++
+			}
+		case (ch == '"' || ch == '`') && !inWord:
+			wordLine = lineNo
+			start := lineNo
+			closed := false
+			for i++; i < len(src); i++ {
+				c := src[i]
+				if c == ch {
+					closed = true
+					break
+				}
+				if ch == '"' && c == '\\' && i+1 < len(src) && src[i+1] == '"' {
+					c = '"'
+					i++
+				}
+				if c == '\n' {
+					lineNo++
+				}
+				word.WriteByte(c)
+			}
+			if !closed {
+				return nil, fmt.Errorf("line %d: unterminated quoted string", start)
+			}
+			endWord(true)
+		default:
+			if !inWord {
+				inWord = true
+				wordLine = lineNo
+			}
+			word.WriteByte(ch)
+		}
+	}
+	endLine()
+	return lines, nil
+}
+
+// caddyfileNode is a directive, option or site with its arguments and
+// optional block
+type caddyfileNode struct {
+	line     int
+	args     []string
+	hasBlock bool
+	block    []*caddyfileNode
+}
+
+// parseCaddyfileBlock reads nodes from lines until the closing brace of the
+// current block, or the end of the file at the top level
+func parseCaddyfileBlock(lines [][]caddyfileToken, i *int, depth int) ([]*caddyfileNode, error) {
+	var nodes []*caddyfileNode
+	for *i < len(lines) {
+		tokens := lines[*i]
+		*i++
+		if len(tokens) == 1 && tokens[0].isBrace("}") {
+			if depth == 0 {
+				return nil, fmt.Errorf("line %d: unexpected }", tokens[0].line)
+			}
+			return nodes, nil
+		}
+
+		// Site addresses may continue on the next line after a comma
+		for depth == 0 && strings.HasSuffix(tokens[len(tokens)-1].text, ",") && *i < len(lines) {
+			tokens = append(tokens, lines[*i]...)
+			*i++
+		}
+
+		n := &caddyfileNode{line: tokens[0].line}
+		if last := tokens[len(tokens)-1]; last.isBrace("{") {
+			n.hasBlock = true
+			tokens = tokens[:len(tokens)-1]
+		}
+		for _, t := range tokens {
+			if t.isBrace("{") || t.isBrace("}") {
+				return nil, fmt.Errorf("line %d: unexpected %s", t.line, t.text)
+			}
+			n.args = append(n.args, t.text)
+		}
+		if n.hasBlock {
+			var err error
+			n.block, err = parseCaddyfileBlock(lines, i, depth+1)
+			if errors.Is(err, errUnclosedBlock) {
+				return nil, fmt.Errorf("line %d: block is never closed", n.line)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		switch {
+		case len(n.args) > 0:
+		case depth > 0:
+			return nil, fmt.Errorf("line %d: block without a directive", n.line)
+		case len(nodes) > 0:
+			return nil, fmt.Errorf("line %d: the global options block must come first", n.line)
+		}
+		nodes = append(nodes, n)
+	}
+	if depth > 0 {
+		return nil, errUnclosedBlock
+	}
+	return nodes, nil
+}
+
+// errUnclosedBlock is returned by nested parseCaddyfileBlock calls that
+// run out of lines; the caller reports the block's opening line instead
+var errUnclosedBlock = errors.New("block is never closed")
+
+// snippetName returns the name of a snippet definition like "(common) {"
+func snippetName(n *caddyfileNode) (string, bool) {
+	if len(n.args) != 1 || !n.hasBlock {
+		return "", false
+	}
+	arg := n.args[0]
+	if len(arg) > 2 && arg[0] == '(' && arg[len(arg)-1] == ')' {
+		return arg[1 : len(arg)-1], true
+	}
+	return "", false
+}
+
+// caddyfileParser collects routes and issues while walking the sites
+type caddyfileParser struct {
+	result   *CaddyfileImport
+	snippets map[string][]*caddyfileNode
+}
+
+func (p *caddyfileParser) unsupported(line int, format string, args ...any) {
+	p.result.Unsupported = append(p.result.Unsupported, CaddyfileIssue{Line: line, Message: fmt.Sprintf(format, args...)})
+}
+
+// finish orders the issues by line, as nested blocks are handled after
+// their parent, and drops repeats from snippets imported more than once
+func (p *caddyfileParser) finish() *CaddyfileImport {
+	issues := p.result.Unsupported
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].Line < issues[j].Line })
+	p.result.Unsupported = slices.Compact(issues)
+	return p.result
+}
+
+// expand replaces imports of snippets with the snippets' directives
+func (p *caddyfileParser) expand(nodes []*caddyfileNode, depth int) []*caddyfileNode {
+	var expanded []*caddyfileNode
+	for _, n := range nodes {
+		if n.args[0] != "import" {
+			expanded = append(expanded, n)
+			continue
+		}
+		snippet, ok := p.snippets[argAt(n.args, 1)]
+		switch {
+		case len(n.args) != 2 || !ok:
+			p.unsupported(n.line, "import of %q is not supported, only snippets without arguments", strings.Join(n.args[1:], " "))
+		case depth >= 10:
+			p.unsupported(n.line, "snippet %s imports itself", n.args[1])
+		default:
+			expanded = append(expanded, p.expand(snippet, depth+1)...)
+		}
+	}
+	return expanded
+}
+
+// caddyfileScope is a site or a handle block. Routes in a handle block
+// start out with the settings of the site around it.
+type caddyfileScope struct {
+	domain    string
+	path      string
+	strip     string
+	root      string
+	headers   *storage.HeaderConfig
+	basicAuth *storage.BasicAuthConfig
+	handlers  []*caddyfileHandler
+	nested    []*caddyfileNode
+}
+
+// caddyfileHandler is a main handler directive of a scope
+type caddyfileHandler struct {
+	line        int
+	path        string
+	handlerType string
+	config      any
+}
+
+// site turns a site block into routes
+func (p *caddyfileParser) site(n *caddyfileNode, body []*caddyfileNode) {
+	domain, ok := p.siteDomain(n)
+	if !ok {
+		return
+	}
+	before := len(p.result.Routes)
+	p.scope(&caddyfileScope{domain: domain}, body)
+	if len(p.result.Routes) == before {
+		p.unsupported(n.line, "site %s has no supported handler and was skipped", strings.Join(n.args, " "))
+	}
+}
+
+// siteDomain returns the route domain for a site's addresses. Addresses
+// without a host match every domain.
+func (p *caddyfileParser) siteDomain(n *caddyfileNode) (string, bool) {
+	var hosts []string
+	catchAll := false
+	for _, arg := range n.args {
+		for _, addr := range strings.Split(arg, ",") {
+			addr = strings.TrimSpace(addr)
+			if addr == "" {
+				continue
+			}
+			rest := addr
+			if i := strings.Index(rest, "://"); i >= 0 {
+				rest = rest[i+3:]
+			}
+			if strings.Contains(rest, "/") {
+				p.unsupported(n.line, "site address %s has a path, use handle blocks instead", addr)
+				return "", false
+			}
+			host := rest
+			if h, port, err := net.SplitHostPort(rest); err == nil {
+				host = h
+				if port != "80" && port != "443" {
+					p.unsupported(n.line, "port %s of %s is not imported, routes go to the default server", port, addr)
+				}
+			}
+			if host == "" {
+				catchAll = true
+			} else {
+				hosts = append(hosts, host)
+			}
+		}
+	}
+	if catchAll || len(hosts) == 0 {
+		return "*", true
+	}
+	return strings.Join(hosts, ", "), true
+}
+
+// scope reads the directives of a site or handle block, then emits a route
+// per main handler and handles the nested handle blocks
+func (p *caddyfileParser) scope(s *caddyfileScope, body []*caddyfileNode) {
+	for _, n := range p.expand(body, 0) {
+		p.directive(s, n)
+	}
+
+	headers := s.headers
+	if headers != nil && len(headers.Set) == 0 && len(headers.Add) == 0 && len(headers.Delete) == 0 {
+		headers = nil
+	}
+	for _, h := range s.handlers {
+		route := &storage.Route{
+			ID:              uuid.New().String(),
+			Domain:          s.domain,
+			Path:            s.path,
+			HandlerType:     h.handlerType,
+			Headers:         headers,
+			BasicAuth:       s.basicAuth,
+			StripPathPrefix: s.strip,
+			Enabled:         true,
+		}
+		if h.path != "" {
+			route.Path = h.path
+		}
+		if fs, ok := h.config.(*storage.FileServerConfig); ok && fs.Root == "" {
+			fs.Root = s.root
+		}
+		route.Config, _ = json.Marshal(h.config)
+		p.result.Routes = append(p.result.Routes, route)
+	}
+
+	for _, n := range s.nested {
+		p.handleBlock(s, n)
+	}
+}
+
+// directive applies one directive of a scope
+func (p *caddyfileParser) directive(s *caddyfileScope, n *caddyfileNode) {
+	name := n.args[0]
+	if strings.HasPrefix(name, "@") {
+		p.unsupported(n.line, "named matcher %s is not supported", name)
+		return
+	}
+
+	switch name {
+	case "root":
+		path, args, ok := p.matcher(n)
+		if !ok {
+			return
+		}
+		if path != "" || len(args) != 1 {
+			p.unsupported(n.line, "root only supports a single path for the whole site")
+			return
+		}
+		s.root = args[0]
+	case "reverse_proxy":
+		p.reverseProxy(s, n)
+	case "file_server":
+		p.fileServer(s, n)
+	case "redir":
+		p.redir(s, n)
+	case "header":
+		p.header(s, n)
+	case "encode":
+		path, _, ok := p.matcher(n)
+		if !ok {
+			return
+		}
+		if path != "" {
+			p.unsupported(n.line, "encode with a matcher is not supported, compression applies to all routes")
+			return
+		}
+		for _, sub := range n.block {
+			if sub.args[0] != "gzip" && sub.args[0] != "zstd" {
+				p.unsupported(sub.line, "encode option %q is not supported", sub.args[0])
+			}
+		}
+		p.result.EnableEncode = true
+	case "basicauth", "basic_auth":
+		p.basicAuth(s, n)
+	case "uri":
+		path, args, ok := p.matcher(n)
+		if !ok {
+			return
+		}
+		if path != "" || len(args) != 2 || args[0] != "strip_prefix" {
+			p.unsupported(n.line, "uri only supports strip_prefix without a matcher")
+			return
+		}
+		s.strip = strings.TrimSuffix(args[1], "/")
+	case "handle", "handle_path":
+		s.nested = append(s.nested, n)
+	default:
+		p.unsupported(n.line, "unsupported directive %q", name)
+	}
+}
+
+// matcher splits a leading matcher off a directive's arguments. Only path
+// matchers are supported; "*" and no matcher match everything.
+func (p *caddyfileParser) matcher(n *caddyfileNode) (path string, args []string, ok bool) {
+	args = n.args[1:]
+	if len(args) == 0 {
+		return "", args, true
+	}
+	switch first := args[0]; {
+	case first == "*":
+		return "", args[1:], true
+	case strings.HasPrefix(first, "/"):
+		return first, args[1:], true
+	case strings.HasPrefix(first, "@"):
+		p.unsupported(n.line, "%s with named matcher %s is not supported", n.args[0], first)
+		return "", nil, false
+	}
+	return "", args, true
+}
+
+// addHandler adds a main handler to a scope. A path gets one handler;
+// inside a handle block the block's path is used.
+func (p *caddyfileParser) addHandler(s *caddyfileScope, n *caddyfileNode, path, handlerType string, cfg any) {
+	if path != "" && s.path != "" {
+		p.unsupported(n.line, "%s with a path inside a handle block is not supported", n.args[0])
+		return
+	}
+	for _, h := range s.handlers {
+		if h.path == path {
+			p.unsupported(n.line, "%s: path %q already has a %s handler (line %d)", n.args[0], displayPath(path), h.handlerType, h.line)
+			return
+		}
+	}
+	s.handlers = append(s.handlers, &caddyfileHandler{line: n.line, path: path, handlerType: handlerType, config: cfg})
+}
+
+func displayPath(path string) string {
+	if path == "" {
+		return "*"
+	}
+	return path
+}
+
+func (p *caddyfileParser) reverseProxy(s *caddyfileScope, n *caddyfileNode) {
+	path, args, ok := p.matcher(n)
+	if !ok {
+		return
+	}
+	cfg := &storage.ReverseProxyConfig{}
+	for _, u := range args {
+		p.upstream(cfg, n.line, u)
+	}
+	for _, sub := range n.block {
+		switch sub.args[0] {
+		case "to":
+			for _, u := range sub.args[1:] {
+				p.upstream(cfg, sub.line, u)
+			}
+		case "lb_policy":
+			if len(sub.args) != 2 {
+				p.unsupported(sub.line, "lb_policy options are not supported")
+				continue
+			}
+			cfg.LoadBalancing = sub.args[1]
+		case "header_up":
+			field := argAt(sub.args, 1)
+			if len(sub.args) != 3 || strings.HasPrefix(field, "+") || strings.HasPrefix(field, "-") {
+				p.unsupported(sub.line, "header_up only supports setting a header")
+				continue
+			}
+			if cfg.Headers == nil {
+				cfg.Headers = map[string]string{}
+			}
+			cfg.Headers[field] = sub.args[2]
+		default:
+			p.unsupported(sub.line, "reverse_proxy option %q is not supported", sub.args[0])
+		}
+	}
+	if len(cfg.Upstreams) == 0 {
+		p.unsupported(n.line, "reverse_proxy has no supported upstreams")
+		return
+	}
+	p.addHandler(s, n, path, "reverse_proxy", cfg)
+}
+
+// upstream adds an upstream address as a dial address
+func (p *caddyfileParser) upstream(cfg *storage.ReverseProxyConfig, line int, addr string) {
+	dial := strings.TrimPrefix(addr, "http://")
+	if strings.Contains(dial, "://") {
+		p.unsupported(line, "upstream %s: only plain HTTP upstreams are supported", addr)
+		return
+	}
+	if _, _, err := net.SplitHostPort(dial); err != nil && !strings.HasPrefix(dial, "{") {
+		dial = net.JoinHostPort(dial, "80")
+	}
+	cfg.Upstreams = append(cfg.Upstreams, dial)
+}
+
+func (p *caddyfileParser) fileServer(s *caddyfileScope, n *caddyfileNode) {
+	path, args, ok := p.matcher(n)
+	if !ok {
+		return
+	}
+	cfg := &storage.FileServerConfig{}
+	for _, arg := range args {
+		if arg == "browse" {
+			cfg.Browse = true
+		} else {
+			p.unsupported(n.line, "file_server argument %q is not supported", arg)
+		}
+	}
+	for _, sub := range n.block {
+		switch sub.args[0] {
+		case "root":
+			cfg.Root = argAt(sub.args, 1)
+		case "browse":
+			cfg.Browse = true
+			if len(sub.args) > 1 || sub.hasBlock {
+				p.unsupported(sub.line, "browse templates and options are not supported")
+			}
+		case "index":
+			cfg.Index = append(cfg.Index, sub.args[1:]...)
+		case "hide":
+			cfg.Hide = append(cfg.Hide, sub.args[1:]...)
+		case "precompressed":
+			cfg.Precompressed = true
+		default:
+			p.unsupported(sub.line, "file_server option %q is not supported", sub.args[0])
+		}
+	}
+	p.addHandler(s, n, path, "file_server", cfg)
+}
+
+func (p *caddyfileParser) redir(s *caddyfileScope, n *caddyfileNode) {
+	path, args, ok := p.matcher(n)
+	if !ok {
+		return
+	}
+	// A lone path is the target, not a matcher
+	if path != "" && len(args) == 0 {
+		path, args = "", []string{path}
+	}
+	if len(args) == 0 || len(args) > 2 {
+		p.unsupported(n.line, "redir needs a target and an optional code")
+		return
+	}
+
+	cfg := &storage.RedirectConfig{To: args[0]}
+	switch code := argAt(args, 1); code {
+	case "", "temporary":
+	case "permanent":
+		cfg.Code = 301
+	default:
+		status, err := strconv.Atoi(code)
+		if err != nil || status < 300 || status > 399 {
+			p.unsupported(n.line, "redir code %q is not supported", code)
+			return
+		}
+		cfg.Code = status
+	}
+	p.addHandler(s, n, path, "redir", cfg)
+}
+
+// header sets response headers for every route of the scope
+func (p *caddyfileParser) header(s *caddyfileScope, n *caddyfileNode) {
+	path, args, ok := p.matcher(n)
+	if !ok {
+		return
+	}
+	if path != "" {
+		p.unsupported(n.line, "header with a path matcher is not supported, use a handle block")
+		return
+	}
+	s.headers = cloneHeaderConfig(s.headers)
+	if len(args) > 0 {
+		p.headerOp(s.headers, n.line, args)
+	}
+	for _, sub := range n.block {
+		p.headerOp(s.headers, sub.line, sub.args)
+	}
+}
+
+// headerOp applies one header field operation: "Name value" sets,
+// "+Name value" adds and "-Name" deletes
+func (p *caddyfileParser) headerOp(h *storage.HeaderConfig, line int, args []string) {
+	field := strings.TrimPrefix(args[0], ">")
+	switch {
+	case len(field) > 1 && field[0] == '-' && len(args) == 1:
+		h.Delete = append(h.Delete, field[1:])
+	case len(field) > 1 && field[0] == '+' && len(args) == 2:
+		if h.Add == nil {
+			h.Add = map[string]string{}
+		}
+		h.Add[field[1:]] = args[1]
+	case field != "" && !strings.ContainsAny(field[:1], "+-?") && len(args) == 2:
+		if h.Set == nil {
+			h.Set = map[string]string{}
+		}
+		h.Set[field] = args[1]
+	default:
+		p.unsupported(line, "header operation %q is not supported", strings.Join(args, " "))
+	}
+}
+
+func (p *caddyfileParser) basicAuth(s *caddyfileScope, n *caddyfileNode) {
+	path, args, ok := p.matcher(n)
+	if !ok {
+		return
+	}
+	if path != "" {
+		p.unsupported(n.line, "%s with a path matcher is not supported, use a handle block", n.args[0])
+		return
+	}
+	if alg := argAt(args, 0); alg != "" && alg != "bcrypt" {
+		p.unsupported(n.line, "%s hash algorithm %s is not supported, only bcrypt", n.args[0], alg)
+		return
+	}
+
+	cfg := &storage.BasicAuthConfig{Enabled: true, Realm: argAt(args, 1)}
+	for _, sub := range n.block {
+		if len(sub.args) != 2 {
+			p.unsupported(sub.line, "%s account needs a username and a password hash", n.args[0])
+			continue
+		}
+		hash := decodeBasicAuthHash(sub.args[1])
+		if !storage.IsBcryptHash(hash) {
+			p.unsupported(sub.line, "password of %s is not a bcrypt hash", sub.args[0])
+			continue
+		}
+		cfg.Users = append(cfg.Users, storage.BasicAuthUser{Username: sub.args[0], Password: hash})
+	}
+	if len(cfg.Users) == 0 {
+		p.unsupported(n.line, "%s has no usable accounts", n.args[0])
+		return
+	}
+	s.basicAuth = cfg
+}
+
+// handleBlock turns a handle or handle_path block into a nested scope.
+// handle_path also strips the matched prefix.
+func (p *caddyfileParser) handleBlock(parent *caddyfileScope, n *caddyfileNode) {
+	path, args, ok := p.matcher(n)
+	if !ok {
+		return
+	}
+	switch {
+	case !n.hasBlock:
+		p.unsupported(n.line, "%s needs a block", n.args[0])
+		return
+	case len(args) > 0:
+		p.unsupported(n.line, "%s only supports a single path matcher", n.args[0])
+		return
+	case parent.path != "":
+		p.unsupported(n.line, "nested %s blocks are not supported", n.args[0])
+		return
+	}
+
+	child := &caddyfileScope{
+		domain:    parent.domain,
+		path:      path,
+		root:      parent.root,
+		headers:   parent.headers,
+		basicAuth: parent.basicAuth,
+	}
+	if n.args[0] == "handle_path" {
+		if path == "" {
+			p.unsupported(n.line, "handle_path needs a path")
+			return
+		}
+		child.strip = strings.TrimSuffix(strings.TrimSuffix(path, "*"), "/")
+	}
+	p.scope(child, n.block)
+}
+
+// cloneHeaderConfig copies h so a handle block can add to its site's
+// headers without changing them
+func cloneHeaderConfig(h *storage.HeaderConfig) *storage.HeaderConfig {
+	if h == nil {
+		return &storage.HeaderConfig{}
+	}
+	return &storage.HeaderConfig{
+		Set:    maps.Clone(h.Set),
+		Add:    maps.Clone(h.Add),
+		Delete: append([]string(nil), h.Delete...),
+	}
+}
+
+// argAt returns args[i], or "" if there are fewer arguments
+func argAt(args []string, i int) string {
+	if i < len(args) {
+		return args[i]
+	}
+	return ""
+}
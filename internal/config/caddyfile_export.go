@@ -0,0 +1,374 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ArtemStepanov/caddy-admin-ui/internal/storage"
+)
+
+// RenderCaddyfile renders routes as a Caddyfile, one site block per domain.
+// A host that is part of several domains, like b.com in "a.com, b.com" and
+// "b.com", gets a single site with the routes of all of them, as Caddy
+// refuses a host defined twice. A site with a single route without a path
+// gets its directives directly;
+// otherwise each route goes in a handle block for its path, or handle_path
+// if the route strips exactly that prefix. Routes that can't be expressed,
+// such as unknown handlers only stored as Caddy JSON, and disabled routes
+// are written as comments.
+func RenderCaddyfile(routes []*storage.Route, global *storage.GlobalConfig) string {
+	sites := make(map[string][]*storage.Route)
+	for _, r := range routes {
+		addr := siteAddress(r.Domain)
+		sites[addr] = append(sites[addr], r)
+	}
+	sites, merged := mergeSharedHosts(sites)
+	addrs := make([]string, 0, len(sites))
+	for addr := range sites {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+
+	w := &caddyfileWriter{}
+	w.comment("Generated by Caddy Admin UI from %d route(s)", len(routes))
+	for _, addr := range addrs {
+		w.blank()
+		if merged[addr] {
+			w.comment("%s is part of several domains; their routes are merged here", addr)
+		}
+		renderSite(w, addr, sites[addr], global)
+	}
+	return w.String()
+}
+
+// mergeSharedHosts moves hosts that are in more than one site address into
+// a site of their own with the routes of every address they were in. It
+// returns the new sites and the addresses of the merged ones.
+func mergeSharedHosts(sites map[string][]*storage.Route) (map[string][]*storage.Route, map[string]bool) {
+	addrs := make([]string, 0, len(sites))
+	count := make(map[string]int)
+	for addr := range sites {
+		addrs = append(addrs, addr)
+		for _, host := range strings.Split(addr, ", ") {
+			count[host]++
+		}
+	}
+	// Sorted, so merged routes with the same path keep a stable order
+	sort.Strings(addrs)
+
+	result := make(map[string][]*storage.Route, len(sites))
+	merged := make(map[string]bool)
+	for _, addr := range addrs {
+		routes := sites[addr]
+		var own []string
+		for _, host := range strings.Split(addr, ", ") {
+			if count[host] == 1 {
+				own = append(own, host)
+				continue
+			}
+			result[host] = append(result[host], routes...)
+			merged[host] = true
+		}
+		if len(own) > 0 {
+			joined := strings.Join(own, ", ")
+			result[joined] = append(result[joined], routes...)
+		}
+	}
+	return result, merged
+}
+
+// siteAddress turns a route domain into site addresses. Routes for every
+// domain become a site for plain HTTP on port 80.
+func siteAddress(domain string) string {
+	var hosts []string
+	for _, h := range strings.Split(domain, ",") {
+		if h = strings.TrimSpace(h); h != "" && h != "*" && !slices.Contains(hosts, h) {
+			hosts = append(hosts, h)
+		}
+	}
+	if len(hosts) == 0 {
+		return ":80"
+	}
+	return strings.Join(hosts, ", ")
+}
+
+func renderSite(w *caddyfileWriter, addr string, routes []*storage.Route, global *storage.GlobalConfig) {
+	// More specific paths first, the catch-all route last, as in the
+	// generated JSON config
+	sort.SliceStable(routes, func(i, j int) bool {
+		return compareRoutes(routes[i], routes[j]) < 0
+	})
+
+	w.open(addr)
+	if global != nil && global.EnableEncode {
+		w.line("encode", "zstd", "gzip")
+	}
+	if len(routes) == 1 && routes[0].Path == "" {
+		renderRoute(w, routes[0], false)
+		w.close()
+		return
+	}
+
+	for _, r := range routes {
+		if !r.Enabled || !exportable(r) {
+			renderRoute(w, r, false)
+			continue
+		}
+		path := normalizePath(r.Path)
+		stripped := r.StripPathPrefix != "" && normalizePath(r.StripPathPrefix) == pathPrefix(path)
+		switch {
+		case r.Path == "":
+			w.open("handle")
+		case stripped:
+			w.open("handle_path", path)
+		default:
+			w.open("handle", path)
+		}
+		renderRoute(w, r, stripped)
+		w.close()
+	}
+	w.close()
+}
+
+// pathPrefix is the prefix a handle_path block for path strips
+func pathPrefix(path string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(path, "*"), "/")
+}
+
+// exportable reports whether a route's handler can be written as Caddyfile
+// directives
+func exportable(r *storage.Route) bool {
+	switch r.HandlerType {
+	case "reverse_proxy", "file_server", "redir":
+		return true
+	}
+	return false
+}
+
+// renderRoute writes a route's directives. stripped is set when a
+// handle_path block already strips the route's prefix.
+func renderRoute(w *caddyfileWriter, r *storage.Route, stripped bool) {
+	where := r.Domain + normalizePath(r.Path)
+	if !r.Enabled {
+		w.comment("Route %s (%s %s) is disabled", r.ID, where, r.HandlerType)
+		return
+	}
+	if !exportable(r) {
+		w.comment("Route %s (%s, handler %s) can't be expressed in a Caddyfile", r.ID, where, r.HandlerType)
+		if len(r.RawCaddyRoute) > 0 {
+			w.comment("Caddy JSON: %s", compactJSON(r.RawCaddyRoute))
+		}
+		return
+	}
+
+	if r.Server != "" && r.Server != storage.DefaultServerName {
+		w.comment("Server: %s", r.Server)
+	}
+	if len(r.Instances) > 0 {
+		w.comment("Instances: %s", strings.Join(r.Instances, ", "))
+	}
+
+	renderHeaders(w, r.Headers)
+	renderBasicAuth(w, r.BasicAuth)
+	if r.StripPathPrefix != "" && !stripped {
+		w.line("uri", "strip_prefix", normalizePath(r.StripPathPrefix))
+	}
+
+	switch r.HandlerType {
+	case "reverse_proxy":
+		var cfg storage.ReverseProxyConfig
+		json.Unmarshal(r.Config, &cfg)
+		renderReverseProxy(w, &cfg)
+	case "file_server":
+		var cfg storage.FileServerConfig
+		json.Unmarshal(r.Config, &cfg)
+		renderFileServer(w, &cfg)
+	case "redir":
+		var cfg storage.RedirectConfig
+		json.Unmarshal(r.Config, &cfg)
+		renderRedirect(w, &cfg)
+	}
+}
+
+func renderHeaders(w *caddyfileWriter, h *storage.HeaderConfig) {
+	if h == nil || len(h.Set)+len(h.Add)+len(h.Delete) == 0 {
+		return
+	}
+	w.open("header")
+	for _, name := range sortedKeys(h.Set) {
+		w.line(name, h.Set[name])
+	}
+	for _, name := range sortedKeys(h.Add) {
+		w.line("+"+name, h.Add[name])
+	}
+	for _, name := range h.Delete {
+		w.line("-" + name)
+	}
+	w.close()
+}
+
+func renderBasicAuth(w *caddyfileWriter, b *storage.BasicAuthConfig) {
+	if b == nil || !b.Enabled || len(b.Users) == 0 {
+		return
+	}
+	if b.Realm != "" {
+		w.open("basicauth", "bcrypt", b.Realm)
+	} else {
+		w.open("basicauth")
+	}
+	for _, u := range b.Users {
+		w.line(u.Username, u.Password)
+	}
+	w.close()
+}
+
+func renderReverseProxy(w *caddyfileWriter, cfg *storage.ReverseProxyConfig) {
+	if len(cfg.Upstreams) == 0 {
+		w.comment("reverse_proxy without upstreams")
+		return
+	}
+	args := append([]string{"reverse_proxy"}, cfg.Upstreams...)
+	if cfg.LoadBalancing == "" && len(cfg.Headers) == 0 {
+		w.line(args...)
+		return
+	}
+	w.open(args...)
+	if cfg.LoadBalancing != "" {
+		w.line("lb_policy", cfg.LoadBalancing)
+	}
+	for _, name := range sortedKeys(cfg.Headers) {
+		w.line("header_up", name, cfg.Headers[name])
+	}
+	w.close()
+}
+
+func renderFileServer(w *caddyfileWriter, cfg *storage.FileServerConfig) {
+	if cfg.Root != "" {
+		w.line("root", "*", cfg.Root)
+	}
+	if len(cfg.Index) == 0 && len(cfg.Hide) == 0 && !cfg.Precompressed {
+		if cfg.Browse {
+			w.line("file_server", "browse")
+		} else {
+			w.line("file_server")
+		}
+		return
+	}
+	w.open("file_server")
+	if cfg.Browse {
+		w.line("browse")
+	}
+	if len(cfg.Index) > 0 {
+		w.line(append([]string{"index"}, cfg.Index...)...)
+	}
+	if len(cfg.Hide) > 0 {
+		w.line(append([]string{"hide"}, cfg.Hide...)...)
+	}
+	if cfg.Precompressed {
+		w.line("precompressed")
+	}
+	w.close()
+}
+
+func renderRedirect(w *caddyfileWriter, cfg *storage.RedirectConfig) {
+	switch cfg.Code {
+	case 0, 302:
+		w.line("redir", cfg.To)
+	case 301:
+		w.line("redir", cfg.To, "permanent")
+	default:
+		w.line("redir", cfg.To, strconv.Itoa(cfg.Code))
+	}
+}
+
+// caddyfileWriter writes indented Caddyfile lines
+type caddyfileWriter struct {
+	b     strings.Builder
+	stack []string
+}
+
+func (w *caddyfileWriter) String() string {
+	return w.b.String()
+}
+
+func (w *caddyfileWriter) indent() {
+	w.b.WriteString(strings.Repeat("\t", len(w.stack)))
+}
+
+// line writes a directive, quoting tokens where needed
+func (w *caddyfileWriter) line(tokens ...string) {
+	w.indent()
+	w.tokens(tokens)
+	w.b.WriteByte('\n')
+}
+
+// tokens writes quoted tokens separated by spaces
+func (w *caddyfileWriter) tokens(tokens []string) {
+	for i, t := range tokens {
+		if i > 0 {
+			w.b.WriteByte(' ')
+		}
+		w.b.WriteString(caddyfileQuote(t))
+	}
+}
+
+// open writes a directive that starts a block. It is the only place a
+// bare brace is written. Site addresses are written as they are, as they
+// may hold several comma-separated addresses.
+func (w *caddyfileWriter) open(tokens ...string) {
+	w.indent()
+	if len(w.stack) == 0 {
+		w.b.WriteString(tokens[0])
+	} else {
+		w.tokens(tokens)
+	}
+	w.b.WriteString(" {\n")
+	w.stack = append(w.stack, tokens[0])
+}
+
+func (w *caddyfileWriter) close() {
+	w.stack = w.stack[:len(w.stack)-1]
+	w.indent()
+	w.b.WriteString("}\n")
+}
+
+func (w *caddyfileWriter) comment(format string, args ...any) {
+	w.indent()
+	w.b.WriteString("# " + fmt.Sprintf(format, args...) + "\n")
+}
+
+func (w *caddyfileWriter) blank() {
+	w.b.WriteByte('\n')
+}
+
+// caddyfileQuote quotes a token if the Caddyfile lexer would otherwise
+// split or drop it, or read it as a brace
+func caddyfileQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\r\n\"`") && !strings.HasPrefix(s, "#") && s != "{" && s != "}" {
+		return s
+	}
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+// compactJSON returns raw on a single line
+func compactJSON(raw json.RawMessage) string {
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return string(raw)
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ArtemStepanov/caddy-admin-ui/internal/storage"
+)
+
+func exportRoute(id, domain, path, handlerType string, cfg any) *storage.Route {
+	data, _ := json.Marshal(cfg)
+	return &storage.Route{ID: id, Domain: domain, Path: path, HandlerType: handlerType, Config: data, Enabled: true}
+}
+
+func TestRenderCaddyfile_RoundTrip(t *testing.T) {
+	api := exportRoute("api", "example.com", "/api/*", "reverse_proxy", storage.ReverseProxyConfig{
+		Upstreams:     []string{"api:8080", "api:8081"},
+		LoadBalancing: "least_conn",
+		Headers:       map[string]string{"X-Real-IP": "{remote_host}", "X-Brace": "{"},
+	})
+	api.StripPathPrefix = "/api"
+	docs := exportRoute("docs", "example.com", "/docs/*", "file_server", storage.FileServerConfig{
+		Root: "/srv/docs", Browse: true, Index: []string{"index.html"},
+	})
+	docs.StripPathPrefix = "/documentation"
+	docs.Headers = &storage.HeaderConfig{
+		Set:    map[string]string{"Cache-Control": "public, max-age=3600"},
+		Delete: []string{"Server"},
+	}
+	web := exportRoute("web", "example.com", "", "reverse_proxy", storage.ReverseProxyConfig{Upstreams: []string{"web:3000"}})
+	web.BasicAuth = &storage.BasicAuthConfig{
+		Enabled: true,
+		Realm:   "Staff only",
+		Users:   []storage.BasicAuthUser{{Username: "alice", Password: testBcryptHash}},
+	}
+	old := exportRoute("old", "old.example.com, www.old.example.com", "", "redir", storage.RedirectConfig{To: "https://example.com{uri}", Code: 301})
+
+	out := RenderCaddyfile([]*storage.Route{web, old, docs, api}, &storage.GlobalConfig{EnableEncode: true})
+	if !strings.Contains(out, "\thandle_path /api/* {\n") || !strings.Contains(out, "\thandle /docs/* {\n") {
+		t.Errorf("Expected handle blocks for the paths, got:\n%s", out)
+	}
+	if strings.Index(out, "handle_path /api/*") > strings.Index(out, "\thandle {") {
+		t.Errorf("Expected the catch-all route last, got:\n%s", out)
+	}
+
+	result, err := ParseCaddyfile([]byte(out))
+	if err != nil {
+		t.Fatalf("Unexpected error parsing the export: %v\n%s", err, out)
+	}
+	if len(result.Unsupported) != 0 || !result.EnableEncode || len(result.Routes) != 4 {
+		t.Fatalf("Expected 4 routes without issues, got %d / %+v:\n%s", len(result.Routes), result.Unsupported, out)
+	}
+
+	gotAPI := routeByPath(t, result, "example.com", "/api/*")
+	var rp storage.ReverseProxyConfig
+	json.Unmarshal(gotAPI.Config, &rp)
+	if gotAPI.StripPathPrefix != "/api" || len(rp.Upstreams) != 2 || rp.LoadBalancing != "least_conn" || rp.Headers["X-Real-IP"] != "{remote_host}" || rp.Headers["X-Brace"] != "{" {
+		t.Errorf("Expected the api route back, got %+v %s", gotAPI, gotAPI.Config)
+	}
+	gotDocs := routeByPath(t, result, "example.com", "/docs/*")
+	var fs storage.FileServerConfig
+	json.Unmarshal(gotDocs.Config, &fs)
+	if gotDocs.StripPathPrefix != "/documentation" || fs.Root != "/srv/docs" || !fs.Browse || len(fs.Index) != 1 {
+		t.Errorf("Expected the docs route back, got %+v %s", gotDocs, gotDocs.Config)
+	}
+	if gotDocs.Headers == nil || gotDocs.Headers.Set["Cache-Control"] != "public, max-age=3600" || len(gotDocs.Headers.Delete) != 1 {
+		t.Errorf("Expected the docs headers back, got %+v", gotDocs.Headers)
+	}
+	gotWeb := routeByPath(t, result, "example.com", "")
+	if gotWeb.BasicAuth == nil || gotWeb.BasicAuth.Realm != "Staff only" || gotWeb.BasicAuth.Users[0].Password != testBcryptHash {
+		t.Errorf("Expected basic auth back, got %+v", gotWeb.BasicAuth)
+	}
+	gotOld := routeByPath(t, result, "old.example.com, www.old.example.com", "")
+	var redir storage.RedirectConfig
+	json.Unmarshal(gotOld.Config, &redir)
+	if redir.To != "https://example.com{uri}" || redir.Code != 301 {
+		t.Errorf("Expected the redirect back, got %s", gotOld.Config)
+	}
+}
+
+func TestRenderCaddyfile_Comments(t *testing.T) {
+	unknown := &storage.Route{
+		ID: "raw", Domain: "example.com", Path: "/ping", HandlerType: "unknown", Enabled: true,
+		RawCaddyRoute: json.RawMessage(`{
+			"handle": [{"handler": "static_response", "body": "pong"}]
+		}`),
+	}
+	disabled := exportRoute("off", "example.com", "/old/*", "redir", storage.RedirectConfig{To: "/new"})
+	disabled.Enabled = false
+	catchAll := exportRoute("all", "*", "", "file_server", storage.FileServerConfig{Root: "/srv/www"})
+
+	out := RenderCaddyfile([]*storage.Route{unknown, disabled, catchAll}, nil)
+	for _, want := range []string{
+		"\t# Route raw (example.com/ping, handler unknown) can't be expressed",
+		`# Caddy JSON: {"handle":[{"body":"pong","handler":"static_response"}]}`,
+		"\t# Route off (example.com/old/* redir) is disabled",
+		":80 {\n\troot * /srv/www\n\tfile_server\n}",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in:\n%s", want, out)
+		}
+	}
+
+	result, err := ParseCaddyfile([]byte(out))
+	if err != nil {
+		t.Fatalf("Unexpected error parsing the export: %v", err)
+	}
+	if len(result.Routes) != 1 || result.Routes[0].Domain != "*" {
+		t.Errorf("Expected only the catch-all route to be parsed, got %+v", result.Routes)
+	}
+}
+
+func TestRenderCaddyfile_SharedHosts(t *testing.T) {
+	both := exportRoute("both", "a.example.com, b.example.com", "", "reverse_proxy", storage.ReverseProxyConfig{Upstreams: []string{"both:80"}})
+	api := exportRoute("api", "b.example.com", "/api/*", "reverse_proxy", storage.ReverseProxyConfig{Upstreams: []string{"api:80"}})
+
+	out := RenderCaddyfile([]*storage.Route{both, api}, nil)
+	if strings.Count(out, "b.example.com {") != 1 || !strings.Contains(out, "\na.example.com {") {
+		t.Fatalf("Expected one site per host, got:\n%s", out)
+	}
+	if !strings.Contains(out, "# b.example.com is part of several domains") {
+		t.Errorf("Expected the merged site to be explained, got:\n%s", out)
+	}
+
+	result, err := ParseCaddyfile([]byte(out))
+	if err != nil {
+		t.Fatalf("Unexpected error parsing the export: %v", err)
+	}
+	if len(result.Routes) != 3 {
+		t.Fatalf("Expected a.example.com and both routes of b.example.com, got %+v", result.Routes)
+	}
+	routeByPath(t, result, "a.example.com", "")
+	routeByPath(t, result, "b.example.com", "")
+	routeByPath(t, result, "b.example.com", "/api/*")
+}
@@ -0,0 +1,260 @@
+package config
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ArtemStepanov/caddy-admin-ui/internal/storage"
+)
+
+// testBcryptHash is the example bcrypt hash from the basicauth docs
+const testBcryptHash = "$2a$14$Zkx19XLiW6VYouLHR5NmfOFU0z2GTNmpkT/5qqR7hx4IjWJPDhjvG"
+
+// routeByPath returns the route of a parse result for domain and path
+func routeByPath(t *testing.T, result *CaddyfileImport, domain, path string) *storage.Route {
+	t.Helper()
+	for _, r := range result.Routes {
+		if r.Domain == domain && r.Path == path {
+			return r
+		}
+	}
+	t.Fatalf("Expected a route for %s%s, got %d routes", domain, path, len(result.Routes))
+	return nil
+}
+
+func TestParseCaddyfile_Sites(t *testing.T) {
+	src := `
+{
+	email admin@example.com
+}
+
+(security) {
+	header {
+		X-Frame-Options DENY
+		-Server
+	}
+}
+
+example.com, www.example.com {
+	import security
+	encode gzip zstd
+	reverse_proxy localhost:8080 app:9000 {
+		lb_policy least_conn
+		header_up X-Real-IP {remote_host}
+	}
+}
+
+static.example.com {
+	root * /srv/www
+	file_server browse
+}
+
+old.example.com {
+	redir https://example.com{uri} permanent
+}
+`
+	result, err := ParseCaddyfile([]byte(src))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(result.Routes) != 3 {
+		t.Fatalf("Expected 3 routes, got %d", len(result.Routes))
+	}
+	if !result.EnableEncode {
+		t.Error("Expected encode to enable compression")
+	}
+
+	proxy := routeByPath(t, result, "example.com, www.example.com", "")
+	var rp storage.ReverseProxyConfig
+	json.Unmarshal(proxy.Config, &rp)
+	if proxy.HandlerType != "reverse_proxy" || len(rp.Upstreams) != 2 || rp.Upstreams[1] != "app:9000" {
+		t.Errorf("Expected reverse_proxy with 2 upstreams, got %s %s", proxy.HandlerType, proxy.Config)
+	}
+	if rp.LoadBalancing != "least_conn" || rp.Headers["X-Real-IP"] != "{remote_host}" {
+		t.Errorf("Expected load balancing and upstream headers, got %+v", rp)
+	}
+	if proxy.Headers == nil || proxy.Headers.Set["X-Frame-Options"] != "DENY" || proxy.Headers.Delete[0] != "Server" {
+		t.Errorf("Expected headers from the snippet, got %+v", proxy.Headers)
+	}
+	if !proxy.Enabled || proxy.ID == "" {
+		t.Errorf("Expected an enabled route with an ID, got %+v", proxy)
+	}
+
+	static := routeByPath(t, result, "static.example.com", "")
+	var fs storage.FileServerConfig
+	json.Unmarshal(static.Config, &fs)
+	if fs.Root != "/srv/www" || !fs.Browse {
+		t.Errorf("Expected file server with the site root, got %s", static.Config)
+	}
+
+	redirect := routeByPath(t, result, "old.example.com", "")
+	var redir storage.RedirectConfig
+	json.Unmarshal(redirect.Config, &redir)
+	if redir.To != "https://example.com{uri}" || redir.Code != 301 {
+		t.Errorf("Expected permanent redirect, got %s", redirect.Config)
+	}
+
+	if len(result.Unsupported) != 1 || result.Unsupported[0].Line != 3 || !strings.Contains(result.Unsupported[0].Message, "email") {
+		t.Errorf("Expected the global option to be reported, got %+v", result.Unsupported)
+	}
+}
+
+func TestParseCaddyfile_HandleBlocks(t *testing.T) {
+	src := `example.com {
+	basicauth {
+		alice ` + testBcryptHash + `
+	}
+	handle_path /api/* {
+		reverse_proxy api:8080
+	}
+	handle /docs/* {
+		header Cache-Control "public, max-age=3600"
+		file_server {
+			root /srv/docs
+		}
+	}
+	handle {
+		reverse_proxy web:3000
+	}
+}`
+	result, err := ParseCaddyfile([]byte(src))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(result.Routes) != 3 || len(result.Unsupported) != 0 {
+		t.Fatalf("Expected 3 routes without issues, got %d / %+v", len(result.Routes), result.Unsupported)
+	}
+
+	api := routeByPath(t, result, "example.com", "/api/*")
+	if api.StripPathPrefix != "/api" {
+		t.Errorf("Expected handle_path to strip /api, got %q", api.StripPathPrefix)
+	}
+	docs := routeByPath(t, result, "example.com", "/docs/*")
+	if docs.StripPathPrefix != "" || docs.Headers == nil || docs.Headers.Set["Cache-Control"] != "public, max-age=3600" {
+		t.Errorf("Expected docs route with its own headers, got %+v", docs)
+	}
+	fallback := routeByPath(t, result, "example.com", "")
+	if fallback.Headers != nil {
+		t.Errorf("Expected the handle block's headers to stay in it, got %+v", fallback.Headers)
+	}
+	for _, r := range result.Routes {
+		if r.BasicAuth == nil || len(r.BasicAuth.Users) != 1 || r.BasicAuth.Users[0].Password != testBcryptHash {
+			t.Errorf("Expected site basicauth on %s, got %+v", r.Path, r.BasicAuth)
+		}
+	}
+}
+
+func TestParseCaddyfile_BuildsCatchAllLast(t *testing.T) {
+	src := `example.com {
+	handle {
+		reverse_proxy web:3000
+	}
+	handle /docs/* {
+		file_server {
+			root /srv/docs
+		}
+	}
+	handle_path /api/v1/* {
+		reverse_proxy api:8080
+	}
+}
+
+a.example.com, example.com {
+	reverse_proxy other:3000
+}`
+	result, err := ParseCaddyfile([]byte(src))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	cfg := BuildCaddyConfig(result.Routes, nil)
+	var paths []string
+	for _, r := range cfg.Apps.HTTP.Servers["srv0"].Routes {
+		path := ""
+		if len(r.Match) > 0 && len(r.Match[0].Path) > 0 {
+			path = r.Match[0].Path[0]
+		}
+		paths = append(paths, path)
+	}
+
+	// Every route is terminal, so a catch-all route before /docs/* or
+	// /api/v1/* would answer their requests
+	expected := []string{"/api/v1/*", "/docs/*", "", ""}
+	if strings.Join(paths, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected route paths %q, got %q", expected, paths)
+	}
+}
+
+func TestParseCaddyfile_Unsupported(t *testing.T) {
+	src := `:8080 {
+	tls internal
+	@api path /api/*
+	reverse_proxy @api localhost:9000
+	reverse_proxy localhost:8080 {
+		health_uri /healthz
+	}
+	respond /ping "pong"
+	redir /old /new 418
+}
+
+nothing.example.com {
+	log
+}`
+	result, err := ParseCaddyfile([]byte(src))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(result.Routes) != 1 || result.Routes[0].Domain != "*" {
+		t.Fatalf("Expected a single catch-all route, got %+v", result.Routes)
+	}
+
+	var lines []int
+	for _, issue := range result.Unsupported {
+		lines = append(lines, issue.Line)
+	}
+	want := []int{1, 2, 3, 4, 6, 8, 9, 12, 13}
+	if len(lines) != len(want) {
+		t.Fatalf("Expected issues on lines %v, got %+v", want, result.Unsupported)
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("Expected issues on lines %v, got %v", want, lines)
+			break
+		}
+	}
+	if msg := result.Unsupported[1].Message; !strings.Contains(msg, `"tls"`) {
+		t.Errorf("Expected the directive to be named, got %q", msg)
+	}
+}
+
+func TestParseCaddyfile_SingleSiteWithoutBraces(t *testing.T) {
+	src := "# Minimal Caddyfile\nlocalhost\n\nreverse_proxy 127.0.0.1:3000\n"
+	result, err := ParseCaddyfile([]byte(src))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(result.Routes) != 1 || result.Routes[0].Domain != "localhost" {
+		t.Fatalf("Expected a route for localhost, got %+v", result.Routes)
+	}
+}
+
+func TestParseCaddyfile_SyntaxErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		line string
+	}{
+		{"unclosed block", "example.com {\n\treverse_proxy localhost:8080\n", "line 1"},
+		{"stray brace", "example.com {\n}\n}\n", "line 3"},
+		{"unterminated quote", "example.com {\n\theader X \"oops\n}\n", "line 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseCaddyfile([]byte(tt.src))
+			if err == nil || !strings.Contains(err.Error(), tt.line) {
+				t.Errorf("Expected an error on %s, got %v", tt.line, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// Change operations reported by Diff
+const (
+	ChangeAdd    = "add"
+	ChangeRemove = "remove"
+	ChangeUpdate = "update"
+)
+
+// Change is a single difference between two JSON documents.
+// Path is a JSON pointer (RFC 6901) into the documents, "" for the whole
+// document.
+type Change struct {
+	Path string `json:"path"`
+	Op   string `json:"op"`
+	Old  any    `json:"old,omitempty"`
+	New  any    `json:"new,omitempty"`
+}
+
+// Diff compares two configurations and returns the changes needed to turn
+// current into desired. Both values are normalized through JSON first, so
+// typed structs can be compared with raw JSON fetched from Caddy.
+func Diff(current, desired any) ([]Change, error) {
+	a, err := normalizeJSON(current)
+	if err != nil {
+		return nil, fmt.Errorf("failed to normalize current config: %w", err)
+	}
+	b, err := normalizeJSON(desired)
+	if err != nil {
+		return nil, fmt.Errorf("failed to normalize desired config: %w", err)
+	}
+
+	var changes []Change
+	diffValues("", a, b, &changes)
+	slices.SortStableFunc(changes, func(x, y Change) int {
+		return comparePointers(x.Path, y.Path)
+	})
+	return changes, nil
+}
+
+// comparePointers orders JSON pointers token by token, comparing array
+// indices as numbers so /10 comes after /9
+func comparePointers(a, b string) int {
+	at, bt := strings.Split(a, "/"), strings.Split(b, "/")
+	for i := 0; i < len(at) && i < len(bt); i++ {
+		x, y := at[i], bt[i]
+		if isIndex(x) && isIndex(y) {
+			if c := cmp.Compare(len(x), len(y)); c != 0 {
+				return c
+			}
+		}
+		if c := strings.Compare(x, y); c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(len(at), len(bt))
+}
+
+// isIndex reports whether a pointer token is an array index
+func isIndex(token string) bool {
+	return token != "" && strings.Trim(token, "0123456789") == ""
+}
+
+func normalizeJSON(v any) (any, error) {
+	var data []byte
+	switch t := v.(type) {
+	case json.RawMessage:
+		data = t
+	case []byte:
+		data = t
+	default:
+		var err error
+		data, err = json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	var out any
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func diffValues(path string, a, b any, changes *[]Change) {
+	if a == nil && b == nil {
+		return
+	}
+	if a == nil {
+		*changes = append(*changes, Change{Path: path, Op: ChangeAdd, New: b})
+		return
+	}
+	if b == nil {
+		*changes = append(*changes, Change{Path: path, Op: ChangeRemove, Old: a})
+		return
+	}
+
+	switch av := a.(type) {
+	case map[string]any:
+		bv, ok := b.(map[string]any)
+		if !ok {
+			break
+		}
+		for k, va := range av {
+			diffValues(path+"/"+escapePointer(k), va, bv[k], changes)
+		}
+		for k, vb := range bv {
+			if _, exists := av[k]; !exists {
+				diffValues(path+"/"+escapePointer(k), nil, vb, changes)
+			}
+		}
+		return
+	case []any:
+		bv, ok := b.([]any)
+		if !ok {
+			break
+		}
+		n := max(len(av), len(bv))
+		for i := 0; i < n; i++ {
+			var va, vb any
+			if i < len(av) {
+				va = av[i]
+			}
+			if i < len(bv) {
+				vb = bv[i]
+			}
+			diffValues(fmt.Sprintf("%s/%d", path, i), va, vb, changes)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(a, b) {
+		*changes = append(*changes, Change{Path: path, Op: ChangeUpdate, Old: a, New: b})
+	}
+}
+
+func escapePointer(s string) string {
+	s = strings.ReplaceAll(s, "~", "~0")
+	return strings.ReplaceAll(s, "/", "~1")
+}
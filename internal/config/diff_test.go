@@ -0,0 +1,104 @@
+package config
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ArtemStepanov/caddy-admin-ui/internal/storage"
+)
+
+func TestDiff_Identical(t *testing.T) {
+	routes := []*storage.Route{
+		{
+			Domain:      "example.com",
+			HandlerType: "reverse_proxy",
+			Config:      json.RawMessage(`{"upstreams":["localhost:8080"]}`),
+			Enabled:     true,
+		},
+	}
+	cfg := BuildCaddyConfig(routes, nil)
+	live, _ := json.Marshal(cfg)
+
+	changes, err := Diff(json.RawMessage(live), cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("Expected no changes, got %+v", changes)
+	}
+}
+
+func TestDiff_Changes(t *testing.T) {
+	current := json.RawMessage(`{
+		"admin": {"listen": "0.0.0.0:2019"},
+		"apps": {"http": {"servers": {"srv0": {
+			"listen": [":443", ":80"],
+			"routes": [{"handle": [{"handler": "reverse_proxy", "upstreams": [{"dial": "a:1"}]}]}]
+		}}}},
+		"logging": {"logs": {}}
+	}`)
+	desired := json.RawMessage(`{
+		"admin": {"listen": "0.0.0.0:2019"},
+		"apps": {"http": {"servers": {"srv0": {
+			"listen": [":443"],
+			"routes": [{"handle": [{"handler": "reverse_proxy", "upstreams": [{"dial": "b:1"}]}]}]
+		}}}},
+		"storage": {"module": "file_system"}
+	}`)
+
+	changes, err := Diff(current, desired)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := map[string]string{
+		"/apps/http/servers/srv0/listen/1":                           ChangeRemove,
+		"/apps/http/servers/srv0/routes/0/handle/0/upstreams/0/dial": ChangeUpdate,
+		"/logging": ChangeRemove,
+		"/storage": ChangeAdd,
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected %d changes, got %d: %+v", len(expected), len(changes), changes)
+	}
+	for _, c := range changes {
+		if op, ok := expected[c.Path]; !ok || op != c.Op {
+			t.Errorf("Unexpected change %+v", c)
+		}
+	}
+
+	// Changes are sorted by path
+	for i := 1; i < len(changes); i++ {
+		if comparePointers(changes[i-1].Path, changes[i].Path) > 0 {
+			t.Errorf("Expected changes sorted by path, got %s before %s", changes[i-1].Path, changes[i].Path)
+		}
+	}
+}
+
+func TestDiff_NullCurrent(t *testing.T) {
+	changes, err := Diff(json.RawMessage("null"), &CaddyConfig{Admin: &AdminConfig{Listen: ":2019"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(changes) != 1 || changes[0].Path != "" || changes[0].Op != ChangeAdd {
+		t.Errorf("Expected a single root add, got %+v", changes)
+	}
+}
+
+func TestDiff_SortsIndicesNumerically(t *testing.T) {
+	changes, _ := Diff(json.RawMessage(`{"a": [0,0,0,0,0,0,0,0,0,0,0], "b": 1}`), json.RawMessage(`{"a": [0,0,1,0,0,0,0,0,0,1,1], "b": 2}`))
+	var paths []string
+	for _, c := range changes {
+		paths = append(paths, c.Path)
+	}
+	if strings.Join(paths, " ") != "/a/2 /a/9 /a/10 /b" {
+		t.Errorf("Expected array indices in numeric order, got %v", paths)
+	}
+}
+
+func TestDiff_EscapesPointer(t *testing.T) {
+	changes, _ := Diff(json.RawMessage(`{"a/b": 1}`), json.RawMessage(`{"a/b": 2}`))
+	if len(changes) != 1 || changes[0].Path != "/a~1b" {
+		t.Errorf("Expected escaped pointer /a~1b, got %+v", changes)
+	}
+}
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RouteDrift groups the changes that affect a single HTTP route
+type RouteDrift struct {
+	Server   string   `json:"server"`
+	Index    int      `json:"index"`
+	Hosts    []string `json:"hosts,omitempty"`
+	Paths    []string `json:"paths,omitempty"`
+	Handlers []string `json:"handlers,omitempty"`
+	Changes  []Change `json:"changes"`
+}
+
+// GroupRouteChanges splits a diff into per-route drift and the remaining
+// changes outside of HTTP routes. Route details (matchers, handler names)
+// are taken from the desired config, falling back to the live one for
+// routes that only exist in Caddy.
+func GroupRouteChanges(changes []Change, live, desired *CaddyConfig) ([]RouteDrift, []Change) {
+	type key struct {
+		server string
+		index  int
+	}
+
+	byRoute := make(map[key]*RouteDrift)
+	handlerSeen := make(map[key]map[string]bool)
+	var order []key
+	var other []Change
+
+	for _, c := range changes {
+		server, index, handleIdx, ok := splitRoutePath(c.Path)
+		if !ok {
+			other = append(other, c)
+			continue
+		}
+
+		k := key{server, index}
+		rd, exists := byRoute[k]
+		if !exists {
+			rd = &RouteDrift{Server: server, Index: index}
+			if r := routeAt(desired, server, index); r != nil {
+				fillRouteDrift(rd, r)
+			} else if r := routeAt(live, server, index); r != nil {
+				fillRouteDrift(rd, r)
+			}
+			byRoute[k] = rd
+			handlerSeen[k] = make(map[string]bool)
+			order = append(order, k)
+		}
+		rd.Changes = append(rd.Changes, c)
+
+		if handleIdx >= 0 {
+			name := handlerName(desired, server, index, handleIdx)
+			if name == "" {
+				name = handlerName(live, server, index, handleIdx)
+			}
+			if name != "" && !handlerSeen[k][name] {
+				handlerSeen[k][name] = true
+				rd.Handlers = append(rd.Handlers, name)
+			}
+		}
+	}
+
+	sort.Slice(order, func(i, j int) bool {
+		if order[i].server != order[j].server {
+			return order[i].server < order[j].server
+		}
+		return order[i].index < order[j].index
+	})
+
+	routes := make([]RouteDrift, 0, len(order))
+	for _, k := range order {
+		routes = append(routes, *byRoute[k])
+	}
+	return routes, other
+}
+
+// splitRoutePath parses /apps/http/servers/<name>/routes/<i>[/handle/<j>/...].
+// handleIdx is -1 when the change is not inside a handler.
+func splitRoutePath(path string) (server string, index, handleIdx int, ok bool) {
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(parts) < 6 || parts[0] != "apps" || parts[1] != "http" || parts[2] != "servers" || parts[4] != "routes" {
+		return "", 0, 0, false
+	}
+
+	index, err := strconv.Atoi(parts[5])
+	if err != nil {
+		return "", 0, 0, false
+	}
+
+	handleIdx = -1
+	if len(parts) >= 8 && parts[6] == "handle" {
+		if j, err := strconv.Atoi(parts[7]); err == nil {
+			handleIdx = j
+		}
+	}
+
+	server = strings.ReplaceAll(strings.ReplaceAll(parts[3], "~1", "/"), "~0", "~")
+	return server, index, handleIdx, true
+}
+
+func routeAt(cfg *CaddyConfig, server string, index int) *Route {
+	if cfg == nil || cfg.Apps == nil || cfg.Apps.HTTP == nil {
+		return nil
+	}
+	srv, ok := cfg.Apps.HTTP.Servers[server]
+	if !ok || srv == nil || index < 0 || index >= len(srv.Routes) {
+		return nil
+	}
+	return &srv.Routes[index]
+}
+
+func handlerName(cfg *CaddyConfig, server string, index, handleIdx int) string {
+	r := routeAt(cfg, server, index)
+	if r == nil || handleIdx < 0 || handleIdx >= len(r.Handle) {
+		return ""
+	}
+	name, _ := r.Handle[handleIdx]["handler"].(string)
+	return name
+}
+
+func fillRouteDrift(rd *RouteDrift, r *Route) {
+	for _, m := range r.Match {
+		rd.Hosts = append(rd.Hosts, m.Host...)
+		rd.Paths = append(rd.Paths, m.Path...)
+	}
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ArtemStepanov/caddy-admin-ui/internal/storage"
+)
+
+func TestGroupRouteChanges(t *testing.T) {
+	desired := BuildCaddyConfig([]*storage.Route{
+		{
+			Domain:      "a.example.com",
+			HandlerType: "reverse_proxy",
+			Config:      json.RawMessage(`{"upstreams":["localhost:8080"]}`),
+			Enabled:     true,
+		},
+		{
+			Domain:      "b.example.com",
+			Path:        "/static",
+			HandlerType: "file_server",
+			Config:      json.RawMessage(`{"root":"/srv"}`),
+			Enabled:     true,
+		},
+	}, nil)
+
+	changes := []Change{
+		{Path: "/apps/http/servers/srv0/routes/0/handle/0/root", Op: ChangeUpdate, Old: "/var/www", New: "/srv"},
+		{Path: "/apps/http/servers/srv0/routes/1/match/0/host/0", Op: ChangeUpdate, Old: "x", New: "a.example.com"},
+		{Path: "/logging", Op: ChangeRemove, Old: map[string]any{}},
+	}
+
+	routes, other := GroupRouteChanges(changes, nil, desired)
+
+	if len(other) != 1 || other[0].Path != "/logging" {
+		t.Errorf("Expected /logging as a non-route change, got %+v", other)
+	}
+	if len(routes) != 2 {
+		t.Fatalf("Expected 2 drifted routes, got %d", len(routes))
+	}
+
+	if routes[0].Index != 0 || routes[0].Paths[0] != "/static" {
+		t.Errorf("Unexpected first route drift: %+v", routes[0])
+	}
+	if len(routes[0].Handlers) != 1 || routes[0].Handlers[0] != "file_server" {
+		t.Errorf("Expected file_server handler to differ, got %v", routes[0].Handlers)
+	}
+	if routes[1].Index != 1 || routes[1].Hosts[0] != "a.example.com" || len(routes[1].Handlers) != 0 {
+		t.Errorf("Unexpected second route drift: %+v", routes[1])
+	}
+}
+
+func TestGroupRouteChanges_LiveOnlyRoute(t *testing.T) {
+	live := &CaddyConfig{
+		Apps: &Apps{HTTP: &HTTPApp{Servers: map[string]*Server{
+			"srv0": {Routes: []Route{
+				{Match: []Match{{Host: []string{"added.example.com"}}}, Handle: []Handler{{"handler": "static_response"}}},
+			}},
+		}}},
+	}
+
+	changes := []Change{{Path: "/apps/http/servers/srv0/routes/0", Op: ChangeRemove}}
+	routes, _ := GroupRouteChanges(changes, live, &CaddyConfig{})
+
+	if len(routes) != 1 || len(routes[0].Hosts) != 1 || routes[0].Hosts[0] != "added.example.com" {
+		t.Errorf("Expected details from live config, got %+v", routes)
+	}
+}
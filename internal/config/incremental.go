@@ -0,0 +1,172 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Route operations produced by PlanRouteOps
+const (
+	RouteOpAdd    = "add"
+	RouteOpUpdate = "update"
+	RouteOpDelete = "delete"
+)
+
+// RouteOp is a single change to one HTTP route. Updates and deletes address
+// the route by its @id; adds insert it at Index in the server's route list,
+// or append it when Append is set (Index is then the end of the list).
+type RouteOp struct {
+	Op     string `json:"op"`
+	ID     string `json:"id"`
+	Server string `json:"server"`
+	Index  int    `json:"index"`
+	Append bool   `json:"append,omitempty"`
+	Route  *Route `json:"route,omitempty"`
+}
+
+// PlanRouteOps computes the per-route operations that turn the live config
+// into desired. Operations are ordered so they can be applied one after the
+// other: deletes, then updates, then adds in ascending index order.
+//
+// ok is false when the change can't be expressed as per-route operations and
+// the whole config has to be loaded instead: anything outside the route
+// lists differs, a route has no @id, or the surviving routes would change
+// order.
+func PlanRouteOps(live json.RawMessage, desired *CaddyConfig) (ops []RouteOp, ok bool, err error) {
+	liveDoc, err := normalizeJSON(live)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to normalize live config: %w", err)
+	}
+	desiredDoc, err := normalizeJSON(desired)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to normalize desired config: %w", err)
+	}
+
+	liveRoutes := detachRoutes(liveDoc)
+	desiredRoutes := detachRoutes(desiredDoc)
+
+	// Structure outside of routes must already match
+	var structural []Change
+	diffValues("", liveDoc, desiredDoc, &structural)
+	if len(structural) > 0 {
+		return nil, false, nil
+	}
+
+	servers := make([]string, 0, len(desiredRoutes))
+	for name := range desiredRoutes {
+		servers = append(servers, name)
+	}
+	sort.Strings(servers)
+
+	var deletes, updates, adds []RouteOp
+	for _, server := range servers {
+		d, u, a, ok := planServerRoutes(server, liveRoutes[server], desiredRoutes[server], desired)
+		if !ok {
+			return nil, false, nil
+		}
+		deletes = append(deletes, d...)
+		updates = append(updates, u...)
+		adds = append(adds, a...)
+	}
+
+	ops = append(ops, deletes...)
+	ops = append(ops, updates...)
+	ops = append(ops, adds...)
+	return ops, true, nil
+}
+
+func planServerRoutes(server string, live, desired []any, desiredCfg *CaddyConfig) (deletes, updates, adds []RouteOp, ok bool) {
+	// Appending to a server without a route list would create an object
+	// instead of an array
+	if len(live) == 0 && len(desired) > 0 {
+		return nil, nil, nil, false
+	}
+
+	liveByID := make(map[string]any, len(live))
+	var liveOrder []string
+	for _, r := range live {
+		id := routeID(r)
+		if id == "" {
+			return nil, nil, nil, false
+		}
+		liveByID[id] = r
+		liveOrder = append(liveOrder, id)
+	}
+
+	desiredIDs := make(map[string]bool, len(desired))
+	var keptOrder []string
+	for i, r := range desired {
+		id := routeID(r)
+		if id == "" || desiredIDs[id] {
+			return nil, nil, nil, false
+		}
+		desiredIDs[id] = true
+
+		current, exists := liveByID[id]
+		if !exists {
+			adds = append(adds, RouteOp{Op: RouteOpAdd, ID: id, Server: server, Index: i, Route: routeAt(desiredCfg, server, i)})
+			continue
+		}
+		keptOrder = append(keptOrder, id)
+		if !reflect.DeepEqual(current, r) {
+			updates = append(updates, RouteOp{Op: RouteOpUpdate, ID: id, Server: server, Index: i, Route: routeAt(desiredCfg, server, i)})
+		}
+	}
+
+	var survivingOrder []string
+	for _, id := range liveOrder {
+		if desiredIDs[id] {
+			survivingOrder = append(survivingOrder, id)
+		} else {
+			deletes = append(deletes, RouteOp{Op: RouteOpDelete, ID: id, Server: server})
+		}
+	}
+
+	// Inserting at the desired index only works if the routes that stay
+	// keep their relative order
+	if !reflect.DeepEqual(survivingOrder, keptOrder) {
+		return nil, nil, nil, false
+	}
+
+	// When an add is applied, the list holds the desired routes before it
+	// plus the kept routes after it; with none of the latter it's an append
+	for i := range adds {
+		after := 0
+		for j, r := range desired {
+			if j > adds[i].Index && liveByID[routeID(r)] != nil {
+				after++
+			}
+		}
+		adds[i].Append = after == 0
+	}
+	return deletes, updates, adds, true
+}
+
+// detachRoutes removes the route list from every HTTP server in doc and
+// returns them by server name
+func detachRoutes(doc any) map[string][]any {
+	routes := make(map[string][]any)
+
+	root, _ := doc.(map[string]any)
+	apps, _ := root["apps"].(map[string]any)
+	httpApp, _ := apps["http"].(map[string]any)
+	servers, _ := httpApp["servers"].(map[string]any)
+	for name, s := range servers {
+		srv, ok := s.(map[string]any)
+		if !ok {
+			continue
+		}
+		list, _ := srv["routes"].([]any)
+		routes[name] = list
+		delete(srv, "routes")
+	}
+	return routes
+}
+
+func routeID(r any) string {
+	m, _ := r.(map[string]any)
+	id, _ := m["@id"].(string)
+	return id
+}
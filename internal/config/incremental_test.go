@@ -0,0 +1,110 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ArtemStepanov/caddy-admin-ui/internal/storage"
+)
+
+func incrementalRoute(id, domain, upstream string) *storage.Route {
+	return &storage.Route{
+		ID:          id,
+		Domain:      domain,
+		HandlerType: "reverse_proxy",
+		Config:      json.RawMessage(`{"upstreams":["` + upstream + `"]}`),
+		Enabled:     true,
+	}
+}
+
+func liveJSON(t *testing.T, routes ...*storage.Route) json.RawMessage {
+	t.Helper()
+	data, err := json.Marshal(BuildCaddyConfig(routes, nil))
+	if err != nil {
+		t.Fatalf("Failed to marshal config: %v", err)
+	}
+	return data
+}
+
+func TestBuildCaddyConfig_StampsRouteID(t *testing.T) {
+	cfg := BuildCaddyConfig([]*storage.Route{incrementalRoute("route-1", "example.com", "a:1")}, nil)
+
+	route := cfg.Apps.HTTP.Servers["srv0"].Routes[0]
+	if route.ID != "route-1" {
+		t.Errorf("Expected @id route-1, got %q", route.ID)
+	}
+}
+
+func TestPlanRouteOps(t *testing.T) {
+	a := incrementalRoute("a", "a.example.com", "a:1")
+	b := incrementalRoute("b", "b.example.com", "b:1")
+	c := incrementalRoute("c", "c.example.com", "c:1")
+	live := liveJSON(t, a, b, c)
+
+	bChanged := incrementalRoute("b", "b.example.com", "b:2")
+	aa := incrementalRoute("aa", "aa.example.com", "aa:1")
+	d := incrementalRoute("d", "d.example.com", "d:1")
+	desired := BuildCaddyConfig([]*storage.Route{a, aa, bChanged, d}, nil)
+
+	ops, ok, err := PlanRouteOps(live, desired)
+	if err != nil || !ok {
+		t.Fatalf("Expected incremental plan, got ok=%v err=%v", ok, err)
+	}
+
+	expected := []RouteOp{
+		{Op: RouteOpDelete, ID: "c"},
+		{Op: RouteOpUpdate, ID: "b", Index: 2},
+		{Op: RouteOpAdd, ID: "aa", Index: 1},
+		{Op: RouteOpAdd, ID: "d", Index: 3, Append: true},
+	}
+	if len(ops) != len(expected) {
+		t.Fatalf("Expected %d ops, got %+v", len(expected), ops)
+	}
+	for i, want := range expected {
+		got := ops[i]
+		if got.Op != want.Op || got.ID != want.ID || got.Index != want.Index || got.Append != want.Append || got.Server != "srv0" {
+			t.Errorf("Op %d: expected %+v, got %+v", i, want, got)
+		}
+		if got.Op != RouteOpDelete && (got.Route == nil || got.Route.ID != want.ID) {
+			t.Errorf("Op %d: expected route payload with @id %s", i, want.ID)
+		}
+	}
+}
+
+func TestPlanRouteOps_NoChanges(t *testing.T) {
+	a := incrementalRoute("a", "a.example.com", "a:1")
+
+	ops, ok, err := PlanRouteOps(liveJSON(t, a), BuildCaddyConfig([]*storage.Route{a}, nil))
+	if err != nil || !ok || len(ops) != 0 {
+		t.Errorf("Expected empty incremental plan, got ops=%+v ok=%v err=%v", ops, ok, err)
+	}
+}
+
+func TestPlanRouteOps_NeedsLoad(t *testing.T) {
+	a := incrementalRoute("a", "a.example.com", "a:1")
+	b := incrementalRoute("b", "b.example.com", "b:1")
+	desired := BuildCaddyConfig([]*storage.Route{a, b}, nil)
+
+	tests := []struct {
+		name string
+		live json.RawMessage
+	}{
+		{"empty config", json.RawMessage(`null`)},
+		{"listen changed", json.RawMessage(`{"admin":{"listen":"0.0.0.0:2019"},"apps":{"http":{"servers":{"srv0":{"listen":[":8080"],"routes":[]}}}}}`)},
+		{"extra app", json.RawMessage(`{"admin":{"listen":"0.0.0.0:2019"},"apps":{"tls":{},"http":{"servers":{"srv0":{"listen":[":443",":80"],"routes":[]}}}}}`)},
+		{"route without @id", json.RawMessage(`{"admin":{"listen":"0.0.0.0:2019"},"apps":{"http":{"servers":{"srv0":{"listen":[":443",":80"],"routes":[{"handle":[]}]}}}}}`)},
+		{"reordered", liveJSON(t, incrementalRoute("b", "0.example.com", "b:1"), a)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, ok, err := PlanRouteOps(tt.live, desired)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if ok {
+				t.Error("Expected full load to be required")
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/goccy/go-yaml"
+
+	"github.com/ArtemStepanov/caddy-admin-ui/internal/storage"
+)
+
+// ManifestVersion is the manifest format version read and written by
+// this build
+const ManifestVersion = 1
+
+// Manifest formats
+const (
+	ManifestFormatYAML = "yaml"
+	ManifestFormatJSON = "json"
+)
+
+// Manifest declares the whole managed configuration: every route, and
+// optionally the servers and global config. Routes are matched to stored
+// ones by domain and path, so a manifest carries no IDs or versions.
+type Manifest struct {
+	Version int                   `json:"version"`
+	Global  *storage.GlobalConfig `json:"global,omitempty"`
+	// Servers is left alone when nil; an empty list removes all servers
+	Servers []*ManifestServer `json:"servers,omitempty"`
+	Routes  []*ManifestRoute  `json:"routes"`
+}
+
+// ManifestServer is a server as written in a manifest
+type ManifestServer struct {
+	Name           string                        `json:"name"`
+	Listen         []string                      `json:"listen"`
+	Protocols      []string                      `json:"protocols,omitempty"`
+	AutomaticHTTPS *storage.AutomaticHTTPSConfig `json:"automatic_https,omitempty"`
+}
+
+// ManifestRoute is a route as written in a manifest. Enabled defaults to
+// true. CaddyRoute is the stored Caddy JSON of routes imported from Caddy,
+// which keeps handlers the UI doesn't model.
+type ManifestRoute struct {
+	Domain          string                   `json:"domain"`
+	Path            string                   `json:"path,omitempty"`
+	HandlerType     string                   `json:"handler_type"`
+	Config          json.RawMessage          `json:"config,omitempty"`
+	Headers         *storage.HeaderConfig    `json:"headers,omitempty"`
+	BasicAuth       *storage.BasicAuthConfig `json:"basic_auth,omitempty"`
+	StripPathPrefix string                   `json:"strip_path_prefix,omitempty"`
+	Server          string                   `json:"server,omitempty"`
+	Instances       []string                 `json:"instances,omitempty"`
+	Enabled         *bool                    `json:"enabled,omitempty"`
+	CaddyRoute      json.RawMessage          `json:"caddy_route,omitempty"`
+}
+
+// NewManifest describes the stored configuration as a manifest
+func NewManifest(routes []*storage.Route, servers []*storage.Server, global *storage.GlobalConfig) *Manifest {
+	m := &Manifest{Version: ManifestVersion, Global: global, Routes: []*ManifestRoute{}}
+	for _, s := range servers {
+		m.Servers = append(m.Servers, &ManifestServer{
+			Name:           s.Name,
+			Listen:         s.Listen,
+			Protocols:      s.Protocols,
+			AutomaticHTTPS: s.AutomaticHTTPS,
+		})
+	}
+	for _, r := range routes {
+		mr := &ManifestRoute{
+			Domain:          r.Domain,
+			Path:            r.Path,
+			HandlerType:     r.HandlerType,
+			Headers:         r.Headers,
+			BasicAuth:       r.BasicAuth,
+			StripPathPrefix: r.StripPathPrefix,
+			Server:          r.Server,
+			Instances:       r.Instances,
+			CaddyRoute:      r.RawCaddyRoute,
+		}
+		if string(r.Config) != "{}" && string(r.Config) != "null" {
+			mr.Config = r.Config
+		}
+		if !r.Enabled {
+			mr.Enabled = new(bool)
+		}
+		m.Routes = append(m.Routes, mr)
+	}
+	return m
+}
+
+// Route returns the route a manifest entry declares
+func (mr *ManifestRoute) Route() *storage.Route {
+	cfg := mr.Config
+	if len(cfg) == 0 {
+		cfg = json.RawMessage(`{}`)
+	}
+	return &storage.Route{
+		Domain:          mr.Domain,
+		Path:            mr.Path,
+		HandlerType:     mr.HandlerType,
+		Config:          cfg,
+		Headers:         mr.Headers,
+		BasicAuth:       mr.BasicAuth,
+		StripPathPrefix: mr.StripPathPrefix,
+		Server:          mr.Server,
+		Instances:       mr.Instances,
+		Enabled:         mr.Enabled == nil || *mr.Enabled,
+		RawCaddyRoute:   mr.CaddyRoute,
+	}
+}
+
+// Server returns the server a manifest entry declares
+func (ms *ManifestServer) Server() *storage.Server {
+	return &storage.Server{
+		Name:           ms.Name,
+		Listen:         ms.Listen,
+		Protocols:      ms.Protocols,
+		AutomaticHTTPS: ms.AutomaticHTTPS,
+	}
+}
+
+// ParseManifest reads a manifest in YAML or JSON. Unknown fields are
+// rejected so typos don't go unnoticed.
+func ParseManifest(data []byte) (*Manifest, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, errors.New("manifest is empty")
+	}
+	if data[0] != '{' {
+		converted, err := yaml.YAMLToJSON(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid YAML: %w", err)
+		}
+		data = converted
+	}
+
+	var m Manifest
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&m); err != nil {
+		return nil, err
+	}
+	switch m.Version {
+	case ManifestVersion:
+	case 0:
+		return nil, errors.New("version is required")
+	default:
+		return nil, fmt.Errorf("unsupported manifest version %d, expected %d", m.Version, ManifestVersion)
+	}
+	return &m, nil
+}
+
+// EncodeManifest writes a manifest as YAML or JSON
+func EncodeManifest(m *Manifest, format string) ([]byte, error) {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case ManifestFormatJSON:
+		return append(data, '\n'), nil
+	case ManifestFormatYAML:
+		return yaml.JSONToYAML(data)
+	}
+	return nil, fmt.Errorf("unknown manifest format %q", format)
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ArtemStepanov/caddy-admin-ui/internal/storage"
+)
+
+func TestManifest_RoundTrip(t *testing.T) {
+	api := exportRoute("api", "example.com", "/api/*", "reverse_proxy", storage.ReverseProxyConfig{
+		Upstreams: []string{"api:8080"},
+		Headers:   map[string]string{"X-Real-IP": "{remote_host}"},
+	})
+	api.StripPathPrefix = "/api"
+	api.Headers = &storage.HeaderConfig{Set: map[string]string{"X-Frame-Options": "DENY"}, Delete: []string{"Server"}}
+	api.Instances = []string{"edge-1"}
+	raw := exportRoute("raw", "example.com", "/ping", "unknown", nil)
+	raw.Config = json.RawMessage(`{}`)
+	raw.RawCaddyRoute = json.RawMessage(`{"handle":[{"handler":"static_response","body":"pong"}]}`)
+	raw.Enabled = false
+	servers := []*storage.Server{{Name: "internal", Listen: []string{":8443"}, Protocols: []string{"h1", "h2"}}}
+	global := &storage.GlobalConfig{EnableEncode: true, DriftPolicy: storage.DriftPolicyReconcile}
+
+	for _, format := range []string{ManifestFormatYAML, ManifestFormatJSON} {
+		t.Run(format, func(t *testing.T) {
+			data, err := EncodeManifest(NewManifest([]*storage.Route{api, raw}, servers, global), format)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			m, err := ParseManifest(data)
+			if err != nil {
+				t.Fatalf("Unexpected error parsing:\n%s\n%v", data, err)
+			}
+
+			if m.Version != ManifestVersion || m.Global == nil || !m.Global.EnableEncode || m.Global.DriftPolicy != storage.DriftPolicyReconcile {
+				t.Errorf("Expected the global config back, got %+v", m.Global)
+			}
+			if len(m.Servers) != 1 || m.Servers[0].Server().Listen[0] != ":8443" {
+				t.Errorf("Expected the server back, got %+v", m.Servers)
+			}
+			if len(m.Routes) != 2 {
+				t.Fatalf("Expected 2 routes, got %d", len(m.Routes))
+			}
+			for i, want := range []*storage.Route{api, raw} {
+				got := m.Routes[i].Route()
+				if diff := storage.RouteDiff(want, got); len(diff) > 0 {
+					t.Errorf("Expected route %s back, %v differ:\n%s", want.ID, diff, data)
+				}
+			}
+		})
+	}
+}
+
+func TestParseManifest_Errors(t *testing.T) {
+	tests := []struct {
+		name, src, want string
+	}{
+		{"empty", "  \n", "empty"},
+		{"missing version", "routes: []\n", "version is required"},
+		{"future version", "version: 2\nroutes: []\n", "unsupported manifest version 2"},
+		{"unknown field", "version: 1\nroutes:\n  - domian: example.com\n", `unknown field "domian"`},
+		{"bad yaml", "version: 1\nroutes: [\n", "invalid YAML"},
+		{"bad json", `{"version": 1, "routes": {}}`, "cannot unmarshal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseManifest([]byte(tt.src))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected an error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
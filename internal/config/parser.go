@@ -1,7 +1,10 @@
 package config
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/ArtemStepanov/caddy-admin-ui/internal/storage"
@@ -16,7 +19,12 @@ func ParseCaddyConfig(cfg *CaddyConfig) ([]*storage.Route, error) {
 		return routes, nil
 	}
 
-	for _, server := range cfg.Apps.HTTP.Servers {
+	seen := make(map[string]bool)
+	for _, name := range serverNames(cfg) {
+		server := cfg.Apps.HTTP.Servers[name]
+		if server == nil {
+			continue
+		}
 		for _, caddyRoute := range server.Routes {
 			parsedRoute, err := parseRoute(caddyRoute)
 			if err != nil {
@@ -25,6 +33,13 @@ func ParseCaddyConfig(cfg *CaddyConfig) ([]*storage.Route, error) {
 				// If we fail to parse, let's treat it as an unknown handler type
 				parsedRoute = createRawRoute(caddyRoute)
 			}
+			// Caddy rejects duplicate IDs, but a hand-edited config may not
+			// have been loaded yet
+			if seen[parsedRoute.ID] {
+				parsedRoute.ID = uuid.New().String()
+			}
+			seen[parsedRoute.ID] = true
+			parsedRoute.Server = name
 			routes = append(routes, parsedRoute)
 		}
 	}
@@ -32,6 +47,67 @@ func ParseCaddyConfig(cfg *CaddyConfig) ([]*storage.Route, error) {
 	return routes, nil
 }
 
+// ParseCaddyServers returns the HTTP servers of a Caddy configuration,
+// ordered by name. Routes are left to ParseCaddyConfig.
+func ParseCaddyServers(cfg *CaddyConfig) []*storage.Server {
+	var servers []*storage.Server
+	for _, name := range serverNames(cfg) {
+		s := cfg.Apps.HTTP.Servers[name]
+		if s == nil {
+			continue
+		}
+		servers = append(servers, &storage.Server{
+			Name:           name,
+			Listen:         s.Listen,
+			Protocols:      s.Protocols,
+			AutomaticHTTPS: s.AutomaticHTTPS,
+		})
+	}
+	return servers
+}
+
+// ParseAdminSettings returns the admin settings of a Caddy configuration,
+// or nil if it has no admin section
+func ParseAdminSettings(cfg *CaddyConfig) *storage.AdminSettings {
+	if cfg.Admin == nil {
+		return nil
+	}
+	return &storage.AdminSettings{
+		Listen:        cfg.Admin.Listen,
+		EnforceOrigin: cfg.Admin.EnforceOrigin,
+		Origins:       cfg.Admin.Origins,
+		Identity:      cfg.Admin.Identity,
+		Remote:        cfg.Admin.Remote,
+	}
+}
+
+// serverNames returns the names of the HTTP servers in cfg, sorted so
+// parsing is deterministic
+func serverNames(cfg *CaddyConfig) []string {
+	if cfg.Apps == nil || cfg.Apps.HTTP == nil {
+		return nil
+	}
+	names := make([]string, 0, len(cfg.Apps.HTTP.Servers))
+	for name := range cfg.Apps.HTTP.Servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// routeIDPattern matches the "@id"s that can be used as route IDs as they
+// are, without escaping in API or /id/ paths
+var routeIDPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,128}$`)
+
+// importedRouteID returns the "@id" of a Caddy route, such as the one the
+// builder sets, or a new ID if it has none that can be used
+func importedRouteID(r Route) string {
+	if routeIDPattern.MatchString(r.ID) && r.ID != "." && r.ID != ".." {
+		return r.ID
+	}
+	return uuid.New().String()
+}
+
 func parseRoute(r Route) (*storage.Route, error) {
 	// marshal raw route first
 	rawJSON, err := json.Marshal(r)
@@ -40,7 +116,7 @@ func parseRoute(r Route) (*storage.Route, error) {
 	}
 
 	storageRoute := &storage.Route{
-		ID:            uuid.New().String(),
+		ID:            importedRouteID(r),
 		Enabled:       true,
 		RawCaddyRoute: rawJSON,
 	}
@@ -133,6 +209,12 @@ func parseRoute(r Route) (*storage.Route, error) {
 				storageRoute.StripPathPrefix = prefix
 			}
 
+		case "authentication":
+			// Only http_basic is modelled; other providers stay in RawCaddyRoute
+			if cfg, err := parseBasicAuth(h); err == nil && cfg != nil {
+				storageRoute.BasicAuth = cfg
+			}
+
 		case "encode":
 			// We just ignore encode handler as it's global setting in our model usually,
 			// or implied. But if we want to support per-route encode, we'd need to add it to model.
@@ -153,7 +235,7 @@ func parseRoute(r Route) (*storage.Route, error) {
 func createRawRoute(r Route) *storage.Route {
 	rawJSON, _ := json.Marshal(r)
 	return &storage.Route{
-		ID:            uuid.New().String(),
+		ID:            importedRouteID(r),
 		Domain:        "UNKNOWN",
 		HandlerType:   "unknown",
 		Enabled:       true,
@@ -290,3 +372,64 @@ func parseHeaders(h Handler) (*storage.HeaderConfig, error) {
 
 	return cfg, nil
 }
+
+func parseBasicAuth(h Handler) (*storage.BasicAuthConfig, error) {
+	providers, ok := h["providers"].(map[string]any)
+	if !ok {
+		return nil, nil
+	}
+	httpBasic, ok := providers["http_basic"].(map[string]any)
+	if !ok || basicAuthAlgorithm(httpBasic) != "bcrypt" {
+		// Other hashes (scrypt, argon2id) can't be stored as bcrypt, so the
+		// handler stays in RawCaddyRoute as is
+		return nil, nil
+	}
+
+	cfg := &storage.BasicAuthConfig{Enabled: true}
+
+	if realm, ok := httpBasic["realm"].(string); ok {
+		cfg.Realm = realm
+	}
+
+	if accounts, ok := httpBasic["accounts"].([]any); ok {
+		for _, a := range accounts {
+			aMap, ok := a.(map[string]any)
+			if !ok {
+				continue
+			}
+			username, _ := aMap["username"].(string)
+			password, _ := aMap["password"].(string)
+			if username == "" {
+				continue
+			}
+			cfg.Users = append(cfg.Users, storage.BasicAuthUser{
+				Username: username,
+				Password: decodeBasicAuthHash(password),
+			})
+		}
+	}
+
+	return cfg, nil
+}
+
+// basicAuthAlgorithm returns the hash algorithm of an http_basic provider,
+// which Caddy defaults to bcrypt
+func basicAuthAlgorithm(httpBasic map[string]any) string {
+	hash, _ := httpBasic["hash"].(map[string]any)
+	if algorithm, _ := hash["algorithm"].(string); algorithm != "" {
+		return algorithm
+	}
+	return "bcrypt"
+}
+
+// decodeBasicAuthHash returns the bcrypt hash for a stored account password.
+// Older Caddy versions base64-encode the hash, newer ones store it verbatim.
+func decodeBasicAuthHash(password string) string {
+	if storage.IsBcryptHash(password) {
+		return password
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(password); err == nil && storage.IsBcryptHash(string(decoded)) {
+		return string(decoded)
+	}
+	return password
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"testing"
 
@@ -397,6 +398,46 @@ func TestRoundTrip_ReverseProxy(t *testing.T) {
 	}
 }
 
+func TestRoundTrip_RouteIDs(t *testing.T) {
+	original := []*storage.Route{
+		{ID: "3f1c9e2a-7b4d-4e8a-9c61-0d5f2b7a8e13", Domain: "a.example.com", HandlerType: "reverse_proxy", Config: json.RawMessage(`{"upstreams":["localhost:8080"]}`), Enabled: true},
+		{ID: "docs_v2", Domain: "b.example.com", Path: "/docs", HandlerType: "file_server", Config: json.RawMessage(`{"root":"/srv"}`), Enabled: true},
+	}
+
+	// Marshal/unmarshal to mimic fetching from Caddy
+	data, _ := json.Marshal(BuildCaddyConfig(original, nil))
+	var fetched CaddyConfig
+	json.Unmarshal(data, &fetched)
+
+	parsed, err := ParseCaddyConfig(&fetched)
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	ids := make(map[string]string)
+	for _, r := range parsed {
+		ids[r.Domain] = r.ID
+	}
+	for _, r := range original {
+		if ids[r.Domain] != r.ID {
+			t.Errorf("Expected %s to keep ID %s, got %s", r.Domain, r.ID, ids[r.Domain])
+		}
+	}
+
+	// An @id that can't be a route ID, or a duplicate one, gets a new ID
+	fetched.Apps.HTTP.Servers["srv0"].Routes[0].ID = "a/b"
+	fetched.Apps.HTTP.Servers["srv0"].Routes[1].ID = "a/b"
+	parsed, _ = ParseCaddyConfig(&fetched)
+	if parsed[0].ID == "a/b" || parsed[1].ID == "a/b" || parsed[0].ID == parsed[1].ID {
+		t.Errorf("Expected new distinct IDs, got %s and %s", parsed[0].ID, parsed[1].ID)
+	}
+	fetched.Apps.HTTP.Servers["srv0"].Routes[0].ID = "same"
+	fetched.Apps.HTTP.Servers["srv0"].Routes[1].ID = "same"
+	parsed, _ = ParseCaddyConfig(&fetched)
+	if parsed[0].ID != "same" || parsed[1].ID == "same" {
+		t.Errorf("Expected only the first route to keep a duplicate ID, got %s and %s", parsed[0].ID, parsed[1].ID)
+	}
+}
+
 func TestRoundTrip_FileServer(t *testing.T) {
 	original := &storage.Route{
 		Domain:      "static.example.com",
@@ -550,3 +591,216 @@ func TestRoundTrip_StripPathPrefix(t *testing.T) {
 		t.Errorf("Expected path /api/*, got %s", parsed.Path)
 	}
 }
+
+func TestParseCaddyConfig_BasicAuth(t *testing.T) {
+	hash := "$2a$14$Zkx19XLiW6VYouLHR5NmfOFU0z2GTNmpkT/5qqR7hx4IjWJPDhjvG"
+
+	cfg := &CaddyConfig{
+		Apps: &Apps{
+			HTTP: &HTTPApp{
+				Servers: map[string]*Server{
+					"srv0": {
+						Listen: []string{":443"},
+						Routes: []Route{
+							{
+								Match: []Match{
+									{Host: []string{"example.com"}},
+								},
+								Handle: []Handler{
+									{
+										"handler": "authentication",
+										"providers": map[string]any{
+											"http_basic": map[string]any{
+												"realm": "restricted",
+												"accounts": []any{
+													map[string]any{"username": "plain", "password": hash},
+													map[string]any{"username": "encoded", "password": base64.StdEncoding.EncodeToString([]byte(hash))},
+												},
+											},
+										},
+									},
+									{
+										"handler": "reverse_proxy",
+										"upstreams": []any{
+											map[string]any{"dial": "localhost:8080"},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	routes, err := ParseCaddyConfig(cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	auth := routes[0].BasicAuth
+	if auth == nil {
+		t.Fatal("Expected basic auth to be parsed")
+	}
+	if !auth.Enabled || auth.Realm != "restricted" {
+		t.Errorf("Unexpected basic auth config: %+v", auth)
+	}
+	if len(auth.Users) != 2 {
+		t.Fatalf("Expected 2 users, got %d", len(auth.Users))
+	}
+	for _, u := range auth.Users {
+		if u.Password != hash {
+			t.Errorf("Expected decoded bcrypt hash for %s, got %s", u.Username, u.Password)
+		}
+	}
+}
+
+func TestParseCaddyConfig_BasicAuthScrypt(t *testing.T) {
+	live := `{"apps": {"http": {"servers": {"srv0": {"routes": [{
+		"match": [{"host": ["example.com"]}],
+		"handle": [
+			{"handler": "authentication", "providers": {"http_basic": {
+				"hash": {"algorithm": "scrypt", "N": 32768, "r": 8, "p": 1, "key_length": 32},
+				"accounts": [{"username": "alice", "password": "c2NyeXB0aGFzaA==", "salt": "c2FsdA=="}]
+			}}},
+			{"handler": "reverse_proxy", "upstreams": [{"dial": "localhost:8080"}]}
+		]
+	}]}}}}}`
+
+	var cfg CaddyConfig
+	if err := json.Unmarshal([]byte(live), &cfg); err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	routes, err := ParseCaddyConfig(&cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if routes[0].BasicAuth != nil {
+		t.Errorf("Expected scrypt accounts not to be imported as bcrypt, got %+v", routes[0].BasicAuth)
+	}
+
+	handle := BuildCaddyConfig(routes, nil).Apps.HTTP.Servers["srv0"].Routes[0].Handle
+	if len(handle) != 2 || handle[0]["handler"] != "authentication" {
+		t.Fatalf("Expected the authentication handler to be kept, got %v", handle)
+	}
+	basic := handle[0]["providers"].(map[string]any)["http_basic"].(map[string]any)
+	if basic["hash"].(map[string]any)["algorithm"] != "scrypt" {
+		t.Errorf("Expected the scrypt hash settings to be kept, got %v", basic["hash"])
+	}
+	account := basic["accounts"].([]any)[0].(map[string]any)
+	if account["password"] != "c2NyeXB0aGFzaA==" || account["salt"] != "c2FsdA==" {
+		t.Errorf("Expected the scrypt account to be kept as is, got %v", account)
+	}
+}
+
+func TestRoundTrip_BasicAuth(t *testing.T) {
+	original := []*storage.Route{
+		{
+			Domain:      "example.com",
+			HandlerType: "reverse_proxy",
+			Config:      json.RawMessage(`{"upstreams":["localhost:8080"]}`),
+			BasicAuth: &storage.BasicAuthConfig{
+				Enabled: true,
+				Users: []storage.BasicAuthUser{
+					{Username: "admin", Password: "$2a$14$Zkx19XLiW6VYouLHR5NmfOFU0z2GTNmpkT/5qqR7hx4IjWJPDhjvG"},
+				},
+			},
+			Enabled: true,
+		},
+	}
+
+	caddyCfg := BuildCaddyConfig(original, nil)
+
+	// Marshal/unmarshal to mimic fetching from Caddy
+	data, _ := json.Marshal(caddyCfg)
+	var fetched CaddyConfig
+	json.Unmarshal(data, &fetched)
+
+	parsed, err := ParseCaddyConfig(&fetched)
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+
+	auth := parsed[0].BasicAuth
+	if auth == nil || len(auth.Users) != 1 {
+		t.Fatalf("Expected basic auth with 1 user, got %+v", auth)
+	}
+	if auth.Users[0].Username != "admin" || auth.Users[0].Password != original[0].BasicAuth.Users[0].Password {
+		t.Errorf("Basic auth user mismatch: %+v", auth.Users[0])
+	}
+	if parsed[0].HandlerType != "reverse_proxy" {
+		t.Errorf("Expected reverse_proxy main handler, got %s", parsed[0].HandlerType)
+	}
+}
+
+func TestRoundTrip_MultipleServers(t *testing.T) {
+	live := `{"apps": {"http": {"servers": {
+		"public": {
+			"listen": [":443"],
+			"protocols": ["h1", "h2", "h3"],
+			"automatic_https": {"disable_redirects": true},
+			"routes": [{"match": [{"host": ["example.com"]}], "handle": [{"handler": "reverse_proxy", "upstreams": [{"dial": "app:8080"}]}]}]
+		},
+		"internal": {
+			"listen": [":8080"],
+			"automatic_https": {"disable": true},
+			"routes": [{"match": [{"host": ["admin.internal"]}], "handle": [{"handler": "file_server", "root": "/srv"}]}]
+		},
+		"idle": {"listen": [":9000"], "routes": []}
+	}}}}`
+
+	var cfg CaddyConfig
+	if err := json.Unmarshal([]byte(live), &cfg); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+
+	servers := ParseCaddyServers(&cfg)
+	if len(servers) != 3 || servers[0].Name != "idle" || servers[1].Name != "internal" || servers[2].Name != "public" {
+		t.Fatalf("Expected 3 servers sorted by name, got %+v", servers)
+	}
+	if servers[1].AutomaticHTTPS == nil || !servers[1].AutomaticHTTPS.Disable {
+		t.Errorf("Expected automatic_https to be parsed, got %+v", servers[1].AutomaticHTTPS)
+	}
+
+	routes, _ := ParseCaddyConfig(&cfg)
+	if len(routes) != 2 || routes[0].Server != "internal" || routes[1].Server != "public" {
+		t.Fatalf("Expected routes to keep their server, got %+v", routes)
+	}
+
+	built := BuildCaddyConfigWithServers(routes, servers, nil).Apps.HTTP.Servers
+
+	if len(built) != 3 || len(built["idle"].Routes) != 0 || built["idle"].Listen[0] != ":9000" {
+		t.Errorf("Expected idle server to be kept without routes, got %+v", built["idle"])
+	}
+	public := built["public"]
+	if len(public.Routes) != 1 || public.Routes[0].Match[0].Host[0] != "example.com" {
+		t.Errorf("Expected example.com in public server, got %+v", public.Routes)
+	}
+	if len(public.Protocols) != 3 || public.AutomaticHTTPS == nil || !public.AutomaticHTTPS.DisableRedirects {
+		t.Errorf("Expected public server settings to round-trip, got %+v", public)
+	}
+	if len(built["internal"].Routes) != 1 || built["internal"].Listen[0] != ":8080" {
+		t.Errorf("Expected admin.internal in internal server, got %+v", built["internal"])
+	}
+}
+
+func TestBuildCaddyConfigWithServers_UnknownServer(t *testing.T) {
+	route := &storage.Route{
+		ID:          "r1",
+		Domain:      "example.com",
+		HandlerType: "reverse_proxy",
+		Config:      json.RawMessage(`{"upstreams":["localhost:8080"]}`),
+		Server:      "gone",
+		Enabled:     true,
+	}
+
+	cfg := BuildCaddyConfigWithServers([]*storage.Route{route}, nil, nil)
+	srv0 := cfg.Apps.HTTP.Servers[storage.DefaultServerName]
+	if srv0 == nil || len(srv0.Routes) != 1 || len(cfg.Apps.HTTP.Servers) != 1 {
+		t.Fatalf("Expected route in the default server, got %+v", cfg.Apps.HTTP.Servers)
+	}
+	if len(srv0.Listen) != 2 {
+		t.Errorf("Expected default listen addresses, got %v", srv0.Listen)
+	}
+}
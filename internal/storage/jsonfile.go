@@ -0,0 +1,991 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// JSONStorage implements Store in pure Go, keeping everything in memory and
+// writing it to a single JSON file after each change. With an empty path
+// nothing is written, which is handy for tests.
+type JSONStorage struct {
+	mu    sync.Mutex
+	path  string
+	state *jsonState
+}
+
+// The whole file is rewritten on every change, so only the newest
+// revisions and audit events are kept; older ones are dropped as new ones
+// are added.
+const (
+	jsonMaxRevisions   = 100
+	jsonMaxAuditEvents = 1000
+)
+
+// jsonState is the full contents of a JSONStorage. It also implements
+// RouteStore, so WithTx can run callbacks against a copy of it.
+type jsonState struct {
+	Routes         map[string]*Route    `json:"-"`
+	Servers        map[string]*Server   `json:"servers,omitempty"`
+	Instances      map[string]*Instance `json:"instances,omitempty"`
+	GlobalConfig   *GlobalConfig        `json:"global_config,omitempty"`
+	BaseConfig     json.RawMessage      `json:"base_config,omitempty"`
+	Revisions      []*Revision          `json:"-"`
+	NextRevisionID int64                `json:"next_revision_id"`
+	Users          map[string]*User     `json:"-"`
+	Sessions       map[string]*Session  `json:"sessions,omitempty"`
+	APITokens      map[string]*APIToken `json:"-"`
+	AuditEvents    []*AuditEvent        `json:"audit_events,omitempty"`
+	NextAuditID    int64                `json:"next_audit_id,omitempty"`
+}
+
+// jsonFile is the on-disk format. Routes go through the snapshot encoding
+// so RawCaddyRoute is kept, and users and API tokens include the hashes
+// their types hide from JSON.
+type jsonFile struct {
+	*jsonState
+	Routes    json.RawMessage `json:"routes"`
+	Revisions []jsonRevision  `json:"revisions"`
+	Users     []jsonUser      `json:"users,omitempty"`
+	APITokens []jsonAPIToken  `json:"api_tokens,omitempty"`
+}
+
+type jsonRevision struct {
+	*Revision
+	Routes json.RawMessage `json:"routes"`
+}
+
+type jsonUser struct {
+	*User
+	PasswordHash string `json:"password_hash"`
+}
+
+type jsonAPIToken struct {
+	*APIToken
+	TokenHash string `json:"token_hash"`
+}
+
+// NewJSONStorage creates a JSON-file storage, loading path if it exists
+func NewJSONStorage(path string) (*JSONStorage, error) {
+	s := &JSONStorage{
+		path: path,
+		state: &jsonState{
+			Routes:         make(map[string]*Route),
+			Servers:        make(map[string]*Server),
+			Instances:      make(map[string]*Instance),
+			NextRevisionID: 1,
+			Users:          make(map[string]*User),
+			Sessions:       make(map[string]*Session),
+			APITokens:      make(map[string]*APIToken),
+		},
+	}
+	if path == "" {
+		return s, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := decodeJSONState(data)
+	if err != nil {
+		return nil, err
+	}
+	s.state = state
+	return s, nil
+}
+
+// WithTx runs fn against a copy of the current state and keeps the copy
+// only if fn succeeds. The store is locked for the duration of fn.
+func (s *JSONStorage) WithTx(fn func(tx RouteStore) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	draft, err := s.state.clone()
+	if err != nil {
+		return err
+	}
+	if err := fn(draft); err != nil {
+		return err
+	}
+	return s.commit(draft)
+}
+
+// write applies a single change through WithTx
+func (s *JSONStorage) write(fn func(st *jsonState) error) error {
+	return s.WithTx(func(tx RouteStore) error {
+		return fn(tx.(*jsonState))
+	})
+}
+
+// commit swaps in the new state and persists it
+func (s *JSONStorage) commit(state *jsonState) error {
+	if s.path != "" {
+		data, err := state.encode()
+		if err != nil {
+			return err
+		}
+		// Write to a temp file first so a crash can't leave a truncated file
+		tmp := s.path + ".tmp"
+		if err := os.WriteFile(tmp, data, 0600); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, s.path); err != nil {
+			return err
+		}
+	}
+	s.state = state
+	return nil
+}
+
+// Route CRUD operations
+
+// CreateRoute creates a new route
+func (s *JSONStorage) CreateRoute(route *Route) error {
+	return s.write(func(st *jsonState) error { return st.CreateRoute(route) })
+}
+
+// GetRoute retrieves a route by ID
+func (s *JSONStorage) GetRoute(id string) (*Route, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state.GetRoute(id)
+}
+
+// ListRoutes returns all routes
+func (s *JSONStorage) ListRoutes() ([]*Route, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state.ListRoutes()
+}
+
+// UpdateRoute updates an existing route
+func (s *JSONStorage) UpdateRoute(route *Route) error {
+	return s.write(func(st *jsonState) error { return st.UpdateRoute(route) })
+}
+
+// DeleteRoute deletes a route
+func (s *JSONStorage) DeleteRoute(id string) error {
+	return s.write(func(st *jsonState) error { return st.DeleteRoute(id) })
+}
+
+// DeleteAllRoutes deletes all routes (used for import)
+func (s *JSONStorage) DeleteAllRoutes() error {
+	return s.write(func(st *jsonState) error { return st.DeleteAllRoutes() })
+}
+
+// Servers
+
+// CreateServer stores a new server
+func (s *JSONStorage) CreateServer(server *Server) error {
+	return s.write(func(st *jsonState) error { return st.CreateServer(server) })
+}
+
+// GetServer retrieves a server by name
+func (s *JSONStorage) GetServer(name string) (*Server, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state.GetServer(name)
+}
+
+// ListServers returns all servers ordered by name
+func (s *JSONStorage) ListServers() ([]*Server, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state.ListServers()
+}
+
+// UpdateServer updates an existing server
+func (s *JSONStorage) UpdateServer(server *Server) error {
+	return s.write(func(st *jsonState) error { return st.UpdateServer(server) })
+}
+
+// DeleteServer deletes a server. Routes referencing it are left alone.
+func (s *JSONStorage) DeleteServer(name string) error {
+	return s.write(func(st *jsonState) error { return st.DeleteServer(name) })
+}
+
+// DeleteAllServers deletes all servers (used for import)
+func (s *JSONStorage) DeleteAllServers() error {
+	return s.write(func(st *jsonState) error { return st.DeleteAllServers() })
+}
+
+// Instances
+
+// CreateInstance stores a new instance
+func (s *JSONStorage) CreateInstance(instance *Instance) error {
+	return s.write(func(st *jsonState) error { return st.CreateInstance(instance) })
+}
+
+// GetInstance retrieves an instance by name
+func (s *JSONStorage) GetInstance(name string) (*Instance, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state.GetInstance(name)
+}
+
+// ListInstances returns all instances ordered by name
+func (s *JSONStorage) ListInstances() ([]*Instance, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state.ListInstances()
+}
+
+// UpdateInstance updates an existing instance
+func (s *JSONStorage) UpdateInstance(instance *Instance) error {
+	return s.write(func(st *jsonState) error { return st.UpdateInstance(instance) })
+}
+
+// DeleteInstance deletes an instance. Routes referencing it are left alone.
+func (s *JSONStorage) DeleteInstance(name string) error {
+	return s.write(func(st *jsonState) error { return st.DeleteInstance(name) })
+}
+
+// Global config
+
+// GetGlobalConfig retrieves the global configuration
+func (s *JSONStorage) GetGlobalConfig() (*GlobalConfig, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state.GetGlobalConfig()
+}
+
+// SetGlobalConfig saves the global configuration
+func (s *JSONStorage) SetGlobalConfig(config *GlobalConfig) error {
+	return s.write(func(st *jsonState) error { return st.SetGlobalConfig(config) })
+}
+
+// GetBaseConfig retrieves the stored base Caddy config
+func (s *JSONStorage) GetBaseConfig() (json.RawMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state.GetBaseConfig()
+}
+
+// SetBaseConfig saves the base Caddy config; nil clears it
+func (s *JSONStorage) SetBaseConfig(base json.RawMessage) error {
+	return s.write(func(st *jsonState) error { return st.SetBaseConfig(base) })
+}
+
+// Revisions
+
+// CreateRevision stores a new revision. Revisions are never updated.
+func (s *JSONStorage) CreateRevision(rev *Revision) error {
+	return s.write(func(st *jsonState) error {
+		stored, err := cloneRevision(rev)
+		if err != nil {
+			return err
+		}
+		stored.ID = st.NextRevisionID
+		stored.RouteCount = len(rev.Routes)
+		stored.CreatedAt = time.Now()
+		st.NextRevisionID++
+		st.Revisions = append(st.Revisions, stored)
+		if n := len(st.Revisions) - jsonMaxRevisions; n > 0 {
+			st.Revisions = slices.Delete(st.Revisions, 0, n)
+		}
+
+		rev.ID, rev.RouteCount, rev.CreatedAt = stored.ID, stored.RouteCount, stored.CreatedAt
+		return nil
+	})
+}
+
+// GetRevision retrieves a revision including its config and route snapshot
+func (s *JSONStorage) GetRevision(id int64) (*Revision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, rev := range s.state.Revisions {
+		if rev.ID == id {
+			return cloneRevision(rev)
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// ListRevisions returns revision summaries (without config and routes),
+// newest first. A negative limit returns all of them, as in SQLite.
+func (s *JSONStorage) ListRevisions(limit int) ([]*Revision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var revisions []*Revision
+	for i := len(s.state.Revisions) - 1; i >= 0 && (limit < 0 || len(revisions) < limit); i-- {
+		rev := s.state.Revisions[i]
+		revisions = append(revisions, &Revision{
+			ID:         rev.ID,
+			Action:     rev.Action,
+			Instance:   rev.Instance,
+			RouteCount: rev.RouteCount,
+			CreatedAt:  rev.CreatedAt,
+		})
+	}
+	return revisions, nil
+}
+
+// Users
+
+// CreateUser stores a new user
+func (s *JSONStorage) CreateUser(user *User) error {
+	return s.write(func(st *jsonState) error {
+		if _, exists := st.Users[user.Username]; exists {
+			return ErrUserExists
+		}
+		user.CreatedAt = time.Now()
+		user.UpdatedAt = user.CreatedAt
+		st.Users[user.Username] = cloneUser(user)
+		return nil
+	})
+}
+
+// GetUser retrieves a user by username
+func (s *JSONStorage) GetUser(username string) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.state.Users[username]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return cloneUser(user), nil
+}
+
+// ListUsers returns all users ordered by username
+func (s *JSONStorage) ListUsers() ([]*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var users []*User
+	for _, u := range s.state.Users {
+		users = append(users, cloneUser(u))
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+	return users, nil
+}
+
+// CountUsers returns the number of users
+func (s *JSONStorage) CountUsers() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.state.Users), nil
+}
+
+// UpdateUser updates an existing user
+func (s *JSONStorage) UpdateUser(user *User) error {
+	return s.write(func(st *jsonState) error {
+		existing, ok := st.Users[user.Username]
+		if !ok {
+			return ErrNotFound
+		}
+		user.CreatedAt = existing.CreatedAt
+		user.UpdatedAt = time.Now()
+		st.Users[user.Username] = cloneUser(user)
+		return nil
+	})
+}
+
+// DeleteUser deletes a user along with their sessions and API tokens
+func (s *JSONStorage) DeleteUser(username string) error {
+	return s.write(func(st *jsonState) error {
+		delete(st.Users, username)
+		for hash, session := range st.Sessions {
+			if session.Username == username {
+				delete(st.Sessions, hash)
+			}
+		}
+		for id, token := range st.APITokens {
+			if token.Username == username {
+				delete(st.APITokens, id)
+			}
+		}
+		return nil
+	})
+}
+
+// Sessions and API tokens
+
+// CreateSession stores a new session and drops expired ones
+func (s *JSONStorage) CreateSession(session *Session) error {
+	return s.write(func(st *jsonState) error {
+		session.CreatedAt = time.Now()
+		for hash, existing := range st.Sessions {
+			if existing.ExpiresAt.Before(session.CreatedAt) {
+				delete(st.Sessions, hash)
+			}
+		}
+		stored := *session
+		st.Sessions[session.TokenHash] = &stored
+		return nil
+	})
+}
+
+// GetSession retrieves a session by the hash of its token. Expired
+// sessions are returned too; it's up to the caller to check ExpiresAt.
+func (s *JSONStorage) GetSession(tokenHash string) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.state.Sessions[tokenHash]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	cloned := *session
+	return &cloned, nil
+}
+
+// DeleteSession deletes a session
+func (s *JSONStorage) DeleteSession(tokenHash string) error {
+	return s.write(func(st *jsonState) error {
+		delete(st.Sessions, tokenHash)
+		return nil
+	})
+}
+
+// DeleteUserSessions deletes a user's sessions other than keep
+func (s *JSONStorage) DeleteUserSessions(username, keep string) error {
+	return s.write(func(st *jsonState) error {
+		for hash, session := range st.Sessions {
+			if session.Username == username && hash != keep {
+				delete(st.Sessions, hash)
+			}
+		}
+		return nil
+	})
+}
+
+// CreateAPIToken stores a new API token
+func (s *JSONStorage) CreateAPIToken(token *APIToken) error {
+	return s.write(func(st *jsonState) error {
+		if token.ID == "" {
+			token.ID = uuid.New().String()
+		}
+		token.CreatedAt = time.Now()
+		stored := *token
+		st.APITokens[token.ID] = &stored
+		return nil
+	})
+}
+
+// GetAPIToken retrieves an API token by the hash of its secret
+func (s *JSONStorage) GetAPIToken(tokenHash string) (*APIToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, token := range s.state.APITokens {
+		if token.TokenHash == tokenHash {
+			cloned := *token
+			return &cloned, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// ListAPITokens returns the API tokens of a user, or all tokens if
+// username is empty, oldest first
+func (s *JSONStorage) ListAPITokens(username string) ([]*APIToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var tokens []*APIToken
+	for _, token := range s.state.APITokens {
+		if username == "" || token.Username == username {
+			cloned := *token
+			tokens = append(tokens, &cloned)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		if !tokens[i].CreatedAt.Equal(tokens[j].CreatedAt) {
+			return tokens[i].CreatedAt.Before(tokens[j].CreatedAt)
+		}
+		return tokens[i].ID < tokens[j].ID
+	})
+	return tokens, nil
+}
+
+// DeleteAPIToken deletes an API token
+func (s *JSONStorage) DeleteAPIToken(id string) error {
+	return s.write(func(st *jsonState) error {
+		delete(st.APITokens, id)
+		return nil
+	})
+}
+
+// Audit events
+
+// CreateAuditEvent stores a new audit event
+func (s *JSONStorage) CreateAuditEvent(event *AuditEvent) error {
+	return s.write(func(st *jsonState) error {
+		st.NextAuditID = max(st.NextAuditID, 1)
+		event.ID = st.NextAuditID
+		event.CreatedAt = time.Now()
+		st.NextAuditID++
+
+		stored := *event
+		stored.Before = cloneRaw(event.Before)
+		stored.After = cloneRaw(event.After)
+		st.AuditEvents = append(st.AuditEvents, &stored)
+		if n := len(st.AuditEvents) - jsonMaxAuditEvents; n > 0 {
+			st.AuditEvents = slices.Delete(st.AuditEvents, 0, n)
+		}
+		return nil
+	})
+}
+
+// ListAuditEvents returns the events matching filter, newest first
+func (s *JSONStorage) ListAuditEvents(filter AuditFilter) ([]*AuditEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var events []*AuditEvent
+	for i := len(s.state.AuditEvents) - 1; i >= 0; i-- {
+		if filter.Limit > 0 && len(events) == filter.Limit {
+			break
+		}
+		e := s.state.AuditEvents[i]
+		if !filter.Matches(e) {
+			continue
+		}
+		cloned := *e
+		cloned.Before = cloneRaw(e.Before)
+		cloned.After = cloneRaw(e.After)
+		events = append(events, &cloned)
+	}
+	return events, nil
+}
+
+// Close is a no-op; every change is already on disk
+func (s *JSONStorage) Close() error {
+	return nil
+}
+
+// jsonState RouteStore implementation. Routes are copied on the way in and
+// out so callers can't modify stored state by accident.
+
+func (st *jsonState) CreateRoute(route *Route) error {
+	if route.ID == "" {
+		route.ID = uuid.New().String()
+	}
+	if _, exists := st.Routes[route.ID]; exists {
+		return errors.New("route " + route.ID + " already exists")
+	}
+	if err := route.BasicAuth.HashPasswords(); err != nil {
+		return err
+	}
+	if route.CreatedAt.IsZero() {
+		route.CreatedAt = time.Now()
+	}
+	route.UpdatedAt = time.Now()
+	if route.Version == 0 {
+		route.Version = 1
+	}
+
+	stored, err := cloneRoute(route)
+	if err != nil {
+		return err
+	}
+	st.Routes[route.ID] = stored
+	return nil
+}
+
+func (st *jsonState) GetRoute(id string) (*Route, error) {
+	route, ok := st.Routes[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return cloneRoute(route)
+}
+
+func (st *jsonState) ListRoutes() ([]*Route, error) {
+	var routes []*Route
+	for _, r := range st.Routes {
+		route, err := cloneRoute(r)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, route)
+	}
+	// Same order as SQLiteStorage
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Domain != routes[j].Domain {
+			return routes[i].Domain < routes[j].Domain
+		}
+		return routes[i].Path < routes[j].Path
+	})
+	return routes, nil
+}
+
+func (st *jsonState) UpdateRoute(route *Route) error {
+	existing, ok := st.Routes[route.ID]
+	if !ok {
+		// Matches SQL UPDATE semantics: nothing to update is not an error
+		return nil
+	}
+	if route.Version != 0 && route.Version != existing.Version {
+		return ErrVersionConflict
+	}
+	if err := route.BasicAuth.HashPasswords(); err != nil {
+		return err
+	}
+	route.UpdatedAt = time.Now()
+	route.Version = existing.Version + 1
+
+	stored, err := cloneRoute(route)
+	if err != nil {
+		return err
+	}
+	stored.CreatedAt = existing.CreatedAt
+	st.Routes[route.ID] = stored
+	return nil
+}
+
+func (st *jsonState) DeleteRoute(id string) error {
+	delete(st.Routes, id)
+	return nil
+}
+
+func (st *jsonState) DeleteAllRoutes() error {
+	st.Routes = make(map[string]*Route)
+	return nil
+}
+
+func (st *jsonState) CreateServer(server *Server) error {
+	if _, exists := st.Servers[server.Name]; exists {
+		return ErrServerExists
+	}
+	server.CreatedAt = time.Now()
+	server.UpdatedAt = server.CreatedAt
+	st.Servers[server.Name] = cloneServer(server)
+	return nil
+}
+
+func (st *jsonState) GetServer(name string) (*Server, error) {
+	server, ok := st.Servers[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return cloneServer(server), nil
+}
+
+func (st *jsonState) ListServers() ([]*Server, error) {
+	var servers []*Server
+	for _, s := range st.Servers {
+		servers = append(servers, cloneServer(s))
+	}
+	sort.Slice(servers, func(i, j int) bool { return servers[i].Name < servers[j].Name })
+	return servers, nil
+}
+
+func (st *jsonState) UpdateServer(server *Server) error {
+	existing, ok := st.Servers[server.Name]
+	if !ok {
+		return ErrNotFound
+	}
+	server.CreatedAt = existing.CreatedAt
+	server.UpdatedAt = time.Now()
+	st.Servers[server.Name] = cloneServer(server)
+	return nil
+}
+
+func (st *jsonState) DeleteServer(name string) error {
+	delete(st.Servers, name)
+	return nil
+}
+
+func (st *jsonState) DeleteAllServers() error {
+	st.Servers = make(map[string]*Server)
+	return nil
+}
+
+func (st *jsonState) CreateInstance(instance *Instance) error {
+	if _, exists := st.Instances[instance.Name]; exists {
+		return ErrInstanceExists
+	}
+	instance.CreatedAt = time.Now()
+	instance.UpdatedAt = instance.CreatedAt
+	st.Instances[instance.Name] = cloneInstance(instance)
+	return nil
+}
+
+func (st *jsonState) GetInstance(name string) (*Instance, error) {
+	instance, ok := st.Instances[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return cloneInstance(instance), nil
+}
+
+func (st *jsonState) ListInstances() ([]*Instance, error) {
+	var instances []*Instance
+	for _, i := range st.Instances {
+		instances = append(instances, cloneInstance(i))
+	}
+	sort.Slice(instances, func(i, j int) bool { return instances[i].Name < instances[j].Name })
+	return instances, nil
+}
+
+func (st *jsonState) UpdateInstance(instance *Instance) error {
+	existing, ok := st.Instances[instance.Name]
+	if !ok {
+		return ErrNotFound
+	}
+	instance.CreatedAt = existing.CreatedAt
+	instance.UpdatedAt = time.Now()
+	st.Instances[instance.Name] = cloneInstance(instance)
+	return nil
+}
+
+func (st *jsonState) DeleteInstance(name string) error {
+	delete(st.Instances, name)
+	return nil
+}
+
+func (st *jsonState) GetGlobalConfig() (*GlobalConfig, error) {
+	if st.GlobalConfig == nil {
+		return defaultGlobalConfig(), nil
+	}
+	cfg := *st.GlobalConfig
+	return &cfg, nil
+}
+
+func (st *jsonState) SetGlobalConfig(config *GlobalConfig) error {
+	cfg := *config
+	st.GlobalConfig = &cfg
+	return nil
+}
+
+func (st *jsonState) GetBaseConfig() (json.RawMessage, error) {
+	return cloneRaw(st.BaseConfig), nil
+}
+
+func (st *jsonState) SetBaseConfig(base json.RawMessage) error {
+	if len(base) == 0 {
+		st.BaseConfig = nil
+		return nil
+	}
+	st.BaseConfig = cloneRaw(base)
+	return nil
+}
+
+func (st *jsonState) clone() (*jsonState, error) {
+	cloned := &jsonState{
+		Routes:         make(map[string]*Route, len(st.Routes)),
+		Servers:        make(map[string]*Server, len(st.Servers)),
+		Instances:      make(map[string]*Instance, len(st.Instances)),
+		BaseConfig:     cloneRaw(st.BaseConfig),
+		NextRevisionID: st.NextRevisionID,
+		Users:          make(map[string]*User, len(st.Users)),
+		Sessions:       make(map[string]*Session, len(st.Sessions)),
+		APITokens:      make(map[string]*APIToken, len(st.APITokens)),
+	}
+	if st.GlobalConfig != nil {
+		cfg := *st.GlobalConfig
+		cloned.GlobalConfig = &cfg
+	}
+	for id, r := range st.Routes {
+		route, err := cloneRoute(r)
+		if err != nil {
+			return nil, err
+		}
+		cloned.Routes[id] = route
+	}
+	for name, s := range st.Servers {
+		cloned.Servers[name] = cloneServer(s)
+	}
+	for name, i := range st.Instances {
+		cloned.Instances[name] = cloneInstance(i)
+	}
+	// Users, sessions and tokens are replaced rather than modified in
+	// place, so the pointers can be shared like revisions
+	maps.Copy(cloned.Users, st.Users)
+	maps.Copy(cloned.Sessions, st.Sessions)
+	maps.Copy(cloned.APITokens, st.APITokens)
+	// Stored revisions and audit events are immutable, so they can be shared
+	cloned.Revisions = append([]*Revision(nil), st.Revisions...)
+	cloned.AuditEvents = append([]*AuditEvent(nil), st.AuditEvents...)
+	cloned.NextAuditID = st.NextAuditID
+	return cloned, nil
+}
+
+func (st *jsonState) encode() ([]byte, error) {
+	var routes []*Route
+	for _, r := range st.Routes {
+		routes = append(routes, r)
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].ID < routes[j].ID })
+
+	routesJSON, err := marshalRouteSnapshot(routes)
+	if err != nil {
+		return nil, err
+	}
+
+	file := jsonFile{jsonState: st, Routes: routesJSON, Revisions: []jsonRevision{}}
+	for _, rev := range st.Revisions {
+		revRoutes, err := marshalRouteSnapshot(rev.Routes)
+		if err != nil {
+			return nil, err
+		}
+		file.Revisions = append(file.Revisions, jsonRevision{Revision: rev, Routes: revRoutes})
+	}
+	for _, u := range st.Users {
+		file.Users = append(file.Users, jsonUser{User: u, PasswordHash: u.PasswordHash})
+	}
+	sort.Slice(file.Users, func(i, j int) bool { return file.Users[i].Username < file.Users[j].Username })
+	for _, t := range st.APITokens {
+		file.APITokens = append(file.APITokens, jsonAPIToken{APIToken: t, TokenHash: t.TokenHash})
+	}
+	sort.Slice(file.APITokens, func(i, j int) bool { return file.APITokens[i].ID < file.APITokens[j].ID })
+	return json.Marshal(file)
+}
+
+func decodeJSONState(data []byte) (*jsonState, error) {
+	file := jsonFile{jsonState: &jsonState{}}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+
+	st := file.jsonState
+	st.Routes = make(map[string]*Route)
+	if st.Servers == nil {
+		st.Servers = make(map[string]*Server)
+	}
+	if st.Instances == nil {
+		st.Instances = make(map[string]*Instance)
+	}
+	if st.Sessions == nil {
+		st.Sessions = make(map[string]*Session)
+	}
+	st.Users = make(map[string]*User, len(file.Users))
+	for _, ju := range file.Users {
+		if ju.User == nil {
+			continue
+		}
+		ju.User.PasswordHash = ju.PasswordHash
+		st.Users[ju.Username] = ju.User
+	}
+	st.APITokens = make(map[string]*APIToken, len(file.APITokens))
+	for _, jt := range file.APITokens {
+		if jt.APIToken == nil {
+			continue
+		}
+		jt.APIToken.TokenHash = jt.TokenHash
+		st.APITokens[jt.ID] = jt.APIToken
+	}
+	if len(file.Routes) > 0 {
+		routes, err := unmarshalRouteSnapshot(file.Routes)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range routes {
+			st.Routes[r.ID] = r
+		}
+	}
+
+	for _, jr := range file.Revisions {
+		if jr.Revision == nil {
+			continue
+		}
+		routes, err := unmarshalRouteSnapshot(jr.Routes)
+		if err != nil {
+			return nil, err
+		}
+		jr.Revision.Routes = routes
+		st.Revisions = append(st.Revisions, jr.Revision)
+	}
+	if st.NextRevisionID == 0 {
+		st.NextRevisionID = 1
+	}
+	return st, nil
+}
+
+// cloneRoute deep-copies a route. Raw JSON fields are copied byte for byte
+// rather than re-encoded, so they come back exactly as they were stored.
+func cloneRoute(r *Route) (*Route, error) {
+	cloned := *r
+	cloned.Config = cloneRaw(r.Config)
+	cloned.RawCaddyRoute = cloneRaw(r.RawCaddyRoute)
+	if r.Headers != nil {
+		data, err := json.Marshal(r.Headers)
+		if err != nil {
+			return nil, err
+		}
+		cloned.Headers = &HeaderConfig{}
+		if err := json.Unmarshal(data, cloned.Headers); err != nil {
+			return nil, err
+		}
+	}
+	if r.BasicAuth != nil {
+		auth := *r.BasicAuth
+		auth.Users = append([]BasicAuthUser(nil), r.BasicAuth.Users...)
+		cloned.BasicAuth = &auth
+	}
+	cloned.Instances = append([]string(nil), r.Instances...)
+	return &cloned, nil
+}
+
+func cloneServer(s *Server) *Server {
+	cloned := *s
+	cloned.Listen = append([]string(nil), s.Listen...)
+	cloned.Protocols = append([]string(nil), s.Protocols...)
+	if s.AutomaticHTTPS != nil {
+		auto := *s.AutomaticHTTPS
+		auto.Skip = append([]string(nil), s.AutomaticHTTPS.Skip...)
+		auto.SkipCertificates = append([]string(nil), s.AutomaticHTTPS.SkipCertificates...)
+		cloned.AutomaticHTTPS = &auto
+	}
+	return &cloned
+}
+
+func cloneInstance(i *Instance) *Instance {
+	cloned := *i
+	if i.Labels != nil {
+		cloned.Labels = make(map[string]string, len(i.Labels))
+		for k, v := range i.Labels {
+			cloned.Labels[k] = v
+		}
+	}
+	return &cloned
+}
+
+func cloneUser(u *User) *User {
+	cloned := *u
+	cloned.Domains = append([]string(nil), u.Domains...)
+	return &cloned
+}
+
+func cloneRaw(raw json.RawMessage) json.RawMessage {
+	if raw == nil {
+		return nil
+	}
+	return append(json.RawMessage{}, raw...)
+}
+
+func cloneRevision(rev *Revision) (*Revision, error) {
+	cloned := *rev
+	cloned.Config = cloneRaw(rev.Config)
+	cloned.Routes = make([]*Route, 0, len(rev.Routes))
+	for _, r := range rev.Routes {
+		route, err := cloneRoute(r)
+		if err != nil {
+			return nil, err
+		}
+		cloned.Routes = append(cloned.Routes, route)
+	}
+	return &cloned, nil
+}
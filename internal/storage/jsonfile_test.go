@@ -0,0 +1,311 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setupTestJSON creates a JSON storage backed by a temporary file
+func setupTestJSON(t *testing.T) (*JSONStorage, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "routes.json")
+	storage, err := NewJSONStorage(path)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	return storage, path
+}
+
+func TestJSONStorage_RouteCRUD(t *testing.T) {
+	storage, err := NewJSONStorage("")
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+
+	route := &Route{
+		Domain:      "b.example.com",
+		HandlerType: "reverse_proxy",
+		Config:      json.RawMessage(`{"upstreams":["localhost:8080"]}`),
+		Enabled:     true,
+	}
+	if err := storage.CreateRoute(route); err != nil {
+		t.Fatalf("Failed to create route: %v", err)
+	}
+	if route.ID == "" || route.CreatedAt.IsZero() {
+		t.Fatal("Expected ID and CreatedAt to be set")
+	}
+	storage.CreateRoute(&Route{Domain: "a.example.com", HandlerType: "static_response", Config: json.RawMessage(`{}`)})
+
+	routes, _ := storage.ListRoutes()
+	if len(routes) != 2 || routes[0].Domain != "a.example.com" {
+		t.Fatalf("Expected 2 routes sorted by domain, got %+v", routes)
+	}
+
+	// Returned routes are copies
+	routes[1].Domain = "changed.example.com"
+	got, err := storage.GetRoute(route.ID)
+	if err != nil {
+		t.Fatalf("Failed to get route: %v", err)
+	}
+	if got.Domain != "b.example.com" {
+		t.Errorf("Expected stored route to be unaffected, got %s", got.Domain)
+	}
+
+	got.Enabled = false
+	if err := storage.UpdateRoute(got); err != nil {
+		t.Fatalf("Failed to update route: %v", err)
+	}
+	got, _ = storage.GetRoute(route.ID)
+	if got.Enabled || !got.CreatedAt.Equal(route.CreatedAt) {
+		t.Errorf("Expected update to keep CreatedAt and disable route, got %+v", got)
+	}
+
+	storage.DeleteRoute(route.ID)
+	if _, err := storage.GetRoute(route.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestJSONStorage_RouteVersions(t *testing.T) {
+	storage, _ := setupTestJSON(t)
+	testRouteVersions(t, storage)
+}
+
+func TestJSONStorage_BaseConfig(t *testing.T) {
+	storage, _ := setupTestJSON(t)
+	testBaseConfig(t, storage)
+}
+
+func TestJSONStorage_Servers(t *testing.T) {
+	storage, path := setupTestJSON(t)
+	testServers(t, storage)
+
+	storage.CreateServer(&Server{Name: "srv0", Listen: []string{":80"}, Protocols: []string{"h1"}})
+	reopened, err := NewJSONStorage(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen storage: %v", err)
+	}
+	server, err := reopened.GetServer("srv0")
+	if err != nil || server.Listen[0] != ":80" || server.Protocols[0] != "h1" {
+		t.Errorf("Expected server to survive reload, got %+v / %v", server, err)
+	}
+}
+
+func TestJSONStorage_Instances(t *testing.T) {
+	storage, path := setupTestJSON(t)
+	testInstances(t, storage)
+
+	reopened, err := NewJSONStorage(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen storage: %v", err)
+	}
+	instance, err := reopened.GetInstance("edge-1")
+	if err != nil || instance.AdminURL != "http://10.0.0.2:2019" {
+		t.Errorf("Expected instance to survive reload, got %+v / %v", instance, err)
+	}
+}
+
+func TestJSONStorage_Users(t *testing.T) {
+	storage, path := setupTestJSON(t)
+	testUsers(t, storage)
+
+	storage.CreateAPIToken(&APIToken{Name: "ci", Username: "bob", TokenHash: HashToken("secret")})
+	reopened, err := NewJSONStorage(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen storage: %v", err)
+	}
+	user, err := reopened.GetUser("bob")
+	if err != nil || user.PasswordHash == "" {
+		t.Errorf("Expected user with password hash to survive reload, got %+v / %v", user, err)
+	}
+	if _, err := reopened.GetAPIToken(HashToken("secret")); err != nil {
+		t.Errorf("Expected API token to survive reload, got %v", err)
+	}
+}
+
+func TestJSONStorage_AuditEvents(t *testing.T) {
+	storage, path := setupTestJSON(t)
+	testAuditEvents(t, storage)
+
+	reopened, err := NewJSONStorage(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen storage: %v", err)
+	}
+	events, _ := reopened.ListAuditEvents(AuditFilter{})
+	if len(events) != 3 || string(events[2].After) != `{"domain":"a.com"}` {
+		t.Errorf("Expected audit events to survive reload, got %+v", events)
+	}
+	next := &AuditEvent{Actor: "alice", Action: "sync", Outcome: AuditOutcomeSuccess}
+	reopened.CreateAuditEvent(next)
+	if next.ID != events[0].ID+1 {
+		t.Errorf("Expected IDs to continue after reload, got %d", next.ID)
+	}
+}
+
+func TestJSONStorage_Persistence(t *testing.T) {
+	storage, path := setupTestJSON(t)
+
+	route := &Route{
+		Domain:        "example.com",
+		HandlerType:   "reverse_proxy",
+		Config:        json.RawMessage(`{"upstreams":["localhost:8080"]}`),
+		RawCaddyRoute: json.RawMessage(`{"handle":[{"handler":"custom"}]}`),
+		BasicAuth:     &BasicAuthConfig{Enabled: true, Users: []BasicAuthUser{{Username: "admin", Password: "secret"}}},
+		Enabled:       true,
+	}
+	storage.CreateRoute(route)
+	storage.SetGlobalConfig(&GlobalConfig{CaddyAdminURL: "http://caddy:2019", DriftPolicy: DriftPolicyReconcile})
+	storage.CreateRevision(&Revision{Action: RevisionActionSync, Config: json.RawMessage(`{"apps":{}}`), Routes: []*Route{route}})
+	storage.Close()
+
+	reopened, err := NewJSONStorage(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen storage: %v", err)
+	}
+
+	got, err := reopened.GetRoute(route.ID)
+	if err != nil {
+		t.Fatalf("Failed to get route: %v", err)
+	}
+	if string(got.RawCaddyRoute) != `{"handle":[{"handler":"custom"}]}` {
+		t.Errorf("Expected RawCaddyRoute to survive reload, got %s", got.RawCaddyRoute)
+	}
+	if got.BasicAuth == nil || !IsBcryptHash(got.BasicAuth.Users[0].Password) {
+		t.Errorf("Expected hashed basic auth password, got %+v", got.BasicAuth)
+	}
+
+	cfg, _ := reopened.GetGlobalConfig()
+	if cfg.CaddyAdminURL != "http://caddy:2019" || cfg.DriftPolicy != DriftPolicyReconcile {
+		t.Errorf("Unexpected global config: %+v", cfg)
+	}
+
+	rev, err := reopened.GetRevision(1)
+	if err != nil {
+		t.Fatalf("Failed to get revision: %v", err)
+	}
+	if len(rev.Routes) != 1 || string(rev.Routes[0].RawCaddyRoute) == "" {
+		t.Errorf("Expected revision route snapshot with raw route, got %+v", rev.Routes)
+	}
+
+	// IDs keep counting from where they left off
+	next := &Revision{Action: RevisionActionSync}
+	reopened.CreateRevision(next)
+	if next.ID != 2 {
+		t.Errorf("Expected revision ID 2, got %d", next.ID)
+	}
+}
+
+func TestJSONStorage_Revisions(t *testing.T) {
+	storage, _ := setupTestJSON(t)
+
+	for _, action := range []string{RevisionActionSync, RevisionActionCreateRoute, RevisionActionRollback} {
+		storage.CreateRevision(&Revision{Action: action, Config: json.RawMessage(`{}`)})
+	}
+
+	list, _ := storage.ListRevisions(2)
+	if len(list) != 2 || list[0].Action != RevisionActionRollback || list[0].Config != nil {
+		t.Errorf("Expected 2 newest summaries without config, got %+v", list)
+	}
+	if all, _ := storage.ListRevisions(-1); len(all) != 3 {
+		t.Errorf("Expected all 3 revisions for a negative limit, got %d", len(all))
+	}
+
+	if _, err := storage.GetRevision(42); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestJSONStorage_PrunesHistory(t *testing.T) {
+	storage, _ := NewJSONStorage("")
+
+	for range jsonMaxRevisions + 5 {
+		storage.CreateRevision(&Revision{Action: RevisionActionSync})
+	}
+	for range jsonMaxAuditEvents + 5 {
+		storage.CreateAuditEvent(&AuditEvent{Actor: "alice", Action: "sync", Outcome: AuditOutcomeSuccess})
+	}
+
+	revisions, _ := storage.ListRevisions(-1)
+	if len(revisions) != jsonMaxRevisions || revisions[0].ID != jsonMaxRevisions+5 {
+		t.Errorf("Expected the newest %d revisions, got %d", jsonMaxRevisions, len(revisions))
+	}
+	if _, err := storage.GetRevision(5); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected the oldest revisions to be dropped, got %v", err)
+	}
+	events, _ := storage.ListAuditEvents(AuditFilter{})
+	if len(events) != jsonMaxAuditEvents || events[len(events)-1].ID != 6 {
+		t.Errorf("Expected the newest %d audit events, got %d", jsonMaxAuditEvents, len(events))
+	}
+}
+
+func TestJSONStorage_FileMode(t *testing.T) {
+	storage, path := setupTestJSON(t)
+	storage.CreateUser(&User{Username: "admin", PasswordHash: "hash"})
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat storage file: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the storage file to be private, got %v", info.Mode().Perm())
+	}
+}
+
+func TestJSONStorage_WithTxRollback(t *testing.T) {
+	storage, path := setupTestJSON(t)
+	storage.CreateRoute(&Route{ID: "keep", Domain: "keep.example.com", HandlerType: "reverse_proxy"})
+
+	err := storage.WithTx(func(tx RouteStore) error {
+		tx.DeleteRoute("keep")
+		tx.CreateRoute(&Route{Domain: "new.example.com", HandlerType: "reverse_proxy"})
+		return errors.New("boom")
+	})
+	if err == nil {
+		t.Fatal("Expected error from WithTx")
+	}
+
+	routes, _ := storage.ListRoutes()
+	if len(routes) != 1 || routes[0].ID != "keep" {
+		t.Errorf("Expected transaction to be discarded, got %+v", routes)
+	}
+
+	// Nothing from the failed transaction reached disk either
+	data, _ := os.ReadFile(path)
+	reopened, err := NewJSONStorage(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen storage: %v (file: %s)", err, data)
+	}
+	routes, _ = reopened.ListRoutes()
+	if len(routes) != 1 {
+		t.Errorf("Expected 1 route on disk, got %d", len(routes))
+	}
+}
+
+func TestOpen(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := Open(BackendJSON, filepath.Join(dir, "routes.json"))
+	if err != nil {
+		t.Fatalf("Failed to open json backend: %v", err)
+	}
+	if _, ok := store.(*JSONStorage); !ok {
+		t.Errorf("Expected *JSONStorage, got %T", store)
+	}
+
+	store, err = Open("", filepath.Join(dir, "routes.db"))
+	if err != nil {
+		t.Fatalf("Failed to open default backend: %v", err)
+	}
+	defer store.Close()
+	if _, ok := store.(*SQLiteStorage); !ok {
+		t.Errorf("Expected *SQLiteStorage, got %T", store)
+	}
+
+	if _, err := Open("bbolt", ""); err == nil {
+		t.Error("Expected error for unknown backend")
+	}
+}
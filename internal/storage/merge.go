@@ -0,0 +1,301 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Import modes
+const (
+	ImportModeReplace = "replace"
+	ImportModeMerge   = "merge"
+)
+
+// ImportPlan lists what an import will do to the route table
+type ImportPlan struct {
+	Create    []*Route `json:"create"`
+	Update    []*Route `json:"update"`
+	Unchanged []*Route `json:"unchanged"`
+	Delete    []*Route `json:"delete"`
+	Keep      []*Route `json:"keep"`
+}
+
+// ImportResult reports the outcome of applying an ImportPlan
+type ImportResult struct {
+	Created int            `json:"created"`
+	Updated int            `json:"updated"`
+	Skipped int            `json:"skipped"`
+	Deleted int            `json:"deleted"`
+	Failed  int            `json:"failed"`
+	Details []ImportDetail `json:"details"`
+}
+
+// ImportDetail describes what happened to a single route during an import
+type ImportDetail struct {
+	RouteID string `json:"route_id,omitempty"`
+	Domain  string `json:"domain"`
+	Path    string `json:"path,omitempty"`
+	Action  string `json:"action"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// Import detail actions
+const (
+	ImportActionCreated = "created"
+	ImportActionUpdated = "updated"
+	ImportActionSkipped = "skipped"
+	ImportActionDeleted = "deleted"
+	ImportActionFailed  = "failed"
+)
+
+// RouteKey identifies a route by its normalized domain list and path.
+// Imports use it to match incoming routes against existing ones.
+func RouteKey(r *Route) string {
+	var hosts []string
+	for _, h := range strings.Split(r.Domain, ",") {
+		h = strings.ToLower(strings.TrimSpace(h))
+		if h != "" {
+			hosts = append(hosts, h)
+		}
+	}
+	sort.Strings(hosts)
+
+	path := strings.TrimSpace(r.Path)
+	if path != "" && !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	return strings.Join(hosts, ",") + "|" + path
+}
+
+// PlanReplace plans an import that deletes every existing route and
+// inserts all incoming ones
+func PlanReplace(existing, incoming []*Route) *ImportPlan {
+	return &ImportPlan{
+		Create: incoming,
+		Delete: existing,
+	}
+}
+
+// PlanMerge matches incoming routes against existing ones by ID, then by
+// RouteKey. Matched routes keep their existing ID and are updated only if
+// something changed; unmatched incoming routes are created. Existing routes
+// without a match are kept when keepLocal is set and deleted otherwise.
+func PlanMerge(existing, incoming []*Route, keepLocal bool) *ImportPlan {
+	return planMatched(existing, incoming, keepLocal, true)
+}
+
+// PlanApply plans making incoming the whole route table, as a manifest
+// does. Routes are matched as in PlanMerge, but keep the instances given
+// in incoming, and existing routes without a match are deleted.
+func PlanApply(existing, incoming []*Route) *ImportPlan {
+	return planMatched(existing, incoming, false, false)
+}
+
+// planMatched implements PlanMerge and PlanApply. keepInstances carries
+// the instances of existing routes over to the incoming ones they match.
+func planMatched(existing, incoming []*Route, keepLocal, keepInstances bool) *ImportPlan {
+	plan := &ImportPlan{}
+
+	// Several routes can share a key; match them one-to-one in order
+	byID := make(map[string]*Route)
+	byKey := make(map[string][]*Route)
+	for _, r := range existing {
+		byID[r.ID] = r
+		k := RouteKey(r)
+		byKey[k] = append(byKey[k], r)
+	}
+	matched := make(map[string]bool)
+
+	// Routes imported from Caddy carry the ID they were synced with, which
+	// still matches after their domain or path was changed there
+	matches := make([]*Route, len(incoming))
+	for i, in := range incoming {
+		if r, ok := byID[in.ID]; ok && in.ID != "" && !matched[r.ID] {
+			matches[i] = r
+			matched[r.ID] = true
+		}
+	}
+	for i, in := range incoming {
+		if matches[i] != nil {
+			continue
+		}
+		k := RouteKey(in)
+		for len(byKey[k]) > 0 && matched[byKey[k][0].ID] {
+			byKey[k] = byKey[k][1:]
+		}
+		if len(byKey[k]) > 0 {
+			matches[i] = byKey[k][0]
+			byKey[k] = byKey[k][1:]
+			matched[matches[i].ID] = true
+		}
+	}
+
+	for i, in := range incoming {
+		current := matches[i]
+		if current == nil {
+			if _, taken := byID[in.ID]; taken {
+				// The ID belongs to another route; let the store pick one
+				in.ID = ""
+			}
+			plan.Create = append(plan.Create, in)
+			continue
+		}
+
+		in.ID = current.ID
+		in.CreatedAt = current.CreatedAt
+		if keepInstances {
+			// Caddy's config doesn't say which instances a route belongs to
+			in.Instances = current.Instances
+		}
+		if RoutesEqual(current, in) {
+			plan.Unchanged = append(plan.Unchanged, current)
+		} else {
+			plan.Update = append(plan.Update, in)
+		}
+	}
+
+	for _, r := range existing {
+		if matched[r.ID] {
+			continue
+		}
+		if keepLocal {
+			plan.Keep = append(plan.Keep, r)
+		} else {
+			plan.Delete = append(plan.Delete, r)
+		}
+	}
+
+	return plan
+}
+
+// RoutesEqual reports whether two routes have the same user-visible
+// configuration. IDs and timestamps are ignored.
+func RoutesEqual(a, b *Route) bool {
+	return len(RouteDiff(a, b)) == 0
+}
+
+// RouteDiff lists the JSON names of the fields that differ between two
+// routes, with "raw_caddy_route" for the stored Caddy JSON. IDs, versions
+// and timestamps are ignored.
+func RouteDiff(a, b *Route) []string {
+	var fields []string
+	diff := func(name string, differs bool) {
+		if differs {
+			fields = append(fields, name)
+		}
+	}
+	diff("domain", a.Domain != b.Domain)
+	diff("path", a.Path != b.Path)
+	diff("handler_type", a.HandlerType != b.HandlerType)
+	diff("config", !jsonEqual(a.Config, b.Config))
+	diff("headers", !jsonEqual(a.Headers, b.Headers))
+	diff("basic_auth", !jsonEqual(a.BasicAuth, b.BasicAuth))
+	diff("strip_path_prefix", a.StripPathPrefix != b.StripPathPrefix)
+	diff("server", a.Server != b.Server)
+	diff("instances", !slices.Equal(a.Instances, b.Instances))
+	diff("enabled", a.Enabled != b.Enabled)
+	diff("raw_caddy_route", !jsonEqual(a.RawCaddyRoute, b.RawCaddyRoute))
+	return fields
+}
+
+// jsonEqual compares two values by their compacted JSON encoding
+func jsonEqual(a, b any) bool {
+	ja, errA := canonicalJSON(a)
+	jb, errB := canonicalJSON(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	return bytes.Equal(ja, jb)
+}
+
+func canonicalJSON(v any) ([]byte, error) {
+	var data []byte
+	switch t := v.(type) {
+	case json.RawMessage:
+		data = t
+	default:
+		var err error
+		if data, err = json.Marshal(v); err != nil {
+			return nil, err
+		}
+	}
+	if len(data) == 0 || string(data) == "null" {
+		return nil, nil
+	}
+
+	// Round-trip through any so map keys are sorted
+	var decoded any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, err
+	}
+	return json.Marshal(decoded)
+}
+
+// ApplyImport applies an import plan to rs. Per-route failures are recorded
+// in the result instead of aborting; run it inside WithTx so the whole
+// import is written atomically.
+func ApplyImport(rs RouteStore, plan *ImportPlan) *ImportResult {
+	result := &ImportResult{Details: []ImportDetail{}}
+	record := func(r *Route, action, reason string, err error) {
+		detail := ImportDetail{RouteID: r.ID, Domain: r.Domain, Path: r.Path, Action: action, Reason: reason}
+		if err != nil {
+			detail.Action = ImportActionFailed
+			detail.Reason = err.Error()
+		}
+		switch detail.Action {
+		case ImportActionCreated:
+			result.Created++
+		case ImportActionUpdated:
+			result.Updated++
+		case ImportActionDeleted:
+			result.Deleted++
+		case ImportActionSkipped:
+			result.Skipped++
+		case ImportActionFailed:
+			result.Failed++
+		}
+		result.Details = append(result.Details, detail)
+	}
+
+	// Deletes first so replaced routes can't collide with new ones
+	for _, r := range plan.Delete {
+		record(r, ImportActionDeleted, "", rs.DeleteRoute(r.ID))
+	}
+	for _, r := range plan.Update {
+		err := validateImportedRoute(r)
+		if err == nil {
+			err = rs.UpdateRoute(r)
+		}
+		record(r, ImportActionUpdated, "", err)
+	}
+	for _, r := range plan.Create {
+		err := validateImportedRoute(r)
+		if err == nil {
+			err = rs.CreateRoute(r)
+		}
+		record(r, ImportActionCreated, "", err)
+	}
+	for _, r := range plan.Unchanged {
+		record(r, ImportActionSkipped, "unchanged", nil)
+	}
+	for _, r := range plan.Keep {
+		record(r, ImportActionSkipped, "not present in import, kept", nil)
+	}
+
+	return result
+}
+
+func validateImportedRoute(r *Route) error {
+	if r.Domain == "" {
+		return errors.New("domain is required")
+	}
+	if r.HandlerType == "" {
+		return errors.New("handler_type is required")
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRouteKey(t *testing.T) {
+	tests := []struct {
+		a, b  *Route
+		equal bool
+	}{
+		{&Route{Domain: "example.com", Path: "/api"}, &Route{Domain: "example.com", Path: "api"}, true},
+		{&Route{Domain: "b.com, a.com"}, &Route{Domain: "A.com,b.com"}, true},
+		{&Route{Domain: "example.com", Path: "/api"}, &Route{Domain: "example.com"}, false},
+		{&Route{Domain: "a.com"}, &Route{Domain: "b.com"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := RouteKey(tt.a) == RouteKey(tt.b); got != tt.equal {
+			t.Errorf("RouteKey(%q %q) == RouteKey(%q %q): expected %v", tt.a.Domain, tt.a.Path, tt.b.Domain, tt.b.Path, tt.equal)
+		}
+	}
+}
+
+func TestPlanMerge(t *testing.T) {
+	existing := []*Route{
+		{ID: "same", Domain: "same.com", HandlerType: "reverse_proxy", Config: json.RawMessage(`{"upstreams":["a:1"]}`), Enabled: true},
+		{ID: "changed", Domain: "changed.com", HandlerType: "reverse_proxy", Config: json.RawMessage(`{"upstreams":["a:1"]}`), Enabled: true},
+		{ID: "local", Domain: "local.com", HandlerType: "reverse_proxy", Config: json.RawMessage(`{}`), Enabled: true},
+	}
+	incoming := func() []*Route {
+		return []*Route{
+			{ID: "new-1", Domain: "same.com", HandlerType: "reverse_proxy", Config: json.RawMessage(`{ "upstreams": ["a:1"] }`), Enabled: true},
+			{ID: "new-2", Domain: "changed.com", HandlerType: "reverse_proxy", Config: json.RawMessage(`{"upstreams":["b:1"]}`), Enabled: true},
+			{ID: "new-3", Domain: "fresh.com", HandlerType: "file_server", Config: json.RawMessage(`{}`), Enabled: true},
+		}
+	}
+
+	t.Run("keep local", func(t *testing.T) {
+		plan := PlanMerge(existing, incoming(), true)
+
+		if len(plan.Unchanged) != 1 || plan.Unchanged[0].ID != "same" {
+			t.Errorf("Expected same.com unchanged, got %+v", plan.Unchanged)
+		}
+		if len(plan.Update) != 1 || plan.Update[0].ID != "changed" {
+			t.Errorf("Expected changed.com updated with existing ID, got %+v", plan.Update)
+		}
+		if len(plan.Create) != 1 || plan.Create[0].ID != "new-3" {
+			t.Errorf("Expected fresh.com created, got %+v", plan.Create)
+		}
+		if len(plan.Keep) != 1 || plan.Keep[0].ID != "local" {
+			t.Errorf("Expected local.com kept, got %+v", plan.Keep)
+		}
+		if len(plan.Delete) != 0 {
+			t.Errorf("Expected no deletes, got %+v", plan.Delete)
+		}
+	})
+
+	t.Run("drop local", func(t *testing.T) {
+		plan := PlanMerge(existing, incoming(), false)
+
+		if len(plan.Delete) != 1 || plan.Delete[0].ID != "local" {
+			t.Errorf("Expected local.com deleted, got %+v", plan.Delete)
+		}
+		if len(plan.Keep) != 0 {
+			t.Errorf("Expected nothing kept, got %+v", plan.Keep)
+		}
+	})
+}
+
+func TestPlanMerge_DuplicateKeys(t *testing.T) {
+	existing := []*Route{
+		{ID: "first", Domain: "dup.com", HandlerType: "reverse_proxy", Config: json.RawMessage(`{}`), Enabled: true},
+	}
+	incoming := []*Route{
+		{Domain: "dup.com", HandlerType: "reverse_proxy", Config: json.RawMessage(`{}`), Enabled: true},
+		{Domain: "dup.com", HandlerType: "file_server", Config: json.RawMessage(`{}`), Enabled: true},
+	}
+
+	plan := PlanMerge(existing, incoming, true)
+	if len(plan.Unchanged) != 1 || len(plan.Create) != 1 {
+		t.Errorf("Expected one match and one create, got unchanged=%d create=%d", len(plan.Unchanged), len(plan.Create))
+	}
+}
+
+func TestPlanMerge_MatchesByID(t *testing.T) {
+	existing := []*Route{
+		{ID: "moved", Domain: "old.com", HandlerType: "reverse_proxy", Config: json.RawMessage(`{}`), Enabled: true},
+		{ID: "other", Domain: "other.com", HandlerType: "reverse_proxy", Config: json.RawMessage(`{}`), Enabled: true},
+	}
+	incoming := []*Route{
+		{ID: "moved", Domain: "new.com", HandlerType: "reverse_proxy", Config: json.RawMessage(`{}`), Enabled: true},
+		{ID: "moved", Domain: "copy.com", HandlerType: "reverse_proxy", Config: json.RawMessage(`{}`), Enabled: true},
+	}
+
+	plan := PlanMerge(existing, incoming, true)
+	if len(plan.Update) != 1 || plan.Update[0].ID != "moved" || plan.Update[0].Domain != "new.com" {
+		t.Errorf("Expected the route to be matched by ID, got %+v", plan.Update)
+	}
+	if len(plan.Create) != 1 || plan.Create[0].ID != "" {
+		t.Errorf("Expected a create without the taken ID, got %+v", plan.Create)
+	}
+	if len(plan.Keep) != 1 || plan.Keep[0].ID != "other" {
+		t.Errorf("Expected other.com kept, got %+v", plan.Keep)
+	}
+}
+
+func TestPlanApply(t *testing.T) {
+	existing := []*Route{
+		{ID: "edge", Domain: "edge.com", HandlerType: "redir", Config: json.RawMessage(`{"to":"/"}`), Instances: []string{"edge-1"}, Enabled: true},
+		{ID: "gone", Domain: "gone.com", HandlerType: "redir", Config: json.RawMessage(`{"to":"/"}`), Enabled: true},
+	}
+	incoming := []*Route{
+		{Domain: "edge.com", HandlerType: "redir", Config: json.RawMessage(`{"to":"/"}`), Instances: []string{"edge-2"}, Enabled: true},
+	}
+
+	plan := PlanApply(existing, incoming)
+	if len(plan.Update) != 1 || plan.Update[0].ID != "edge" || plan.Update[0].Instances[0] != "edge-2" {
+		t.Errorf("Expected edge.com moved to edge-2, got %+v", plan.Update)
+	}
+	if len(plan.Delete) != 1 || plan.Delete[0].ID != "gone" || len(plan.Keep) != 0 {
+		t.Errorf("Expected gone.com deleted, got delete=%+v keep=%+v", plan.Delete, plan.Keep)
+	}
+}
+
+func TestRoutesEqual(t *testing.T) {
+	base := &Route{
+		Domain:      "example.com",
+		HandlerType: "reverse_proxy",
+		Config:      json.RawMessage(`{"upstreams":["a:1"],"websocket":true}`),
+		Headers:     &HeaderConfig{Set: map[string]string{"X-A": "1"}},
+		Enabled:     true,
+	}
+
+	same := *base
+	same.ID = "other"
+	same.Config = json.RawMessage(`{"websocket":true,"upstreams":["a:1"]}`)
+	if !RoutesEqual(base, &same) {
+		t.Error("Expected routes differing only in ID and key order to be equal")
+	}
+
+	changed := *base
+	changed.Headers = &HeaderConfig{Set: map[string]string{"X-A": "2"}}
+	if RoutesEqual(base, &changed) {
+		t.Error("Expected routes with different headers to differ")
+	}
+
+	changed.Enabled = false
+	if diff := RouteDiff(base, &changed); len(diff) != 2 || diff[0] != "headers" || diff[1] != "enabled" {
+		t.Errorf("Expected headers and enabled to differ, got %v", diff)
+	}
+}
@@ -0,0 +1,304 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// migration is a single numbered schema change. Each migration runs in its
+// own transaction together with the bookkeeping row in schema_migrations.
+type migration struct {
+	version int
+	name    string
+	up      func(tx *sql.Tx) error
+}
+
+// migrations lists every schema change in order. Never edit or reorder an
+// entry that has been released; append a new one instead.
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "create_routes_and_global_config",
+		up: execSQL(`
+			CREATE TABLE IF NOT EXISTS routes (
+				id TEXT PRIMARY KEY,
+				domain TEXT NOT NULL,
+				path TEXT DEFAULT '',
+				handler_type TEXT NOT NULL,
+				config TEXT NOT NULL,
+				enabled INTEGER DEFAULT 1,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			);
+
+			CREATE TABLE IF NOT EXISTS global_config (
+				key TEXT PRIMARY KEY,
+				value TEXT NOT NULL
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_routes_domain ON routes(domain);
+			CREATE INDEX IF NOT EXISTS idx_routes_enabled ON routes(enabled);
+		`),
+	},
+	{
+		version: 2,
+		name:    "add_routes_raw_caddy_route",
+		up:      addColumn("routes", "raw_caddy_route", "TEXT"),
+	},
+	{
+		version: 3,
+		name:    "add_routes_strip_path_prefix",
+		up:      addColumn("routes", "strip_path_prefix", "TEXT DEFAULT ''"),
+	},
+	{
+		version: 4,
+		name:    "add_routes_basic_auth",
+		up:      addColumn("routes", "basic_auth", "TEXT"),
+	},
+	{
+		version: 5,
+		name:    "add_routes_headers",
+		up:      addColumn("routes", "headers", "TEXT"),
+	},
+	{
+		version: 6,
+		name:    "create_revisions",
+		up: execSQL(`
+			CREATE TABLE revisions (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				action TEXT NOT NULL,
+				config TEXT NOT NULL,
+				routes TEXT NOT NULL,
+				route_count INTEGER NOT NULL DEFAULT 0,
+				created_at DATETIME NOT NULL
+			);
+		`),
+	},
+	{
+		version: 7,
+		name:    "add_routes_version",
+		up:      addColumn("routes", "version", "INTEGER NOT NULL DEFAULT 1"),
+	},
+	{
+		version: 8,
+		name:    "create_servers",
+		up: execSQL(`
+			CREATE TABLE servers (
+				name TEXT PRIMARY KEY,
+				listen TEXT NOT NULL,
+				protocols TEXT NOT NULL DEFAULT '',
+				automatic_https TEXT NOT NULL DEFAULT '',
+				created_at DATETIME NOT NULL,
+				updated_at DATETIME NOT NULL
+			);
+		`),
+	},
+	{
+		version: 9,
+		name:    "add_routes_server",
+		up:      addColumn("routes", "server", "TEXT NOT NULL DEFAULT ''"),
+	},
+	{
+		version: 10,
+		name:    "create_instances",
+		up: execSQL(`
+			CREATE TABLE instances (
+				name TEXT PRIMARY KEY,
+				admin_url TEXT NOT NULL,
+				labels TEXT NOT NULL DEFAULT '',
+				created_at DATETIME NOT NULL,
+				updated_at DATETIME NOT NULL
+			);
+		`),
+	},
+	{
+		version: 11,
+		name:    "add_routes_instances",
+		up:      addColumn("routes", "instances", "TEXT NOT NULL DEFAULT ''"),
+	},
+	{
+		version: 12,
+		name:    "add_revisions_instance",
+		up:      addColumn("revisions", "instance", "TEXT NOT NULL DEFAULT ''"),
+	},
+	{
+		version: 13,
+		name:    "create_users",
+		up: execSQL(`
+			CREATE TABLE users (
+				username TEXT PRIMARY KEY,
+				password_hash TEXT NOT NULL,
+				created_at DATETIME NOT NULL,
+				updated_at DATETIME NOT NULL
+			);
+			CREATE TABLE sessions (
+				token_hash TEXT PRIMARY KEY,
+				username TEXT NOT NULL,
+				created_at DATETIME NOT NULL,
+				expires_at DATETIME NOT NULL
+			);
+			CREATE TABLE api_tokens (
+				id TEXT PRIMARY KEY,
+				name TEXT NOT NULL,
+				username TEXT NOT NULL,
+				token_hash TEXT NOT NULL UNIQUE,
+				created_at DATETIME NOT NULL
+			);
+		`),
+	},
+	{
+		version: 14,
+		name:    "add_users_role",
+		// Users created before roles existed keep full access
+		up: func(tx *sql.Tx) error {
+			if err := addColumn("users", "role", "TEXT NOT NULL DEFAULT 'admin'")(tx); err != nil {
+				return err
+			}
+			return addColumn("users", "domains", "TEXT NOT NULL DEFAULT ''")(tx)
+		},
+	},
+	{
+		version: 15,
+		name:    "create_audit_events",
+		up: execSQL(`
+			CREATE TABLE audit_events (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				actor TEXT NOT NULL,
+				action TEXT NOT NULL,
+				route_id TEXT NOT NULL DEFAULT '',
+				target TEXT NOT NULL DEFAULT '',
+				before TEXT NOT NULL DEFAULT '',
+				after TEXT NOT NULL DEFAULT '',
+				outcome TEXT NOT NULL,
+				message TEXT NOT NULL DEFAULT '',
+				created_at DATETIME NOT NULL
+			);
+			CREATE INDEX idx_audit_events_route_id ON audit_events(route_id);
+			CREATE INDEX idx_audit_events_created_at ON audit_events(created_at);
+		`),
+	},
+}
+
+// migrate brings the schema up to date
+func (s *SQLiteStorage) migrate() error {
+	return s.runMigrations(migrations)
+}
+
+func (s *SQLiteStorage) runMigrations(list []migration) error {
+	_, err := s.db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at DATETIME NOT NULL
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	current, err := s.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	applied := 0
+	for _, m := range list {
+		if m.version <= current {
+			continue
+		}
+		if err := s.applyMigration(m); err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.name, err)
+		}
+		log.Printf("Applied database migration %d: %s", m.version, m.name)
+		current = m.version
+		applied++
+	}
+
+	if applied == 0 {
+		log.Printf("Database schema up to date (version %d)", current)
+	}
+	return nil
+}
+
+func (s *SQLiteStorage) applyMigration(m migration) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := m.up(tx); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+		m.version, m.name, time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SchemaVersion returns the highest applied migration version
+func (s *SQLiteStorage) SchemaVersion() (int, error) {
+	var version int
+	err := s.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
+
+func execSQL(query string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(query)
+		return err
+	}
+}
+
+// addColumn adds a column unless it already exists. Databases created before
+// versioned migrations may already have some of the columns.
+func addColumn(table, column, definition string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		exists, err := columnExists(tx, table, column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return nil
+		}
+		_, err = tx.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, definition))
+		return err
+	}
+}
+
+func columnExists(tx *sql.Tx, table, column string) (bool, error) {
+	rows, err := tx.Query(fmt.Sprintf(`PRAGMA table_info(%s)`, table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			colType    string
+			notNull    int
+			defaultVal sql.NullString
+			pk         int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultVal, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMigrate_FreshDatabase(t *testing.T) {
+	storage, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	version, err := storage.SchemaVersion()
+	if err != nil {
+		t.Fatalf("Failed to get schema version: %v", err)
+	}
+
+	latest := migrations[len(migrations)-1].version
+	if version != latest {
+		t.Errorf("Expected schema version %d, got %d", latest, version)
+	}
+
+	var count int
+	storage.db.QueryRow(`SELECT COUNT(*) FROM schema_migrations`).Scan(&count)
+	if count != len(migrations) {
+		t.Errorf("Expected %d recorded migrations, got %d", len(migrations), count)
+	}
+}
+
+func TestMigrate_Reopen(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+
+	first, err := NewSQLiteStorage(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	first.Close()
+
+	second, err := NewSQLiteStorage(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to reopen storage: %v", err)
+	}
+	defer second.Close()
+
+	var count int
+	second.db.QueryRow(`SELECT COUNT(*) FROM schema_migrations`).Scan(&count)
+	if count != len(migrations) {
+		t.Errorf("Expected migrations to run once, got %d records", count)
+	}
+}
+
+func TestMigrate_PreVersionedDatabase(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "legacy.db")
+
+	// Schema as left behind by the old ALTER TABLE based migrate()
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	_, err = db.Exec(`
+		CREATE TABLE routes (
+			id TEXT PRIMARY KEY,
+			domain TEXT NOT NULL,
+			path TEXT DEFAULT '',
+			handler_type TEXT NOT NULL,
+			config TEXT NOT NULL,
+			enabled INTEGER DEFAULT 1,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			raw_caddy_route TEXT,
+			strip_path_prefix TEXT DEFAULT ''
+		);
+		CREATE TABLE global_config (key TEXT PRIMARY KEY, value TEXT NOT NULL);
+	`)
+	db.Close()
+	if err != nil {
+		t.Fatalf("Failed to create legacy schema: %v", err)
+	}
+
+	storage, err := NewSQLiteStorage(dbPath)
+	if err != nil {
+		t.Fatalf("Expected legacy database to migrate, got: %v", err)
+	}
+	defer storage.Close()
+
+	version, _ := storage.SchemaVersion()
+	if version != migrations[len(migrations)-1].version {
+		t.Errorf("Expected legacy database at latest version, got %d", version)
+	}
+}
+
+func TestMigrate_FailureRollsBack(t *testing.T) {
+	storage, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	before, _ := storage.SchemaVersion()
+
+	failing := append([]migration{}, migrations...)
+	failing = append(failing, migration{
+		version: before + 1,
+		name:    "broken",
+		up: func(tx *sql.Tx) error {
+			if _, err := tx.Exec(`CREATE TABLE half_done (id TEXT)`); err != nil {
+				return err
+			}
+			return errors.New("boom")
+		},
+	})
+
+	err := storage.runMigrations(failing)
+	if err == nil {
+		t.Fatal("Expected migration failure to be reported")
+	}
+	if !strings.Contains(err.Error(), "broken") || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("Expected error to name the failed migration, got: %v", err)
+	}
+
+	after, _ := storage.SchemaVersion()
+	if after != before {
+		t.Errorf("Expected schema version to stay at %d, got %d", before, after)
+	}
+
+	var name string
+	err = storage.db.QueryRow(`SELECT name FROM sqlite_master WHERE type='table' AND name='half_done'`).Scan(&name)
+	if err != sql.ErrNoRows {
+		t.Errorf("Expected failed migration to be rolled back, got table %q (err %v)", name, err)
+	}
+}
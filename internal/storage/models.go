@@ -1,22 +1,49 @@
 package storage
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
 	"time"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
+// ErrNotFound is returned when a requested record does not exist
+var ErrNotFound = errors.New("not found")
+
+// ErrVersionConflict is returned by UpdateRoute when the route's version no
+// longer matches the stored one, i.e. someone else updated it first
+var ErrVersionConflict = errors.New("version conflict")
+
+// ErrServerExists is returned by CreateServer when the name is taken
+var ErrServerExists = errors.New("server already exists")
+
+// ErrInstanceExists is returned by CreateInstance when the name is taken
+var ErrInstanceExists = errors.New("instance already exists")
+
+// ErrUserExists is returned by CreateUser when the username is taken
+var ErrUserExists = errors.New("user already exists")
+
 // Route represents a single route configuration
 type Route struct {
-	ID              string          `json:"id"`
-	Domain          string          `json:"domain"`
-	Path            string          `json:"path,omitempty"`
-	HandlerType     string          `json:"handler_type"`
-	Config          json.RawMessage `json:"config"`
-	Headers         *HeaderConfig   `json:"headers,omitempty"`
-	StripPathPrefix string          `json:"strip_path_prefix,omitempty"`
-	Enabled         bool            `json:"enabled"`
-	CreatedAt       time.Time       `json:"created_at"`
-	UpdatedAt       time.Time       `json:"updated_at"`
+	ID              string           `json:"id"`
+	Domain          string           `json:"domain"`
+	Path            string           `json:"path,omitempty"`
+	HandlerType     string           `json:"handler_type"`
+	Config          json.RawMessage  `json:"config"`
+	Headers         *HeaderConfig    `json:"headers,omitempty"`
+	BasicAuth       *BasicAuthConfig `json:"basic_auth,omitempty"`
+	StripPathPrefix string           `json:"strip_path_prefix,omitempty"`
+	Server          string           `json:"server,omitempty"`
+	Instances       []string         `json:"instances,omitempty"`
+	Enabled         bool             `json:"enabled"`
+	Version         int64            `json:"version"`
+	CreatedAt       time.Time        `json:"created_at"`
+	UpdatedAt       time.Time        `json:"updated_at"`
 
 	// RawCaddyRoute stores the original Caddy route JSON for preserving
 	// unsupported handlers during round-trip sync.
@@ -24,6 +51,189 @@ type Route struct {
 	RawCaddyRoute json.RawMessage `json:"-"`
 }
 
+// DefaultServerName is the server routes without a Server are placed in
+const DefaultServerName = "srv0"
+
+// DefaultServerListen is used for the default server until one is stored
+var DefaultServerListen = []string{":443", ":80"}
+
+// Server is an HTTP server in Caddy's http app. Routes reference it by
+// Name, which is also its key under apps.http.servers.
+type Server struct {
+	Name           string                `json:"name"`
+	Listen         []string              `json:"listen"`
+	Protocols      []string              `json:"protocols,omitempty"`
+	AutomaticHTTPS *AutomaticHTTPSConfig `json:"automatic_https,omitempty"`
+	CreatedAt      time.Time             `json:"created_at"`
+	UpdatedAt      time.Time             `json:"updated_at"`
+}
+
+// AutomaticHTTPSConfig mirrors the automatic_https options of a Caddy server
+type AutomaticHTTPSConfig struct {
+	Disable                  bool     `json:"disable,omitempty"`
+	DisableRedirects         bool     `json:"disable_redirects,omitempty"`
+	DisableCertificates      bool     `json:"disable_certificates,omitempty"`
+	Skip                     []string `json:"skip,omitempty"`
+	SkipCertificates         []string `json:"skip_certificates,omitempty"`
+	IgnoreLoadedCertificates bool     `json:"ignore_loaded_certificates,omitempty"`
+}
+
+// Instance is a Caddy instance managed by this app. Routes list the
+// instances they are deployed to by Name; a route without any goes to all
+// of them.
+type Instance struct {
+	Name      string            `json:"name"`
+	AdminURL  string            `json:"admin_url"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// DeployedTo reports whether the route is deployed to the named instance
+func (r *Route) DeployedTo(instance string) bool {
+	return len(r.Instances) == 0 || slices.Contains(r.Instances, instance)
+}
+
+// User is a local account that can sign in to the management API and UI.
+// Domains optionally limits an editor to routes whose domain matches one
+// of the patterns, see CanManageDomain.
+type User struct {
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"-"`
+	Role         string    `json:"role"`
+	Domains      []string  `json:"domains,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// User roles, from least to most privileged. Viewers can only read,
+// editors can also change routes and sync, admins can do everything.
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+	RoleAdmin  = "admin"
+)
+
+// roleRanks orders the roles; unknown roles rank below viewer
+var roleRanks = map[string]int{RoleViewer: 1, RoleEditor: 2, RoleAdmin: 3}
+
+// ValidRole reports whether role is one of the known roles
+func ValidRole(role string) bool {
+	return roleRanks[role] > 0
+}
+
+// HasRole reports whether the user's role is role or a more privileged one
+func (u *User) HasRole(role string) bool {
+	return roleRanks[u.Role] >= roleRanks[role]
+}
+
+// CanManageDomain reports whether the user may change routes for domain.
+// Admins and users without domain patterns may change any. A pattern is
+// either a domain or "*." followed by a domain, which matches its
+// subdomains at any depth but not the domain itself.
+func (u *User) CanManageDomain(domain string) bool {
+	if u.Role == RoleAdmin || len(u.Domains) == 0 {
+		return true
+	}
+	domain = strings.ToLower(domain)
+	for _, pattern := range u.Domains {
+		pattern = strings.ToLower(pattern)
+		if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+			if strings.HasSuffix(domain, suffix) && len(domain) > len(suffix) {
+				return true
+			}
+		} else if domain == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// SetPassword stores a bcrypt hash of password
+func (u *User) SetPassword(password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	u.PasswordHash = string(hash)
+	return nil
+}
+
+// CheckPassword reports whether password matches the stored hash
+func (u *User) CheckPassword(password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) == nil
+}
+
+// Session is a signed-in browser session. Only the hash of the cookie
+// value is stored, see HashToken.
+type Session struct {
+	TokenHash string    `json:"token_hash"`
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// APIToken is a long-lived credential for automation, sent as a bearer
+// token. Like sessions, only the hash of the secret is stored.
+type APIToken struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Username  string    `json:"username"`
+	TokenHash string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// HashToken returns the hex SHA-256 of a session or API token secret.
+// Secrets are random, so a fast hash is enough to keep them out of storage.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditEvent records a change made through the API: who did it, what it
+// was, the state before and after, and whether it worked. RouteID is set
+// for route changes, Target names other things such as a server or user.
+type AuditEvent struct {
+	ID        int64           `json:"id"`
+	Actor     string          `json:"actor"`
+	Action    string          `json:"action"`
+	RouteID   string          `json:"route_id,omitempty"`
+	Target    string          `json:"target,omitempty"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+	Outcome   string          `json:"outcome"`
+	Message   string          `json:"message,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// Audit outcomes. A warning means the change was saved but something
+// after it, usually the sync to Caddy, failed.
+const (
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeWarning = "warning"
+	AuditOutcomeFailure = "failure"
+)
+
+// AuditFilter selects audit events. Zero fields match everything; Since
+// is inclusive and Until exclusive. A Limit of 0 returns all matches.
+type AuditFilter struct {
+	RouteID string
+	Actor   string
+	Action  string
+	Since   time.Time
+	Until   time.Time
+	Limit   int
+}
+
+// Matches reports whether an event passes the filter, ignoring Limit
+func (f *AuditFilter) Matches(e *AuditEvent) bool {
+	return (f.RouteID == "" || e.RouteID == f.RouteID) &&
+		(f.Actor == "" || e.Actor == f.Actor) &&
+		(f.Action == "" || e.Action == f.Action) &&
+		(f.Since.IsZero() || !e.CreatedAt.Before(f.Since)) &&
+		(f.Until.IsZero() || e.CreatedAt.Before(f.Until))
+}
+
 // Handler-specific config structs
 
 // ReverseProxyConfig for reverse_proxy handler
@@ -63,14 +273,173 @@ type BasicAuthConfig struct {
 	Realm   string          `json:"realm,omitempty"`
 }
 
-// BasicAuthUser represents a user for basic auth
+// BasicAuthUser represents a user for basic auth.
+// Password holds a bcrypt hash once the route has been stored.
 type BasicAuthUser struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
 }
 
+// HashPasswords replaces plaintext passwords with bcrypt hashes.
+// Passwords that are already bcrypt hashes are left untouched.
+func (b *BasicAuthConfig) HashPasswords() error {
+	if b == nil {
+		return nil
+	}
+	for i, u := range b.Users {
+		if u.Password == "" || IsBcryptHash(u.Password) {
+			continue
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return err
+		}
+		b.Users[i].Password = string(hash)
+	}
+	return nil
+}
+
+// ReuseHashes replaces plaintext passwords with the stored hash of the
+// same user in existing if the hash matches, so that a password given
+// again in plaintext doesn't count as a change
+func (b *BasicAuthConfig) ReuseHashes(existing *BasicAuthConfig) {
+	if b == nil || existing == nil {
+		return
+	}
+	hashes := make(map[string]string, len(existing.Users))
+	for _, u := range existing.Users {
+		hashes[u.Username] = u.Password
+	}
+	for i, u := range b.Users {
+		hash, ok := hashes[u.Username]
+		if !ok || u.Password == "" || IsBcryptHash(u.Password) {
+			continue
+		}
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(u.Password)) == nil {
+			b.Users[i].Password = hash
+		}
+	}
+}
+
+// IsBcryptHash reports whether s looks like a bcrypt hash
+func IsBcryptHash(s string) bool {
+	if !strings.HasPrefix(s, "$2") {
+		return false
+	}
+	_, err := bcrypt.Cost([]byte(s))
+	return err == nil
+}
+
 // GlobalConfig for settings that apply to all routes
 type GlobalConfig struct {
 	CaddyAdminURL string `json:"caddy_admin_url"`
 	EnableEncode  bool   `json:"enable_encode"`
+	// DriftPolicy controls what happens when the live Caddy config no longer
+	// matches the stored routes: "detect" (default) or "reconcile"
+	DriftPolicy string `json:"drift_policy,omitempty"`
+	// Admin configures Caddy's own admin endpoint; nil keeps the default
+	Admin *AdminSettings `json:"admin,omitempty"`
+	// Rollout makes syncs to managed instances go out in stages; nil
+	// updates all instances at once
+	Rollout *RolloutSettings `json:"rollout,omitempty"`
+}
+
+// RolloutSettings controls a staged rollout: the canary instance is updated
+// first, then the others in batches. Each stage is verified before the next
+// starts, and if one fails every instance updated so far is rolled back.
+type RolloutSettings struct {
+	// Canary is the instance updated first; empty picks the first by name
+	Canary string `json:"canary,omitempty"`
+	// BatchSize is how many instances are updated at once after the
+	// canary; 0 means one at a time
+	BatchSize int            `json:"batch_size,omitempty"`
+	Probes    []RolloutProbe `json:"probes,omitempty"`
+}
+
+// RolloutProbe is an HTTP request that must succeed against every instance
+// after it was updated. "{host}" in URL is replaced by the host of the
+// instance's admin URL, so the probe reaches that node.
+type RolloutProbe struct {
+	URL string `json:"url"`
+	// Host overrides the Host header, to hit a route on a node by address
+	Host string `json:"host,omitempty"`
+	// ExpectStatus is the required status code; 0 accepts any 2xx or 3xx
+	ExpectStatus int `json:"expect_status,omitempty"`
+}
+
+// DefaultAdminListen is the admin address used when none is configured
+const DefaultAdminListen = "0.0.0.0:2019"
+
+// AdminSettings mirrors the admin section of a Caddy config. Listen may be
+// a unix socket in Caddy's "unix//path" form.
+type AdminSettings struct {
+	Listen        string         `json:"listen,omitempty"`
+	EnforceOrigin bool           `json:"enforce_origin,omitempty"`
+	Origins       []string       `json:"origins,omitempty"`
+	Identity      *AdminIdentity `json:"identity,omitempty"`
+	Remote        *RemoteAdmin   `json:"remote,omitempty"`
+}
+
+// AdminIdentity is the identity Caddy obtains a certificate for to serve
+// the remote admin endpoint. Issuers are Caddy issuer modules, kept as-is.
+type AdminIdentity struct {
+	Identifiers []string          `json:"identifiers,omitempty"`
+	Issuers     []json.RawMessage `json:"issuers,omitempty"`
+}
+
+// RemoteAdmin enables the mTLS-secured remote admin endpoint
+type RemoteAdmin struct {
+	Listen        string              `json:"listen,omitempty"`
+	AccessControl []RemoteAdminAccess `json:"access_control,omitempty"`
+}
+
+// RemoteAdminAccess grants the clients with the given public keys the
+// listed permissions; no permissions means full access
+type RemoteAdminAccess struct {
+	PublicKeys  []string                `json:"public_keys,omitempty"`
+	Permissions []RemoteAdminPermission `json:"permissions,omitempty"`
+}
+
+// RemoteAdminPermission limits access to some paths and methods
+type RemoteAdminPermission struct {
+	Paths   []string `json:"paths,omitempty"`
+	Methods []string `json:"methods,omitempty"`
 }
+
+// Drift policies
+const (
+	DriftPolicyDetect    = "detect"
+	DriftPolicyReconcile = "reconcile"
+)
+
+// Revision is an immutable snapshot of a configuration that was
+// successfully loaded into Caddy. Instance names the managed instance it
+// was loaded into; it is empty for the default Caddy.
+type Revision struct {
+	ID         int64           `json:"id"`
+	Action     string          `json:"action"`
+	Instance   string          `json:"instance,omitempty"`
+	Config     json.RawMessage `json:"config,omitempty"`
+	Routes     []*Route        `json:"routes,omitempty"`
+	RouteCount int             `json:"route_count"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// Revision actions describe what triggered a sync
+const (
+	RevisionActionCreateRoute    = "create_route"
+	RevisionActionUpdateRoute    = "update_route"
+	RevisionActionDeleteRoute    = "delete_route"
+	RevisionActionToggleRoute    = "toggle_route"
+	RevisionActionCreateServer   = "create_server"
+	RevisionActionUpdateServer   = "update_server"
+	RevisionActionDeleteServer   = "delete_server"
+	RevisionActionCreateInstance = "create_instance"
+	RevisionActionUpdateInstance = "update_instance"
+	RevisionActionBulk           = "bulk"
+	RevisionActionSync           = "sync"
+	RevisionActionRollback       = "rollback"
+	RevisionActionReconcile      = "reconcile"
+	RevisionActionImport         = "import"
+	RevisionActionApply          = "apply"
+)
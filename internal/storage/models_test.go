@@ -0,0 +1,58 @@
+package storage
+
+import "testing"
+
+func TestUser_HasRole(t *testing.T) {
+	editor := &User{Role: RoleEditor}
+	if !editor.HasRole(RoleViewer) || !editor.HasRole(RoleEditor) || editor.HasRole(RoleAdmin) {
+		t.Errorf("Unexpected permissions for an editor")
+	}
+	if (&User{Role: "root"}).HasRole(RoleViewer) {
+		t.Error("Expected an unknown role to have no permissions")
+	}
+}
+
+func TestUser_CanManageDomain(t *testing.T) {
+	scoped := &User{Role: RoleEditor, Domains: []string{"app.example.com", "*.dev.example.com"}}
+
+	tests := []struct {
+		domain string
+		want   bool
+	}{
+		{"app.example.com", true},
+		{"APP.example.com", true},
+		{"api.dev.example.com", true},
+		{"a.b.dev.example.com", true},
+		{"dev.example.com", false},
+		{"evildev.example.com", false},
+		{"other.example.com", false},
+	}
+	for _, tt := range tests {
+		if got := scoped.CanManageDomain(tt.domain); got != tt.want {
+			t.Errorf("CanManageDomain(%q) = %v, want %v", tt.domain, got, tt.want)
+		}
+	}
+
+	if !(&User{Role: RoleEditor}).CanManageDomain("any.example.com") {
+		t.Error("Expected an unscoped editor to manage any domain")
+	}
+	if !(&User{Role: RoleAdmin, Domains: []string{"a.example.com"}}).CanManageDomain("b.example.com") {
+		t.Error("Expected admins to ignore domain patterns")
+	}
+}
+
+func TestBasicAuthConfig_ReuseHashes(t *testing.T) {
+	existing := &BasicAuthConfig{Users: []BasicAuthUser{{Username: "alice", Password: "secret"}, {Username: "bob", Password: "hunter2"}}}
+	if err := existing.HashPasswords(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	updated := &BasicAuthConfig{Users: []BasicAuthUser{{Username: "alice", Password: "secret"}, {Username: "bob", Password: "changed"}}}
+	updated.ReuseHashes(existing)
+	if updated.Users[0].Password != existing.Users[0].Password {
+		t.Error("Expected alice's unchanged password to reuse the stored hash")
+	}
+	if updated.Users[1].Password != "changed" {
+		t.Error("Expected bob's new password to be left for hashing")
+	}
+}
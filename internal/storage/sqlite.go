@@ -13,6 +13,7 @@
 
 // SQLiteStorage implements storage using SQLite
 type SQLiteStorage struct {
+	sqlRouteStore
 	db *sql.DB
 }
 
@@ -24,89 +25,104 @@ func NewSQLiteStorage(path string) (*SQLiteStorage, error) {
 		return nil, err
 	}
 
-	db, err := sql.Open("sqlite3", path)
+	// Transactions take the write lock when they begin, so one that reads
+	// before it writes waits for other writers instead of failing to
+	// upgrade its lock. WAL lets reads go on during a write, and the busy
+	// timeout is how long a writer waits for the lock.
+	db, err := sql.Open("sqlite3", path+"?_txlock=immediate&_journal_mode=WAL&_busy_timeout=5000")
 	if err != nil {
 		return nil, err
 	}
 
-	s := &SQLiteStorage{db: db}
+	s := &SQLiteStorage{sqlRouteStore: sqlRouteStore{q: db}, db: db}
 	if err := s.migrate(); err != nil {
+		db.Close()
 		return nil, err
 	}
 
 	return s, nil
 }
 
-func (s *SQLiteStorage) migrate() error {
-	_, err := s.db.Exec(`
-		CREATE TABLE IF NOT EXISTS routes (
-			id TEXT PRIMARY KEY,
-			domain TEXT NOT NULL,
-			path TEXT DEFAULT '',
-			handler_type TEXT NOT NULL,
-			config TEXT NOT NULL,
-			enabled INTEGER DEFAULT 1,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		);
+// Route CRUD operations
+
+// querier is satisfied by both *sql.DB and *sql.Tx
+type querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
 
-		CREATE TABLE IF NOT EXISTS global_config (
-			key TEXT PRIMARY KEY,
-			value TEXT NOT NULL
-		);
+// sqlRouteStore implements RouteStore on top of either the database or a
+// transaction
+type sqlRouteStore struct {
+	q querier
+}
 
-		CREATE INDEX IF NOT EXISTS idx_routes_domain ON routes(domain);
-		CREATE INDEX IF NOT EXISTS idx_routes_enabled ON routes(enabled);
-	`)
+// WithTx runs fn inside a transaction. The transaction is committed if fn
+// returns nil and rolled back otherwise, so either all of fn's writes
+// happen or none do.
+func (s *SQLiteStorage) WithTx(fn func(tx RouteStore) error) error {
+	tx, err := s.db.Begin()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	// Migration: Add raw_caddy_route column if it doesn't exist
-	// We ignore the error because it returns error if column already exists
-	_, _ = s.db.Exec(`ALTER TABLE routes ADD COLUMN raw_caddy_route TEXT`)
-
-	// Migration: Add strip_path_prefix column if it doesn't exist
-	_, _ = s.db.Exec(`ALTER TABLE routes ADD COLUMN strip_path_prefix TEXT DEFAULT ''`)
-
-	return nil
+	if err := fn(&sqlRouteStore{q: tx}); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-// Route CRUD operations
-
 // CreateRoute creates a new route
-func (s *SQLiteStorage) CreateRoute(route *Route) error {
+func (s *sqlRouteStore) CreateRoute(route *Route) error {
 	if route.ID == "" {
 		route.ID = uuid.New().String()
 	}
-	route.CreatedAt = time.Now()
+	if route.CreatedAt.IsZero() {
+		route.CreatedAt = time.Now()
+	}
 	route.UpdatedAt = time.Now()
+	if route.Version == 0 {
+		route.Version = 1
+	}
 
-	_, err := s.db.Exec(
-		`INSERT INTO routes (id, domain, path, handler_type, config, enabled, created_at, updated_at, raw_caddy_route, strip_path_prefix)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+	basicAuth, err := encodeBasicAuth(route.BasicAuth)
+	if err != nil {
+		return err
+	}
+	headers, err := encodeHeaders(route.Headers)
+	if err != nil {
+		return err
+	}
+	instances, err := encodeStrings(route.Instances)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.q.Exec(
+		`INSERT INTO routes (id, domain, path, handler_type, config, enabled, created_at, updated_at, raw_caddy_route, strip_path_prefix, basic_auth, headers, version, server, instances)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		route.ID, route.Domain, route.Path, route.HandlerType,
 		string(route.Config), boolToInt(route.Enabled), route.CreatedAt, route.UpdatedAt,
-		string(route.RawCaddyRoute), route.StripPathPrefix,
+		string(route.RawCaddyRoute), route.StripPathPrefix, basicAuth, headers, route.Version, route.Server, instances,
 	)
 	return err
 }
 
 // GetRoute retrieves a route by ID
-func (s *SQLiteStorage) GetRoute(id string) (*Route, error) {
-	row := s.db.QueryRow(
-		`SELECT id, domain, path, handler_type, config, enabled, created_at, updated_at, COALESCE(raw_caddy_route, ''), COALESCE(strip_path_prefix, '')
-		 FROM routes WHERE id = ?`, id,
-	)
-	return s.scanRoute(row)
+func (s *sqlRouteStore) GetRoute(id string) (*Route, error) {
+	row := s.q.QueryRow(`SELECT `+routeColumns+` FROM routes WHERE id = ?`, id)
+	route, err := scanRoute(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return route, err
 }
 
 // ListRoutes returns all routes
-func (s *SQLiteStorage) ListRoutes() ([]*Route, error) {
-	rows, err := s.db.Query(
-		`SELECT id, domain, path, handler_type, config, enabled, created_at, updated_at, COALESCE(raw_caddy_route, ''), COALESCE(strip_path_prefix, '')
-		 FROM routes ORDER BY domain, path`,
-	)
+func (s *sqlRouteStore) ListRoutes() ([]*Route, error) {
+	rows, err := s.q.Query(`SELECT ` + routeColumns + ` FROM routes ORDER BY domain, path`)
 	if err != nil {
 		return nil, err
 	}
@@ -114,7 +130,7 @@ func (s *SQLiteStorage) ListRoutes() ([]*Route, error) {
 
 	var routes []*Route
 	for rows.Next() {
-		route, err := s.scanRouteRows(rows)
+		route, err := scanRoute(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -124,39 +140,86 @@ func (s *SQLiteStorage) ListRoutes() ([]*Route, error) {
 }
 
 // UpdateRoute updates an existing route
-func (s *SQLiteStorage) UpdateRoute(route *Route) error {
+func (s *sqlRouteStore) UpdateRoute(route *Route) error {
 	route.UpdatedAt = time.Now()
-	_, err := s.db.Exec(
-		`UPDATE routes SET domain=?, path=?, handler_type=?, config=?, enabled=?, updated_at=?, raw_caddy_route=?, strip_path_prefix=?
-		 WHERE id=?`,
+
+	basicAuth, err := encodeBasicAuth(route.BasicAuth)
+	if err != nil {
+		return err
+	}
+	headers, err := encodeHeaders(route.Headers)
+	if err != nil {
+		return err
+	}
+	instances, err := encodeStrings(route.Instances)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.q.Exec(
+		`UPDATE routes SET domain=?, path=?, handler_type=?, config=?, enabled=?, updated_at=?, raw_caddy_route=?, strip_path_prefix=?, basic_auth=?, headers=?, server=?, instances=?, version=version+1
+		 WHERE id=? AND (?=0 OR version=?)`,
 		route.Domain, route.Path, route.HandlerType,
-		string(route.Config), boolToInt(route.Enabled), route.UpdatedAt, string(route.RawCaddyRoute), route.StripPathPrefix, route.ID,
+		string(route.Config), boolToInt(route.Enabled), route.UpdatedAt, string(route.RawCaddyRoute), route.StripPathPrefix, basicAuth, headers, route.Server, instances, route.ID,
+		route.Version, route.Version,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+
+	var version int64
+	err = s.q.QueryRow(`SELECT version FROM routes WHERE id=?`, route.ID).Scan(&version)
+	if err == sql.ErrNoRows {
+		// Nothing to update is not an error
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrVersionConflict
+	}
+	route.Version = version
+	return nil
 }
 
 // DeleteRoute deletes a route
-func (s *SQLiteStorage) DeleteRoute(id string) error {
-	_, err := s.db.Exec(`DELETE FROM routes WHERE id=?`, id)
+func (s *sqlRouteStore) DeleteRoute(id string) error {
+	_, err := s.q.Exec(`DELETE FROM routes WHERE id=?`, id)
 	return err
 }
 
 // DeleteAllRoutes deletes all routes (used for import)
-func (s *SQLiteStorage) DeleteAllRoutes() error {
-	_, err := s.db.Exec(`DELETE FROM routes`)
+func (s *sqlRouteStore) DeleteAllRoutes() error {
+	_, err := s.q.Exec(`DELETE FROM routes`)
 	return err
 }
 
-func (s *SQLiteStorage) scanRoute(row *sql.Row) (*Route, error) {
+// routeColumns is the column list expected by scanRoute
+const routeColumns = `id, domain, path, handler_type, config, enabled, created_at, updated_at,
+	COALESCE(raw_caddy_route, ''), COALESCE(strip_path_prefix, ''), COALESCE(basic_auth, ''), COALESCE(headers, ''), version, server, instances`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanRoute(row rowScanner) (*Route, error) {
 	var route Route
 	var config string
 	var enabled int
 	var rawCaddyRoute string
 	var stripPathPrefix string
+	var basicAuth string
+	var headers string
+	var instances string
 	err := row.Scan(
 		&route.ID, &route.Domain, &route.Path, &route.HandlerType,
 		&config, &enabled, &route.CreatedAt, &route.UpdatedAt,
-		&rawCaddyRoute, &stripPathPrefix,
+		&rawCaddyRoute, &stripPathPrefix, &basicAuth, &headers, &route.Version, &route.Server, &instances,
 	)
 	if err != nil {
 		return nil, err
@@ -167,45 +230,294 @@ func (s *SQLiteStorage) scanRoute(row *sql.Row) (*Route, error) {
 		route.RawCaddyRoute = json.RawMessage(rawCaddyRoute)
 	}
 	route.StripPathPrefix = stripPathPrefix
+	if basicAuth != "" {
+		route.BasicAuth = &BasicAuthConfig{}
+		if err := json.Unmarshal([]byte(basicAuth), route.BasicAuth); err != nil {
+			return nil, err
+		}
+	}
+	if headers != "" {
+		route.Headers = &HeaderConfig{}
+		if err := json.Unmarshal([]byte(headers), route.Headers); err != nil {
+			return nil, err
+		}
+	}
+	if instances != "" {
+		if err := json.Unmarshal([]byte(instances), &route.Instances); err != nil {
+			return nil, err
+		}
+	}
 	return &route, nil
 }
 
-func (s *SQLiteStorage) scanRouteRows(rows *sql.Rows) (*Route, error) {
-	var route Route
-	var config string
-	var enabled int
-	var rawCaddyRoute string
-	var stripPathPrefix string
-	err := rows.Scan(
-		&route.ID, &route.Domain, &route.Path, &route.HandlerType,
-		&config, &enabled, &route.CreatedAt, &route.UpdatedAt,
-		&rawCaddyRoute, &stripPathPrefix,
+// Servers
+
+// CreateServer stores a new server
+func (s *sqlRouteStore) CreateServer(server *Server) error {
+	protocols, automaticHTTPS, err := encodeServer(server)
+	if err != nil {
+		return err
+	}
+	listen, err := json.Marshal(server.Listen)
+	if err != nil {
+		return err
+	}
+
+	var exists int
+	err = s.q.QueryRow(`SELECT COUNT(*) FROM servers WHERE name = ?`, server.Name).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists > 0 {
+		return ErrServerExists
+	}
+
+	server.CreatedAt = time.Now()
+	server.UpdatedAt = server.CreatedAt
+	_, err = s.q.Exec(
+		`INSERT INTO servers (name, listen, protocols, automatic_https, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		server.Name, string(listen), protocols, automaticHTTPS, server.CreatedAt, server.UpdatedAt,
 	)
+	return err
+}
+
+// GetServer retrieves a server by name
+func (s *sqlRouteStore) GetServer(name string) (*Server, error) {
+	row := s.q.QueryRow(`SELECT `+serverColumns+` FROM servers WHERE name = ?`, name)
+	server, err := scanServer(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return server, err
+}
+
+// ListServers returns all servers ordered by name
+func (s *sqlRouteStore) ListServers() ([]*Server, error) {
+	rows, err := s.q.Query(`SELECT ` + serverColumns + ` FROM servers ORDER BY name`)
 	if err != nil {
 		return nil, err
 	}
-	route.Config = json.RawMessage(config)
-	route.Enabled = enabled == 1
-	if rawCaddyRoute != "" {
-		route.RawCaddyRoute = json.RawMessage(rawCaddyRoute)
+	defer rows.Close()
+
+	var servers []*Server
+	for rows.Next() {
+		server, err := scanServer(rows)
+		if err != nil {
+			return nil, err
+		}
+		servers = append(servers, server)
 	}
-	route.StripPathPrefix = stripPathPrefix
-	return &route, nil
+	return servers, rows.Err()
+}
+
+// UpdateServer updates an existing server
+func (s *sqlRouteStore) UpdateServer(server *Server) error {
+	protocols, automaticHTTPS, err := encodeServer(server)
+	if err != nil {
+		return err
+	}
+	listen, err := json.Marshal(server.Listen)
+	if err != nil {
+		return err
+	}
+
+	server.UpdatedAt = time.Now()
+	res, err := s.q.Exec(
+		`UPDATE servers SET listen=?, protocols=?, automatic_https=?, updated_at=? WHERE name=?`,
+		string(listen), protocols, automaticHTTPS, server.UpdatedAt, server.Name,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return s.q.QueryRow(`SELECT created_at FROM servers WHERE name=?`, server.Name).Scan(&server.CreatedAt)
+}
+
+// DeleteServer deletes a server. Routes referencing it are left alone.
+func (s *sqlRouteStore) DeleteServer(name string) error {
+	_, err := s.q.Exec(`DELETE FROM servers WHERE name=?`, name)
+	return err
+}
+
+// DeleteAllServers deletes all servers (used for import)
+func (s *sqlRouteStore) DeleteAllServers() error {
+	_, err := s.q.Exec(`DELETE FROM servers`)
+	return err
+}
+
+// serverColumns is the column list expected by scanServer
+const serverColumns = `name, listen, protocols, automatic_https, created_at, updated_at`
+
+func scanServer(row rowScanner) (*Server, error) {
+	var server Server
+	var listen, protocols, automaticHTTPS string
+	err := row.Scan(&server.Name, &listen, &protocols, &automaticHTTPS, &server.CreatedAt, &server.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(listen), &server.Listen); err != nil {
+		return nil, err
+	}
+	if protocols != "" {
+		if err := json.Unmarshal([]byte(protocols), &server.Protocols); err != nil {
+			return nil, err
+		}
+	}
+	if automaticHTTPS != "" {
+		server.AutomaticHTTPS = &AutomaticHTTPSConfig{}
+		if err := json.Unmarshal([]byte(automaticHTTPS), server.AutomaticHTTPS); err != nil {
+			return nil, err
+		}
+	}
+	return &server, nil
+}
+
+// encodeServer serializes the optional server settings for storage.
+// Unset values are stored as empty strings.
+func encodeServer(server *Server) (protocols, automaticHTTPS string, err error) {
+	if protocols, err = encodeStrings(server.Protocols); err != nil {
+		return "", "", err
+	}
+	if server.AutomaticHTTPS != nil {
+		data, err := json.Marshal(server.AutomaticHTTPS)
+		if err != nil {
+			return "", "", err
+		}
+		automaticHTTPS = string(data)
+	}
+	return protocols, automaticHTTPS, nil
+}
+
+// Instances
+
+// CreateInstance stores a new instance
+func (s *sqlRouteStore) CreateInstance(instance *Instance) error {
+	labels, err := encodeLabels(instance.Labels)
+	if err != nil {
+		return err
+	}
+
+	var exists int
+	err = s.q.QueryRow(`SELECT COUNT(*) FROM instances WHERE name = ?`, instance.Name).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists > 0 {
+		return ErrInstanceExists
+	}
+
+	instance.CreatedAt = time.Now()
+	instance.UpdatedAt = instance.CreatedAt
+	_, err = s.q.Exec(
+		`INSERT INTO instances (name, admin_url, labels, created_at, updated_at) VALUES (?, ?, ?, ?, ?)`,
+		instance.Name, instance.AdminURL, labels, instance.CreatedAt, instance.UpdatedAt,
+	)
+	return err
+}
+
+// GetInstance retrieves an instance by name
+func (s *sqlRouteStore) GetInstance(name string) (*Instance, error) {
+	row := s.q.QueryRow(`SELECT `+instanceColumns+` FROM instances WHERE name = ?`, name)
+	instance, err := scanInstance(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return instance, err
+}
+
+// ListInstances returns all instances ordered by name
+func (s *sqlRouteStore) ListInstances() ([]*Instance, error) {
+	rows, err := s.q.Query(`SELECT ` + instanceColumns + ` FROM instances ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var instances []*Instance
+	for rows.Next() {
+		instance, err := scanInstance(rows)
+		if err != nil {
+			return nil, err
+		}
+		instances = append(instances, instance)
+	}
+	return instances, rows.Err()
+}
+
+// UpdateInstance updates an existing instance
+func (s *sqlRouteStore) UpdateInstance(instance *Instance) error {
+	labels, err := encodeLabels(instance.Labels)
+	if err != nil {
+		return err
+	}
+
+	instance.UpdatedAt = time.Now()
+	res, err := s.q.Exec(
+		`UPDATE instances SET admin_url=?, labels=?, updated_at=? WHERE name=?`,
+		instance.AdminURL, labels, instance.UpdatedAt, instance.Name,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return s.q.QueryRow(`SELECT created_at FROM instances WHERE name=?`, instance.Name).Scan(&instance.CreatedAt)
+}
+
+// DeleteInstance deletes an instance. Routes referencing it are left alone.
+func (s *sqlRouteStore) DeleteInstance(name string) error {
+	_, err := s.q.Exec(`DELETE FROM instances WHERE name=?`, name)
+	return err
+}
+
+// instanceColumns is the column list expected by scanInstance
+const instanceColumns = `name, admin_url, labels, created_at, updated_at`
+
+func scanInstance(row rowScanner) (*Instance, error) {
+	var instance Instance
+	var labels string
+	err := row.Scan(&instance.Name, &instance.AdminURL, &labels, &instance.CreatedAt, &instance.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if labels != "" {
+		if err := json.Unmarshal([]byte(labels), &instance.Labels); err != nil {
+			return nil, err
+		}
+	}
+	return &instance, nil
+}
+
+// encodeLabels serializes instance labels for storage.
+// No labels are stored as an empty string.
+func encodeLabels(labels map[string]string) (string, error) {
+	if len(labels) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(labels)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
 }
 
 // Global config
 
 // GetGlobalConfig retrieves the global configuration
-func (s *SQLiteStorage) GetGlobalConfig() (*GlobalConfig, error) {
-	row := s.db.QueryRow(`SELECT value FROM global_config WHERE key = 'main'`)
+func (s *sqlRouteStore) GetGlobalConfig() (*GlobalConfig, error) {
+	row := s.q.QueryRow(`SELECT value FROM global_config WHERE key = 'main'`)
 	var value string
 	err := row.Scan(&value)
 	if err == sql.ErrNoRows {
 		// Return defaults
-		return &GlobalConfig{
-			CaddyAdminURL: "http://localhost:2019",
-			EnableEncode:  true,
-		}, nil
+		return defaultGlobalConfig(), nil
 	}
 	if err != nil {
 		return nil, err
@@ -219,23 +531,461 @@ func (s *SQLiteStorage) GetGlobalConfig() (*GlobalConfig, error) {
 }
 
 // SetGlobalConfig saves the global configuration
-func (s *SQLiteStorage) SetGlobalConfig(config *GlobalConfig) error {
+func (s *sqlRouteStore) SetGlobalConfig(config *GlobalConfig) error {
 	data, err := json.Marshal(config)
 	if err != nil {
 		return err
 	}
-	_, err = s.db.Exec(
+	_, err = s.q.Exec(
 		`INSERT OR REPLACE INTO global_config (key, value) VALUES ('main', ?)`,
 		string(data),
 	)
 	return err
 }
 
+// GetBaseConfig retrieves the stored base Caddy config
+func (s *sqlRouteStore) GetBaseConfig() (json.RawMessage, error) {
+	var value string
+	err := s.q.QueryRow(`SELECT value FROM global_config WHERE key = 'base_config'`).Scan(&value)
+	if err == sql.ErrNoRows || value == "" {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(value), nil
+}
+
+// SetBaseConfig saves the base Caddy config; nil clears it
+func (s *sqlRouteStore) SetBaseConfig(base json.RawMessage) error {
+	if len(base) == 0 {
+		_, err := s.q.Exec(`DELETE FROM global_config WHERE key = 'base_config'`)
+		return err
+	}
+	_, err := s.q.Exec(
+		`INSERT OR REPLACE INTO global_config (key, value) VALUES ('base_config', ?)`,
+		string(base),
+	)
+	return err
+}
+
+// Revisions
+
+// CreateRevision stores a new revision. Revisions are never updated.
+func (s *SQLiteStorage) CreateRevision(rev *Revision) error {
+	routes, err := marshalRouteSnapshot(rev.Routes)
+	if err != nil {
+		return err
+	}
+
+	rev.RouteCount = len(rev.Routes)
+	rev.CreatedAt = time.Now()
+
+	res, err := s.db.Exec(
+		`INSERT INTO revisions (action, instance, config, routes, route_count, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		rev.Action, rev.Instance, string(rev.Config), string(routes), rev.RouteCount, rev.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	rev.ID, err = res.LastInsertId()
+	return err
+}
+
+// GetRevision retrieves a revision including its config and route snapshot
+func (s *SQLiteStorage) GetRevision(id int64) (*Revision, error) {
+	var rev Revision
+	var config, routes string
+	err := s.db.QueryRow(
+		`SELECT id, action, instance, config, routes, route_count, created_at FROM revisions WHERE id = ?`, id,
+	).Scan(&rev.ID, &rev.Action, &rev.Instance, &config, &routes, &rev.RouteCount, &rev.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rev.Config = json.RawMessage(config)
+
+	rev.Routes, err = unmarshalRouteSnapshot([]byte(routes))
+	if err != nil {
+		return nil, err
+	}
+	return &rev, nil
+}
+
+// ListRevisions returns revision summaries (without config and routes),
+// newest first
+func (s *SQLiteStorage) ListRevisions(limit int) ([]*Revision, error) {
+	rows, err := s.db.Query(
+		`SELECT id, action, instance, route_count, created_at FROM revisions ORDER BY id DESC LIMIT ?`, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []*Revision
+	for rows.Next() {
+		var rev Revision
+		if err := rows.Scan(&rev.ID, &rev.Action, &rev.Instance, &rev.RouteCount, &rev.CreatedAt); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, &rev)
+	}
+	return revisions, rows.Err()
+}
+
+// Users
+
+// CreateUser stores a new user
+func (s *SQLiteStorage) CreateUser(user *User) error {
+	var exists int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM users WHERE username = ?`, user.Username).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists > 0 {
+		return ErrUserExists
+	}
+
+	domains, err := encodeStrings(user.Domains)
+	if err != nil {
+		return err
+	}
+
+	user.CreatedAt = time.Now()
+	user.UpdatedAt = user.CreatedAt
+	_, err = s.db.Exec(
+		`INSERT INTO users (username, password_hash, role, domains, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		user.Username, user.PasswordHash, user.Role, domains, user.CreatedAt, user.UpdatedAt,
+	)
+	return err
+}
+
+// GetUser retrieves a user by username
+func (s *SQLiteStorage) GetUser(username string) (*User, error) {
+	row := s.db.QueryRow(`SELECT `+userColumns+` FROM users WHERE username = ?`, username)
+	user, err := scanUser(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return user, err
+}
+
+// ListUsers returns all users ordered by username
+func (s *SQLiteStorage) ListUsers() ([]*User, error) {
+	rows, err := s.db.Query(`SELECT ` + userColumns + ` FROM users ORDER BY username`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// CountUsers returns the number of users
+func (s *SQLiteStorage) CountUsers() (int, error) {
+	var n int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM users`).Scan(&n)
+	return n, err
+}
+
+// UpdateUser updates an existing user
+func (s *SQLiteStorage) UpdateUser(user *User) error {
+	domains, err := encodeStrings(user.Domains)
+	if err != nil {
+		return err
+	}
+
+	user.UpdatedAt = time.Now()
+	res, err := s.db.Exec(
+		`UPDATE users SET password_hash=?, role=?, domains=?, updated_at=? WHERE username=?`,
+		user.PasswordHash, user.Role, domains, user.UpdatedAt, user.Username,
+	)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return s.db.QueryRow(`SELECT created_at FROM users WHERE username=?`, user.Username).Scan(&user.CreatedAt)
+}
+
+// DeleteUser deletes a user along with their sessions and API tokens
+func (s *SQLiteStorage) DeleteUser(username string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"sessions", "api_tokens", "users"} {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE username=?`, username); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// userColumns is the column list expected by scanUser
+const userColumns = `username, password_hash, role, domains, created_at, updated_at`
+
+func scanUser(row rowScanner) (*User, error) {
+	var user User
+	var domains string
+	err := row.Scan(&user.Username, &user.PasswordHash, &user.Role, &domains, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if domains != "" {
+		if err := json.Unmarshal([]byte(domains), &user.Domains); err != nil {
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
+// Sessions and API tokens
+
+// CreateSession stores a new session and drops expired ones
+func (s *SQLiteStorage) CreateSession(session *Session) error {
+	session.CreatedAt = time.Now()
+	if _, err := s.db.Exec(`DELETE FROM sessions WHERE expires_at < ?`, session.CreatedAt); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(
+		`INSERT INTO sessions (token_hash, username, created_at, expires_at) VALUES (?, ?, ?, ?)`,
+		session.TokenHash, session.Username, session.CreatedAt, session.ExpiresAt,
+	)
+	return err
+}
+
+// GetSession retrieves a session by the hash of its token. Expired
+// sessions are returned too; it's up to the caller to check ExpiresAt.
+func (s *SQLiteStorage) GetSession(tokenHash string) (*Session, error) {
+	var session Session
+	err := s.db.QueryRow(
+		`SELECT token_hash, username, created_at, expires_at FROM sessions WHERE token_hash = ?`, tokenHash,
+	).Scan(&session.TokenHash, &session.Username, &session.CreatedAt, &session.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// DeleteSession deletes a session
+func (s *SQLiteStorage) DeleteSession(tokenHash string) error {
+	_, err := s.db.Exec(`DELETE FROM sessions WHERE token_hash=?`, tokenHash)
+	return err
+}
+
+// DeleteUserSessions deletes a user's sessions other than keep
+func (s *SQLiteStorage) DeleteUserSessions(username, keep string) error {
+	_, err := s.db.Exec(`DELETE FROM sessions WHERE username=? AND token_hash<>?`, username, keep)
+	return err
+}
+
+// CreateAPIToken stores a new API token
+func (s *SQLiteStorage) CreateAPIToken(token *APIToken) error {
+	if token.ID == "" {
+		token.ID = uuid.New().String()
+	}
+	token.CreatedAt = time.Now()
+	_, err := s.db.Exec(
+		`INSERT INTO api_tokens (id, name, username, token_hash, created_at) VALUES (?, ?, ?, ?, ?)`,
+		token.ID, token.Name, token.Username, token.TokenHash, token.CreatedAt,
+	)
+	return err
+}
+
+// GetAPIToken retrieves an API token by the hash of its secret
+func (s *SQLiteStorage) GetAPIToken(tokenHash string) (*APIToken, error) {
+	row := s.db.QueryRow(`SELECT `+apiTokenColumns+` FROM api_tokens WHERE token_hash = ?`, tokenHash)
+	token, err := scanAPIToken(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return token, err
+}
+
+// ListAPITokens returns the API tokens of a user, or all tokens if
+// username is empty, oldest first
+func (s *SQLiteStorage) ListAPITokens(username string) ([]*APIToken, error) {
+	rows, err := s.db.Query(
+		`SELECT `+apiTokenColumns+` FROM api_tokens WHERE ? = '' OR username = ? ORDER BY created_at, id`,
+		username, username,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []*APIToken
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+// DeleteAPIToken deletes an API token
+func (s *SQLiteStorage) DeleteAPIToken(id string) error {
+	_, err := s.db.Exec(`DELETE FROM api_tokens WHERE id=?`, id)
+	return err
+}
+
+// apiTokenColumns is the column list expected by scanAPIToken
+const apiTokenColumns = `id, name, username, token_hash, created_at`
+
+func scanAPIToken(row rowScanner) (*APIToken, error) {
+	var token APIToken
+	err := row.Scan(&token.ID, &token.Name, &token.Username, &token.TokenHash, &token.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// Audit events
+
+// CreateAuditEvent stores a new audit event
+func (s *SQLiteStorage) CreateAuditEvent(event *AuditEvent) error {
+	// Timestamps are stored in UTC so time filters compare correctly
+	event.CreatedAt = time.Now().UTC()
+	res, err := s.db.Exec(
+		`INSERT INTO audit_events (actor, action, route_id, target, before, after, outcome, message, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		event.Actor, event.Action, event.RouteID, event.Target, string(event.Before), string(event.After),
+		event.Outcome, event.Message, event.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	event.ID, err = res.LastInsertId()
+	return err
+}
+
+// ListAuditEvents returns the events matching filter, newest first
+func (s *SQLiteStorage) ListAuditEvents(filter AuditFilter) ([]*AuditEvent, error) {
+	query := `SELECT id, actor, action, route_id, target, before, after, outcome, message, created_at FROM audit_events WHERE 1=1`
+	var args []any
+	for _, cond := range []struct {
+		clause string
+		value  string
+	}{
+		{` AND route_id = ?`, filter.RouteID},
+		{` AND actor = ?`, filter.Actor},
+		{` AND action = ?`, filter.Action},
+	} {
+		if cond.value != "" {
+			query += cond.clause
+			args = append(args, cond.value)
+		}
+	}
+	if !filter.Since.IsZero() {
+		query += ` AND created_at >= ?`
+		args = append(args, filter.Since.UTC())
+	}
+	if !filter.Until.IsZero() {
+		query += ` AND created_at < ?`
+		args = append(args, filter.Until.UTC())
+	}
+	query += ` ORDER BY id DESC`
+	if filter.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*AuditEvent
+	for rows.Next() {
+		var e AuditEvent
+		var before, after string
+		err := rows.Scan(&e.ID, &e.Actor, &e.Action, &e.RouteID, &e.Target, &before, &after, &e.Outcome, &e.Message, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if before != "" {
+			e.Before = json.RawMessage(before)
+		}
+		if after != "" {
+			e.After = json.RawMessage(after)
+		}
+		events = append(events, &e)
+	}
+	return events, rows.Err()
+}
+
 // Close closes the database connection
 func (s *SQLiteStorage) Close() error {
 	return s.db.Close()
 }
 
+// encodeBasicAuth hashes any plaintext passwords and serializes the config
+// for storage. A nil config is stored as an empty string.
+func encodeBasicAuth(cfg *BasicAuthConfig) (string, error) {
+	if cfg == nil {
+		return "", nil
+	}
+	if err := cfg.HashPasswords(); err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// encodeHeaders serializes the header config for storage.
+// A nil config is stored as an empty string.
+func encodeHeaders(cfg *HeaderConfig) (string, error) {
+	if cfg == nil {
+		return "", nil
+	}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// encodeStrings serializes a string list for storage.
+// An empty list is stored as an empty string.
+func encodeStrings(list []string) (string, error) {
+	if len(list) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(list)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
 func boolToInt(b bool) int {
 	if b {
 		return 1
@@ -1,10 +1,15 @@
 package storage
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 )
 
 // setupTestDB creates a temporary SQLite database for testing
@@ -67,6 +72,14 @@ func TestCreateRoute(t *testing.T) {
 	if route.UpdatedAt.IsZero() {
 		t.Error("Expected UpdatedAt to be set")
 	}
+
+	// A restored route keeps its creation time
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	restored := &Route{Domain: "old.example.com", HandlerType: "reverse_proxy", Config: json.RawMessage(`{}`), CreatedAt: created}
+	storage.CreateRoute(restored)
+	if got, _ := storage.GetRoute(restored.ID); !got.CreatedAt.Equal(created) {
+		t.Errorf("Expected CreatedAt %v to be kept, got %v", created, got.CreatedAt)
+	}
 }
 
 func TestGetRoute(t *testing.T) {
@@ -192,6 +205,388 @@ func TestUpdateRoute(t *testing.T) {
 	}
 }
 
+func TestUpdateRoute_Version(t *testing.T) {
+	storage, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	testRouteVersions(t, storage)
+}
+
+// testRouteVersions checks the optimistic locking contract of UpdateRoute
+func testRouteVersions(t *testing.T, rs RouteStore) {
+	t.Helper()
+
+	route := &Route{Domain: "example.com", HandlerType: "reverse_proxy", Config: json.RawMessage(`{}`)}
+	rs.CreateRoute(route)
+	if route.Version != 1 {
+		t.Fatalf("Expected new route at version 1, got %d", route.Version)
+	}
+
+	// Two editors load version 1
+	first, _ := rs.GetRoute(route.ID)
+	second, _ := rs.GetRoute(route.ID)
+
+	first.Path = "/first"
+	if err := rs.UpdateRoute(first); err != nil {
+		t.Fatalf("Failed to update route: %v", err)
+	}
+	if first.Version != 2 {
+		t.Errorf("Expected version 2 after update, got %d", first.Version)
+	}
+
+	second.Path = "/second"
+	if err := rs.UpdateRoute(second); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("Expected ErrVersionConflict, got %v", err)
+	}
+	if stored, _ := rs.GetRoute(route.ID); stored.Path != "/first" || stored.Version != 2 {
+		t.Errorf("Expected conflicting update to be rejected, got %+v", stored)
+	}
+
+	// Version 0 skips the check but still bumps the version
+	second.Version = 0
+	if err := rs.UpdateRoute(second); err != nil {
+		t.Fatalf("Failed unconditional update: %v", err)
+	}
+	if second.Version != 3 {
+		t.Errorf("Expected version 3 after unconditional update, got %d", second.Version)
+	}
+}
+
+func TestBaseConfig(t *testing.T) {
+	storage, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	testBaseConfig(t, storage)
+}
+
+// testBaseConfig checks storing and clearing the base Caddy config
+func testBaseConfig(t *testing.T, rs RouteStore) {
+	t.Helper()
+
+	if base, err := rs.GetBaseConfig(); err != nil || base != nil {
+		t.Fatalf("Expected no base config initially, got %s / %v", base, err)
+	}
+
+	want := `{"apps":{"tls":{}},"logging":{}}`
+	if err := rs.SetBaseConfig(json.RawMessage(want)); err != nil {
+		t.Fatalf("Failed to set base config: %v", err)
+	}
+	if base, _ := rs.GetBaseConfig(); string(base) != want {
+		t.Errorf("Expected %s, got %s", want, base)
+	}
+
+	// The base config must not disturb the global config stored next to it
+	if cfg, _ := rs.GetGlobalConfig(); cfg.CaddyAdminURL == "" {
+		t.Error("Expected default global config")
+	}
+
+	rs.SetBaseConfig(nil)
+	if base, _ := rs.GetBaseConfig(); base != nil {
+		t.Errorf("Expected base config to be cleared, got %s", base)
+	}
+}
+
+func TestServers(t *testing.T) {
+	storage, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	testServers(t, storage)
+}
+
+// testServers checks server CRUD and the server reference on routes
+func testServers(t *testing.T, rs RouteStore) {
+	t.Helper()
+
+	server := &Server{
+		Name:           "public",
+		Listen:         []string{":443"},
+		Protocols:      []string{"h1", "h2", "h3"},
+		AutomaticHTTPS: &AutomaticHTTPSConfig{DisableRedirects: true, Skip: []string{"internal.example.com"}},
+	}
+	if err := rs.CreateServer(server); err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	if err := rs.CreateServer(&Server{Name: "public", Listen: []string{":8443"}}); !errors.Is(err, ErrServerExists) {
+		t.Errorf("Expected ErrServerExists, got %v", err)
+	}
+	rs.CreateServer(&Server{Name: "internal", Listen: []string{":8080"}})
+
+	got, err := rs.GetServer("public")
+	if err != nil {
+		t.Fatalf("Failed to get server: %v", err)
+	}
+	if len(got.Protocols) != 3 || got.AutomaticHTTPS == nil || !got.AutomaticHTTPS.DisableRedirects || got.AutomaticHTTPS.Skip[0] != "internal.example.com" {
+		t.Errorf("Server did not round-trip: %+v", got)
+	}
+
+	got.Listen = []string{":443", ":80"}
+	got.AutomaticHTTPS = nil
+	if err := rs.UpdateServer(got); err != nil {
+		t.Fatalf("Failed to update server: %v", err)
+	}
+	got, _ = rs.GetServer("public")
+	if len(got.Listen) != 2 || got.AutomaticHTTPS != nil || got.CreatedAt.IsZero() {
+		t.Errorf("Unexpected updated server: %+v", got)
+	}
+	if err := rs.UpdateServer(&Server{Name: "missing"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	servers, _ := rs.ListServers()
+	if len(servers) != 2 || servers[0].Name != "internal" {
+		t.Errorf("Expected 2 servers sorted by name, got %+v", servers)
+	}
+
+	route := &Route{Domain: "example.com", HandlerType: "reverse_proxy", Config: json.RawMessage(`{}`), Server: "public"}
+	rs.CreateRoute(route)
+	stored, _ := rs.GetRoute(route.ID)
+	if stored.Server != "public" {
+		t.Errorf("Expected route server to be stored, got %q", stored.Server)
+	}
+
+	rs.DeleteServer("internal")
+	if _, err := rs.GetServer("internal"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after delete, got %v", err)
+	}
+	rs.DeleteAllServers()
+	if servers, _ := rs.ListServers(); len(servers) != 0 {
+		t.Errorf("Expected no servers, got %d", len(servers))
+	}
+}
+
+func TestInstances(t *testing.T) {
+	storage, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	testInstances(t, storage)
+}
+
+// testInstances checks instance CRUD and the instance list on routes
+func testInstances(t *testing.T, rs RouteStore) {
+	t.Helper()
+
+	edge := &Instance{Name: "edge-1", AdminURL: "http://10.0.0.1:2019", Labels: map[string]string{"region": "eu"}}
+	if err := rs.CreateInstance(edge); err != nil {
+		t.Fatalf("Failed to create instance: %v", err)
+	}
+	if err := rs.CreateInstance(&Instance{Name: "edge-1", AdminURL: "http://10.0.0.9:2019"}); !errors.Is(err, ErrInstanceExists) {
+		t.Errorf("Expected ErrInstanceExists, got %v", err)
+	}
+	rs.CreateInstance(&Instance{Name: "edge-0", AdminURL: "unix//run/caddy/admin.sock"})
+
+	got, err := rs.GetInstance("edge-1")
+	if err != nil {
+		t.Fatalf("Failed to get instance: %v", err)
+	}
+	if got.AdminURL != "http://10.0.0.1:2019" || got.Labels["region"] != "eu" {
+		t.Errorf("Instance did not round-trip: %+v", got)
+	}
+
+	got.AdminURL = "http://10.0.0.2:2019"
+	got.Labels = nil
+	if err := rs.UpdateInstance(got); err != nil {
+		t.Fatalf("Failed to update instance: %v", err)
+	}
+	got, _ = rs.GetInstance("edge-1")
+	if got.AdminURL != "http://10.0.0.2:2019" || got.Labels != nil || got.CreatedAt.IsZero() {
+		t.Errorf("Unexpected updated instance: %+v", got)
+	}
+	if err := rs.UpdateInstance(&Instance{Name: "missing"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	instances, _ := rs.ListInstances()
+	if len(instances) != 2 || instances[0].Name != "edge-0" {
+		t.Errorf("Expected 2 instances sorted by name, got %+v", instances)
+	}
+
+	route := &Route{Domain: "example.com", HandlerType: "reverse_proxy", Config: json.RawMessage(`{}`), Instances: []string{"edge-0", "edge-1"}}
+	rs.CreateRoute(route)
+	stored, _ := rs.GetRoute(route.ID)
+	if len(stored.Instances) != 2 || !stored.DeployedTo("edge-1") || stored.DeployedTo("edge-2") {
+		t.Errorf("Expected route instances to be stored, got %v", stored.Instances)
+	}
+
+	rs.DeleteInstance("edge-0")
+	if _, err := rs.GetInstance("edge-0"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after delete, got %v", err)
+	}
+}
+
+func TestUsers(t *testing.T) {
+	storage, cleanup := setupTestDB(t)
+	defer cleanup()
+	testUsers(t, storage)
+}
+
+// testUsers checks users, sessions and API tokens, including that deleting
+// a user removes their credentials
+func testUsers(t *testing.T, s Store) {
+	t.Helper()
+
+	alice := &User{Username: "alice", Role: RoleEditor, Domains: []string{"*.example.com"}}
+	if err := alice.SetPassword("correct horse"); err != nil {
+		t.Fatalf("Failed to set password: %v", err)
+	}
+	if err := s.CreateUser(alice); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if err := s.CreateUser(&User{Username: "alice"}); !errors.Is(err, ErrUserExists) {
+		t.Errorf("Expected ErrUserExists, got %v", err)
+	}
+	s.CreateUser(&User{Username: "bob", PasswordHash: alice.PasswordHash})
+
+	got, err := s.GetUser("alice")
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	if !got.CheckPassword("correct horse") || got.CheckPassword("wrong") {
+		t.Error("Expected stored password hash to verify")
+	}
+	if got.Role != RoleEditor || len(got.Domains) != 1 || got.Domains[0] != "*.example.com" {
+		t.Errorf("Expected role and domains to round-trip, got %+v", got)
+	}
+	got.Role, got.Domains = RoleAdmin, nil
+	got.SetPassword("battery staple")
+	if err := s.UpdateUser(got); err != nil {
+		t.Fatalf("Failed to update user: %v", err)
+	}
+	if got, _ := s.GetUser("alice"); !got.CheckPassword("battery staple") || got.Role != RoleAdmin || got.Domains != nil || got.CreatedAt.IsZero() {
+		t.Errorf("Expected updated password, got %+v", got)
+	}
+	if err := s.UpdateUser(&User{Username: "missing"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if users, _ := s.ListUsers(); len(users) != 2 || users[0].Username != "alice" {
+		t.Errorf("Expected 2 users sorted by name, got %+v", users)
+	}
+
+	expired := &Session{TokenHash: HashToken("old"), Username: "alice", ExpiresAt: time.Now().Add(-time.Minute)}
+	s.CreateSession(expired)
+	session := &Session{TokenHash: HashToken("cookie"), Username: "alice", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := s.CreateSession(session); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if _, err := s.GetSession(HashToken("old")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected expired session to be dropped, got %v", err)
+	}
+	if got, err := s.GetSession(HashToken("cookie")); err != nil || got.Username != "alice" {
+		t.Errorf("Expected session for alice, got %+v / %v", got, err)
+	}
+	s.DeleteSession(HashToken("cookie"))
+	if _, err := s.GetSession(HashToken("cookie")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after logout, got %v", err)
+	}
+
+	for _, secret := range []string{"laptop", "phone"} {
+		s.CreateSession(&Session{TokenHash: HashToken(secret), Username: "alice", ExpiresAt: time.Now().Add(time.Hour)})
+	}
+	s.CreateSession(&Session{TokenHash: HashToken("bobs"), Username: "bob", ExpiresAt: time.Now().Add(time.Hour)})
+	if err := s.DeleteUserSessions("alice", HashToken("laptop")); err != nil {
+		t.Fatalf("Failed to delete sessions: %v", err)
+	}
+	if _, err := s.GetSession(HashToken("phone")); !errors.Is(err, ErrNotFound) {
+		t.Error("Expected alice's other session to be deleted")
+	}
+	for _, secret := range []string{"laptop", "bobs"} {
+		if _, err := s.GetSession(HashToken(secret)); err != nil {
+			t.Errorf("Expected session %s to be kept, got %v", secret, err)
+		}
+	}
+
+	token := &APIToken{Name: "ci", Username: "alice", TokenHash: HashToken("secret")}
+	if err := s.CreateAPIToken(token); err != nil {
+		t.Fatalf("Failed to create API token: %v", err)
+	}
+	s.CreateAPIToken(&APIToken{Name: "deploy", Username: "bob", TokenHash: HashToken("other")})
+	if got, err := s.GetAPIToken(HashToken("secret")); err != nil || got.ID != token.ID || got.Name != "ci" {
+		t.Errorf("Expected token by hash, got %+v / %v", got, err)
+	}
+	if tokens, _ := s.ListAPITokens("alice"); len(tokens) != 1 {
+		t.Errorf("Expected 1 token for alice, got %d", len(tokens))
+	}
+	if tokens, _ := s.ListAPITokens(""); len(tokens) != 2 {
+		t.Errorf("Expected 2 tokens in total, got %d", len(tokens))
+	}
+
+	s.CreateSession(&Session{TokenHash: HashToken("cookie2"), Username: "alice", ExpiresAt: time.Now().Add(time.Hour)})
+	if err := s.DeleteUser("alice"); err != nil {
+		t.Fatalf("Failed to delete user: %v", err)
+	}
+	if _, err := s.GetSession(HashToken("cookie2")); !errors.Is(err, ErrNotFound) {
+		t.Error("Expected the user's sessions to be deleted with them")
+	}
+	if _, err := s.GetAPIToken(HashToken("secret")); !errors.Is(err, ErrNotFound) {
+		t.Error("Expected the user's tokens to be deleted with them")
+	}
+	if n, _ := s.CountUsers(); n != 1 {
+		t.Errorf("Expected 1 user left, got %d", n)
+	}
+
+	tokens, _ := s.ListAPITokens("bob")
+	s.DeleteAPIToken(tokens[0].ID)
+	if tokens, _ := s.ListAPITokens(""); len(tokens) != 0 {
+		t.Errorf("Expected no tokens left, got %d", len(tokens))
+	}
+}
+
+func TestAuditEvents(t *testing.T) {
+	storage, cleanup := setupTestDB(t)
+	defer cleanup()
+	testAuditEvents(t, storage)
+}
+
+// testAuditEvents checks that audit events keep their change and filter
+// by route, actor, action and time
+func testAuditEvents(t *testing.T, s Store) {
+	t.Helper()
+
+	first := &AuditEvent{Actor: "alice", Action: "create_route", RouteID: "r1", After: json.RawMessage(`{"domain":"a.com"}`), Outcome: AuditOutcomeSuccess}
+	if err := s.CreateAuditEvent(first); err != nil {
+		t.Fatalf("Failed to create audit event: %v", err)
+	}
+	if first.ID == 0 || first.CreatedAt.IsZero() {
+		t.Errorf("Expected ID and timestamp to be set, got %+v", first)
+	}
+	time.Sleep(10 * time.Millisecond)
+	middle := time.Now()
+	s.CreateAuditEvent(&AuditEvent{Actor: "bob", Action: "update_route", RouteID: "r1", Before: json.RawMessage(`{"domain":"a.com"}`), Outcome: AuditOutcomeWarning, Message: "sync failed"})
+	s.CreateAuditEvent(&AuditEvent{Actor: "alice", Action: "update_config", Outcome: AuditOutcomeFailure})
+
+	all, err := s.ListAuditEvents(AuditFilter{})
+	if err != nil {
+		t.Fatalf("Failed to list audit events: %v", err)
+	}
+	if len(all) != 3 || all[0].Action != "update_config" || all[2].ID != first.ID {
+		t.Fatalf("Expected 3 events newest first, got %+v", all)
+	}
+	if string(all[2].After) != `{"domain":"a.com"}` || all[2].Before != nil {
+		t.Errorf("Expected before and after to round-trip, got %s / %s", all[2].Before, all[2].After)
+	}
+	if all[1].Outcome != AuditOutcomeWarning || all[1].Message != "sync failed" {
+		t.Errorf("Expected outcome and message to round-trip, got %+v", all[1])
+	}
+
+	tests := []struct {
+		name   string
+		filter AuditFilter
+		want   int
+	}{
+		{"route", AuditFilter{RouteID: "r1"}, 2},
+		{"actor", AuditFilter{Actor: "alice"}, 2},
+		{"action", AuditFilter{Action: "update_route"}, 1},
+		{"since", AuditFilter{Since: middle}, 2},
+		{"until", AuditFilter{Until: middle}, 1},
+		{"combined", AuditFilter{RouteID: "r1", Actor: "alice"}, 1},
+		{"limit", AuditFilter{Limit: 1}, 1},
+	}
+	for _, tt := range tests {
+		if got, _ := s.ListAuditEvents(tt.filter); len(got) != tt.want {
+			t.Errorf("%s: expected %d events, got %d", tt.name, tt.want, len(got))
+		}
+	}
+}
+
 func TestDeleteRoute(t *testing.T) {
 	storage, cleanup := setupTestDB(t)
 	defer cleanup()
@@ -321,8 +716,8 @@ func TestRouteWithHeaders(t *testing.T) {
 	storage, cleanup := setupTestDB(t)
 	defer cleanup()
 
-	// Note: Headers are stored in the JSON config, not as a separate field in SQLite
-	// This test verifies the struct works correctly with the Config field
+	// Note: Upstream request headers live in the JSON config, while response
+	// headers have their own column (see TestRouteWithResponseHeaders)
 	config := ReverseProxyConfig{
 		Upstreams: []string{"localhost:8080"},
 		Headers:   map[string]string{"X-Custom": "value"},
@@ -349,3 +744,406 @@ func TestRouteWithHeaders(t *testing.T) {
 		t.Errorf("Expected header X-Custom=value, got %s", retrievedConfig.Headers["X-Custom"])
 	}
 }
+
+func TestRouteWithBasicAuth(t *testing.T) {
+	storage, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	route := &Route{
+		Domain:      "example.com",
+		HandlerType: "reverse_proxy",
+		Config:      json.RawMessage(`{"upstreams":["localhost:8080"]}`),
+		BasicAuth: &BasicAuthConfig{
+			Enabled: true,
+			Realm:   "restricted",
+			Users:   []BasicAuthUser{{Username: "admin", Password: "secret"}},
+		},
+	}
+
+	if err := storage.CreateRoute(route); err != nil {
+		t.Fatalf("Failed to create route: %v", err)
+	}
+
+	retrieved, err := storage.GetRoute(route.ID)
+	if err != nil {
+		t.Fatalf("Failed to get route: %v", err)
+	}
+
+	if retrieved.BasicAuth == nil {
+		t.Fatal("Expected basic auth to be persisted")
+	}
+	if retrieved.BasicAuth.Realm != "restricted" {
+		t.Errorf("Expected realm restricted, got %s", retrieved.BasicAuth.Realm)
+	}
+	if len(retrieved.BasicAuth.Users) != 1 {
+		t.Fatalf("Expected 1 user, got %d", len(retrieved.BasicAuth.Users))
+	}
+
+	hash := retrieved.BasicAuth.Users[0].Password
+	if hash == "secret" || !IsBcryptHash(hash) {
+		t.Errorf("Expected password to be stored as bcrypt hash, got %s", hash)
+	}
+
+	// Saving again must not re-hash an existing hash
+	if err := storage.UpdateRoute(retrieved); err != nil {
+		t.Fatalf("Failed to update route: %v", err)
+	}
+	updated, _ := storage.GetRoute(route.ID)
+	if updated.BasicAuth.Users[0].Password != hash {
+		t.Error("Expected existing hash to be preserved on update")
+	}
+}
+
+func TestRouteWithoutBasicAuth(t *testing.T) {
+	storage, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	route := &Route{
+		Domain:      "example.com",
+		HandlerType: "reverse_proxy",
+		Config:      json.RawMessage(`{}`),
+	}
+	storage.CreateRoute(route)
+
+	retrieved, _ := storage.GetRoute(route.ID)
+	if retrieved.BasicAuth != nil {
+		t.Errorf("Expected nil basic auth, got %+v", retrieved.BasicAuth)
+	}
+}
+
+func TestRouteWithResponseHeaders(t *testing.T) {
+	storage, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	route := &Route{
+		Domain:      "example.com",
+		HandlerType: "reverse_proxy",
+		Config:      json.RawMessage(`{"upstreams":["localhost:8080"]}`),
+		Headers: &HeaderConfig{
+			Set:    map[string]string{"X-Frame-Options": "DENY"},
+			Add:    map[string]string{"X-Custom": "value"},
+			Delete: []string{"Server"},
+		},
+	}
+
+	if err := storage.CreateRoute(route); err != nil {
+		t.Fatalf("Failed to create route: %v", err)
+	}
+
+	retrieved, err := storage.GetRoute(route.ID)
+	if err != nil {
+		t.Fatalf("Failed to get route: %v", err)
+	}
+	if retrieved.Headers == nil {
+		t.Fatal("Expected headers to be persisted")
+	}
+	if retrieved.Headers.Set["X-Frame-Options"] != "DENY" {
+		t.Errorf("Expected Set X-Frame-Options=DENY, got %v", retrieved.Headers.Set)
+	}
+	if retrieved.Headers.Add["X-Custom"] != "value" {
+		t.Errorf("Expected Add X-Custom=value, got %v", retrieved.Headers.Add)
+	}
+	if len(retrieved.Headers.Delete) != 1 || retrieved.Headers.Delete[0] != "Server" {
+		t.Errorf("Expected Delete [Server], got %v", retrieved.Headers.Delete)
+	}
+
+	t.Run("update", func(t *testing.T) {
+		retrieved.Headers = &HeaderConfig{Set: map[string]string{"X-Frame-Options": "SAMEORIGIN"}}
+		if err := storage.UpdateRoute(retrieved); err != nil {
+			t.Fatalf("Failed to update route: %v", err)
+		}
+
+		routes, _ := storage.ListRoutes()
+		if routes[0].Headers == nil || routes[0].Headers.Set["X-Frame-Options"] != "SAMEORIGIN" {
+			t.Errorf("Expected updated headers, got %+v", routes[0].Headers)
+		}
+		if len(routes[0].Headers.Delete) != 0 {
+			t.Errorf("Expected Delete to be cleared, got %v", routes[0].Headers.Delete)
+		}
+	})
+
+	t.Run("clear", func(t *testing.T) {
+		retrieved.Headers = nil
+		storage.UpdateRoute(retrieved)
+
+		cleared, _ := storage.GetRoute(route.ID)
+		if cleared.Headers != nil {
+			t.Errorf("Expected headers to be cleared, got %+v", cleared.Headers)
+		}
+	})
+}
+
+func TestMigrate_AddsHeadersToExistingDatabase(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "legacy.db")
+
+	// Create a database with the original schema and one route
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	_, err = db.Exec(`
+		CREATE TABLE routes (
+			id TEXT PRIMARY KEY,
+			domain TEXT NOT NULL,
+			path TEXT DEFAULT '',
+			handler_type TEXT NOT NULL,
+			config TEXT NOT NULL,
+			enabled INTEGER DEFAULT 1,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		INSERT INTO routes (id, domain, handler_type, config) VALUES ('legacy', 'example.com', 'reverse_proxy', '{}');
+	`)
+	db.Close()
+	if err != nil {
+		t.Fatalf("Failed to create legacy schema: %v", err)
+	}
+
+	storage, err := NewSQLiteStorage(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open legacy database: %v", err)
+	}
+	defer storage.Close()
+
+	route, err := storage.GetRoute("legacy")
+	if err != nil {
+		t.Fatalf("Failed to read legacy route: %v", err)
+	}
+	if route.Headers != nil {
+		t.Errorf("Expected no headers on legacy route, got %+v", route.Headers)
+	}
+
+	route.Headers = &HeaderConfig{Delete: []string{"Server"}}
+	if err := storage.UpdateRoute(route); err != nil {
+		t.Fatalf("Failed to update legacy route: %v", err)
+	}
+
+	updated, _ := storage.GetRoute("legacy")
+	if updated.Headers == nil || len(updated.Headers.Delete) != 1 {
+		t.Errorf("Expected headers to be stored after migration, got %+v", updated.Headers)
+	}
+}
+
+func TestRevisions(t *testing.T) {
+	storage, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	route := &Route{
+		ID:            "route-1",
+		Domain:        "example.com",
+		HandlerType:   "reverse_proxy",
+		Config:        json.RawMessage(`{"upstreams":["localhost:8080"]}`),
+		Enabled:       true,
+		RawCaddyRoute: json.RawMessage(`{"handle":[{"handler":"custom"}]}`),
+	}
+
+	for _, action := range []string{RevisionActionSync, RevisionActionCreateRoute} {
+		rev := &Revision{
+			Action: action,
+			Config: json.RawMessage(`{"admin":{"listen":"0.0.0.0:2019"}}`),
+			Routes: []*Route{route},
+		}
+		if err := storage.CreateRevision(rev); err != nil {
+			t.Fatalf("Failed to create revision: %v", err)
+		}
+		if rev.ID == 0 {
+			t.Error("Expected revision ID to be set")
+		}
+	}
+
+	t.Run("list newest first", func(t *testing.T) {
+		revisions, err := storage.ListRevisions(10)
+		if err != nil {
+			t.Fatalf("Failed to list revisions: %v", err)
+		}
+		if len(revisions) != 2 {
+			t.Fatalf("Expected 2 revisions, got %d", len(revisions))
+		}
+		if revisions[0].Action != RevisionActionCreateRoute {
+			t.Errorf("Expected newest revision first, got %s", revisions[0].Action)
+		}
+		if revisions[0].RouteCount != 1 || revisions[0].Routes != nil {
+			t.Errorf("Expected summary with route count only, got %+v", revisions[0])
+		}
+	})
+
+	t.Run("list limit", func(t *testing.T) {
+		revisions, _ := storage.ListRevisions(1)
+		if len(revisions) != 1 {
+			t.Errorf("Expected 1 revision, got %d", len(revisions))
+		}
+	})
+
+	t.Run("list all", func(t *testing.T) {
+		revisions, _ := storage.ListRevisions(-1)
+		if len(revisions) != 2 {
+			t.Errorf("Expected all 2 revisions for a negative limit, got %d", len(revisions))
+		}
+	})
+
+	t.Run("get with snapshot", func(t *testing.T) {
+		revisions, _ := storage.ListRevisions(1)
+		rev, err := storage.GetRevision(revisions[0].ID)
+		if err != nil {
+			t.Fatalf("Failed to get revision: %v", err)
+		}
+		if len(rev.Routes) != 1 || rev.Routes[0].ID != "route-1" {
+			t.Fatalf("Expected route snapshot, got %+v", rev.Routes)
+		}
+		if string(rev.Routes[0].RawCaddyRoute) != string(route.RawCaddyRoute) {
+			t.Errorf("Expected RawCaddyRoute in snapshot, got %s", rev.Routes[0].RawCaddyRoute)
+		}
+	})
+
+	t.Run("get missing", func(t *testing.T) {
+		if _, err := storage.GetRevision(999); err != ErrNotFound {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+	})
+}
+
+func TestApplyImport(t *testing.T) {
+	storage, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	existing := &Route{ID: "existing", Domain: "a.com", HandlerType: "reverse_proxy", Config: json.RawMessage(`{}`), Enabled: true}
+	stale := &Route{ID: "stale", Domain: "stale.com", HandlerType: "reverse_proxy", Config: json.RawMessage(`{}`), Enabled: true}
+	storage.CreateRoute(existing)
+	storage.CreateRoute(stale)
+
+	plan := &ImportPlan{
+		Create: []*Route{
+			{Domain: "b.com", HandlerType: "file_server", Config: json.RawMessage(`{}`), Enabled: true},
+			{Domain: "", HandlerType: "file_server", Config: json.RawMessage(`{}`)},
+		},
+		Update: []*Route{
+			{ID: "existing", Domain: "a.com", HandlerType: "redir", Config: json.RawMessage(`{"to":"/x"}`), Enabled: true},
+		},
+		Delete: []*Route{stale},
+	}
+
+	var result *ImportResult
+	err := storage.WithTx(func(tx RouteStore) error {
+		result = ApplyImport(tx, plan)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to apply import: %v", err)
+	}
+
+	if result.Created != 1 || result.Updated != 1 || result.Deleted != 1 || result.Failed != 1 {
+		t.Errorf("Unexpected counts: %+v", result)
+	}
+
+	var failure *ImportDetail
+	for i := range result.Details {
+		if result.Details[i].Action == ImportActionFailed {
+			failure = &result.Details[i]
+		}
+	}
+	if failure == nil || failure.Reason != "domain is required" {
+		t.Errorf("Expected failure reason to be reported, got %+v", failure)
+	}
+
+	routes, _ := storage.ListRoutes()
+	if len(routes) != 2 {
+		t.Fatalf("Expected 2 routes after import, got %d", len(routes))
+	}
+	updated, _ := storage.GetRoute("existing")
+	if updated.HandlerType != "redir" {
+		t.Errorf("Expected existing route to be updated, got %s", updated.HandlerType)
+	}
+}
+
+func TestWithTx_Commit(t *testing.T) {
+	storage, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	err := storage.WithTx(func(tx RouteStore) error {
+		if err := tx.CreateRoute(&Route{ID: "r1", Domain: "a.com", HandlerType: "reverse_proxy", Config: json.RawMessage(`{}`)}); err != nil {
+			return err
+		}
+		// Reads inside the transaction see its own writes
+		if _, err := tx.GetRoute("r1"); err != nil {
+			return err
+		}
+		return tx.SetGlobalConfig(&GlobalConfig{CaddyAdminURL: "http://tx:2019"})
+	})
+	if err != nil {
+		t.Fatalf("Transaction failed: %v", err)
+	}
+
+	if _, err := storage.GetRoute("r1"); err != nil {
+		t.Error("Expected route to be committed")
+	}
+	cfg, _ := storage.GetGlobalConfig()
+	if cfg.CaddyAdminURL != "http://tx:2019" {
+		t.Errorf("Expected global config to be committed, got %s", cfg.CaddyAdminURL)
+	}
+}
+
+func TestWithTx_Rollback(t *testing.T) {
+	storage, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	storage.CreateRoute(&Route{ID: "keep", Domain: "a.com", HandlerType: "reverse_proxy", Config: json.RawMessage(`{}`)})
+
+	errBoom := errors.New("boom")
+	err := storage.WithTx(func(tx RouteStore) error {
+		if err := tx.DeleteAllRoutes(); err != nil {
+			return err
+		}
+		if err := tx.CreateRoute(&Route{ID: "new", Domain: "b.com", HandlerType: "reverse_proxy", Config: json.RawMessage(`{}`)}); err != nil {
+			return err
+		}
+		return errBoom
+	})
+	if err != errBoom {
+		t.Fatalf("Expected callback error to be returned, got %v", err)
+	}
+
+	routes, _ := storage.ListRoutes()
+	if len(routes) != 1 || routes[0].ID != "keep" {
+		t.Errorf("Expected transaction to be rolled back, got %+v", routes)
+	}
+}
+
+func TestWithTx_ConcurrentWriters(t *testing.T) {
+	storage, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	// Transactions that read before they write, racing each other and
+	// plain writes, must wait for the lock rather than fail
+	const writers = 8
+	errs := make(chan error, 2*writers)
+	var wg sync.WaitGroup
+	for i := range writers {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			errs <- storage.WithTx(func(tx RouteStore) error {
+				if _, err := tx.ListRoutes(); err != nil {
+					return err
+				}
+				time.Sleep(5 * time.Millisecond)
+				return tx.CreateRoute(&Route{Domain: fmt.Sprintf("r%d.example.com", i), HandlerType: "reverse_proxy", Config: json.RawMessage(`{}`)})
+			})
+		}()
+		go func() {
+			defer wg.Done()
+			errs <- storage.CreateAuditEvent(&AuditEvent{Actor: "test", Action: "create_route", Outcome: "success"})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Expected concurrent writes to succeed, got %v", err)
+		}
+	}
+	if routes, _ := storage.ListRoutes(); len(routes) != writers {
+		t.Errorf("Expected %d routes, got %d", writers, len(routes))
+	}
+}
@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// RouteStore is the set of route and global config operations. It is
+// implemented by every Store and by the transaction-scoped store passed to
+// WithTx callbacks.
+//
+// CreateRoute keeps a route's CreatedAt if it is set, so a route restored
+// from a revision keeps its original one.
+//
+// Routes carry a version that starts at 1 and is incremented by every
+// UpdateRoute. An update with a non-zero Version only succeeds if it matches
+// the stored version and returns ErrVersionConflict otherwise; Version 0
+// updates unconditionally. Either way route.Version is set to the new value.
+type RouteStore interface {
+	CreateRoute(route *Route) error
+	GetRoute(id string) (*Route, error)
+	ListRoutes() ([]*Route, error)
+	UpdateRoute(route *Route) error
+	DeleteRoute(id string) error
+	DeleteAllRoutes() error
+
+	// Servers are keyed by name; CreateServer fails if the name is taken
+	// and UpdateServer returns ErrNotFound for an unknown one
+	CreateServer(server *Server) error
+	GetServer(name string) (*Server, error)
+	ListServers() ([]*Server, error)
+	UpdateServer(server *Server) error
+	DeleteServer(name string) error
+	DeleteAllServers() error
+
+	// Instances are keyed by name like servers
+	CreateInstance(instance *Instance) error
+	GetInstance(name string) (*Instance, error)
+	ListInstances() ([]*Instance, error)
+	UpdateInstance(instance *Instance) error
+	DeleteInstance(name string) error
+
+	GetGlobalConfig() (*GlobalConfig, error)
+	SetGlobalConfig(config *GlobalConfig) error
+
+	// The base config is the part of Caddy's config that routes don't
+	// cover (other apps, logging, storage, server options). It is nil
+	// until one has been imported or set.
+	GetBaseConfig() (json.RawMessage, error)
+	SetBaseConfig(base json.RawMessage) error
+}
+
+// Store is a storage backend. SQLiteStorage is the default; JSONStorage is
+// a pure-Go alternative that also works fully in memory.
+type Store interface {
+	RouteStore
+
+	// WithTx runs fn atomically: its writes are kept only if it returns nil.
+	// fn must use tx rather than the Store itself.
+	WithTx(fn func(tx RouteStore) error) error
+
+	// ListRevisions returns the newest limit revisions, or all of them if
+	// limit is negative. The JSON backend keeps only the newest ones.
+	CreateRevision(rev *Revision) error
+	GetRevision(id int64) (*Revision, error)
+	ListRevisions(limit int) ([]*Revision, error)
+
+	// Users are keyed by username. DeleteUser also removes the user's
+	// sessions and API tokens.
+	CreateUser(user *User) error
+	GetUser(username string) (*User, error)
+	ListUsers() ([]*User, error)
+	CountUsers() (int, error)
+	UpdateUser(user *User) error
+	DeleteUser(username string) error
+
+	// Sessions and API tokens are looked up by the hash of their secret.
+	// CreateSession also drops expired sessions. DeleteUserSessions signs a
+	// user out everywhere except the session with the hash keep.
+	// ListAPITokens returns the tokens of a user, or all of them for an
+	// empty username.
+	CreateSession(session *Session) error
+	GetSession(tokenHash string) (*Session, error)
+	DeleteSession(tokenHash string) error
+	DeleteUserSessions(username, keep string) error
+	CreateAPIToken(token *APIToken) error
+	GetAPIToken(tokenHash string) (*APIToken, error)
+	ListAPITokens(username string) ([]*APIToken, error)
+	DeleteAPIToken(id string) error
+
+	// Audit events are never updated, and the JSON backend keeps only the
+	// newest ones. ListAuditEvents returns matches newest first.
+	CreateAuditEvent(event *AuditEvent) error
+	ListAuditEvents(filter AuditFilter) ([]*AuditEvent, error)
+
+	Close() error
+}
+
+// Storage backends
+const (
+	BackendSQLite = "sqlite"
+	BackendJSON   = "json"
+)
+
+// Open creates the storage backend with the given name
+func Open(backend, path string) (Store, error) {
+	switch backend {
+	case "", BackendSQLite:
+		return NewSQLiteStorage(path)
+	case BackendJSON:
+		return NewJSONStorage(path)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", backend)
+	}
+}
+
+// defaultGlobalConfig is returned when no global config has been saved yet
+func defaultGlobalConfig() *GlobalConfig {
+	return &GlobalConfig{
+		CaddyAdminURL: "http://localhost:2019",
+		EnableEncode:  true,
+	}
+}
+
+// snapshotRoute includes RawCaddyRoute, which Route hides from JSON,
+// so serialized routes can be restored exactly
+type snapshotRoute struct {
+	*Route
+	RawCaddyRoute json.RawMessage `json:"raw_caddy_route,omitempty"`
+}
+
+func marshalRouteSnapshot(routes []*Route) ([]byte, error) {
+	snapshot := make([]snapshotRoute, 0, len(routes))
+	for _, r := range routes {
+		snapshot = append(snapshot, snapshotRoute{Route: r, RawCaddyRoute: r.RawCaddyRoute})
+	}
+	return json.Marshal(snapshot)
+}
+
+func unmarshalRouteSnapshot(data []byte) ([]*Route, error) {
+	var snapshot []snapshotRoute
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, err
+	}
+	routes := make([]*Route, 0, len(snapshot))
+	for _, sr := range snapshot {
+		if sr.Route == nil {
+			continue
+		}
+		sr.Route.RawCaddyRoute = sr.RawCaddyRoute
+		routes = append(routes, sr.Route)
+	}
+	return routes, nil
+}
@@ -30,6 +30,11 @@ export function Layout({ children }: LayoutProps) {
     }
   }
 
+  async function signOut() {
+    await api.logout();
+    window.location.href = '/';
+  }
+
   const status = checking && !statusData ? 'loading' : (statusData?.status || 'offline');
 
   return (
@@ -54,6 +59,7 @@ export function Layout({ children }: LayoutProps) {
             <nav class="flex gap-4">
               <a href="/" class="text-slate-300 hover:text-white">Dashboard</a>
               <a href="/settings" class="text-slate-300 hover:text-white">Settings</a>
+              <button type="button" onClick={signOut} class="text-slate-300 hover:text-white">Sign out</button>
             </nav>
           </div>
         </div>
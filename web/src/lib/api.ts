@@ -8,6 +8,17 @@ export interface HeaderConfig {
   delete?: string[];
 }
 
+export interface BasicAuthUser {
+  username: string;
+  password: string;
+}
+
+export interface BasicAuthConfig {
+  enabled: boolean;
+  users: BasicAuthUser[];
+  realm?: string;
+}
+
 export interface Route {
   id: string;
   domain: string;
@@ -16,26 +27,168 @@ export interface Route {
   handler_type: string;
   config: any;
   headers?: HeaderConfig;
+  basic_auth?: BasicAuthConfig;
+  server?: string;
+  instances?: string[];
   enabled: boolean;
+  version: number;
   created_at: string;
   updated_at: string;
 }
 
+export interface AutomaticHTTPSConfig {
+  disable?: boolean;
+  disable_redirects?: boolean;
+  disable_certificates?: boolean;
+  skip?: string[];
+  skip_certificates?: string[];
+  ignore_loaded_certificates?: boolean;
+}
+
+export interface Server {
+  name: string;
+  listen: string[];
+  protocols?: string[];
+  automatic_https?: AutomaticHTTPSConfig;
+  created_at?: string;
+  updated_at?: string;
+}
+
+export interface Instance {
+  name: string;
+  admin_url: string;
+  labels?: Record<string, string>;
+  created_at?: string;
+  updated_at?: string;
+}
+
+export interface InstanceStatus {
+  name: string;
+  admin_url: string;
+  labels?: Record<string, string>;
+  status: 'online' | 'offline';
+  error?: string;
+  latency: number;
+  route_count: number;
+  last_synced_at?: string;
+  last_sync_error?: string;
+  last_sync_mode?: 'incremental' | 'load';
+}
+
+export interface InstanceSyncResult {
+  instance: string;
+  mode?: 'incremental' | 'load';
+  stage?: number;
+  error?: string;
+  conflict?: boolean;
+  rolled_back?: boolean;
+  skipped?: boolean;
+}
+
+export interface AdminSettings {
+  listen?: string;
+  enforce_origin?: boolean;
+  origins?: string[];
+  identity?: { identifiers?: string[]; issuers?: any[] };
+  remote?: {
+    listen?: string;
+    access_control?: { public_keys?: string[]; permissions?: { paths?: string[]; methods?: string[] }[] }[];
+  };
+}
+
+export interface RolloutSettings {
+  canary?: string;
+  batch_size?: number;
+  probes?: { url: string; host?: string; expect_status?: number }[];
+}
+
 export interface GlobalConfig {
   caddy_admin_url: string;
   enable_encode: boolean;
+  admin?: AdminSettings;
+  rollout?: RolloutSettings;
+}
+
+export type Role = 'viewer' | 'editor' | 'admin';
+
+export interface User {
+  username: string;
+  role: Role;
+  domains?: string[];
+  created_at: string;
+  updated_at: string;
+}
+
+export interface APIToken {
+  id: string;
+  name: string;
+  username: string;
+  created_at: string;
+}
+
+export interface CaddyfileIssue {
+  line: number;
+  message: string;
+}
+
+export interface ManifestPlanEntry {
+  action: 'create' | 'update' | 'delete' | 'unchanged';
+  route_id?: string;
+  domain?: string;
+  path?: string;
+  name?: string;
+  fields?: string[];
+}
+
+export interface ManifestApplyResult {
+  plan: {
+    routes: ManifestPlanEntry[];
+    servers?: ManifestPlanEntry[];
+    global?: 'update' | 'unchanged';
+  };
+  summary: Record<'create' | 'update' | 'delete' | 'unchanged', number>;
+  applied: boolean;
+  message?: string;
+  warning?: string;
+}
+
+export interface AuditEvent {
+  id: number;
+  actor: string;
+  action: string;
+  route_id?: string;
+  target?: string;
+  before?: unknown;
+  after?: unknown;
+  outcome: 'success' | 'warning' | 'failure';
+  message?: string;
+  created_at: string;
+}
+
+export interface AuditQuery {
+  route?: string;
+  actor?: string;
+  action?: string;
+  since?: string;
+  until?: string;
+  limit?: number;
 }
 
 export interface StatusResponse {
-  status: 'online' | 'offline';
+  status: 'online' | 'offline' | 'degraded';
   latency?: number;
   error?: string;
   admin_url?: string;
   route_count?: number;
   last_synced_at?: string;
   last_sync_error?: string;
+  last_sync_mode?: 'incremental' | 'load';
+  instances?: InstanceStatus[];
 }
 
+// Dispatched on window when the session is missing or has expired
+export const AUTH_REQUIRED_EVENT = 'auth-required';
+
 class ApiClient {
   private async request<T>(path: string, options?: RequestInit): Promise<T> {
     const res = await fetch(`${API_BASE}${path}`, {
@@ -48,6 +201,9 @@ class ApiClient {
 
     const data = await res.json();
 
+    if (res.status === 401 && path !== '/auth/login') {
+      window.dispatchEvent(new Event(AUTH_REQUIRED_EVENT));
+    }
     if (!res.ok) {
       throw new Error(data.error || `HTTP ${res.status}`);
     }
@@ -55,6 +211,60 @@ class ApiClient {
     return data;
   }
 
+  // Authentication
+  async login(username: string, password: string): Promise<{ user: User; expires_at: string }> {
+    return this.request('/auth/login', {
+      method: 'POST',
+      body: JSON.stringify({ username, password }),
+    });
+  }
+
+  async logout(): Promise<{ message: string }> {
+    return this.request('/auth/logout', { method: 'POST' });
+  }
+
+  async me(): Promise<{ user: User | null; auth_required: boolean }> {
+    return this.request('/auth/me');
+  }
+
+  // Users and API tokens
+  async listUsers(): Promise<{ users: User[] }> {
+    return this.request('/users');
+  }
+
+  async createUser(user: { username: string; password: string; role?: Role; domains?: string[] }): Promise<{ user: User }> {
+    return this.request('/users', {
+      method: 'POST',
+      body: JSON.stringify(user),
+    });
+  }
+
+  async updateUser(username: string, changes: { password?: string; current_password?: string; role?: Role; domains?: string[] }): Promise<{ user: User }> {
+    return this.request(`/users/${username}`, {
+      method: 'PUT',
+      body: JSON.stringify(changes),
+    });
+  }
+
+  async deleteUser(username: string): Promise<{ message: string }> {
+    return this.request(`/users/${username}`, { method: 'DELETE' });
+  }
+
+  async listTokens(): Promise<{ tokens: APIToken[] }> {
+    return this.request('/tokens');
+  }
+
+  async createToken(name: string): Promise<{ token: APIToken; secret: string }> {
+    return this.request('/tokens', {
+      method: 'POST',
+      body: JSON.stringify({ name }),
+    });
+  }
+
+  async deleteToken(id: string): Promise<{ message: string }> {
+    return this.request(`/tokens/${id}`, { method: 'DELETE' });
+  }
+
   // Routes
   async listRoutes(): Promise<{ routes: Route[] }> {
     return this.request('/routes');
@@ -91,13 +301,62 @@ class ApiClient {
     return res;
   }
 
-  async toggleRoute(id: string): Promise<{ route: Route; warning?: string }> {
-    const res = await this.request<{ route: Route; warning?: string }>(`/routes/${id}/toggle`, { method: 'POST' });
+  async toggleRoute(id: string, version: number): Promise<{ route: Route; warning?: string }> {
+    const res = await this.request<{ route: Route; warning?: string }>(`/routes/${id}/toggle`, {
+      method: 'POST',
+      body: JSON.stringify({ version }),
+    });
     if (res.warning) notifySyncResult('error', res.warning);
     else notifySyncResult('success', `Route ${res.route.enabled ? 'enabled' : 'disabled'} and synced`);
     return res;
   }
 
+  // Servers
+  async listServers(): Promise<{ servers: Server[] }> {
+    return this.request('/servers');
+  }
+
+  async createServer(server: Server): Promise<{ server: Server; warning?: string }> {
+    return this.request('/servers', {
+      method: 'POST',
+      body: JSON.stringify(server),
+    });
+  }
+
+  async updateServer(name: string, server: Server): Promise<{ server: Server; warning?: string }> {
+    return this.request(`/servers/${name}`, {
+      method: 'PUT',
+      body: JSON.stringify(server),
+    });
+  }
+
+  async deleteServer(name: string): Promise<{ message: string }> {
+    return this.request(`/servers/${name}`, { method: 'DELETE' });
+  }
+
+  // Instances
+  async listInstances(): Promise<{ instances: Instance[] }> {
+    return this.request('/instances');
+  }
+
+  async createInstance(instance: Instance): Promise<{ instance: Instance; warning?: string }> {
+    return this.request('/instances', {
+      method: 'POST',
+      body: JSON.stringify(instance),
+    });
+  }
+
+  async updateInstance(name: string, instance: Instance): Promise<{ instance: Instance; warning?: string }> {
+    return this.request(`/instances/${name}`, {
+      method: 'PUT',
+      body: JSON.stringify(instance),
+    });
+  }
+
+  async deleteInstance(name: string): Promise<{ message: string }> {
+    return this.request(`/instances/${name}`, { method: 'DELETE' });
+  }
+
   // Config
   async getConfig(): Promise<{ config: GlobalConfig }> {
     return this.request('/config');
@@ -115,7 +374,7 @@ class ApiClient {
     return this.request('/status');
   }
 
-  async sync(): Promise<{ message: string }> {
+  async sync(): Promise<{ message: string; results?: InstanceSyncResult[] }> {
     return this.request('/sync', { method: 'POST' });
   }
 
@@ -133,6 +392,65 @@ class ApiClient {
   async importFromCaddy(): Promise<{ imported: number; message: string }> {
     return this.request('/import', { method: 'POST' });
   }
+
+  async previewCaddyfile(caddyfile: string): Promise<{ routes: Route[]; count: number; unsupported: CaddyfileIssue[] }> {
+    return this.request('/import-preview/caddyfile', {
+      method: 'POST',
+      headers: { 'Content-Type': 'text/caddyfile' },
+      body: caddyfile,
+    });
+  }
+
+  async importCaddyfile(caddyfile: string): Promise<{ imported: number; message: string; unsupported: CaddyfileIssue[]; warning?: string }> {
+    return this.request('/import/caddyfile', {
+      method: 'POST',
+      headers: { 'Content-Type': 'text/caddyfile' },
+      body: caddyfile,
+    });
+  }
+
+  async exportCaddyfile(instance?: string): Promise<string> {
+    const qs = instance ? `?instance=${encodeURIComponent(instance)}` : '';
+    const res = await fetch(`${API_BASE}/export/caddyfile${qs}`);
+    if (res.status === 401) {
+      window.dispatchEvent(new Event(AUTH_REQUIRED_EVENT));
+    }
+    if (!res.ok) {
+      const data = await res.json();
+      throw new Error(data.error || `HTTP ${res.status}`);
+    }
+    return res.text();
+  }
+
+  async exportManifest(format: 'yaml' | 'json' = 'yaml'): Promise<string> {
+    const res = await fetch(`${API_BASE}/export/manifest?format=${format}`);
+    if (res.status === 401) {
+      window.dispatchEvent(new Event(AUTH_REQUIRED_EVENT));
+    }
+    if (!res.ok) {
+      const data = await res.json();
+      throw new Error(data.error || `HTTP ${res.status}`);
+    }
+    return res.text();
+  }
+
+  async applyManifest(manifest: string, confirm = false): Promise<ManifestApplyResult> {
+    return this.request(`/apply${confirm ? '?confirm=true' : ''}`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/yaml' },
+      body: manifest,
+    });
+  }
+
+  // Audit log
+  async listAuditEvents(query: AuditQuery = {}): Promise<{ events: AuditEvent[] }> {
+    const params = new URLSearchParams();
+    for (const [key, value] of Object.entries(query)) {
+      if (value !== undefined && value !== '') params.set(key, String(value));
+    }
+    const qs = params.toString();
+    return this.request(`/audit${qs ? `?${qs}` : ''}`);
+  }
 }
 
 export const api = new ApiClient();
@@ -1,14 +1,33 @@
 import { render } from 'preact';
+import { useState, useEffect } from 'preact/hooks';
 import Router, { Route } from 'preact-router';
 import './index.css';
 
+import { api, AUTH_REQUIRED_EVENT } from './lib/api';
 import { Layout } from './components/Layout';
 import { Dashboard } from './pages/Dashboard';
 import { RouteForm } from './pages/RouteForm';
 import { Settings } from './pages/Settings';
 import { NotFound } from './pages/NotFound';
+import { Login } from './pages/Login';
 
 function App() {
+  const [signedIn, setSignedIn] = useState<boolean | null>(null);
+
+  useEffect(() => {
+    const onAuthRequired = () => setSignedIn(false);
+    window.addEventListener(AUTH_REQUIRED_EVENT, onAuthRequired);
+    api.me().then(() => setSignedIn(true)).catch(() => setSignedIn(false));
+    return () => window.removeEventListener(AUTH_REQUIRED_EVENT, onAuthRequired);
+  }, []);
+
+  if (signedIn === null) {
+    return null;
+  }
+  if (!signedIn) {
+    return <Login onLogin={() => setSignedIn(true)} />;
+  }
+
   return (
     <Layout>
       <Router>
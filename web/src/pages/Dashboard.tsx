@@ -128,7 +128,8 @@ export function Dashboard() {
 
   async function handleToggle(id: string) {
     try {
-      const { route } = await api.toggleRoute(id);
+      const current = routes.find((r) => r.id === id);
+      const { route } = await api.toggleRoute(id, current?.version ?? 0);
       setRoutes(routes.map((r) => (r.id === id ? route : r)));
     } catch (err: any) {
       setError(err.message);
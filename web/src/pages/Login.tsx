@@ -0,0 +1,70 @@
+import { useState } from 'preact/hooks';
+import { api } from '../lib/api';
+
+interface LoginProps {
+  onLogin: () => void;
+}
+
+export function Login({ onLogin }: LoginProps) {
+  const [username, setUsername] = useState('');
+  const [password, setPassword] = useState('');
+  const [error, setError] = useState<string | null>(null);
+  const [submitting, setSubmitting] = useState(false);
+
+  async function handleSubmit(e: Event) {
+    e.preventDefault();
+    setSubmitting(true);
+    setError(null);
+
+    try {
+      await api.login(username, password);
+      onLogin();
+    } catch (err: any) {
+      setError(err.message);
+    } finally {
+      setSubmitting(false);
+    }
+  }
+
+  return (
+    <div class="min-h-screen flex items-center justify-center px-4">
+      <form onSubmit={handleSubmit} class="card w-full max-w-sm space-y-4">
+        <h1 class="text-xl font-bold">Sign in to Caddy Lite</h1>
+
+        {error && (
+          <div class="bg-red-900/50 border border-red-700 rounded-lg p-3 text-sm text-red-300">
+            {error}
+          </div>
+        )}
+
+        <div>
+          <label class="label">Username</label>
+          <input
+            type="text"
+            value={username}
+            onInput={(e) => setUsername((e.target as HTMLInputElement).value)}
+            class="input"
+            autocomplete="username"
+            required
+          />
+        </div>
+
+        <div>
+          <label class="label">Password</label>
+          <input
+            type="password"
+            value={password}
+            onInput={(e) => setPassword((e.target as HTMLInputElement).value)}
+            class="input"
+            autocomplete="current-password"
+            required
+          />
+        </div>
+
+        <button type="submit" class="btn btn-primary w-full" disabled={submitting}>
+          {submitting ? 'Signing in...' : 'Sign in'}
+        </button>
+      </form>
+    </div>
+  );
+}
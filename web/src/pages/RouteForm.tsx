@@ -1,6 +1,6 @@
 import { useState, useEffect } from 'preact/hooks';
 import { route as navigate } from 'preact-router';
-import { api } from '../lib/api';
+import { api, Server } from '../lib/api';
 import { HeaderEditor, getDefaultHeaderConfig } from '../components/forms/HeaderEditor';
 
 interface RouteFormProps {
@@ -26,6 +26,9 @@ export function RouteForm({ id }: RouteFormProps) {
   const [config, setConfig] = useState<any>({ upstreams: [], websocket: false, headers: {}, load_balancing: 'round_robin' });
   const [headers, setHeaders] = useState(getDefaultHeaderConfig());
   const [showHeaders, setShowHeaders] = useState(false);
+  const [version, setVersion] = useState(0);
+  const [server, setServer] = useState('');
+  const [servers, setServers] = useState<Server[]>([]);
 
   useEffect(() => {
     if (isEdit) {
@@ -33,12 +36,18 @@ export function RouteForm({ id }: RouteFormProps) {
     }
   }, [id]);
 
+  useEffect(() => {
+    api.listServers().then(({ servers }) => setServers(servers)).catch(() => setServers([]));
+  }, []);
+
   async function loadRoute() {
     try {
       const { route } = await api.getRoute(id!);
+      setVersion(route.version);
       setDomain(route.domain);
       setPath(route.path || '');
       setStripPathPrefix(route.strip_path_prefix || '');
+      setServer(route.server || '');
       setHandlerType(route.handler_type);
       setConfig(typeof route.config === 'string' ? JSON.parse(route.config) : route.config);
       if (route.headers) {
@@ -61,13 +70,14 @@ export function RouteForm({ id }: RouteFormProps) {
         domain,
         path: path || undefined,
         strip_path_prefix: stripPathPrefix || undefined,
+        server: server || undefined,
         handler_type: handlerType,
         config,
         headers,
       };
 
       if (isEdit) {
-        await api.updateRoute(id!, routeData);
+        await api.updateRoute(id!, { ...routeData, version });
       } else {
         await api.createRoute(routeData);
       }
@@ -152,6 +162,25 @@ export function RouteForm({ id }: RouteFormProps) {
             </div>
           </div>
 
+          {/* Server - only show when there is a choice */}
+          {servers.length > 1 && (
+            <div class="mt-4">
+              <label class="label">Server</label>
+              <select
+                value={server}
+                onChange={(e) => setServer((e.target as HTMLSelectElement).value)}
+                class="input"
+              >
+                <option value="">Default (srv0)</option>
+                {servers.map((s) => (
+                  <option key={s.name} value={s.name}>
+                    {s.name} ({s.listen.join(', ')})
+                  </option>
+                ))}
+              </select>
+            </div>
+          )}
+
           {/* Strip Path Prefix - only show when path is set */}
           {path && (
             <div class="mt-4">